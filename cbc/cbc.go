@@ -0,0 +1,582 @@
+// Package cbc reads and writes compiled cardboard programs (.cbc files).
+//
+// A file is laid out as follows, integers being unsigned varints unless
+// noted otherwise, and strings a length followed by their bytes:
+//
+//	magic      "CBC\x00"
+//	version    2 bytes, big endian
+//	source     path of the script the program was compiled from
+//	globals    count, then the identifier of every global slot
+//	constants  count, then every constant, prefixed with its tag
+//	main       function prototype of the top level statements
+//	checksum   4 bytes, big endian CRC-32 of everything before it
+//
+// A function prototype holds its instructions, the number of locals and
+// parameters, the names of its locals and parameters, its body source,
+// its line table and the kind, depth and index of the binding every local
+// falls back to.
+package cbc
+
+import (
+	"bytes"
+	"cardboard/code"
+	"cardboard/compiler"
+	"cardboard/object"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// Version of the format written by Write. Files of any other version are rejected.
+const Version = 2
+
+// Extension of compiled cardboard files
+const Extension = ".cbc"
+
+var magic = []byte("CBC\x00")
+
+// Constant tags
+const (
+	tagInteger  byte = 1
+	tagString   byte = 2
+	tagFunction byte = 3
+)
+
+// File is a compiled program along with the script it was compiled from
+type File struct {
+	Source   string
+	Bytecode *compiler.Bytecode
+}
+
+// FormatError reports a file that isn't a valid compiled program
+type FormatError struct {
+	Reason string
+}
+
+func (e *FormatError) Error() string {
+	return "Invalid " + Extension + " file: " + e.Reason
+}
+
+func formatError(format string, a ...interface{}) *FormatError {
+	return &FormatError{Reason: fmt.Sprintf(format, a...)}
+}
+
+// Write encodes f to w.
+func Write(w io.Writer, f *File) error {
+	e := &encoder{}
+	e.buf.Write(magic)
+	e.buf.Write([]byte{byte(Version >> 8), byte(Version)})
+
+	e.string(f.Source)
+
+	e.uint(len(f.Bytecode.Globals))
+	for _, name := range f.Bytecode.Globals {
+		e.string(name)
+	}
+
+	e.uint(len(f.Bytecode.Constants))
+	for _, constant := range f.Bytecode.Constants {
+		if err := e.constant(constant); err != nil {
+			return err
+		}
+	}
+
+	e.function(f.Bytecode.Main)
+
+	checksum := make([]byte, 4)
+	binary.BigEndian.PutUint32(checksum, crc32.ChecksumIEEE(e.buf.Bytes()))
+	e.buf.Write(checksum)
+
+	_, err := w.Write(e.buf.Bytes())
+	return err
+}
+
+// Read decodes a file written by Write. Files that are truncated, corrupted,
+// of another version or holding invalid instructions return a *FormatError.
+func Read(r io.Reader) (*File, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < len(magic) || !bytes.Equal(data[:len(magic)], magic) {
+		return nil, formatError("not a compiled cardboard program")
+	}
+	if len(data) < len(magic)+2+4 {
+		return nil, formatError("unexpected end of file")
+	}
+
+	version := int(binary.BigEndian.Uint16(data[len(magic):]))
+	if version != Version {
+		return nil, formatError("unsupported version %d, expected version %d", version, Version)
+	}
+
+	body, checksum := data[:len(data)-4], data[len(data)-4:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(checksum) {
+		return nil, formatError("checksum mismatch, the file is corrupted")
+	}
+
+	d := &decoder{data: body, pos: len(magic) + 2}
+	f := &File{Bytecode: &compiler.Bytecode{}}
+
+	f.Source = d.string()
+
+	globals := d.count()
+	for i := 0; i < globals && d.err == nil; i++ {
+		f.Bytecode.Globals = append(f.Bytecode.Globals, d.string())
+	}
+
+	constants := d.count()
+	f.Bytecode.Constants = []object.Object{}
+	for i := 0; i < constants && d.err == nil; i++ {
+		f.Bytecode.Constants = append(f.Bytecode.Constants, d.constant())
+	}
+
+	f.Bytecode.Main = d.function()
+
+	if d.err == nil && d.pos != len(d.data) {
+		d.fail("%d unexpected bytes after the program", len(d.data)-d.pos)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	if err := verify(f.Bytecode); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) uint(n int) {
+	var tmp [binary.MaxVarintLen64]byte
+	e.buf.Write(tmp[:binary.PutUvarint(tmp[:], uint64(n))])
+}
+
+func (e *encoder) int(n int64) {
+	var tmp [binary.MaxVarintLen64]byte
+	e.buf.Write(tmp[:binary.PutVarint(tmp[:], n)])
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uint(len(b))
+	e.buf.Write(b)
+}
+
+func (e *encoder) string(s string) { e.bytes([]byte(s)) }
+
+func (e *encoder) strings(s []string) {
+	e.uint(len(s))
+	for _, str := range s {
+		e.string(str)
+	}
+}
+
+func (e *encoder) constant(obj object.Object) error {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		e.buf.WriteByte(tagInteger)
+		e.int(obj.Value)
+	case *object.String:
+		e.buf.WriteByte(tagString)
+		e.string(obj.Value)
+	case *object.CompiledFunction:
+		e.buf.WriteByte(tagFunction)
+		e.function(obj)
+	default:
+		return fmt.Errorf("Error. Can't write constant of type <%s>", obj.Type())
+	}
+	return nil
+}
+
+func (e *encoder) function(fn *object.CompiledFunction) {
+	e.bytes(fn.Instructions)
+	e.uint(fn.NumLocals)
+	e.uint(fn.NumParameters)
+	e.strings(fn.LocalNames)
+	e.strings(fn.Parameters)
+	e.string(fn.Body)
+
+	e.uint(len(fn.Positions))
+	for _, position := range fn.Positions {
+		e.uint(position.Offset)
+		e.uint(position.Line)
+		e.uint(position.Column)
+	}
+
+	e.uint(len(fn.Fallbacks))
+	for _, fallback := range fn.Fallbacks {
+		e.uint(int(fallback.Kind))
+		e.uint(fallback.Depth)
+		e.uint(fallback.Index)
+	}
+}
+
+// Reads the parts of a file, stopping at the first error
+type decoder struct {
+	data []byte
+	pos  int
+	err  *FormatError
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = formatError(format, a...)
+	}
+}
+
+func (d *decoder) uint() int {
+	if d.err != nil {
+		return 0
+	}
+	n, read := binary.Uvarint(d.data[d.pos:])
+	if read <= 0 || n > math.MaxInt32 {
+		d.fail("malformed integer at offset %d", d.pos)
+		return 0
+	}
+	d.pos += read
+	return int(n)
+}
+
+func (d *decoder) int() int64 {
+	if d.err != nil {
+		return 0
+	}
+	n, read := binary.Varint(d.data[d.pos:])
+	if read <= 0 {
+		d.fail("malformed integer at offset %d", d.pos)
+		return 0
+	}
+	d.pos += read
+	return n
+}
+
+// Reads a count of items, each taking at least one byte
+func (d *decoder) count() int {
+	n := d.uint()
+	if n > len(d.data)-d.pos {
+		d.fail("unexpected end of file")
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.count()
+	if d.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, d.data[d.pos:])
+	d.pos += n
+	return b
+}
+
+func (d *decoder) string() string { return string(d.bytes()) }
+
+func (d *decoder) strings() []string {
+	n := d.count()
+	s := []string{}
+	for i := 0; i < n && d.err == nil; i++ {
+		s = append(s, d.string())
+	}
+	return s
+}
+
+func (d *decoder) constant() object.Object {
+	if d.err != nil {
+		return nil
+	}
+	if d.pos >= len(d.data) {
+		d.fail("unexpected end of file")
+		return nil
+	}
+
+	tag := d.data[d.pos]
+	d.pos++
+
+	switch tag {
+	case tagInteger:
+		return &object.Integer{Value: d.int()}
+	case tagString:
+		return &object.String{Value: d.string()}
+	case tagFunction:
+		return d.function()
+	}
+	d.fail("unknown constant tag %d at offset %d", tag, d.pos-1)
+	return nil
+}
+
+func (d *decoder) function() *object.CompiledFunction {
+	fn := &object.CompiledFunction{
+		Instructions:  d.bytes(),
+		NumLocals:     d.uint(),
+		NumParameters: d.uint(),
+		LocalNames:    d.strings(),
+		Parameters:    d.strings(),
+		Body:          d.string(),
+	}
+
+	n := d.count()
+	for i := 0; i < n && d.err == nil; i++ {
+		fn.Positions = append(fn.Positions, object.SourcePosition{
+			Offset: d.uint(),
+			Line:   d.uint(),
+			Column: d.uint(),
+		})
+	}
+
+	n = d.count()
+	for i := 0; i < n && d.err == nil; i++ {
+		fn.Fallbacks = append(fn.Fallbacks, object.Fallback{
+			Kind:  object.FallbackKind(d.uint()),
+			Depth: d.uint(),
+			Index: d.uint(),
+		})
+	}
+	return fn
+}
+
+// Checks that every instruction of the program can be executed by the
+// virtual machine: opcodes are defined, operands refer to existing
+// constants, slots and enclosing calls, jumps land on instructions, and
+// instructions find the values and error handlers they use on the stack.
+func verify(bytecode *compiler.Bytecode) error {
+	v := &verifier{bytecode: bytecode, created: map[*object.CompiledFunction]bool{}}
+	return v.function(bytecode.Main, "<main>", nil)
+}
+
+type verifier struct {
+	bytecode *compiler.Bytecode
+
+	// Functions already created by an OpClosure instruction. The compiler
+	// creates every box from a single place, so the calls enclosing it are known.
+	created map[*object.CompiledFunction]bool
+}
+
+// enclosing holds the functions of the enclosing calls, innermost first.
+func (v *verifier) function(fn *object.CompiledFunction, name string, enclosing []*object.CompiledFunction) error {
+	if len(fn.LocalNames) != fn.NumLocals || fn.NumParameters > fn.NumLocals {
+		return formatError("%s: inconsistent locals", name)
+	}
+	if fn == v.bytecode.Main && fn.NumLocals != 0 {
+		return formatError("%s: the program can't have locals", name)
+	}
+	if len(fn.Fallbacks) != fn.NumLocals {
+		return formatError("%s: inconsistent fallbacks", name)
+	}
+	for idx, fallback := range fn.Fallbacks {
+		if !v.validFallback(fallback, enclosing) {
+			return formatError("%s: invalid fallback for local %d", name, idx)
+		}
+	}
+
+	for idx, position := range fn.Positions {
+		if idx > 0 && position.Offset <= fn.Positions[idx-1].Offset {
+			return formatError("%s: unsorted line table", name)
+		}
+	}
+
+	// Offsets where instructions start, and the jumps to check against them
+	starts := map[int]bool{}
+	targets := []int{}
+
+	ins := fn.Instructions
+	for ip := 0; ip < len(ins); {
+		def, err := code.Lookup(ins[ip])
+		if err != nil {
+			return formatError("%s: %s at offset %d", name, err, ip)
+		}
+
+		size := 1 + width(def)
+		if ip+size > len(ins) {
+			return formatError("%s: truncated %s at offset %d", name, def.Name, ip)
+		}
+
+		starts[ip] = true
+		operands, _ := code.ReadOperands(def, ins[ip+1:])
+		if !v.validOperands(fn, code.Opcode(ins[ip]), operands, enclosing) {
+			return formatError("%s: invalid operand for %s at offset %d", name, def.Name, ip)
+		}
+
+		switch code.Opcode(ins[ip]) {
+		case code.OpClosure:
+			inner := v.bytecode.Constants[operands[0]].(*object.CompiledFunction)
+			v.created[inner] = true
+
+			// Boxes created by the program only refer to globals
+			var innerEnclosing []*object.CompiledFunction
+			if fn != v.bytecode.Main {
+				innerEnclosing = append([]*object.CompiledFunction{fn}, enclosing...)
+			}
+			if err := v.function(inner, fmt.Sprintf("constant %d", operands[0]), innerEnclosing); err != nil {
+				return err
+			}
+		case code.OpJump, code.OpTry:
+			targets = append(targets, operands[0])
+		}
+
+		ip += size
+	}
+
+	for _, target := range targets {
+		if !starts[target] {
+			return formatError("%s: jump to offset %d outside of the instructions", name, target)
+		}
+	}
+
+	// Execution must not run past the last instruction
+	if len(ins) == 0 || code.Opcode(ins[len(ins)-1]) != code.OpReturnValue {
+		return formatError("%s: missing final return", name)
+	}
+	return checkStack(fn, name)
+}
+
+// State of a call before one of its instructions: the number of values it
+// pushed on the stack, and of error handlers it registered
+type stackState struct {
+	depth    int
+	handlers int
+}
+
+// Follows every path through the instructions of a function, from its
+// start and from the error handlers it registers, checking that
+// instructions only pop values the call pushed and only unregister
+// handlers it registered, and that paths joining at an instruction agree
+// on the state of the call there. A handler starts with the stack of its
+// OpTry and the caught error on top.
+func checkStack(fn *object.CompiledFunction, name string) error {
+	ins := fn.Instructions
+	states := map[int]stackState{0: {}}
+	pending := []int{0}
+
+	reach := func(ip int, state stackState) error {
+		if seen, ok := states[ip]; ok {
+			if seen != state {
+				return formatError("%s: inconsistent stack at offset %d", name, ip)
+			}
+			return nil
+		}
+		states[ip] = state
+		pending = append(pending, ip)
+		return nil
+	}
+
+	for len(pending) > 0 {
+		ip := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		state := states[ip]
+
+		op := code.Opcode(ins[ip])
+		def, _ := code.Lookup(ins[ip])
+		operands, read := code.ReadOperands(def, ins[ip+1:])
+		next := ip + 1 + read
+
+		pops, pushes := stackEffect(op, operands)
+		if state.depth < pops {
+			return formatError("%s: %s at offset %d pops an empty stack", name, def.Name, ip)
+		}
+		after := stackState{depth: state.depth - pops + pushes, handlers: state.handlers}
+
+		// Handlers belong to the call, which ends or starts over
+		if (op == code.OpReturnValue || op == code.OpTailCall) && state.handlers > 0 {
+			return formatError("%s: %s at offset %d with error handlers registered", name, def.Name, ip)
+		}
+
+		var err error
+		switch op {
+		case code.OpReturnValue, code.OpThrow, code.OpRethrow:
+			continue
+		case code.OpJump:
+			err = reach(operands[0], after)
+		case code.OpTry:
+			err = reach(operands[0], stackState{depth: state.depth + 1, handlers: state.handlers})
+			if err == nil {
+				after.handlers++
+				err = reach(next, after)
+			}
+		case code.OpEndTry:
+			if state.handlers == 0 {
+				return formatError("%s: OpEndTry at offset %d without an error handler", name, ip)
+			}
+			after.handlers--
+			err = reach(next, after)
+		default:
+			err = reach(next, after)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the number of values an instruction pops off the stack, then
+// pushes on it
+func stackEffect(op code.Opcode, operands []int) (int, int) {
+	switch op {
+	case code.OpConstant, code.OpNull, code.OpGetGlobal, code.OpGetLocal, code.OpGetFree, code.OpGetBuiltin, code.OpClosure:
+		return 0, 1
+	case code.OpPop, code.OpReturnValue, code.OpThrow, code.OpRethrow:
+		return 1, 0
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+		return 2, 1
+	case code.OpMinus, code.OpPlus, code.OpSetGlobal, code.OpSetLocal, code.OpMember:
+		return 1, 1
+	case code.OpCall, code.OpTailCall:
+		// The function and its arguments, for the result
+		return operands[0] + 1, 1
+	}
+	return 0, 0
+}
+
+func (v *verifier) validOperands(fn *object.CompiledFunction, op code.Opcode, operands []int, enclosing []*object.CompiledFunction) bool {
+	constants := v.bytecode.Constants
+
+	switch op {
+	case code.OpConstant:
+		return operands[0] < len(constants)
+	case code.OpMember:
+		if operands[0] >= len(constants) {
+			return false
+		}
+		_, ok := constants[operands[0]].(*object.String)
+		return ok
+	case code.OpGetGlobal, code.OpSetGlobal:
+		return operands[0] < len(v.bytecode.Globals)
+	case code.OpGetLocal, code.OpSetLocal:
+		return operands[0] < fn.NumLocals
+	case code.OpGetBuiltin:
+		return operands[0] < len(object.Builtins)
+	case code.OpGetFree:
+		return v.validFree(operands[0], operands[1], enclosing)
+	case code.OpClosure:
+		if operands[0] >= len(constants) {
+			return false
+		}
+		inner, ok := constants[operands[0]].(*object.CompiledFunction)
+		return ok && !v.created[inner]
+	}
+	return true
+}
+
+func (v *verifier) validFree(depth, slot int, enclosing []*object.CompiledFunction) bool {
+	return depth < len(enclosing) && slot < enclosing[depth].NumLocals
+}
+
+func (v *verifier) validFallback(fallback object.Fallback, enclosing []*object.CompiledFunction) bool {
+	switch fallback.Kind {
+	case object.NoFallback:
+		return true
+	case object.GlobalFallback:
+		return fallback.Index < len(v.bytecode.Globals)
+	case object.FreeFallback:
+		return v.validFree(fallback.Depth, fallback.Index, enclosing)
+	}
+	return false
+}
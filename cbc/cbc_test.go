@@ -0,0 +1,261 @@
+package cbc
+
+import (
+	"bytes"
+	"cardboard/code"
+	"cardboard/compiler"
+	"cardboard/lexer"
+	"cardboard/object"
+	"cardboard/parser"
+	"cardboard/vm"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3", "7"},
+		{`put s = "a\n\"b\""; s + "c";`, "a\n\"b\"c"},
+		{"put adder = box(x) { box(y) { x + y } }; adder(-40)(2)", "-38"},
+		{"try { 1 / 0; } catch (e) { e.kind; } finally { 5; }", "ZeroDivisionError"},
+		{"put f = box() { missing }; try { f(); } catch (e) { e.line * 100 + e.column; }", "117"},
+	}
+
+	for _, tt := range tests {
+		bytecode := compile(t, tt.input)
+
+		var buf bytes.Buffer
+		if err := Write(&buf, &File{Source: "test.cb", Bytecode: bytecode}); err != nil {
+			t.Fatalf("Test failed. Write error: %s", err)
+		}
+
+		file, err := Read(&buf)
+		if err != nil {
+			t.Fatalf("Test failed. Read error for <%s>: %s", tt.input, err)
+		}
+
+		if file.Source != "test.cb" {
+			t.Errorf("Test failed. Expected source test.cb. Got <%s>", file.Source)
+		}
+
+		result := vm.New(file.Bytecode).Run()
+		if result.Inspect() != tt.expected {
+			t.Errorf("Test failed. Expected <%s> to run to %q. Got <%q>", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestInvalidFiles(t *testing.T) {
+	valid := encode(t, compile(t, "put a = 1; a + 2;"))
+
+	corrupted := append([]byte{}, valid...)
+	corrupted[len(corrupted)/2] ^= 0xff
+
+	newer := append([]byte{}, valid...)
+	newer[5] = Version + 1
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"empty", []byte{}, "not a compiled cardboard program"},
+		{"source script", []byte("put a = 1;"), "not a compiled cardboard program"},
+		{"header only", valid[:6], "unexpected end of file"},
+		{"newer version", newer, "unsupported version 3, expected version 2"},
+		{"corrupted", corrupted, "checksum mismatch"},
+		{"truncated", valid[:len(valid)-3], "checksum mismatch"},
+	}
+
+	for _, tt := range tests {
+		_, err := Read(bytes.NewReader(tt.data))
+		if _, ok := err.(*FormatError); !ok {
+			t.Errorf("Test failed. Expected a format error for the %s file. Got <%v>", tt.name, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("Test failed. Expected the %s file error to contain %q. Got <%s>", tt.name, tt.expected, err)
+		}
+	}
+}
+
+// Files with a valid checksum but instructions the virtual machine can't run
+func TestInvalidInstructions(t *testing.T) {
+	function := func(instructions ...[]byte) *object.CompiledFunction {
+		fn := &object.CompiledFunction{}
+		for _, ins := range instructions {
+			fn.Instructions = append(fn.Instructions, ins...)
+		}
+		return fn
+	}
+
+	tests := []struct {
+		name     string
+		bytecode *compiler.Bytecode
+		expected string
+	}{
+		{
+			"unknown opcode",
+			&compiler.Bytecode{Main: function([]byte{255})},
+			"opcode 255 undefined",
+		},
+		{
+			"missing constant",
+			&compiler.Bytecode{Main: function(code.Make(code.OpConstant, 3), code.Make(code.OpReturnValue))},
+			"invalid operand for OpConstant at offset 0",
+		},
+		{
+			"missing global",
+			&compiler.Bytecode{Main: function(code.Make(code.OpGetGlobal, 0), code.Make(code.OpReturnValue))},
+			"invalid operand for OpGetGlobal",
+		},
+		{
+			"free variable of the program",
+			&compiler.Bytecode{
+				Main:      function(code.Make(code.OpClosure, 0), code.Make(code.OpReturnValue)),
+				Constants: []object.Object{function(code.Make(code.OpGetFree, 0, 0), code.Make(code.OpReturnValue))},
+			},
+			"constant 0: invalid operand for OpGetFree",
+		},
+		{
+			"fallback to a missing global",
+			&compiler.Bytecode{
+				Main: function(code.Make(code.OpClosure, 0), code.Make(code.OpReturnValue)),
+				Constants: []object.Object{&object.CompiledFunction{
+					Instructions: append(code.Make(code.OpNull), code.Make(code.OpReturnValue)...),
+					NumLocals:    1,
+					LocalNames:   []string{"x"},
+					Fallbacks:    []object.Fallback{{Kind: object.GlobalFallback, Index: 0}},
+				}},
+			},
+			"constant 0: invalid fallback for local 0",
+		},
+		{
+			"closure of an integer",
+			&compiler.Bytecode{
+				Main:      function(code.Make(code.OpClosure, 0), code.Make(code.OpReturnValue)),
+				Constants: []object.Object{&object.Integer{Value: 1}},
+			},
+			"invalid operand for OpClosure",
+		},
+		{
+			"jump inside an instruction",
+			&compiler.Bytecode{Main: function(code.Make(code.OpJump, 1), code.Make(code.OpReturnValue))},
+			"jump to offset 1",
+		},
+		{
+			"truncated instruction",
+			&compiler.Bytecode{Main: function(code.Make(code.OpNull), []byte{byte(code.OpConstant), 0})},
+			"truncated OpConstant at offset 1",
+		},
+		{
+			"missing return",
+			&compiler.Bytecode{Main: function(code.Make(code.OpNull))},
+			"missing final return",
+		},
+		{
+			"pop of an empty stack",
+			&compiler.Bytecode{Main: function(code.Make(code.OpPop), code.Make(code.OpNull), code.Make(code.OpReturnValue))},
+			"OpPop at offset 0 pops an empty stack",
+		},
+		{
+			"call without arguments on the stack",
+			&compiler.Bytecode{Main: function(code.Make(code.OpNull), code.Make(code.OpCall, 1), code.Make(code.OpReturnValue))},
+			"OpCall at offset 1 pops an empty stack",
+		},
+		{
+			"paths joining with different stacks",
+			&compiler.Bytecode{Main: function(
+				code.Make(code.OpTry, 9),
+				code.Make(code.OpEndTry),
+				code.Make(code.OpNull),
+				code.Make(code.OpNull),
+				code.Make(code.OpJump, 9),
+				code.Make(code.OpPop),
+				code.Make(code.OpReturnValue),
+			)},
+			"inconsistent stack at offset 9",
+		},
+		{
+			"unregistered error handler",
+			&compiler.Bytecode{Main: function(code.Make(code.OpEndTry), code.Make(code.OpNull), code.Make(code.OpReturnValue))},
+			"OpEndTry at offset 0 without an error handler",
+		},
+		{
+			"return from a try",
+			&compiler.Bytecode{Main: function(code.Make(code.OpTry, 5), code.Make(code.OpNull), code.Make(code.OpReturnValue), code.Make(code.OpReturnValue))},
+			"OpReturnValue at offset 4 with error handlers registered",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := Read(bytes.NewReader(encode(t, tt.bytecode)))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("Test failed. Expected the %s error to contain %q. Got <%v>", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	source := "put a = 1;\nput f = box(x) {\n  box() { x + a }\n};"
+
+	var out bytes.Buffer
+	Disassemble(&out, compile(t, source), source)
+
+	expected := `== <main> ==
+   1 | put a = 1;
+    0000 OpConstant 0         ; 1
+    0003 OpSetGlobal 0        ; a
+    0006 OpPop
+   2 | put f = box(x) {
+    0007 OpClosure 2          ; box(x)
+    0010 OpSetGlobal 1        ; f
+    0013 OpReturnValue
+
+== constant 1: box() ==
+   3 | box() { x + a }
+    0000 OpGetFree 0 0        ; x
+    0003 OpGetGlobal 0        ; a
+    0006 OpAdd
+    0007 OpReturnValue
+
+== constant 2: box(x) ==
+locals: x
+   3 | box() { x + a }
+    0000 OpClosure 1          ; box()
+    0003 OpReturnValue
+`
+
+	if out.String() != expected {
+		t.Fatalf("Test failed. Wrong listing.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func compile(t *testing.T, input string) *compiler.Bytecode {
+	t.Helper()
+
+	p := parser.CreateParser(lexer.CreateLexer(input))
+	program := p.ParseCardBoard()
+	if errs := p.GetErrors(); len(errs) > 0 {
+		t.Fatalf("Test failed. Parser errors: %v", errs)
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("Test failed. Compiler error: %s", err)
+	}
+	return comp.Bytecode()
+}
+
+func encode(t *testing.T, bytecode *compiler.Bytecode) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := Write(&buf, &File{Bytecode: bytecode}); err != nil {
+		t.Fatalf("Test failed. Write error: %s", err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,171 @@
+package cbc
+
+import (
+	"cardboard/code"
+	"cardboard/compiler"
+	"cardboard/object"
+	"cardboard/parser/ast"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Disassemble writes a listing of the instructions of the program and of
+// every box it creates. Operands are annotated with the constant, binding
+// or address they refer to, and instructions are grouped under the source
+// line they were compiled from. source may be empty when unavailable.
+func Disassemble(w io.Writer, bytecode *compiler.Bytecode, source string) {
+	d := &disassembler{
+		w:        w,
+		bytecode: bytecode,
+		parents:  map[*object.CompiledFunction]*object.CompiledFunction{},
+	}
+	if source != "" {
+		d.lines = strings.Split(source, "\n")
+	}
+
+	d.findParents(bytecode.Main)
+	for _, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			d.findParents(fn)
+		}
+	}
+
+	d.function(bytecode.Main, "<main>")
+	for idx, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			fmt.Fprintln(w)
+			d.function(fn, fmt.Sprintf("constant %d: box(%s)", idx, strings.Join(fn.Parameters, ", ")))
+		}
+	}
+}
+
+type disassembler struct {
+	w        io.Writer
+	bytecode *compiler.Bytecode
+	lines    []string
+
+	// Function creating each box, to name the locals of enclosing calls
+	parents map[*object.CompiledFunction]*object.CompiledFunction
+}
+
+func (d *disassembler) function(fn *object.CompiledFunction, title string) {
+	fmt.Fprintf(d.w, "== %s ==\n", title)
+	if len(fn.LocalNames) > 0 {
+		fmt.Fprintf(d.w, "locals: %s\n", strings.Join(fn.LocalNames, ", "))
+	}
+
+	line := 0
+	ins := fn.Instructions
+	for ip := 0; ip < len(ins); {
+		def, err := code.Lookup(ins[ip])
+		if err != nil {
+			fmt.Fprintf(d.w, "    %04d ERROR: %s\n", ip, err)
+			return
+		}
+
+		if ip+1+width(def) > len(ins) {
+			fmt.Fprintf(d.w, "    %04d ERROR: truncated %s\n", ip, def.Name)
+			return
+		}
+		operands, read := code.ReadOperands(def, ins[ip+1:])
+
+		if l, _ := fn.PositionAt(ip); l != line && l > 0 {
+			line = l
+			d.sourceLine(line)
+		}
+
+		listing := def.Name
+		for _, operand := range operands {
+			listing += fmt.Sprintf(" %d", operand)
+		}
+
+		if note := d.annotate(fn, code.Opcode(ins[ip]), operands); note != "" {
+			fmt.Fprintf(d.w, "    %04d %-20s ; %s\n", ip, listing, note)
+		} else {
+			fmt.Fprintf(d.w, "    %04d %s\n", ip, listing)
+		}
+
+		ip += 1 + read
+	}
+}
+
+// Records fn as the parent of the boxes it creates
+func (d *disassembler) findParents(fn *object.CompiledFunction) {
+	ins := fn.Instructions
+	for ip := 0; ip < len(ins); {
+		def, err := code.Lookup(ins[ip])
+		if err != nil || ip+1+width(def) > len(ins) {
+			return
+		}
+		operands, read := code.ReadOperands(def, ins[ip+1:])
+
+		if code.Opcode(ins[ip]) == code.OpClosure && operands[0] < len(d.bytecode.Constants) {
+			if inner, ok := d.bytecode.Constants[operands[0]].(*object.CompiledFunction); ok {
+				d.parents[inner] = fn
+			}
+		}
+		ip += 1 + read
+	}
+}
+
+func (d *disassembler) sourceLine(line int) {
+	if line <= len(d.lines) {
+		fmt.Fprintf(d.w, "%4d | %s\n", line, strings.TrimSpace(d.lines[line-1]))
+	} else {
+		fmt.Fprintf(d.w, "%4d |\n", line)
+	}
+}
+
+// Describes what the operands of an instruction refer to
+func (d *disassembler) annotate(fn *object.CompiledFunction, op code.Opcode, operands []int) string {
+	constants := d.bytecode.Constants
+
+	switch op {
+	case code.OpConstant, code.OpMember:
+		if operands[0] < len(constants) {
+			if str, ok := constants[operands[0]].(*object.String); ok {
+				return ast.QuoteString(str.Value)
+			}
+			return constants[operands[0]].Inspect()
+		}
+	case code.OpGetGlobal, code.OpSetGlobal:
+		if operands[0] < len(d.bytecode.Globals) {
+			return d.bytecode.Globals[operands[0]]
+		}
+	case code.OpGetLocal, code.OpSetLocal:
+		if operands[0] < len(fn.LocalNames) {
+			return fn.LocalNames[operands[0]]
+		}
+	case code.OpGetBuiltin:
+		if operands[0] < len(object.Builtins) {
+			return object.Builtins[operands[0]].Name
+		}
+	case code.OpGetFree:
+		enclosing := d.parents[fn]
+		for depth := 0; depth < operands[0] && enclosing != nil; depth++ {
+			enclosing = d.parents[enclosing]
+		}
+		if enclosing != nil && operands[1] < len(enclosing.LocalNames) {
+			return enclosing.LocalNames[operands[1]]
+		}
+	case code.OpClosure:
+		if operands[0] < len(constants) {
+			if inner, ok := constants[operands[0]].(*object.CompiledFunction); ok {
+				return fmt.Sprintf("box(%s)", strings.Join(inner.Parameters, ", "))
+			}
+		}
+	case code.OpJump, code.OpTry:
+		return fmt.Sprintf("to %04d", operands[0])
+	}
+	return ""
+}
+
+// Number of bytes taken by the operands of an instruction
+func width(def *code.Definition) int {
+	n := 0
+	for _, w := range def.OperandWidths {
+		n += w
+	}
+	return n
+}
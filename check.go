@@ -0,0 +1,75 @@
+package main
+
+import (
+	"cardboard/lexer"
+	"cardboard/parser"
+	"cardboard/resolver"
+	"cardboard/types"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Reports the problems found in a script without running it: unknown
+// identifiers, shadowed bindings, unused bindings and parameters, and
+// type errors. With -infer, the types of unannotated code are inferred
+// rather than left unchecked, and the inferred signature of every box is
+// listed.
+func checkCommand(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	infer := flags.Bool("infer", false, "infer the types of every box, and list their signatures")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: cardboard check [-infer] script.cb")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	path := flags.Arg(0)
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	p := parser.CreateParser(lexer.CreateLexer(string(source)))
+	program := p.ParseCardBoard()
+	if errs := p.GetErrors(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return 1
+	}
+
+	diagnostics := resolver.Resolve(program)
+	if *infer {
+		signatures, typeErrors := types.Infer(program)
+		for _, signature := range signatures {
+			fmt.Printf("%s:%s\n", path, signature)
+		}
+		diagnostics = append(diagnostics, typeErrors...)
+	} else {
+		diagnostics = append(diagnostics, types.Check(program)...)
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	code := 0
+	for _, diagnostic := range diagnostics {
+		fmt.Printf("%s:%s\n", path, diagnostic)
+		if diagnostic.Severity == resolver.Error {
+			code = 1
+		}
+	}
+	return code
+}
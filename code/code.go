@@ -0,0 +1,219 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Bytecode instructions: an opcode byte followed by its operands (big endian)
+type Instructions []byte
+
+type Opcode byte
+
+const (
+	// Push the constant at <index> of the constant pool
+	OpConstant Opcode = iota
+	// Discard the value on top of the stack
+	OpPop
+	// Push null
+	OpNull
+
+	// Arithmetic on the two values on top of the stack
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+
+	// Prefix operators
+	OpMinus
+	OpPlus
+
+	// Bindings. Set operations leave the value on the stack,
+	// since a 'put' statement evaluates to the bound value.
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	// Read slot <index> of the locals of the enclosing call <depth> levels up
+	OpGetFree
+
+	// Create a closure from the compiled function at <index> of the constant pool
+	OpClosure
+	// Call the function below its <argument count> arguments
+	OpCall
+	// Return the value on top of the stack from the current call
+	OpReturnValue
+
+	OpJump
+
+	// Register an error handler at <address> for the current call
+	OpTry
+	// Unregister the innermost error handler
+	OpEndTry
+	// Raise the value on top of the stack as an error
+	OpThrow
+	// Raise again the caught error on top of the stack
+	OpRethrow
+
+	// Read the property named by the constant at <index>
+	OpMember
+
+	// Call in tail position. Calls of the running closure to itself reuse
+	// the current call, other calls are made like OpCall.
+	OpTailCall
+
+	// Push the builtin at <index> of object.Builtins
+	OpGetBuiltin
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant:    {"OpConstant", []int{2}},
+	OpPop:         {"OpPop", []int{}},
+	OpNull:        {"OpNull", []int{}},
+	OpAdd:         {"OpAdd", []int{}},
+	OpSub:         {"OpSub", []int{}},
+	OpMul:         {"OpMul", []int{}},
+	OpDiv:         {"OpDiv", []int{}},
+	OpMinus:       {"OpMinus", []int{}},
+	OpPlus:        {"OpPlus", []int{}},
+	OpGetGlobal:   {"OpGetGlobal", []int{2}},
+	OpSetGlobal:   {"OpSetGlobal", []int{2}},
+	OpGetLocal:    {"OpGetLocal", []int{1}},
+	OpSetLocal:    {"OpSetLocal", []int{1}},
+	OpGetFree:     {"OpGetFree", []int{1, 1}},
+	OpClosure:     {"OpClosure", []int{2}},
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpJump:        {"OpJump", []int{2}},
+	OpTry:         {"OpTry", []int{2}},
+	OpEndTry:      {"OpEndTry", []int{}},
+	OpThrow:       {"OpThrow", []int{}},
+	OpRethrow:     {"OpRethrow", []int{}},
+	OpMember:      {"OpMember", []int{2}},
+	OpTailCall:    {"OpTailCall", []int{1}},
+	OpGetBuiltin:  {"OpGetBuiltin", []int{1}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make encodes an instruction
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction, returning them
+// along with the number of bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 { return uint8(ins[0]) }
+
+// Human readable listing of the instructions, one per line
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			return out.String()
+		}
+
+		if i+1+operandsWidth(def) > len(ins) {
+			fmt.Fprintf(&out, "%04d ERROR: truncated %s\n", i, def.Name)
+			return out.String()
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+func operandsWidth(def *Definition) int {
+	width := 0
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+	return width
+}
@@ -0,0 +1,90 @@
+package code
+
+import "testing"
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpGetFree, []int{1, 3}, []byte{byte(OpGetFree), 1, 3}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		if len(instruction) != len(tt.expected) {
+			t.Fatalf("Test failed. Expected instruction length %d. Got <%d>", len(tt.expected), len(instruction))
+		}
+
+		for i, b := range tt.expected {
+			if instruction[i] != b {
+				t.Fatalf("Test failed. Expected byte %d to be %d. Got <%d>", i, b, instruction[i])
+			}
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpConstant, 1),
+		Make(OpGetLocal, 1),
+		Make(OpGetFree, 0, 2),
+		Make(OpCall, 2),
+		Make(OpTry, 65535),
+		Make(OpReturnValue),
+	}
+
+	expected := `0000 OpConstant 1
+0003 OpGetLocal 1
+0005 OpGetFree 0 2
+0008 OpCall 2
+0010 OpTry 65535
+0013 OpReturnValue
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != expected {
+		t.Fatalf("Test failed. Instructions wrongly formatted.\nwant=%q\ngot=%q", expected, concatted.String())
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpSetLocal, []int{255}, 1},
+		{OpGetFree, []int{4, 200}, 2},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("Test failed. Definition not found: %q", err)
+		}
+
+		operandsRead, n := ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("Test failed. Expected %d bytes read. Got <%d>", tt.bytesRead, n)
+		}
+
+		for i, want := range tt.operands {
+			if operandsRead[i] != want {
+				t.Fatalf("Test failed. Expected operand %d. Got <%d>", want, operandsRead[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"cardboard/cbc"
+	"cardboard/compiler"
+	"cardboard/lexer"
+	"cardboard/optimizer"
+	"cardboard/parser"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Compiles a script to a .cbc file, which can be run like the script itself.
+func compileCommand(args []string) int {
+	flags := flag.NewFlagSet("compile", flag.ExitOnError)
+	optimize := flags.Bool("optimize", true, "optimize the script before compiling it")
+	output := flags.String("o", "", "path of the compiled file (default: the script path with a "+cbc.Extension+" extension)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: cardboard compile [-optimize=false] [-o output] script.cb")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	path := flags.Arg(0)
+
+	bytecode, _, ok := compileScript(path, *optimize)
+	if !ok {
+		return 1
+	}
+
+	if *output == "" {
+		*output = strings.TrimSuffix(path, ".cb") + cbc.Extension
+	}
+
+	out, err := os.Create(*output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer out.Close()
+
+	if err := cbc.Write(out, &cbc.File{Source: path, Bytecode: bytecode}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// Parses, optionally optimizes, and compiles the script at path, returning
+// its bytecode and source. Errors are printed to standard error.
+func compileScript(path string, optimize bool) (*compiler.Bytecode, string, bool) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, "", false
+	}
+
+	p := parser.CreateParser(lexer.CreateLexer(string(source)))
+	program := p.ParseCardBoard()
+	if errs := p.GetErrors(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return nil, "", false
+	}
+
+	if optimize {
+		program = optimizer.Optimize(program)
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, "", false
+	}
+	return comp.Bytecode(), string(source), true
+}
@@ -0,0 +1,595 @@
+package compiler
+
+import (
+	"cardboard/code"
+	"cardboard/lexer/token"
+	"cardboard/object"
+	"cardboard/parser/ast"
+	"fmt"
+	"math"
+)
+
+// Compiled program
+type Bytecode struct {
+	// Top level statements, compiled like a box body without parameters
+	Main      *object.CompiledFunction
+	Constants []object.Object
+
+	// Identifier of every global slot, indexed by slot
+	Globals []string
+}
+
+type Compiler struct {
+	constants []object.Object
+
+	// Constant pool index of literals already added to the pool
+	literals map[interface{}]int
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// Token of the node instructions are currently emitted for
+	position token.Token
+
+	// First operand that didn't fit in its instruction
+	err error
+}
+
+// Instructions of the box body (or program) being compiled
+type CompilationScope struct {
+	instructions code.Instructions
+	positions    []object.SourcePosition
+
+	// Error handlers active at the current instruction, innermost last
+	tries []tryContext
+}
+
+// An error handler registered by a try statement. Handlers for finally
+// blocks carry the block, which runs before unboxing through them.
+type tryContext struct {
+	finally *ast.BlockStatement
+}
+
+func New() *Compiler {
+	return NewWithState(NewSymbolTable(), []object.Object{})
+}
+
+// Creates a compiler sharing the globals and constants of previous
+// compilations, so the REPL can compile one line at a time.
+func NewWithState(symbolTable *SymbolTable, constants []object.Object) *Compiler {
+	return &Compiler{
+		constants:   constants,
+		literals:    make(map[interface{}]int),
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{{}},
+	}
+}
+
+// Compile compiles node, reporting the first error found, like an operand
+// too large for its instruction.
+func (c *Compiler) Compile(node ast.Node) error {
+	if err := c.compile(node); err != nil {
+		return err
+	}
+	return c.err
+}
+
+func (c *Compiler) compile(node ast.Node) error {
+	switch node := node.(type) {
+
+	// Statements
+	case *ast.Program:
+		c.declareBindings(node.Statements, nil)
+		return c.compileBody(node.Statements)
+	case *ast.ExpressionStatement:
+		return c.Compile(node.Expression)
+	case *ast.PutStatement:
+		return c.compilePutStatement(node)
+	case *ast.UnboxStatement:
+		return c.compileUnboxStatement(node)
+	case *ast.ThrowStatement:
+		if err := c.Compile(node.NodeExpression); err != nil {
+			return err
+		}
+		c.position = node.NodeToken
+		c.emit(code.OpThrow)
+	case *ast.TryStatement:
+		return c.compileTryStatement(node)
+
+	// Expressions
+	case *ast.IntegerLiteral:
+		c.position = node.NodeToken
+		c.emit(code.OpConstant, c.addLiteral(node.Value, &object.Integer{Value: node.Value}))
+	case *ast.StringLiteral:
+		c.position = node.NodeToken
+		c.emit(code.OpConstant, c.addLiteral(node.Value, &object.String{Value: node.Value}))
+	case *ast.Identifier:
+		return c.compileIdentifier(node)
+	case *ast.PrefixExpression:
+		return c.compilePrefixExpression(node)
+	case *ast.InfixExpression:
+		return c.compileInfixExpression(node)
+	case *ast.BoxExpression:
+		return c.compileBoxExpression(node)
+	case *ast.CallExpression:
+		return c.compileCall(node, code.OpCall)
+	case *ast.MemberExpression:
+		if err := c.Compile(node.Object); err != nil {
+			return err
+		}
+		c.position = node.NodeToken
+		c.emit(code.OpMember, c.addLiteral(node.Property.Value, &object.String{Value: node.Property.Value}))
+
+	default:
+		return fmt.Errorf("Unknown Word: <%s>", node.TokenLiteral())
+	}
+
+	return nil
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	main := &object.CompiledFunction{
+		Instructions: c.currentInstructions(),
+		Positions:    c.scopes[c.scopeIndex].positions,
+	}
+	return &Bytecode{Main: main, Constants: c.constants, Globals: c.symbolTable.Global().Names()}
+}
+
+// Compiles the statements of a box body (or program). Like evaluating them,
+// the value of the last statement is returned unless a value is unboxed first.
+func (c *Compiler) compileBody(stmts []ast.Statement) error {
+	if err := c.compileBlock(stmts); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+	return nil
+}
+
+// Compiles the statements of a box body like compileBody, making the calls
+// in tail position with OpTailCall: the value of an 'unbox' statement, or
+// of the last statement.
+func (c *Compiler) compileBoxBody(stmts []ast.Statement) error {
+	if len(stmts) == 0 {
+		c.emit(code.OpNull)
+	}
+
+	for idx, stmt := range stmts {
+		last := idx == len(stmts)-1
+
+		if call := tailCall(stmt, last); call != nil {
+			if err := c.compileCall(call, code.OpTailCall); err != nil {
+				return err
+			}
+			if unbox, ok := stmt.(*ast.UnboxStatement); ok {
+				c.position = unbox.NodeToken
+				c.emit(code.OpReturnValue)
+			}
+			continue
+		}
+
+		if err := c.Compile(stmt); err != nil {
+			return err
+		}
+		if !last {
+			c.emit(code.OpPop)
+		}
+	}
+
+	c.emit(code.OpReturnValue)
+	return nil
+}
+
+// Returns the call in tail position in a statement of a box body, if any
+func tailCall(stmt ast.Statement, last bool) *ast.CallExpression {
+	switch stmt := stmt.(type) {
+	case *ast.UnboxStatement:
+		call, _ := stmt.NodeExpression.(*ast.CallExpression)
+		return call
+	case *ast.ExpressionStatement:
+		if last {
+			call, _ := stmt.Expression.(*ast.CallExpression)
+			return call
+		}
+	}
+	return nil
+}
+
+// Compiles statements so they leave the value of the last one on the stack,
+// or null when there are none.
+func (c *Compiler) compileBlock(stmts []ast.Statement) error {
+	if len(stmts) == 0 {
+		c.emit(code.OpNull)
+		return nil
+	}
+
+	for idx, stmt := range stmts {
+		if err := c.Compile(stmt); err != nil {
+			return err
+		}
+		if idx < len(stmts)-1 {
+			c.emit(code.OpPop)
+		}
+	}
+	return nil
+}
+
+// Reserves a slot for every identifier bound in the statements of a body
+// before compiling it, so boxes can refer to bindings made after them.
+// Until their 'put' runs, the slots fall back to the enclosing bindings.
+// Catch parameters get their slot when their catch block is compiled, and
+// params holds the names of those in scope.
+func (c *Compiler) declareBindings(stmts []ast.Statement, params map[string]bool) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.PutStatement:
+			if !params[stmt.NodeIdentifier.Value] {
+				c.symbolTable.Declare(stmt.NodeIdentifier.Value)
+			}
+		case *ast.TryStatement:
+			c.declareBindings(stmt.Body.Statements, params)
+			if stmt.Catch != nil {
+				catchParams := params
+				if stmt.CatchParameter != nil {
+					catchParams = map[string]bool{stmt.CatchParameter.Value: true}
+					for name := range params {
+						catchParams[name] = true
+					}
+				}
+				c.declareBindings(stmt.Catch.Statements, catchParams)
+			}
+			if stmt.Finally != nil {
+				c.declareBindings(stmt.Finally.Statements, params)
+			}
+		}
+	}
+}
+
+func (c *Compiler) compilePutStatement(stmt *ast.PutStatement) error {
+	if err := c.Compile(stmt.NodeExpression); err != nil {
+		return err
+	}
+	c.position = stmt.NodeToken
+	c.emitSet(c.symbolTable.Declare(stmt.NodeIdentifier.Value))
+	return nil
+}
+
+func (c *Compiler) compileUnboxStatement(stmt *ast.UnboxStatement) error {
+	if err := c.Compile(stmt.NodeExpression); err != nil {
+		return err
+	}
+	c.position = stmt.NodeToken
+
+	// Leave every enclosing try statement, running their finally blocks
+	scope := &c.scopes[c.scopeIndex]
+	tries := scope.tries
+	for idx := len(tries) - 1; idx >= 0; idx-- {
+		c.emit(code.OpEndTry)
+		if tries[idx].finally != nil {
+			scope.tries = tries[:idx]
+			if err := c.compileBlock(tries[idx].finally.Statements); err != nil {
+				return err
+			}
+			c.emit(code.OpPop)
+		}
+	}
+	scope.tries = tries
+
+	c.emit(code.OpReturnValue)
+	return nil
+}
+
+// try { B } catch (e) { C } finally { F } compiles to
+//
+//	    OpTry finally
+//	    OpTry catch
+//	    B
+//	    OpEndTry
+//	    OpJump done
+//	catch:
+//	    bind e, C
+//	done:
+//	    OpEndTry
+//	    F, OpPop
+//	    OpJump end
+//	finally:
+//	    F, OpPop
+//	    OpRethrow
+//	end:
+func (c *Compiler) compileTryStatement(stmt *ast.TryStatement) error {
+	c.position = stmt.NodeToken
+
+	finallyHandler := -1
+	if stmt.Finally != nil {
+		finallyHandler = c.emit(code.OpTry, 9999)
+		c.pushTry(tryContext{finally: stmt.Finally})
+	}
+
+	catchHandler := -1
+	if stmt.Catch != nil {
+		catchHandler = c.emit(code.OpTry, 9999)
+		c.pushTry(tryContext{})
+	}
+
+	if err := c.compileBlock(stmt.Body.Statements); err != nil {
+		return err
+	}
+
+	if stmt.Catch != nil {
+		c.position = stmt.NodeToken
+		c.emit(code.OpEndTry)
+		c.popTry()
+		done := c.emit(code.OpJump, 9999)
+
+		// The caught error is on top of the stack, bound to a slot of
+		// its own while the catch block runs
+		c.changeOperand(catchHandler, len(c.currentInstructions()))
+		restore := func() {}
+		if stmt.CatchParameter != nil {
+			var symbol Symbol
+			symbol, restore = c.symbolTable.DefineScoped(stmt.CatchParameter.Value)
+			c.position = stmt.CatchParameter.NodeToken
+			c.emitSet(symbol)
+		}
+		c.emit(code.OpPop)
+
+		err := c.compileBlock(stmt.Catch.Statements)
+		restore()
+		if err != nil {
+			return err
+		}
+		c.changeOperand(done, len(c.currentInstructions()))
+	}
+
+	if stmt.Finally != nil {
+		c.position = stmt.NodeToken
+		c.emit(code.OpEndTry)
+		c.popTry()
+		if err := c.compileBlock(stmt.Finally.Statements); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+		end := c.emit(code.OpJump, 9999)
+
+		c.changeOperand(finallyHandler, len(c.currentInstructions()))
+		if err := c.compileBlock(stmt.Finally.Statements); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+		c.position = stmt.NodeToken
+		c.emit(code.OpRethrow)
+		c.changeOperand(end, len(c.currentInstructions()))
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileIdentifier(ident *ast.Identifier) error {
+	c.position = ident.NodeToken
+
+	symbol, depth, ok := c.symbolTable.Resolve(ident.Value)
+	if _, index, found := object.LookupBuiltin(ident.Value); !ok && found {
+		c.emit(code.OpGetBuiltin, index)
+		return nil
+	}
+	if !ok {
+		// Unbound names are looked up among the globals when evaluated,
+		// they may be bound by the time the code runs.
+		symbol, depth = c.symbolTable.Global().Define(ident.Value), 0
+	}
+
+	switch {
+	case symbol.Scope == GlobalScope:
+		c.emit(code.OpGetGlobal, symbol.Index)
+	case depth == 0:
+		c.emit(code.OpGetLocal, symbol.Index)
+	default:
+		if depth > math.MaxUint8 {
+			return fmt.Errorf("Error. <%s> is nested too deeply", ident.Value)
+		}
+		c.emit(code.OpGetFree, depth-1, symbol.Index)
+	}
+	return nil
+}
+
+func (c *Compiler) compilePrefixExpression(expr *ast.PrefixExpression) error {
+	if err := c.Compile(expr.Right); err != nil {
+		return err
+	}
+
+	c.position = expr.NodeToken
+	switch expr.Operator {
+	case "-":
+		c.emit(code.OpMinus)
+	case "+":
+		c.emit(code.OpPlus)
+	default:
+		return fmt.Errorf("Unknown Operator: <%s>.", expr.Operator)
+	}
+	return nil
+}
+
+func (c *Compiler) compileInfixExpression(expr *ast.InfixExpression) error {
+	if err := c.Compile(expr.Left); err != nil {
+		return err
+	}
+	if err := c.Compile(expr.Right); err != nil {
+		return err
+	}
+
+	c.position = expr.NodeToken
+	switch expr.Operator {
+	case "+":
+		c.emit(code.OpAdd)
+	case "-":
+		c.emit(code.OpSub)
+	case "*":
+		c.emit(code.OpMul)
+	case "/":
+		c.emit(code.OpDiv)
+	default:
+		return fmt.Errorf("Unknown Operator: <%s>.", expr.Operator)
+	}
+	return nil
+}
+
+func (c *Compiler) compileBoxExpression(box *ast.BoxExpression) error {
+	c.enterScope()
+
+	parameters := []string{}
+	for _, param := range box.ParameterList {
+		c.symbolTable.Define(param.Value)
+		parameters = append(parameters, param.Value)
+	}
+	c.declareBindings(box.Body.Statements, nil)
+
+	if err := c.compileBoxBody(box.Body.Statements); err != nil {
+		return err
+	}
+
+	numLocals := c.symbolTable.NumDefinitions()
+	if numLocals > math.MaxUint8+1 {
+		return fmt.Errorf("Error. Box has more than %d parameters and bindings", math.MaxUint8+1)
+	}
+
+	localNames := c.symbolTable.Names()
+	fallbacks := c.symbolTable.Fallbacks()
+	positions := c.scopes[c.scopeIndex].positions
+	instructions := c.leaveScope()
+
+	fn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(box.ParameterList),
+		LocalNames:    localNames,
+		Fallbacks:     fallbacks,
+		Positions:     positions,
+		Parameters:    parameters,
+		Body:          box.Body.String(),
+	}
+
+	c.position = box.NodeToken
+	c.emit(code.OpClosure, c.addConstant(fn))
+	return nil
+}
+
+func (c *Compiler) compileCall(call *ast.CallExpression, op code.Opcode) error {
+	if err := c.Compile(call.Function); err != nil {
+		return err
+	}
+
+	if len(call.Arguments) > math.MaxUint8 {
+		return fmt.Errorf("Error. Call has more than %d arguments", math.MaxUint8)
+	}
+
+	for _, arg := range call.Arguments {
+		if err := c.Compile(arg); err != nil {
+			return err
+		}
+	}
+
+	c.position = call.NodeToken
+	c.emit(op, len(call.Arguments))
+	return nil
+}
+
+func (c *Compiler) emitSet(symbol Symbol) {
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, symbol.Index)
+	} else {
+		c.emit(code.OpSetLocal, symbol.Index)
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// Adds a literal to the constant pool, reusing the entry of an equal literal.
+func (c *Compiler) addLiteral(value interface{}, obj object.Object) int {
+	if idx, ok := c.literals[value]; ok {
+		return idx
+	}
+	idx := c.addConstant(obj)
+	c.literals[value] = idx
+	return idx
+}
+
+// Appends an instruction, returning its offset.
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	scope := &c.scopes[c.scopeIndex]
+	pos := len(scope.instructions)
+	scope.instructions = append(scope.instructions, code.Make(op, operands...)...)
+	c.checkOperands(op, operands...)
+
+	// Extend the line table when the source position changes
+	line, column := c.position.Line, c.position.Column
+	if n := len(scope.positions); n == 0 || scope.positions[n-1].Line != line || scope.positions[n-1].Column != column {
+		scope.positions = append(scope.positions, object.SourcePosition{Offset: pos, Line: line, Column: column})
+	}
+	return pos
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	ins := c.currentInstructions()
+	op := code.Opcode(ins[opPos])
+	copy(ins[opPos:], code.Make(op, operand))
+	c.checkOperands(op, operand)
+}
+
+// Records the first operand too large for the instruction encoding it
+func (c *Compiler) checkOperands(op code.Opcode, operands ...int) {
+	def, err := code.Lookup(byte(op))
+	if err != nil || c.err != nil {
+		return
+	}
+
+	for idx, operand := range operands {
+		if operand < 1<<(8*def.OperandWidths[idx]) {
+			continue
+		}
+		switch op {
+		case code.OpConstant, code.OpClosure, code.OpMember:
+			c.err = fmt.Errorf("Error. Program has more than %d constants", math.MaxUint16+1)
+		case code.OpGetGlobal, code.OpSetGlobal:
+			c.err = fmt.Errorf("Error. Program has more than %d globals", math.MaxUint16+1)
+		case code.OpJump, code.OpTry:
+			c.err = fmt.Errorf("Error. Instructions are too long to jump to offset %d", operand)
+		default:
+			c.err = fmt.Errorf("Error. Operand %d of %s is too large", operand, def.Name)
+		}
+		return
+	}
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) pushTry(try tryContext) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = append(scope.tries, try)
+}
+
+func (c *Compiler) popTry() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = scope.tries[:len(scope.tries)-1]
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
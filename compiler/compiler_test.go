@@ -0,0 +1,429 @@
+package compiler
+
+import (
+	"cardboard/code"
+	"cardboard/lexer"
+	"cardboard/object"
+	"cardboard/parser"
+	"cardboard/parser/ast"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "1; 2 * 1",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMul),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "-1 / +2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPlus),
+				code.Make(code.OpDiv),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpNull),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestGlobalPutStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "put a = 1; put b = a; b;",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "put a = 1; put a = a + 1;",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBuiltins(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "assertEqual(1, 1);",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 1),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			// Bindings shadow builtins
+			input:             "put assert = 1; assert;",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBoxes(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "box(a) { put b = a; box() { a + b } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0, 0),
+					code.Make(code.OpGetFree, 0, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpPop),
+					code.Make(code.OpClosure, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input: "put f = box() { unbox 5; }; f();",
+			expectedConstants: []interface{}{
+				5,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "box(f) { unbox f(1); f(f) }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			// Calls inside try statements or operations aren't in tail position
+			input: "box(f) { try { unbox f(); } catch { 1; } 1 + f() }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpTry, 13),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpEndTry),
+					code.Make(code.OpReturnValue),
+					code.Make(code.OpEndTry),
+					code.Make(code.OpJump, 17),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestTryStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "try { 1; } catch (e) { e; }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTry, 10),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpEndTry),
+				code.Make(code.OpJump, 17),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "try { throw 1; } finally { 2; }",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTry, 15),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpThrow),
+				code.Make(code.OpEndTry),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpJump, 20),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpRethrow),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLineTable(t *testing.T) {
+	program := parse("put a = 1;\na\n+ 2;")
+
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("Test failed. Compiler error: %s", err)
+	}
+	main := compiler.Bytecode().Main
+
+	tests := []struct {
+		offset int
+		line   int
+		column int
+	}{
+		{0, 1, 9},  // OpConstant 1
+		{3, 1, 1},  // OpSetGlobal a
+		{7, 2, 1},  // OpGetGlobal a
+		{13, 3, 1}, // OpAdd
+	}
+
+	for _, tt := range tests {
+		line, column := main.PositionAt(tt.offset)
+		if line != tt.line || column != tt.column {
+			t.Errorf("Test failed. Expected offset %d at %d:%d. Got <%d:%d>", tt.offset, tt.line, tt.column, line, column)
+		}
+	}
+}
+
+func TestSymbolTable(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+	if a != (Symbol{Name: "a", Scope: GlobalScope, Index: 0}) {
+		t.Fatalf("Test failed. Unexpected symbol %+v", a)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	b := local.Define("b")
+	if b != (Symbol{Name: "b", Scope: LocalScope, Index: 0}) {
+		t.Fatalf("Test failed. Unexpected symbol %+v", b)
+	}
+
+	if again := local.Declare("b"); again != b {
+		t.Fatalf("Test failed. Expected Declare to reuse %+v. Got <%+v>", b, again)
+	}
+
+	nested := NewEnclosedSymbolTable(local)
+	symbol, depth, ok := nested.Resolve("b")
+	if !ok || symbol != b || depth != 1 {
+		t.Fatalf("Test failed. Expected %+v at depth 1. Got <%+v> at depth %d", b, symbol, depth)
+	}
+
+	symbol, depth, ok = nested.Resolve("a")
+	if !ok || symbol != a || depth != 2 {
+		t.Fatalf("Test failed. Expected %+v at depth 2. Got <%+v> at depth %d", a, symbol, depth)
+	}
+
+	if _, _, ok := nested.Resolve("c"); ok {
+		t.Fatalf("Test failed. Expected c to be unresolved")
+	}
+
+	if nested.Global() != global {
+		t.Fatalf("Test failed. Expected the outermost table")
+	}
+}
+
+// Programs too large for the operands of their instructions
+func TestOperandOverflow(t *testing.T) {
+	repeat := func(format string, count int) string {
+		var b strings.Builder
+		for idx := 0; idx < count; idx++ {
+			fmt.Fprintf(&b, format, idx)
+		}
+		return b.String()
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{repeat("%d;", 70000), "Error. Program has more than 65536 constants"},
+		{repeat("put a%d = 0;", 70000), "Error. Program has more than 65536 globals"},
+		{"try {" + repeat("1 + %d;", 30000) + "} catch { 1; }", "Error. Instructions are too long to jump to offset"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		err := New().Compile(program)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("Test failed. Expected an error starting with %q. Got <%v>", tt.expected, err)
+		}
+	}
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		compiler := New()
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("Test failed. Compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+		testInstructions(t, tt.input, tt.expectedInstructions, bytecode.Main.Instructions)
+		testConstants(t, tt.input, tt.expectedConstants, bytecode.Constants)
+	}
+}
+
+func parse(input string) *ast.Program {
+	p := parser.CreateParser(lexer.CreateLexer(input))
+	return p.ParseCardBoard()
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func testInstructions(t *testing.T, input string, expected []code.Instructions, actual code.Instructions) {
+	t.Helper()
+
+	concatted := concatInstructions(expected)
+	if concatted.String() != actual.String() {
+		t.Errorf("Test failed. Wrong instructions for <%s>.\nwant=\n%s\ngot=\n%s", input, concatted, actual)
+	}
+}
+
+func testConstants(t *testing.T, input string, expected []interface{}, actual []object.Object) {
+	t.Helper()
+
+	if len(expected) != len(actual) {
+		t.Errorf("Test failed. Expected %d constants for <%s>. Got <%d>", len(expected), input, len(actual))
+		return
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			integer, ok := actual[i].(*object.Integer)
+			if !ok || integer.Value != int64(constant) {
+				t.Errorf("Test failed. Expected constant %d to be %d. Got <%s>", i, constant, actual[i].Inspect())
+			}
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				t.Errorf("Test failed. Expected constant %d to be a compiled function. Got <%T>", i, actual[i])
+				continue
+			}
+			testInstructions(t, input, constant, fn.Instructions)
+		}
+	}
+}
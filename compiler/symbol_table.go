@@ -0,0 +1,116 @@
+package compiler
+
+import "cardboard/object"
+
+type SymbolScope string
+
+const (
+	GlobalScope SymbolScope = "GLOBAL"
+	LocalScope  SymbolScope = "LOCAL"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// Symbol tables map identifiers to slots. The outermost table holds the
+// globals, and every box body gets a table enclosed by the one it's defined in.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store map[string]Symbol
+	names []string
+
+	// Binding every slot falls back to while it isn't bound
+	fallbacks []object.Fallback
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol)}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Define binds name to a new slot, shadowing any previous definition.
+func (s *SymbolTable) Define(name string) Symbol {
+	symbol := Symbol{Name: name, Index: len(s.names), Scope: LocalScope}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	}
+
+	s.store[name] = symbol
+	s.names = append(s.names, name)
+	s.fallbacks = append(s.fallbacks, object.Fallback{})
+	return symbol
+}
+
+// DefineScoped binds name to a new slot like Define, until restore gives
+// name back the binding it had in this table.
+func (s *SymbolTable) DefineScoped(name string) (symbol Symbol, restore func()) {
+	previous, ok := s.store[name]
+	return s.Define(name), func() {
+		if ok {
+			s.store[name] = previous
+		} else {
+			delete(s.store, name)
+		}
+	}
+}
+
+// Declare binds name to a new slot unless it's already defined in this
+// table. Until the slot is bound, name refers to the binding it has in
+// the enclosing tables, made a global when there is none.
+func (s *SymbolTable) Declare(name string) Symbol {
+	if symbol, ok := s.store[name]; ok {
+		return symbol
+	}
+
+	symbol := s.Define(name)
+	if s.Outer != nil {
+		outer, depth, ok := s.Outer.Resolve(name)
+		if !ok {
+			outer = s.Global().Define(name)
+		}
+		if outer.Scope == GlobalScope {
+			s.fallbacks[symbol.Index] = object.Fallback{Kind: object.GlobalFallback, Index: outer.Index}
+		} else {
+			s.fallbacks[symbol.Index] = object.Fallback{Kind: object.FreeFallback, Depth: depth, Index: outer.Index}
+		}
+	}
+	return symbol
+}
+
+// Resolve looks name up in this table and the enclosing ones. depth is the
+// number of box bodies between the reference and the local definition.
+func (s *SymbolTable) Resolve(name string) (symbol Symbol, depth int, ok bool) {
+	for table := s; table != nil; table = table.Outer {
+		if symbol, ok := table.store[name]; ok {
+			return symbol, depth, true
+		}
+		depth++
+	}
+	return Symbol{}, 0, false
+}
+
+// Global returns the outermost table.
+func (s *SymbolTable) Global() *SymbolTable {
+	table := s
+	for table.Outer != nil {
+		table = table.Outer
+	}
+	return table
+}
+
+// Names returns the identifier of every slot, indexed by slot.
+func (s *SymbolTable) Names() []string { return s.names }
+
+// Fallbacks returns the binding every slot falls back to, indexed by slot.
+func (s *SymbolTable) Fallbacks() []object.Fallback { return s.fallbacks }
+
+func (s *SymbolTable) NumDefinitions() int { return len(s.names) }
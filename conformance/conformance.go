@@ -0,0 +1,51 @@
+// Package conformance runs programs on every execution backend,
+// so their results can be checked against each other, and against the
+// results golden files declare.
+package conformance
+
+import (
+	"cardboard/compiler"
+	"cardboard/eval"
+	"cardboard/object"
+	"cardboard/optimizer"
+	"cardboard/parser/ast"
+	"cardboard/vm"
+	"io"
+)
+
+// Backend executes a program, writing its output to out and returning its
+// result like eval.Eval does.
+type Backend struct {
+	Name string
+	Run  func(program *ast.Program, out io.Writer) object.Object
+}
+
+var Backends = []Backend{
+	{Name: "eval", Run: runEval},
+	{Name: "vm", Run: runVM},
+	{Name: "eval optimized", Run: optimized(runEval)},
+	{Name: "vm optimized", Run: optimized(runVM)},
+}
+
+func runEval(program *ast.Program, out io.Writer) object.Object {
+	env := object.CreateEnvironment()
+	env.SetOutput(out)
+	return eval.Eval(program, env)
+}
+
+// Runs programs after optimizing them
+func optimized(run func(program *ast.Program, out io.Writer) object.Object) func(program *ast.Program, out io.Writer) object.Object {
+	return func(program *ast.Program, out io.Writer) object.Object {
+		return run(optimizer.Optimize(program), out)
+	}
+}
+
+func runVM(program *ast.Program, out io.Writer) object.Object {
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return &object.Error{Kind: object.RUNTIME_ERROR, Message: err.Error()}
+	}
+	machine := vm.New(comp.Bytecode())
+	machine.SetOutput(out)
+	return machine.Run()
+}
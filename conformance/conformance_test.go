@@ -0,0 +1,270 @@
+package conformance
+
+import (
+	"bytes"
+	"cardboard/lexer"
+	"cardboard/object"
+	"cardboard/parser"
+	"cardboard/parser/ast"
+	"fmt"
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// Programs exercising scoping and control flow that the compiler handles
+// separately, run along with every program of the evaluator tests. See
+// evalTestPrograms.
+var programs = []string{
+	// Bindings made after the boxes referring to them
+	"put f = box() { g() }; put g = box() { 7 }; f();",
+	"put f = box() { put g = box() { y }; put y = 5; g() }; f();",
+	"put f = box() { put g = box() { y }; g() }; f();",
+	"x; put x = 1;",
+	"put f = box() { nope }; f();",
+
+	// Nested closures and recursion
+	"put a = box(x) { box(y) { box(z) { x + y + z } } }; a(1)(2)(3);",
+	"put count = box(n) { try { 1 / n; } catch (e) { unbox 0; } unbox 1 + count(n - 1); }; count(50);",
+	"put f = box() { put g = box(n) { try { 1 / n; } catch { unbox 100; } unbox g(n - 1) + 1; }; g(3) }; f();",
+	"box(a, a) { a }(1, 2);",
+
+	// Arity
+	"put f = box(a) { a }; f(1, 2);",
+	"put f = box(a, b) { a }; f(1);",
+
+	// Errors raised and caught across calls
+	"put f = box() { missing }; put g = f; try { g(); } catch (e) { e.trace; }",
+	"put f = box() { 1 / 0; }; put g = box() { try { f(); } catch (e) { throw e; } }; g();",
+	"put f = box() { try { 1 / 0; } finally { put a = 1; } }; box() { f() }();",
+	"try { throw box(x) { x * 2 }; } catch (e) { e.value(21); }",
+	"put kind = box(e) { e.kind }; try { 1 / 0; } catch (e) { kind(e); }",
+	"put f = box() { try { try { unbox 1; } finally { put a = 1; } } finally { put b = 2; } }; f();",
+	"put f = box() { try { unbox 1; } finally { throw 2; } }; try { f(); } catch (e) { e.value; }",
+	"put f = box() { try { throw 1; } catch (e) { throw 2; } finally { unbox 3; } }; f();",
+	"put f = box() { try { throw 1; } catch (e) { e.value + 10; } }; f();",
+	"put e = 5; try { 1 / 0; } catch (e) { 1; } e.kind;",
+	"put x = 1; put f = box() { put x = 2; x }; f() + x;",
+
+	// Calls in tail position
+	"put sum = box(n, acc) { try { 1 / n; } catch { unbox acc; } sum(n - 1, acc + n) }; sum(1000, 0);",
+	"put f = box(n) { try { 1 / n; } catch { unbox missing; } f(n - 1) }; f(3);",
+	"put f = box(n) { try { 1 / n; } catch { unbox missing; } unbox f(n - 1); }; box() { f(2) }();",
+	"put f = box(n, g) { try { 1 / n; } catch { unbox g(); } f(n - 1, box() { n }) }; f(3, box() { 0 });",
+	"put f = box(n) { try { 1 / n; } catch { unbox f(1, 2); } f(n - 1) }; f(2);",
+	"put g = box(n) { 1 / n }; put f = box(n) { g(n) }; f(0);",
+
+	// Programs the optimizer rewrites
+	"put a = 2 * 3; put b = a - 1; a * b;",
+	`put s = "card"; s + "board";`,
+	"put f = box() { a }; put a = 1; f();",
+	"put f = box() { a }; try { f(); } catch (e) { e.message; } put a = 1;",
+	"a + 1; put a = 1;",
+	"put a = 1; put f = box() { a }; put a = 2; f();",
+	"put a = 1; put f = box(a) { a }; f(5) + a;",
+	"put a = 1; try { 1 / 0; } catch (a) { a.kind; }",
+	"try { throw 1; put a = 2; } catch (e) { a; }",
+	"put f = box() { unbox 1; missing; }; f();",
+	"put f = box() { throw 1; put y = 2; }; try { f(); } catch (e) { e.value; }",
+	"put f = box() { put g = box() { y }; unbox g; put y = 5; }; f()();",
+	"put x = 1; put f = box() { unbox x; put x = 2; }; show(f());",
+	"put x = 1; put f = box() { throw x; put x = 2; }; try { f(); } catch (e) { show(e.value); }",
+	"put zero = 0; 10 / zero;",
+	"put n = 5; -n + +n * 2;",
+	"put a = 5; a(1);",
+	"put a = 5; a.kind;",
+	`"a" + 1;`,
+
+	// Type annotations are ignored at runtime
+	"put add = box(a: int, b: int) -> int { a + b }; put x: int = add(1, 2); x;",
+	`put f: box(int) -> string = box(n) { n }; f(1) + 1;`,
+
+	// Builtins
+	"assert(1);",
+	`assert("");`,
+	"put f = box() { assert(0); }; f();",
+	"assertEqual(1 + 1, 2);",
+	`assertEqual(2, "2");`,
+	`assertEqual("a" + "b", "ab");`,
+	"put f = box() {}; assertEqual(f(), f());",
+	"put f = box() { 1 }; assertEqual(f, f); assertEqual(f, box() { 1 });",
+	"put e = assertError(box() { 1 / 0; }); e.kind;",
+	"assertError(box() { 1; });",
+	"assertError(5);",
+	"assertError(box(x) { x }).message;",
+	"assertError(assert).message;",
+	"assert(1, 2);",
+	"assert;",
+	"put assert = 5; assert;",
+	"assert(1); put assert = 5;",
+	"put f = box() { assertEqual(1, 2); }; try { f(); } catch (e) { e.trace; }",
+	"put f = box(n) { assertError(box() { 1 / n }) }; f(0).trace;",
+	"put f = box() { missing }; assertError(box() { f() }).trace;",
+	"assertError(box() { assertError(box() { 2 }) }).message;",
+	"put f = box(n) { try { 1 / n; } catch { unbox 0; } assertError(box() { f(n - 1) }); unbox 1 + f(n - 1); }; f(3);",
+	`show(1); show("two"); show(box(x) { x }); show(show);`,
+	"put count = box(n) { try { 1 / n; } catch { unbox 0; } show(n); count(n - 1) }; count(3);",
+	"put f = box() { show(1); 1 / 0; show(2); }; try { f(); } catch (e) { show(e); }",
+	"show(1, 2);",
+	"put show = 1; show;",
+	// Recursion deeper than object.MaxCallDepth, caught or not
+	"put g = box(n) { try { g(n) } catch (e) { e.kind } }; show(g(1));",
+	"put g = box(n) { 1 + g(n) }; g(1);",
+}
+
+func TestBackendsAgree(t *testing.T) {
+	for _, input := range append(evalTestPrograms(t), programs...) {
+		reference, referenceOutput := run(t, Backends[0], input)
+
+		for _, backend := range Backends[1:] {
+			result, output := run(t, backend, input)
+			if !sameResult(reference, result) {
+				t.Errorf("Test failed. Backends disagree on <%s>.\n%s: %s\n%s: %s",
+					input,
+					Backends[0].Name, describe(reference),
+					backend.Name, describe(result))
+			}
+			if output != referenceOutput {
+				t.Errorf("Test failed. Backends disagree on the output of <%s>.\n%s: %q\n%s: %q",
+					input, Backends[0].Name, referenceOutput, backend.Name, output)
+			}
+		}
+	}
+}
+
+// Programs decoded from their JSON encoding run like the parsed programs
+func TestJSONRoundTrip(t *testing.T) {
+	for _, input := range append(evalTestPrograms(t), programs...) {
+		data, err := ast.EncodeJSON(parse(t, input))
+		if err != nil {
+			t.Fatalf("Test failed. Can't encode <%s>: %s", input, err)
+		}
+
+		for _, backend := range Backends {
+			decoded, err := ast.DecodeJSON(data)
+			if err != nil {
+				t.Fatalf("Test failed. Can't decode <%s>: %s", input, err)
+			}
+
+			expected, _ := run(t, backend, input)
+			result := backend.Run(decoded, io.Discard)
+			if !sameResult(expected, result) {
+				t.Errorf("Test failed. Decoded program <%s> runs differently on %s.\nparsed: %s\ndecoded: %s",
+					input, backend.Name, describe(expected), describe(result))
+			}
+		}
+	}
+}
+
+// Programs of the evaluator tests: the inputs of their test tables, the
+// strings assigned to input or test, and the strings passed to testEval
+func evalTestPrograms(t *testing.T) []string {
+	t.Helper()
+
+	file, err := goparser.ParseFile(gotoken.NewFileSet(), filepath.Join("..", "eval", "eval_test.go"), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inputs := []string{}
+	add := func(expr goast.Expr) {
+		lit, ok := expr.(*goast.BasicLit)
+		if !ok || lit.Kind != gotoken.STRING {
+			return
+		}
+		input, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, input)
+	}
+
+	goast.Inspect(file, func(node goast.Node) bool {
+		switch node := node.(type) {
+		case *goast.AssignStmt:
+			for idx, lhs := range node.Lhs {
+				if ident, ok := lhs.(*goast.Ident); ok && (ident.Name == "input" || ident.Name == "test") && idx < len(node.Rhs) {
+					add(node.Rhs[idx])
+				}
+			}
+		case *goast.CallExpr:
+			if fn, ok := node.Fun.(*goast.Ident); ok && fn.Name == "testEval" && len(node.Args) > 0 {
+				add(node.Args[0])
+			}
+		case *goast.CompositeLit:
+			if !isTestTable(node) {
+				return true
+			}
+			for _, elt := range node.Elts {
+				if tt, ok := elt.(*goast.CompositeLit); ok && len(tt.Elts) > 0 {
+					add(tt.Elts[0])
+				}
+			}
+		}
+		return true
+	})
+
+	if len(inputs) == 0 {
+		t.Fatal("Test failed. No programs in the evaluator tests")
+	}
+	return inputs
+}
+
+// Reports whether lit is a table of tests whose first field is the input
+func isTestTable(lit *goast.CompositeLit) bool {
+	array, ok := lit.Type.(*goast.ArrayType)
+	if !ok {
+		return false
+	}
+	tt, ok := array.Elt.(*goast.StructType)
+	if !ok || len(tt.Fields.List) == 0 || len(tt.Fields.List[0].Names) == 0 {
+		return false
+	}
+	return tt.Fields.List[0].Names[0].Name == "input"
+}
+
+// Runs a program, returning its result and output
+func run(t *testing.T, backend Backend, input string) (object.Object, string) {
+	var out bytes.Buffer
+	result := backend.Run(parse(t, input), &out)
+	return result, out.String()
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.CreateParser(lexer.CreateLexer(input))
+	program := p.ParseCardBoard()
+	if errs := p.GetErrors(); len(errs) > 0 {
+		t.Fatalf("Test failed. Parser errors for <%s>: %v", input, errs)
+	}
+	return program
+}
+
+func sameResult(expected object.Object, got object.Object) bool {
+	if expected.Type() != got.Type() {
+		return false
+	}
+
+	expectedErr, ok := expected.(*object.Error)
+	if !ok {
+		return expected.Inspect() == got.Inspect()
+	}
+
+	gotErr := got.(*object.Error)
+	return expectedErr.Kind == gotErr.Kind &&
+		expectedErr.Message == gotErr.Message &&
+		expectedErr.Line == gotErr.Line &&
+		expectedErr.Column == gotErr.Column &&
+		reflect.DeepEqual(expectedErr.Trace, gotErr.Trace)
+}
+
+func describe(obj object.Object) string {
+	if err, ok := obj.(*object.Error); ok {
+		return fmt.Sprintf("%s <%s> at %d:%d\n%s", err.Kind, err.Message, err.Line, err.Column, err.Traceback())
+	}
+	return fmt.Sprintf("%s <%s>", obj.Type(), obj.Inspect())
+}
@@ -0,0 +1,43 @@
+// Package corpus seeds the corpus of fuzz targets with the programs of
+// the golden files of the conformance tests. It only depends on the
+// standard library, so the tests of every package can use it.
+package corpus
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Add seeds the corpus of a fuzz target with seeds, followed by the
+// golden files of the conformance tests.
+func Add(f *testing.F, seeds ...string) {
+	f.Helper()
+
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		f.Fatal("Test failed. Can't find the golden files of the conformance tests")
+	}
+	dir := filepath.Join(filepath.Dir(file), "..", "testdata")
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !strings.HasSuffix(path, ".cb") {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err == nil {
+			f.Add(string(data))
+		}
+		return err
+	})
+	if err != nil {
+		f.Fatal(err)
+	}
+}
@@ -0,0 +1,118 @@
+package conformance
+
+import (
+	"cardboard/object"
+	"cardboard/parser/ast"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Golden files are scripts declaring how they run in annotations, comments
+// starting with one of the keys below:
+//
+//	< stdout: "hello" >        a line the script writes, in order
+//	< result: INTEGER "3" >    the type and value of the result of the script
+//	< error: ZeroDivisionError 2:5 "Division By Zero: \x3c1/0\x3e" >
+//
+// The error annotation gives the kind, position and message of the error
+// ending the script, in place of its result. Values are quoted like Go
+// strings, with '<' and '>' escaped since they'd end the comment.
+//
+// The golden files of testdata run on every backend with 'go test'.
+// 'go test ./conformance -update' rewrites their annotations from the
+// results of the first backend, at the end of each file.
+const (
+	StdoutKey = "stdout"
+	ResultKey = "result"
+	ErrorKey  = "error"
+)
+
+var annotationKeys = []string{StdoutKey, ResultKey, ErrorKey}
+
+// Annotations returns the annotations describing a run of a script from
+// its result and output: a stdout annotation for each line of the output,
+// followed by the result or the error.
+func Annotations(result object.Object, output string) []string {
+	annotations := []string{}
+	if output != "" {
+		for _, line := range strings.Split(strings.TrimSuffix(output, "\n"), "\n") {
+			annotations = append(annotations, StdoutKey+": "+quote(line))
+		}
+	}
+
+	if err, ok := result.(*object.Error); ok {
+		annotation := fmt.Sprintf("%s: %s %d:%d %s", ErrorKey, err.Kind, err.Line, err.Column, quote(err.Message))
+		return append(annotations, annotation)
+	}
+	return append(annotations, fmt.Sprintf("%s: %s %s", ResultKey, result.Type(), quote(result.Inspect())))
+}
+
+// ReadAnnotations returns the annotations among the comments of a script,
+// in source order
+func ReadAnnotations(program *ast.Program) []string {
+	annotations := []string{}
+	for _, comment := range program.Comments {
+		if text, ok := annotation(comment); ok {
+			annotations = append(annotations, text)
+		}
+	}
+	return annotations
+}
+
+// Annotate returns the source of a script with its annotations replaced
+// by the given ones, written on lines of their own at its end.
+func Annotate(source string, program *ast.Program, annotations []string) string {
+	lines := strings.Split(source, "\n")
+	removed := map[int]bool{}
+	for _, comment := range program.Comments {
+		if _, ok := annotation(comment); !ok {
+			continue
+		}
+
+		// Comments spanning several lines aren't annotations, the line
+		// of the comment holds all of it
+		idx := comment.NodeToken.Line - 1
+		if strings.TrimSpace(lines[idx]) == comment.String() {
+			removed[idx] = true
+		} else {
+			lines[idx] = strings.TrimRight(strings.Replace(lines[idx], comment.String(), "", 1), " \t")
+		}
+	}
+
+	var out strings.Builder
+	for idx, line := range lines {
+		if !removed[idx] {
+			out.WriteString(line + "\n")
+		}
+	}
+	annotated := strings.TrimRight(out.String(), " \t\n") + "\n\n"
+	if strings.TrimSpace(annotated) == "" {
+		annotated = ""
+	}
+	for _, annotation := range annotations {
+		annotated += "< " + annotation + " >\n"
+	}
+	return annotated
+}
+
+// Returns the text of a comment that is an annotation
+func annotation(comment *ast.Comment) (string, bool) {
+	text := strings.TrimSpace(comment.Text)
+	if strings.Contains(text, "\n") {
+		return "", false
+	}
+	for _, key := range annotationKeys {
+		if strings.HasPrefix(text, key+":") {
+			return text, true
+		}
+	}
+	return "", false
+}
+
+// Quotes a string like Go does, escaping the characters delimiting comments
+func quote(s string) string {
+	quoted := strconv.Quote(s)
+	quoted = strings.ReplaceAll(quoted, "<", `\x3c`)
+	return strings.ReplaceAll(quoted, ">", `\x3e`)
+}
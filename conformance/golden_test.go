@@ -0,0 +1,137 @@
+package conformance
+
+import (
+	"bytes"
+	"cardboard/lexer"
+	"cardboard/object"
+	"cardboard/parser"
+	"cardboard/parser/ast"
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the annotations of the golden files with the results of the first backend")
+
+// Runs the golden files of testdata on every backend
+func TestGolden(t *testing.T) {
+	paths := []string{}
+	err := filepath.WalkDir("testdata", func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() && strings.HasSuffix(path, ".cb") {
+			paths = append(paths, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("Test failed. No golden files in testdata")
+	}
+
+	for _, path := range paths {
+		path := path
+		t.Run(filepath.ToSlash(strings.TrimPrefix(path, "testdata"+string(filepath.Separator))), func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			source := string(data)
+
+			if *update {
+				program := parseGolden(t, source)
+				annotations := runGolden(t, Backends[0], source)
+				source = Annotate(source, program, annotations)
+				if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expected := ReadAnnotations(parseGolden(t, source))
+			if len(expected) == 0 {
+				t.Fatalf("Test failed. %s has no annotations, run the tests with -update to add them", path)
+			}
+
+			for _, backend := range Backends {
+				got := runGolden(t, backend, source)
+				if !reflect.DeepEqual(got, expected) {
+					t.Errorf("Test failed. %s runs differently on %s.\nexpected:\n  %s\ngot:\n  %s",
+						path, backend.Name, strings.Join(expected, "\n  "), strings.Join(got, "\n  "))
+				}
+			}
+		})
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	tests := []struct {
+		result   object.Object
+		output   string
+		expected []string
+	}{
+		{&object.Integer{Value: 3}, "", []string{`result: INTEGER "3"`}},
+		{&object.Null{}, "1\nsome <text>\n", []string{`stdout: "1"`, `stdout: "some \x3ctext\x3e"`, `result: NULL "null"`}},
+		{&object.Null{}, "\n", []string{`stdout: ""`, `result: NULL "null"`}},
+		{
+			&object.Error{Kind: object.ZERO_DIVISION_ERROR, Message: "Division By Zero: <1/0>", Line: 2, Column: 5},
+			"",
+			[]string{`error: ZeroDivisionError 2:5 "Division By Zero: \x3c1/0\x3e"`},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := Annotations(tt.result, tt.output); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Test failed. Expected annotations <%q>. Got <%q>", tt.expected, got)
+		}
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	source := `< Adds one >
+put f = box(x) { x + 1 };
+show(f(1)); < stdout: "1" >
+< result: INTEGER "5" >
+
+`
+	program := parseGolden(t, source)
+
+	if got := ReadAnnotations(program); !reflect.DeepEqual(got, []string{`stdout: "1"`, `result: INTEGER "5"`}) {
+		t.Errorf("Test failed. Wrong annotations read: <%q>", got)
+	}
+
+	expected := `< Adds one >
+put f = box(x) { x + 1 };
+show(f(1));
+
+< stdout: "2" >
+< result: NULL "null" >
+`
+	got := Annotate(source, program, []string{`stdout: "2"`, `result: NULL "null"`})
+	if got != expected {
+		t.Errorf("Test failed. Expected annotated source:\n%s\nGot:\n%s", expected, got)
+	}
+}
+
+func parseGolden(t *testing.T, source string) *ast.Program {
+	t.Helper()
+
+	p := parser.CreateParser(lexer.CreateLexer(source))
+	program := p.ParseCardBoard()
+	if errs := p.GetErrors(); len(errs) > 0 {
+		t.Fatalf("Test failed. Parser errors: %v", errs)
+	}
+	return program
+}
+
+// Runs a golden file, returning the annotations describing the run
+func runGolden(t *testing.T, backend Backend, source string) []string {
+	t.Helper()
+
+	var out bytes.Buffer
+	result := backend.Run(parseGolden(t, source), &out)
+	return Annotations(result, out.String())
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"cardboard/coverage"
+	"cardboard/lexer"
+	"cardboard/object"
+	"cardboard/parser"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Runs scripts on the evaluator, printing the times each of their lines
+// ran. Scripts aren't optimized, so the coverage matches the source.
+func coverCommand(args []string) int {
+	flags := flag.NewFlagSet("cover", flag.ExitOnError)
+	html := flags.String("html", "", "also write the coverage to `file` as an HTML page")
+	lcov := flags.String("lcov", "", "also write the coverage to `file` as an LCOV tracefile")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: cardboard cover [-html file] [-lcov file] script.cb...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	// Scripts failing still have their coverage reported
+	code := 0
+	files := []*coverage.File{}
+	for _, path := range flags.Args() {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		p := parser.CreateParser(lexer.CreateLexer(string(source)))
+		program := p.ParseCardBoard()
+		if errs := p.GetErrors(); len(errs) > 0 {
+			for _, err := range errs {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			}
+			return 1
+		}
+
+		file := coverage.New(path, string(source), program)
+		if err, ok := file.Run(object.CreateEnvironment()).(*object.Error); ok {
+			fmt.Fprintf(os.Stderr, "%s: Runtime Error [%d:%d]: %s\n", path, err.Line, err.Column, err.Message)
+			fmt.Fprint(os.Stderr, err.Traceback())
+			code = 1
+		}
+		files = append(files, file)
+	}
+
+	if err := coverage.WriteReport(os.Stdout, files); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, output := range []struct {
+		path  string
+		write func(io.Writer, []*coverage.File) error
+	}{{*html, coverage.WriteHTML}, {*lcov, coverage.WriteLCOV}} {
+		if output.path == "" {
+			continue
+		}
+		if err := writeFile(output.path, func(out io.Writer) error { return output.write(out, files) }); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	return code
+}
+
+// Creates a file and writes it, reporting the errors closing it
+func writeFile(path string, write func(out io.Writer) error) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,241 @@
+// Package coverage records which statements and branches of scripts run
+// on the evaluator, and reports it per line, as an annotated HTML page
+// of the sources, or in the LCOV format of coverage tools.
+//
+// Statements are counted where they start: lines holding no statement
+// aren't counted. The branches are the outcomes of 'try' statements with
+// a 'catch' block: the block ran without error, or the error was caught.
+package coverage
+
+import (
+	"cardboard/eval"
+	"cardboard/lexer/token"
+	"cardboard/object"
+	"cardboard/parser/ast"
+	"sort"
+)
+
+// File is the coverage of a script, recorded by the runs of its program
+type File struct {
+	Path   string
+	Source string
+
+	program *ast.Program
+
+	// Statements, in source order, and the times they ran
+	statements []ast.Statement
+	hits       map[ast.Statement]int
+
+	// 'try' statements with a 'catch' block, by block, and the times each
+	// outcome happened: ran without error, then caught an error
+	tries    []*ast.TryStatement
+	outcomes map[*ast.BlockStatement]*[2]int
+
+	// Boxes, in source order, and the times they were called
+	boxes []*ast.BoxExpression
+	calls map[*ast.BlockStatement]int
+
+	// Names of the boxes, from the bindings they are made by
+	names map[*ast.BoxExpression]string
+}
+
+func New(path string, source string, program *ast.Program) *File {
+	f := &File{
+		Path:     path,
+		Source:   source,
+		program:  program,
+		hits:     map[ast.Statement]int{},
+		outcomes: map[*ast.BlockStatement]*[2]int{},
+		calls:    map[*ast.BlockStatement]int{},
+		names:    map[*ast.BoxExpression]string{},
+	}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.PutStatement:
+			if box, ok := node.NodeExpression.(*ast.BoxExpression); ok {
+				f.names[box] = node.NodeIdentifier.Value
+			}
+		case *ast.TryStatement:
+			if node.Catch != nil {
+				f.tries = append(f.tries, node)
+				f.outcomes[node.Body] = &[2]int{}
+			}
+		case *ast.BoxExpression:
+			f.boxes = append(f.boxes, node)
+		}
+		if stmt, ok := node.(ast.Statement); ok && ast.Start(stmt).Line > 0 {
+			if _, ok := stmt.(*ast.BlockStatement); !ok {
+				f.statements = append(f.statements, stmt)
+			}
+		}
+		return true
+	})
+	return f
+}
+
+// Run runs the program of the file in env, recording its coverage, and
+// returns its result
+func (f *File) Run(env *object.Environment) object.Object {
+	eval.SetHook(env, f)
+	defer eval.SetHook(env, nil)
+	return eval.Eval(f.program, env)
+}
+
+// Hook of the evaluator
+
+func (f *File) Statement(stmt ast.Statement, env *object.Environment) {
+	f.hits[stmt]++
+}
+
+func (f *File) Call(fn *object.Box, call token.Token, env *object.Environment) {
+	f.calls[fn.Body]++
+}
+
+func (f *File) Return(fn *object.Box, result object.Object) {}
+
+// The outcome of a 'try' statement is the value of its block
+func (f *File) Node(node ast.Node, result object.Object, env *object.Environment) {
+	if block, ok := node.(*ast.BlockStatement); ok {
+		if outcome, ok := f.outcomes[block]; ok {
+			if result.Type() == object.ERROR_OBJ {
+				outcome[1]++
+			} else {
+				outcome[0]++
+			}
+		}
+	}
+}
+
+func (f *File) Bind(ident *ast.Identifier, val object.Object, env *object.Environment) {}
+
+// Coverage of a line holding statements
+type Line struct {
+	Number int
+
+	// Times the statements of the line ran, the most any of them did
+	Hits int
+
+	// Statements starting on the line, and how many of them ran
+	Statements int
+	Covered    int
+}
+
+// Lines returns the coverage of the lines holding statements, in order
+func (f *File) Lines() []Line {
+	lines := map[int]*Line{}
+	for _, stmt := range f.statements {
+		number := ast.Start(stmt).Line
+		line, ok := lines[number]
+		if !ok {
+			line = &Line{Number: number}
+			lines[number] = line
+		}
+
+		hits := f.hits[stmt]
+		line.Statements++
+		if hits > 0 {
+			line.Covered++
+		}
+		if hits > line.Hits {
+			line.Hits = hits
+		}
+	}
+
+	out := []Line{}
+	for _, line := range lines {
+		out = append(out, *line)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Number < out[j].Number })
+	return out
+}
+
+// Outcome of a 'try' statement
+type Branch struct {
+	Line int
+
+	// Index of the 'try' statement among the ones of the file, and of the
+	// outcome: 0 when the block ran without error, 1 when it was caught
+	Block  int
+	Branch int
+
+	// Times the outcome happened
+	Taken int
+
+	// The 'try' statement ran
+	Reached bool
+}
+
+// Branches returns the outcomes of the 'try' statements, in source order
+func (f *File) Branches() []Branch {
+	out := []Branch{}
+	for idx, try := range f.tries {
+		outcome := f.outcomes[try.Body]
+		for branch, taken := range outcome {
+			out = append(out, Branch{
+				Line:    ast.Start(try).Line,
+				Block:   idx,
+				Branch:  branch,
+				Taken:   taken,
+				Reached: f.hits[try] > 0,
+			})
+		}
+	}
+	return out
+}
+
+// Coverage of a box
+type Function struct {
+	Name string
+	Line int
+
+	// Times the box was called
+	Calls int
+}
+
+// Functions returns the boxes, in source order. Boxes are named after
+// the binding made with them, "<box>" when anonymous.
+func (f *File) Functions() []Function {
+	out := []Function{}
+	for _, box := range f.boxes {
+		name, ok := f.names[box]
+		if !ok {
+			name = "<box>"
+		}
+		out = append(out, Function{Name: name, Line: ast.Start(box).Line, Calls: f.calls[box.Body]})
+	}
+	return out
+}
+
+// Summary counts the statements and branches of the file, and the ones
+// covered
+type Summary struct {
+	Statements        int
+	CoveredStatements int
+	Branches          int
+	CoveredBranches   int
+}
+
+func (f *File) Summary() Summary {
+	s := Summary{Statements: len(f.statements)}
+	for _, stmt := range f.statements {
+		if f.hits[stmt] > 0 {
+			s.CoveredStatements++
+		}
+	}
+	for _, branch := range f.Branches() {
+		s.Branches++
+		if branch.Taken > 0 {
+			s.CoveredBranches++
+		}
+	}
+	return s
+}
+
+// Percent of a count, 100 when there is nothing to cover
+func percent(covered int, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(covered) / float64(total)
+}
@@ -0,0 +1,152 @@
+package coverage
+
+import (
+	"bytes"
+	"cardboard/lexer"
+	"cardboard/object"
+	"cardboard/parser"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const script = `put safeDivide = box(a, b) {
+    try {
+        unbox a / b;
+    } catch {
+        unbox 0;
+    }
+};
+put unused = box() { 1 };
+safeDivide(4, 2); put x = 1;
+safeDivide(1, 0);
+`
+
+func run(t *testing.T, source string) *File {
+	p := parser.CreateParser(lexer.CreateLexer(source))
+	program := p.ParseCardBoard()
+	if errs := p.GetErrors(); len(errs) > 0 {
+		t.Fatalf("Test failed. Parser errors: %q", errs)
+	}
+	f := New("test.cb", source, program)
+	f.Run(object.CreateEnvironment())
+	return f
+}
+
+func TestCoverage(t *testing.T) {
+	f := run(t, script)
+
+	lines := []Line{
+		{Number: 1, Hits: 1, Statements: 1, Covered: 1},
+		{Number: 2, Hits: 2, Statements: 1, Covered: 1},
+		{Number: 3, Hits: 2, Statements: 1, Covered: 1},
+		{Number: 5, Hits: 1, Statements: 1, Covered: 1},
+		{Number: 8, Hits: 1, Statements: 2, Covered: 1},
+		{Number: 9, Hits: 1, Statements: 2, Covered: 2},
+		{Number: 10, Hits: 1, Statements: 1, Covered: 1},
+	}
+	if got := f.Lines(); !reflect.DeepEqual(got, lines) {
+		t.Errorf("Test failed. Wrong lines.\nwant=%+v\ngot=%+v", lines, got)
+	}
+
+	branches := []Branch{
+		{Line: 2, Block: 0, Branch: 0, Taken: 1, Reached: true},
+		{Line: 2, Block: 0, Branch: 1, Taken: 1, Reached: true},
+	}
+	if got := f.Branches(); !reflect.DeepEqual(got, branches) {
+		t.Errorf("Test failed. Wrong branches.\nwant=%+v\ngot=%+v", branches, got)
+	}
+
+	functions := []Function{{Name: "safeDivide", Line: 1, Calls: 2}, {Name: "unused", Line: 8, Calls: 0}}
+	if got := f.Functions(); !reflect.DeepEqual(got, functions) {
+		t.Errorf("Test failed. Wrong functions.\nwant=%+v\ngot=%+v", functions, got)
+	}
+
+	summary := Summary{Statements: 9, CoveredStatements: 8, Branches: 2, CoveredBranches: 2}
+	if got := f.Summary(); got != summary {
+		t.Errorf("Test failed. Wrong summary.\nwant=%+v\ngot=%+v", summary, got)
+	}
+}
+
+func TestUnreachedBranches(t *testing.T) {
+	f := run(t, "put f = box() { try { 1; } catch (e) { 2; } };")
+	for _, branch := range f.Branches() {
+		if branch.Reached || branch.Taken != 0 {
+			t.Errorf("Test failed. Expected the branches of an uncalled box to be unreached. Got <%+v>", branch)
+		}
+	}
+	if got := f.Summary(); got.CoveredStatements != 1 || got.Statements != 4 {
+		t.Errorf("Test failed. Wrong summary: %+v", got)
+	}
+}
+
+func TestReport(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteReport(&out, []*File{run(t, script)}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `test.cb: 88.9% of statements, 100.0% of branches
+        1:    1:put safeDivide = box(a, b) {
+        2:    2:    try {
+        2:    3:        unbox a / b;
+        -:    4:    } catch {
+        1:    5:        unbox 0;
+        -:    6:    }
+        -:    7:};
+       1*:    8:put unused = box() { 1 };
+        1:    9:safeDivide(4, 2); put x = 1;
+        1:   10:safeDivide(1, 0);
+`
+	if out.String() != expected {
+		t.Errorf("Test failed. Wrong report.\nwant=%s\ngot=%s", expected, out.String())
+	}
+}
+
+func TestLCOV(t *testing.T) {
+	var out bytes.Buffer
+	f := run(t, "put f = box() { try { 1; } catch (e) { 2; } };\n")
+	if err := WriteLCOV(&out, []*File{f}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `TN:
+SF:test.cb
+FN:1,f
+FNDA:0,f
+FNF:1
+FNH:0
+BRDA:1,0,0,-
+BRDA:1,0,1,-
+BRF:2
+BRH:0
+DA:1,1
+LF:1
+LH:1
+end_of_record
+`
+	if out.String() != expected {
+		t.Errorf("Test failed. Wrong LCOV.\nwant=%s\ngot=%s", expected, out.String())
+	}
+}
+
+func TestHTML(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteHTML(&out, []*File{run(t, script+"\"<b> & <i>\";\n")}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"<h2>test.cb</h2>",
+		"<p>90.0% of statements, 100.0% of branches</p>",
+		`<tr class="covered"><td class="number">2</td><td class="hits">2</td><td class="text">    try {</td></tr>`,
+		`<tr class="none"><td class="number">4</td><td class="hits"></td><td class="text">    } catch {</td></tr>`,
+		`<tr class="partial"><td class="number">8</td>`,
+		`<td class="text">&#34;&lt;b&gt; &amp; &lt;i&gt;&#34;;</td>`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Test failed. Expected the page to contain %q. Got\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package coverage
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WriteReport writes the source of each file with the times each line
+// ran, in the layout of gcov: "-" for lines without statements, "#####"
+// for lines none of whose statements ran. Lines where only some of the
+// statements ran are marked by a "*".
+func WriteReport(out io.Writer, files []*File) error {
+	for idx, f := range files {
+		if idx > 0 {
+			if _, err := fmt.Fprintln(out); err != nil {
+				return err
+			}
+		}
+		s := f.Summary()
+		if _, err := fmt.Fprintf(out, "%s: %.1f%% of statements, %.1f%% of branches\n",
+			f.Path, percent(s.CoveredStatements, s.Statements), percent(s.CoveredBranches, s.Branches)); err != nil {
+			return err
+		}
+
+		lines := linesByNumber(f)
+		for number, text := range sourceLines(f) {
+			if _, err := fmt.Fprintf(out, "%9s:%5d:%s\n", hitsLabel(lines[number+1]), number+1, text); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func linesByNumber(f *File) map[int]*Line {
+	lines := map[int]*Line{}
+	for _, line := range f.Lines() {
+		line := line
+		lines[line.Number] = &line
+	}
+	return lines
+}
+
+// Lines of the source, without the empty line after a final newline
+func sourceLines(f *File) []string {
+	return strings.Split(strings.TrimSuffix(f.Source, "\n"), "\n")
+}
+
+func hitsLabel(line *Line) string {
+	switch {
+	case line == nil:
+		return "-"
+	case line.Covered == 0:
+		return "#####"
+	case line.Covered < line.Statements:
+		return strconv.Itoa(line.Hits) + "*"
+	}
+	return strconv.Itoa(line.Hits)
+}
+
+// WriteLCOV writes the coverage of the files as an LCOV tracefile: a
+// record for each file, of its boxes, lines and branches
+func WriteLCOV(out io.Writer, files []*File) error {
+	var b strings.Builder
+	for _, f := range files {
+		b.WriteString("TN:\n")
+		b.WriteString("SF:" + f.Path + "\n")
+
+		functions := f.Functions()
+		hit := 0
+		for _, fn := range functions {
+			fmt.Fprintf(&b, "FN:%d,%s\n", fn.Line, fn.Name)
+		}
+		for _, fn := range functions {
+			fmt.Fprintf(&b, "FNDA:%d,%s\n", fn.Calls, fn.Name)
+			if fn.Calls > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(&b, "FNF:%d\nFNH:%d\n", len(functions), hit)
+
+		branches := f.Branches()
+		hit = 0
+		for _, branch := range branches {
+			taken := "-"
+			if branch.Reached {
+				taken = strconv.Itoa(branch.Taken)
+			}
+			fmt.Fprintf(&b, "BRDA:%d,%d,%d,%s\n", branch.Line, branch.Block, branch.Branch, taken)
+			if branch.Taken > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(&b, "BRF:%d\nBRH:%d\n", len(branches), hit)
+
+		lines := f.Lines()
+		hit = 0
+		for _, line := range lines {
+			fmt.Fprintf(&b, "DA:%d,%d\n", line.Number, line.Hits)
+			if line.Hits > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(&b, "LF:%d\nLH:%d\n", len(lines), hit)
+		b.WriteString("end_of_record\n")
+	}
+
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// A line of the HTML page
+type htmlLine struct {
+	Number int
+	Hits   string
+	Text   string
+
+	// none, covered, partial or uncovered
+	Class string
+}
+
+type htmlFile struct {
+	Path       string
+	Statements string
+	Branches   string
+	Lines      []htmlLine
+}
+
+var htmlTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Coverage</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; font-family: monospace; }
+td { padding: 0 0.5em; white-space: pre; }
+td.number, td.hits { color: #888; text-align: right; }
+tr.covered td.text { background: #dfd; }
+tr.partial td.text { background: #ffd; }
+tr.uncovered td.text { background: #fdd; }
+</style>
+</head>
+<body>
+{{range .}}<h2>{{.Path}}</h2>
+<p>{{.Statements}} of statements, {{.Branches}} of branches</p>
+<table>
+{{range .Lines}}<tr class="{{.Class}}"><td class="number">{{.Number}}</td><td class="hits">{{.Hits}}</td><td class="text">{{.Text}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+// WriteHTML writes a page showing the source of each file, its lines
+// coloured by whether they ran, with the times they did
+func WriteHTML(out io.Writer, files []*File) error {
+	pages := []htmlFile{}
+	for _, f := range files {
+		s := f.Summary()
+		page := htmlFile{
+			Path:       f.Path,
+			Statements: fmt.Sprintf("%.1f%%", percent(s.CoveredStatements, s.Statements)),
+			Branches:   fmt.Sprintf("%.1f%%", percent(s.CoveredBranches, s.Branches)),
+		}
+
+		lines := linesByNumber(f)
+		for number, text := range sourceLines(f) {
+			line := htmlLine{Number: number + 1, Text: text, Class: "none"}
+			if l := lines[number+1]; l != nil {
+				line.Hits = strconv.Itoa(l.Hits)
+				switch {
+				case l.Covered == 0:
+					line.Class = "uncovered"
+				case l.Covered < l.Statements:
+					line.Class = "partial"
+				default:
+					line.Class = "covered"
+				}
+			}
+			page.Lines = append(page.Lines, line)
+		}
+		pages = append(pages, page)
+	}
+	return htmlTemplate.Execute(out, pages)
+}
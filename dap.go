@@ -0,0 +1,30 @@
+package main
+
+import (
+	"cardboard/dap"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Runs the debug adapter, talking to an editor over the standard
+// input and output
+func dapCommand(args []string) int {
+	flags := flag.NewFlagSet("dap", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: cardboard dap")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if err := dap.Serve(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
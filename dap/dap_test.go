@@ -0,0 +1,387 @@
+package dap
+
+import (
+	"cardboard/jsonrpc"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const program = `put add = box(a, b) {
+    put sum = a + b;
+    unbox sum;
+};
+put x = 1;
+
+put y = add(x, 2);
+try { throw "oops"; } catch (e) { add(y, 3); }
+`
+
+// Any message of the protocol, as the client reads it
+type message struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	Command    string          `json:"command"`
+	Event      string          `json:"event"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// In-process client, talking to a server over pipes
+type client struct {
+	t    *testing.T
+	conn *jsonrpc.Conn
+	path string
+
+	// Messages read from the server, and the events among them not looked
+	// at yet
+	messages chan *message
+	events   []*message
+
+	seq  int
+	done chan error
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	path := filepath.Join(t.TempDir(), "test.cb")
+	if err := os.WriteFile(path, []byte(program), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &client{
+		t:        t,
+		conn:     jsonrpc.NewConn(clientIn, clientOut),
+		path:     path,
+		messages: make(chan *message, 64),
+		done:     make(chan error, 1),
+	}
+	go func() {
+		c.done <- Serve(serverIn, serverOut)
+		serverOut.Close()
+	}()
+	go func() {
+		defer close(c.messages)
+		for {
+			msg := &message{}
+			if err := c.conn.Read(msg); err != nil {
+				return
+			}
+			c.messages <- msg
+		}
+	}()
+	t.Cleanup(func() { clientOut.Close() })
+	return c
+}
+
+// Sends a request, and decodes the body of its response. Returns the
+// message of a failed response.
+func (c *client) call(command string, args interface{}, body interface{}) string {
+	c.t.Helper()
+
+	c.seq++
+	req := Request{ProtocolMessage: ProtocolMessage{Seq: c.seq, Type: "request"}, Command: command}
+	if args != nil {
+		req.Arguments, _ = json.Marshal(args)
+	}
+	if err := c.conn.Write(req); err != nil {
+		c.t.Fatal(err)
+	}
+
+	for msg := range c.messages {
+		if msg.Type == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+		if msg.RequestSeq != c.seq || msg.Command != command {
+			c.t.Fatalf("Test failed. Expected the response to %s. Got <%+v>", command, msg)
+		}
+		if !msg.Success {
+			return msg.Message
+		}
+		if body != nil {
+			if err := json.Unmarshal(msg.Body, body); err != nil {
+				c.t.Fatalf("Test failed. Invalid body of %s: %s", command, err)
+			}
+		}
+		return ""
+	}
+	c.t.Fatalf("Test failed. No response to %s", command)
+	return ""
+}
+
+// Waits for the next event, which must have the given name
+func (c *client) event(name string, body interface{}) {
+	c.t.Helper()
+
+	for len(c.events) == 0 {
+		msg, ok := <-c.messages
+		if !ok {
+			c.t.Fatalf("Test failed. No %s event", name)
+		}
+		c.events = append(c.events, msg)
+	}
+	msg := c.events[0]
+	c.events = c.events[1:]
+
+	if msg.Type != "event" || msg.Event != name {
+		c.t.Fatalf("Test failed. Expected a %s event. Got <%+v>", name, msg)
+	}
+	if body != nil {
+		if err := json.Unmarshal(msg.Body, body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+}
+
+// Waits for the program to stop, returning the stack
+func (c *client) stopped(reason string) []StackFrame {
+	c.t.Helper()
+
+	var body StoppedEventBody
+	c.event("stopped", &body)
+	if body.Reason != reason {
+		c.t.Fatalf("Test failed. Expected to stop for %s. Got <%+v>", reason, body)
+	}
+
+	var trace StackTraceResponseBody
+	if msg := c.call("stackTrace", StackTraceArguments{ThreadID: threadID}, &trace); msg != "" {
+		c.t.Fatal(msg)
+	}
+	return trace.StackFrames
+}
+
+// Launches the program with breakpoints, and starts it
+func (c *client) launch(stopOnEntry bool, breakpoints ...SourceBreakpoint) []Breakpoint {
+	c.t.Helper()
+
+	var capabilities Capabilities
+	if msg := c.call("initialize", map[string]string{"adapterID": "cardboard"}, &capabilities); msg != "" {
+		c.t.Fatal(msg)
+	}
+	if !capabilities.SupportsConfigurationDoneRequest || !capabilities.SupportsConditionalBreakpoints {
+		c.t.Errorf("Test failed. Wrong capabilities: %+v", capabilities)
+	}
+
+	if msg := c.call("launch", LaunchArguments{Program: c.path, StopOnEntry: stopOnEntry}, nil); msg != "" {
+		c.t.Fatal(msg)
+	}
+	c.event("initialized", nil)
+
+	var body SetBreakpointsResponseBody
+	args := SetBreakpointsArguments{Source: Source{Path: c.path}, Breakpoints: breakpoints}
+	if msg := c.call("setBreakpoints", args, &body); msg != "" {
+		c.t.Fatal(msg)
+	}
+	if msg := c.call("configurationDone", nil, nil); msg != "" {
+		c.t.Fatal(msg)
+	}
+	return body.Breakpoints
+}
+
+// Describes the frames of a stack, as name:line
+func frames(stack []StackFrame) []string {
+	out := []string{}
+	for _, frame := range stack {
+		out = append(out, frame.Name+":"+itoa(frame.Line))
+	}
+	return out
+}
+
+func itoa(n int) string {
+	b, _ := json.Marshal(n)
+	return string(b)
+}
+
+func (c *client) variables(reference int) map[string]Variable {
+	c.t.Helper()
+
+	var body VariablesResponseBody
+	if msg := c.call("variables", VariablesArguments{VariablesReference: reference}, &body); msg != "" {
+		c.t.Fatal(msg)
+	}
+	variables := map[string]Variable{}
+	for _, v := range body.Variables {
+		variables[v.Name] = v
+	}
+	return variables
+}
+
+func (c *client) evaluate(expression string, frameID int) (string, string) {
+	c.t.Helper()
+
+	var body EvaluateResponseBody
+	msg := c.call("evaluate", EvaluateArguments{Expression: expression, FrameID: frameID, Context: "repl"}, &body)
+	return body.Result, msg
+}
+
+func TestSession(t *testing.T) {
+	c := newClient(t)
+
+	breakpoints := c.launch(true, SourceBreakpoint{Line: 3, Condition: "sum - 3"}, SourceBreakpoint{Line: 6}, SourceBreakpoint{Line: 20})
+	expected := []Breakpoint{
+		{ID: 3, Verified: true, Source: &Source{Name: "test.cb", Path: c.path}, Line: 3},
+		{ID: 7, Verified: true, Source: &Source{Name: "test.cb", Path: c.path}, Line: 7},
+		{Line: 20, Message: "No statement on or after line 20"},
+	}
+	if !reflect.DeepEqual(breakpoints, expected) {
+		t.Errorf("Test failed. Wrong breakpoints.\nwant=%+v\ngot=%+v", expected, breakpoints)
+	}
+
+	var threads ThreadsResponseBody
+	c.call("threads", nil, &threads)
+	if len(threads.Threads) != 1 || threads.Threads[0].ID != threadID {
+		t.Errorf("Test failed. Wrong threads: %+v", threads)
+	}
+
+	if stack := frames(c.stopped("entry")); !reflect.DeepEqual(stack, []string{"<main>:1"}) {
+		t.Errorf("Test failed. Wrong stack on entry: %q", stack)
+	}
+
+	c.call("next", ThreadArguments{ThreadID: threadID}, nil)
+	if stack := frames(c.stopped("step")); !reflect.DeepEqual(stack, []string{"<main>:5"}) {
+		t.Errorf("Test failed. Wrong stack after next: %q", stack)
+	}
+
+	c.call("continue", ThreadArguments{ThreadID: threadID}, nil)
+	if stack := frames(c.stopped("breakpoint")); !reflect.DeepEqual(stack, []string{"<main>:7"}) {
+		t.Errorf("Test failed. Wrong stack at the breakpoint: %q", stack)
+	}
+
+	c.call("stepIn", ThreadArguments{ThreadID: threadID}, nil)
+	if stack := frames(c.stopped("step")); !reflect.DeepEqual(stack, []string{"add:2", "<main>:7"}) {
+		t.Errorf("Test failed. Wrong stack after stepping in: %q", stack)
+	}
+
+	c.call("stepOut", ThreadArguments{ThreadID: threadID}, nil)
+	if stack := frames(c.stopped("step")); !reflect.DeepEqual(stack, []string{"<main>:8"}) {
+		t.Errorf("Test failed. Wrong stack after stepping out: %q", stack)
+	}
+
+	// The condition skips the first call, where sum is 3
+	c.call("continue", ThreadArguments{ThreadID: threadID}, nil)
+	stack := c.stopped("breakpoint")
+	if got := frames(stack); !reflect.DeepEqual(got, []string{"add:3", "<main>:8"}) {
+		t.Errorf("Test failed. Wrong stack at the conditional breakpoint: %q", got)
+	}
+
+	var scopes ScopesResponseBody
+	if msg := c.call("scopes", ScopesArguments{FrameID: stack[0].ID}, &scopes); msg != "" {
+		t.Fatal(msg)
+	}
+	if len(scopes.Scopes) != 2 || scopes.Scopes[0].Name != "add" || scopes.Scopes[1].Name != "<main>" {
+		t.Fatalf("Test failed. Wrong scopes: %+v", scopes)
+	}
+
+	locals := c.variables(scopes.Scopes[0].VariablesReference)
+	if locals["a"].Value != "3" || locals["b"].Value != "3" || locals["sum"].Value != "6" {
+		t.Errorf("Test failed. Wrong locals: %+v", locals)
+	}
+	globals := c.variables(scopes.Scopes[1].VariablesReference)
+	if globals["add"].Value != "box add(a, b)" || globals["y"].Value != "3" {
+		t.Errorf("Test failed. Wrong globals: %+v", globals)
+	}
+
+	// The exception is bound in the caller, its properties are children
+	c.call("scopes", ScopesArguments{FrameID: stack[1].ID}, &scopes)
+	caller := c.variables(scopes.Scopes[0].VariablesReference)
+	e, ok := caller["e"]
+	if !ok || e.Value != "UserError: oops" || e.VariablesReference == 0 {
+		t.Fatalf("Test failed. Wrong exception: %+v", caller)
+	}
+	if properties := c.variables(e.VariablesReference); properties["message"].Value != `"oops"` || properties["line"].Value != "8" {
+		t.Errorf("Test failed. Wrong properties of the exception: %+v", properties)
+	}
+
+	tests := []struct {
+		expression string
+		frameID    int
+		result     string
+		message    string
+	}{
+		{"sum * 2", 0, "12", ""},
+		{"add(sum, x)", stack[0].ID, "7", ""},
+		{"e.message", stack[1].ID, `"oops"`, ""},
+		{"sum", stack[1].ID, "", "Unknown identifier: sum."},
+		{"show(sum)", 0, "null", ""},
+		{"put z = 1;", 0, "", "Invalid expression <put z = 1;>: expected an expression, not a statement"},
+	}
+	for _, tt := range tests {
+		result, msg := c.evaluate(tt.expression, tt.frameID)
+		if result != tt.result || msg != tt.message {
+			t.Errorf("Test failed. Wrong evaluation of %s. want=%q %q, got=%q %q", tt.expression, tt.result, tt.message, result, msg)
+		}
+	}
+
+	// The output of the program is sent in events
+	var output OutputEventBody
+	c.event("output", &output)
+	if output.Category != "stdout" || output.Output != "6\n" {
+		t.Errorf("Test failed. Wrong output event: %+v", output)
+	}
+
+	c.call("continue", ThreadArguments{ThreadID: threadID}, nil)
+	var exited ExitedEventBody
+	c.event("exited", &exited)
+	if exited.ExitCode != 0 {
+		t.Errorf("Test failed. Expected the program to exit with 0. Got %d", exited.ExitCode)
+	}
+	c.event("terminated", nil)
+
+	if msg := c.call("stackTrace", StackTraceArguments{ThreadID: threadID}, nil); msg != "The program isn't stopped" {
+		t.Errorf("Test failed. Expected the stack of a finished program to be refused. Got <%s>", msg)
+	}
+	c.call("disconnect", nil, nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("Test failed. Server exited with <%s>", err)
+	}
+}
+
+func TestTerminate(t *testing.T) {
+	c := newClient(t)
+	c.launch(false, SourceBreakpoint{Line: 2})
+	c.stopped("breakpoint")
+
+	if msg := c.call("disconnect", nil, nil); msg != "" {
+		t.Fatal(msg)
+	}
+	c.event("exited", nil)
+	c.event("terminated", nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("Test failed. Server exited with <%s>", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	c := newClient(t)
+
+	if msg := c.call("threads", nil, nil); msg != "No program launched" {
+		t.Errorf("Test failed. Expected requests before launch to fail. Got <%s>", msg)
+	}
+	if msg := c.call("restart", nil, nil); msg != "Unknown command: restart" {
+		t.Errorf("Test failed. Expected an unknown command error. Got <%s>", msg)
+	}
+	if msg := c.call("launch", LaunchArguments{Program: filepath.Join(t.TempDir(), "missing.cb")}, nil); msg == "" {
+		t.Errorf("Test failed. Expected launching a missing script to fail.")
+	}
+
+	c.launch(false)
+	var body SetBreakpointsResponseBody
+	c.call("setBreakpoints", SetBreakpointsArguments{Source: Source{Path: "other.cb"}, Breakpoints: []SourceBreakpoint{{Line: 1}}}, &body)
+	if len(body.Breakpoints) != 1 || body.Breakpoints[0].Verified {
+		t.Errorf("Test failed. Expected breakpoints in another script to be unverified. Got <%+v>", body)
+	}
+
+	c.event("exited", nil)
+	c.event("terminated", nil)
+	if msg := c.call("continue", ThreadArguments{ThreadID: threadID}, nil); msg != "The program isn't stopped" {
+		t.Errorf("Test failed. Expected continuing a program that isn't stopped to fail. Got <%s>", msg)
+	}
+}
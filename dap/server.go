@@ -0,0 +1,522 @@
+// Package dap is a Debug Adapter Protocol server for cardboard scripts,
+// run by 'cardboard dap' over its standard input and output.
+//
+// The server debugs one script per session with the debugger package:
+// 'launch' parses the script, and it starts running once the client is
+// done configuring breakpoints. The program runs on its own goroutine,
+// waiting while it is stopped for the client to resume it. Messages are
+// framed like the ones of the Language Server Protocol.
+package dap
+
+import (
+	"cardboard/debugger"
+	"cardboard/jsonrpc"
+	"cardboard/lexer"
+	"cardboard/object"
+	"cardboard/parser"
+	"cardboard/parser/ast"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Programs have a single thread
+const threadID = 1
+
+type Server struct {
+	conn *jsonrpc.Conn
+
+	debugger *debugger.Debugger
+
+	// Script launched, nil before 'launch'
+	program *ast.Program
+	path    string
+
+	// The program started running, and the channel closed when it ends
+	started bool
+	done    chan struct{}
+
+	// Runs once the response to the current request is sent
+	then func()
+
+	// Guards the fields below, shared with the goroutine of the program
+	mu  sync.Mutex
+	seq int
+
+	// Channel resuming the program, nil while it runs
+	resume chan debugger.Action
+
+	// The program is being terminated, it ends at its next statement
+	terminating bool
+
+	// Values the client can ask the properties of, by variables reference
+	// minus one. They are valid until the program resumes.
+	handles []handle
+}
+
+// Bindings of a scope of a frame, or the properties of an exception
+type handle struct {
+	frame     int
+	scope     int
+	exception *object.Exception
+}
+
+func NewServer(conn *jsonrpc.Conn) *Server {
+	s := &Server{conn: conn, done: make(chan struct{})}
+	s.debugger = debugger.New(s.stopped)
+	return s
+}
+
+// Serve runs a server reading messages from in and writing to out.
+func Serve(in io.Reader, out io.Writer) error {
+	return NewServer(jsonrpc.NewConn(in, out)).Run()
+}
+
+// Run answers requests until the client sends 'disconnect' or closes the
+// stream, terminating the program if it is still running.
+func (s *Server) Run() error {
+	defer s.terminate()
+
+	for {
+		var req Request
+		err := s.conn.Read(&req)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Responses and events from the client: it sends none we use
+		if req.Type != "request" {
+			continue
+		}
+
+		body, err := s.handle(&req)
+		resp := &Response{
+			ProtocolMessage: ProtocolMessage{Type: "response"},
+			RequestSeq:      req.Seq,
+			Success:         err == nil,
+			Command:         req.Command,
+			Body:            body,
+		}
+		if err != nil {
+			resp.Message = err.Error()
+		}
+		if err := s.send(resp, &resp.ProtocolMessage); err != nil {
+			return err
+		}
+
+		if s.then != nil {
+			then := s.then
+			s.then = nil
+			then()
+		}
+		if req.Command == "disconnect" {
+			return nil
+		}
+	}
+}
+
+// Sends a message, numbering it
+func (s *Server) send(msg interface{}, header *ProtocolMessage) error {
+	s.mu.Lock()
+	s.seq++
+	header.Seq = s.seq
+	s.mu.Unlock()
+	return s.conn.Write(msg)
+}
+
+func (s *Server) event(name string, body interface{}) error {
+	ev := &Event{ProtocolMessage: ProtocolMessage{Type: "event"}, Event: name, Body: body}
+	return s.send(ev, &ev.ProtocolMessage)
+}
+
+type handler func(s *Server, args json.RawMessage) (interface{}, error)
+
+var handlers = map[string]handler{
+	"initialize":        (*Server).initialize,
+	"launch":            (*Server).launch,
+	"setBreakpoints":    (*Server).setBreakpoints,
+	"configurationDone": (*Server).configurationDone,
+	"threads":           (*Server).threads,
+	"stackTrace":        (*Server).stackTrace,
+	"scopes":            (*Server).scopes,
+	"variables":         (*Server).variables,
+	"evaluate":          (*Server).evaluate,
+	"continue":          resumeHandler(debugger.Continue),
+	"next":              resumeHandler(debugger.StepOver),
+	"stepIn":            resumeHandler(debugger.StepInto),
+	"stepOut":           resumeHandler(debugger.StepOut),
+	"pause":             (*Server).pause,
+	"terminate":         (*Server).terminateRequest,
+	"disconnect":        (*Server).terminateRequest,
+}
+
+func (s *Server) handle(req *Request) (interface{}, error) {
+	handle, ok := handlers[req.Command]
+	if !ok {
+		return nil, fmt.Errorf("Unknown command: %s", req.Command)
+	}
+	if s.program == nil && req.Command != "initialize" && req.Command != "launch" && req.Command != "disconnect" {
+		return nil, errors.New("No program launched")
+	}
+	return handle(s, req.Arguments)
+}
+
+func decode(args json.RawMessage, v interface{}) error {
+	if len(args) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(args, v); err != nil {
+		return fmt.Errorf("Invalid arguments: %s", err)
+	}
+	return nil
+}
+
+func (s *Server) initialize(json.RawMessage) (interface{}, error) {
+	return Capabilities{
+		SupportsConfigurationDoneRequest: true,
+		SupportsConditionalBreakpoints:   true,
+		SupportsEvaluateForHovers:        true,
+		SupportsTerminateRequest:         true,
+	}, nil
+}
+
+// Parses the script, ready for the client to set breakpoints in it
+func (s *Server) launch(args json.RawMessage) (interface{}, error) {
+	var a LaunchArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	if s.program != nil {
+		return nil, errors.New("A program is already launched")
+	}
+
+	source, err := os.ReadFile(a.Program)
+	if err != nil {
+		return nil, err
+	}
+	p := parser.CreateParser(lexer.CreateLexer(string(source)))
+	program := p.ParseCardBoard()
+	if errs := p.GetErrors(); len(errs) > 0 {
+		return nil, fmt.Errorf("%s: %s", a.Program, strings.TrimSpace(errs[0]))
+	}
+
+	s.program, s.path = program, a.Program
+	s.debugger.StopOnEntry = a.StopOnEntry
+	s.then = func() { s.event("initialized", nil) }
+	return nil, nil
+}
+
+// Replaces the breakpoints, moving each to the first line at or after it
+// holding a statement
+func (s *Server) setBreakpoints(args json.RawMessage) (interface{}, error) {
+	var a SetBreakpointsArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+
+	breakpoints := []Breakpoint{}
+	if !samePath(a.Source.Path, s.path) {
+		for _, sbp := range a.Breakpoints {
+			breakpoints = append(breakpoints, Breakpoint{Line: sbp.Line, Message: "Breakpoints can only be set in the program debugged"})
+		}
+		return SetBreakpointsResponseBody{Breakpoints: breakpoints}, nil
+	}
+
+	for _, bp := range s.debugger.Breakpoints() {
+		s.debugger.ClearBreakpoint(bp.Line)
+	}
+
+	lines := debugger.StatementLines(s.program)
+	for _, sbp := range a.Breakpoints {
+		line := 0
+		for _, l := range lines {
+			if l >= sbp.Line {
+				line = l
+				break
+			}
+		}
+		if line == 0 {
+			breakpoints = append(breakpoints, Breakpoint{Line: sbp.Line, Message: fmt.Sprintf("No statement on or after line %d", sbp.Line)})
+			continue
+		}
+
+		if _, err := s.debugger.SetBreakpoint(line, sbp.Condition); err != nil {
+			breakpoints = append(breakpoints, Breakpoint{Line: sbp.Line, Message: err.Error()})
+			continue
+		}
+		breakpoints = append(breakpoints, Breakpoint{ID: line, Verified: true, Source: s.source(), Line: line})
+	}
+	return SetBreakpointsResponseBody{Breakpoints: breakpoints}, nil
+}
+
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+func (s *Server) source() *Source {
+	return &Source{Name: filepath.Base(s.path), Path: s.path}
+}
+
+// Starts the program
+func (s *Server) configurationDone(json.RawMessage) (interface{}, error) {
+	if s.started {
+		return nil, errors.New("The program is already running")
+	}
+	s.started = true
+	s.then = func() { go s.run() }
+	return nil, nil
+}
+
+// Runs the program, reporting how it ends
+func (s *Server) run() {
+	defer close(s.done)
+
+	exitCode := 0
+	env := object.CreateEnvironment()
+	env.SetOutput(output{s})
+	result := s.debugger.Run(s.program, env)
+	if err, ok := result.(*object.Error); ok {
+		s.event("output", OutputEventBody{
+			Category: "stderr",
+			Output:   fmt.Sprintf("Runtime Error [%d:%d]: %s\n%s", err.Line, err.Column, err.Message, err.Traceback()),
+		})
+		exitCode = 1
+	}
+
+	s.event("exited", ExitedEventBody{ExitCode: exitCode})
+	s.event("terminated", nil)
+}
+
+// Output of the program, sent to the client in output events since the
+// standard output carries the protocol
+type output struct {
+	s *Server
+}
+
+func (o output) Write(p []byte) (int, error) {
+	if err := o.s.event("output", OutputEventBody{Category: "stdout", Output: string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Handler of the debugger, called on the goroutine of the program: tells
+// the client and waits for it to resume the program
+func (s *Server) stopped(d *debugger.Debugger, stop debugger.Stop) debugger.Action {
+	s.mu.Lock()
+	if s.terminating {
+		s.mu.Unlock()
+		return debugger.Terminate
+	}
+	resume := make(chan debugger.Action)
+	s.resume = resume
+	s.mu.Unlock()
+
+	body := StoppedEventBody{Reason: stop.Reason, ThreadID: threadID, AllThreadsStopped: true}
+	if stop.Breakpoint != nil {
+		body.HitBreakpointIDs = []int{stop.Breakpoint.Line}
+	}
+	if stop.ConditionError != nil {
+		body.Description = "Breakpoint condition failed"
+		body.Text = stop.ConditionError.Message
+	}
+	s.event("stopped", body)
+	return <-resume
+}
+
+// Channel resuming the program, nil while it runs
+func (s *Server) paused() chan debugger.Action {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resume
+}
+
+var errNotStopped = errors.New("The program isn't stopped")
+
+func resumeHandler(action debugger.Action) handler {
+	return func(s *Server, args json.RawMessage) (interface{}, error) {
+		resume := s.paused()
+		if resume == nil {
+			return nil, errNotStopped
+		}
+
+		s.mu.Lock()
+		s.resume, s.handles = nil, nil
+		s.mu.Unlock()
+
+		// The program resumes once the client knows it does
+		s.then = func() { resume <- action }
+		if action == debugger.Continue {
+			return ContinueResponseBody{AllThreadsContinued: true}, nil
+		}
+		return nil, nil
+	}
+}
+
+func (s *Server) pause(json.RawMessage) (interface{}, error) {
+	if s.paused() == nil {
+		s.debugger.Pause()
+	}
+	return nil, nil
+}
+
+func (s *Server) terminateRequest(json.RawMessage) (interface{}, error) {
+	s.terminate()
+	return nil, nil
+}
+
+// Ends the program if it is running, and waits for it to end
+func (s *Server) terminate() {
+	if !s.started {
+		return
+	}
+
+	s.mu.Lock()
+	s.terminating = true
+	resume := s.resume
+	s.resume, s.handles = nil, nil
+	s.mu.Unlock()
+
+	if resume != nil {
+		resume <- debugger.Terminate
+	} else {
+		s.debugger.Pause()
+	}
+	<-s.done
+}
+
+func (s *Server) threads(json.RawMessage) (interface{}, error) {
+	return ThreadsResponseBody{Threads: []Thread{{ID: threadID, Name: "main"}}}, nil
+}
+
+// Frames are numbered from one, the innermost frame first
+func (s *Server) stackTrace(args json.RawMessage) (interface{}, error) {
+	var a StackTraceArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	if s.paused() == nil {
+		return nil, errNotStopped
+	}
+
+	stack := s.debugger.Stack()
+	frames := []StackFrame{}
+	for idx, frame := range stack {
+		if idx < a.StartFrame || (a.Levels > 0 && idx >= a.StartFrame+a.Levels) {
+			continue
+		}
+		frames = append(frames, StackFrame{
+			ID:     idx + 1,
+			Name:   frame.Function,
+			Source: s.source(),
+			Line:   frame.Line,
+			Column: frame.Column,
+		})
+	}
+	return StackTraceResponseBody{StackFrames: frames, TotalFrames: len(stack)}, nil
+}
+
+func (s *Server) scopes(args json.RawMessage) (interface{}, error) {
+	var a ScopesArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	if s.paused() == nil {
+		return nil, errNotStopped
+	}
+
+	frame := a.FrameID - 1
+	scopes := s.debugger.Scopes(frame)
+	if scopes == nil {
+		return nil, fmt.Errorf("No frame %d", a.FrameID)
+	}
+
+	body := ScopesResponseBody{Scopes: []Scope{}}
+	for idx, scope := range scopes {
+		body.Scopes = append(body.Scopes, Scope{Name: scope.Name, VariablesReference: s.newHandle(handle{frame: frame, scope: idx})})
+	}
+	return body, nil
+}
+
+func (s *Server) newHandle(h handle) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handles = append(s.handles, h)
+	return len(s.handles)
+}
+
+func (s *Server) variables(args json.RawMessage) (interface{}, error) {
+	var a VariablesArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	if s.paused() == nil {
+		return nil, errNotStopped
+	}
+
+	s.mu.Lock()
+	if a.VariablesReference < 1 || a.VariablesReference > len(s.handles) {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("Unknown variables reference: %d", a.VariablesReference)
+	}
+	h := s.handles[a.VariablesReference-1]
+	s.mu.Unlock()
+
+	body := VariablesResponseBody{Variables: []Variable{}}
+	if h.exception != nil {
+		for _, name := range []string{"message", "kind", "value", "line", "column"} {
+			value, _ := h.exception.Property(name)
+			body.Variables = append(body.Variables, s.variable(name, value))
+		}
+		return body, nil
+	}
+
+	for _, variable := range s.debugger.Scopes(h.frame)[h.scope].Variables {
+		body.Variables = append(body.Variables, s.variable(variable.Name, variable.Value))
+	}
+	return body, nil
+}
+
+// Exceptions have their properties as children
+func (s *Server) variable(name string, value object.Object) Variable {
+	v := Variable{Name: name, Value: debugger.Display(value)}
+	if ex, ok := value.(*object.Exception); ok {
+		v.VariablesReference = s.newHandle(handle{exception: ex})
+	}
+	return v
+}
+
+func (s *Server) evaluate(args json.RawMessage) (interface{}, error) {
+	var a EvaluateArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	if s.paused() == nil {
+		return nil, errNotStopped
+	}
+
+	frame := 0
+	if a.FrameID > 0 {
+		frame = a.FrameID - 1
+	}
+	value, err := s.debugger.Evaluate(a.Expression, frame)
+	if err != nil {
+		return nil, err
+	}
+	if err, ok := value.(*object.Error); ok {
+		return nil, errors.New(err.Message)
+	}
+
+	v := s.variable("", value)
+	return EvaluateResponseBody{Result: v.Value, VariablesReference: v.VariablesReference}, nil
+}
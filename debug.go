@@ -0,0 +1,59 @@
+package main
+
+import (
+	"cardboard/debugger"
+	"cardboard/lexer"
+	"cardboard/object"
+	"cardboard/parser"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Runs a script on the evaluator under the console debugger, stopped
+// before its first line. Scripts aren't optimized, so they run as written.
+func debugCommand(args []string) int {
+	flags := flag.NewFlagSet("debug", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: cardboard debug script.cb")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	source, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	p := parser.CreateParser(lexer.CreateLexer(string(source)))
+	program := p.ParseCardBoard()
+	if errs := p.GetErrors(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return 1
+	}
+
+	console := debugger.NewConsole(os.Stdin, os.Stdout, string(source))
+	d := debugger.New(console.Stopped)
+	d.StopOnEntry = true
+
+	result := d.Run(program, object.CreateEnvironment())
+	switch result := result.(type) {
+	case nil:
+		fmt.Println("Program terminated")
+	case *object.Error:
+		fmt.Fprintf(os.Stderr, "Runtime Error [%d:%d]: %s\n", result.Line, result.Column, result.Message)
+		fmt.Fprint(os.Stderr, result.Traceback())
+		return 1
+	default:
+		fmt.Println("Program finished")
+	}
+	return 0
+}
@@ -0,0 +1,228 @@
+package debugger
+
+import (
+	"bufio"
+	"cardboard/object"
+	"cardboard/parser/ast"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const consoleHelp = `Commands:
+  break LINE [if EXPR]  set a breakpoint, stopping only when EXPR is true
+  clear LINE            remove the breakpoint of a line
+  breakpoints           list the breakpoints
+  continue, c           run until a breakpoint
+  step, s               run to the next line, entering calls
+  next, n               run to the next line of the current call
+  out, o                run until the current call returns
+  stack, bt             list the running calls
+  frame N, f N          select the call to inspect, 0 being the innermost
+  vars, v               list the bindings visible from the selected call
+  print EXPR, p EXPR    evaluate an expression in the selected call
+  list, l               show the source around the current line
+  help, h               show this help
+  quit, q               end the program
+`
+
+// Console drives a debugger with commands read line by line, printing
+// where the program stops and what the commands find.
+type Console struct {
+	in  *bufio.Scanner
+	out io.Writer
+
+	// Lines of the source of the program
+	lines []string
+
+	// Call selected by 'frame', counted from the innermost one
+	frame int
+}
+
+func NewConsole(in io.Reader, out io.Writer, source string) *Console {
+	return &Console{in: bufio.NewScanner(in), out: out, lines: strings.Split(source, "\n")}
+}
+
+// Stopped is the handler of the debugger: it reads commands until one
+// resumes the program. The end of the input ends the program.
+func (c *Console) Stopped(d *Debugger, stop Stop) Action {
+	c.frame = 0
+	c.printStop(d, stop)
+
+	for {
+		fmt.Fprint(c.out, "(debug) ")
+		if !c.in.Scan() {
+			fmt.Fprintln(c.out)
+			return Terminate
+		}
+
+		command, arg, _ := strings.Cut(strings.TrimSpace(c.in.Text()), " ")
+		arg = strings.TrimSpace(arg)
+
+		switch command {
+		case "":
+		case "continue", "c":
+			return Continue
+		case "step", "s":
+			return StepInto
+		case "next", "n":
+			return StepOver
+		case "out", "o":
+			return StepOut
+		case "quit", "q":
+			return Terminate
+		case "break", "b":
+			c.setBreakpoint(d, arg)
+		case "clear":
+			line, err := strconv.Atoi(arg)
+			if err != nil {
+				fmt.Fprintln(c.out, "usage: clear LINE")
+			} else if !d.ClearBreakpoint(line) {
+				fmt.Fprintf(c.out, "No breakpoint on line %d\n", line)
+			}
+		case "breakpoints":
+			c.printBreakpoints(d)
+		case "stack", "bt":
+			c.printStack(d)
+		case "frame", "f":
+			frame, err := strconv.Atoi(arg)
+			if err != nil || frame < 0 || frame >= len(d.Stack()) {
+				fmt.Fprintf(c.out, "No frame %s\n", arg)
+				continue
+			}
+			c.frame = frame
+			c.printStack(d)
+		case "vars", "v":
+			c.printScopes(d)
+		case "print", "p":
+			value, err := d.Evaluate(arg, c.frame)
+			if err != nil {
+				fmt.Fprintln(c.out, err)
+			} else {
+				fmt.Fprintln(c.out, Display(value))
+			}
+		case "list", "l":
+			frame := d.Stack()[c.frame]
+			c.printSource(frame.Line, 3)
+		case "help", "h":
+			fmt.Fprint(c.out, consoleHelp)
+		default:
+			fmt.Fprintf(c.out, "Unknown command: %s. Type help for the list of commands.\n", command)
+		}
+	}
+}
+
+func (c *Console) printStop(d *Debugger, stop Stop) {
+	function := d.Stack()[0].Function
+	switch stop.Reason {
+	case ReasonBreakpoint:
+		fmt.Fprintf(c.out, "Breakpoint at %d:%d, in %s\n", stop.Line, stop.Column, function)
+		if stop.ConditionError != nil {
+			fmt.Fprintf(c.out, "Condition <%s> failed: %s\n", stop.Breakpoint.Condition, stop.ConditionError.Message)
+		}
+	default:
+		fmt.Fprintf(c.out, "Stopped at %d:%d, in %s\n", stop.Line, stop.Column, function)
+	}
+	c.printSource(stop.Line, 0)
+}
+
+// Prints the lines around a line, marking it
+func (c *Console) printSource(line int, context int) {
+	for idx := line - context; idx <= line+context; idx++ {
+		if idx < 1 || idx > len(c.lines) {
+			continue
+		}
+		marker := " "
+		if idx == line {
+			marker = ">"
+		}
+		fmt.Fprintf(c.out, "%s %4d  %s\n", marker, idx, c.lines[idx-1])
+	}
+}
+
+func (c *Console) setBreakpoint(d *Debugger, arg string) {
+	lineArg, condition, _ := strings.Cut(arg, " ")
+	condition = strings.TrimSpace(condition)
+	if condition != "" {
+		if !strings.HasPrefix(condition, "if ") {
+			fmt.Fprintln(c.out, "usage: break LINE [if EXPR]")
+			return
+		}
+		condition = strings.TrimPrefix(condition, "if ")
+	}
+
+	line, err := strconv.Atoi(lineArg)
+	if err != nil || line < 1 {
+		fmt.Fprintln(c.out, "usage: break LINE [if EXPR]")
+		return
+	}
+
+	bp, err := d.SetBreakpoint(line, condition)
+	if err != nil {
+		fmt.Fprintln(c.out, err)
+		return
+	}
+	fmt.Fprintln(c.out, describeBreakpoint(bp))
+}
+
+func describeBreakpoint(bp *Breakpoint) string {
+	out := fmt.Sprintf("Breakpoint on line %d", bp.Line)
+	if bp.Condition != "" {
+		out += " if " + bp.Condition
+	}
+	return out
+}
+
+func (c *Console) printBreakpoints(d *Debugger) {
+	breakpoints := d.Breakpoints()
+	if len(breakpoints) == 0 {
+		fmt.Fprintln(c.out, "No breakpoints")
+	}
+	for _, bp := range breakpoints {
+		fmt.Fprintf(c.out, "%s, hit %d times\n", describeBreakpoint(bp), bp.Hits)
+	}
+}
+
+func (c *Console) printStack(d *Debugger) {
+	for idx, frame := range d.Stack() {
+		marker := " "
+		if idx == c.frame {
+			marker = ">"
+		}
+		fmt.Fprintf(c.out, "%s #%d %s at %d:%d", marker, idx, frame.Function, frame.Line, frame.Column)
+		if frame.CallLine > 0 {
+			fmt.Fprintf(c.out, ", called at %d:%d", frame.CallLine, frame.CallColumn)
+		}
+		fmt.Fprintln(c.out)
+	}
+}
+
+func (c *Console) printScopes(d *Debugger) {
+	for _, scope := range d.Scopes(c.frame) {
+		fmt.Fprintf(c.out, "%s:\n", scope.Name)
+		for _, variable := range scope.Variables {
+			fmt.Fprintf(c.out, "  %s = %s\n", variable.Name, Display(variable.Value))
+		}
+	}
+}
+
+// Display renders a value the way it is written in scripts where possible
+func Display(value object.Object) string {
+	switch value := value.(type) {
+	case *object.String:
+		return ast.QuoteString(value.Value)
+	case *object.Box:
+		params := []string{}
+		for _, param := range value.ParameterList {
+			params = append(params, param.Value)
+		}
+		if value.Name == "" {
+			return "box(" + strings.Join(params, ", ") + ")"
+		}
+		return "box " + value.Name + "(" + strings.Join(params, ", ") + ")"
+	case *object.Error:
+		return "error: " + value.Message
+	}
+	return value.Inspect()
+}
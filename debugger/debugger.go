@@ -0,0 +1,539 @@
+// Package debugger runs programs on the evaluator, stopping them at
+// breakpoints and after steps to let their state be inspected.
+//
+// Execution stops at statements, only at the first statement of a line
+// for each call, so a line holding several statements is stepped over at
+// once. While a program is stopped, the handler of the debugger is called
+// with the reason; it inspects the program and returns how to resume it.
+package debugger
+
+import (
+	"cardboard/eval"
+	"cardboard/lexer"
+	"cardboard/lexer/token"
+	"cardboard/object"
+	"cardboard/parser"
+	"cardboard/parser/ast"
+	"cardboard/resolver"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// How to resume a stopped program
+type Action int
+
+const (
+	// Run until a breakpoint
+	Continue Action = iota
+
+	// Stop at the next line, entering the boxes it calls
+	StepInto
+
+	// Stop at the next line of the current call, or of its caller when
+	// the call ends
+	StepOver
+
+	// Stop once the current call returns
+	StepOut
+
+	// End the program where it stopped
+	Terminate
+)
+
+// Reasons programs stop for
+const (
+	ReasonEntry      = "entry"
+	ReasonBreakpoint = "breakpoint"
+	ReasonStep       = "step"
+	ReasonPause      = "pause"
+)
+
+// Why a program stopped, and where
+type Stop struct {
+	Reason string
+
+	// Breakpoint stopping the program, nil for other reasons
+	Breakpoint *Breakpoint
+
+	// Error raised by the condition of the breakpoint, which stops the
+	// program whatever its value
+	ConditionError *object.Error
+
+	// Statement about to run
+	Statement ast.Statement
+	Line      int
+	Column    int
+}
+
+// Handler is called each time the program stops, and returns how to
+// resume it. Inspecting the program is only valid during the call.
+type Handler func(d *Debugger, stop Stop) Action
+
+type Breakpoint struct {
+	Line int
+
+	// Expression the breakpoint stops on only when its value is true,
+	// empty to always stop. Values other than null, 0 and "" are true.
+	Condition string
+	condition ast.Expression
+
+	// Number of times the breakpoint stopped the program
+	Hits int
+}
+
+// A running call: a box call, or the program itself
+type Frame struct {
+	// Name of the box, "<box>" when anonymous, "<main>" for the program
+	Function string
+
+	// Position of the statement running
+	Line   int
+	Column int
+
+	// Environment the statement runs in
+	Env *object.Environment
+
+	// Box called, nil for the program
+	box *object.Box
+
+	// Position of the call, 0 for the program
+	CallLine   int
+	CallColumn int
+}
+
+type Debugger struct {
+	handler Handler
+
+	// Stop at the first statement of the program
+	StopOnEntry bool
+
+	// Guards the breakpoints and pausing, which change while the program
+	// runs when the debugger is driven from another goroutine
+	mu          sync.Mutex
+	breakpoints map[int]*Breakpoint
+	pausing     bool
+
+	// Running calls, outermost first
+	frames []*Frame
+
+	// How the program was last resumed, and the number of frames then
+	action Action
+	depth  int
+
+	// The first statement of the program ran
+	started bool
+
+	// Bindings of each box of the program, by slot, and the box each box
+	// is nested in, by body
+	names  map[*ast.BlockStatement][]string
+	parent map[*ast.BlockStatement]*ast.BlockStatement
+
+	// The debugger evaluates an expression itself, the program is paused
+	evaluating bool
+}
+
+func New(handler Handler) *Debugger {
+	return &Debugger{handler: handler, breakpoints: map[int]*Breakpoint{}}
+}
+
+// Ends the evaluation of a program when the handler terminates it
+type terminated struct{}
+
+// Run runs a program in env, stopping it as the breakpoints and the
+// actions returned by the handler ask, and returns its result: nil when
+// the handler terminated the program.
+func (d *Debugger) Run(program *ast.Program, env *object.Environment) (result object.Object) {
+	d.frames = []*Frame{{Function: "<main>", Env: env}}
+	d.action, d.depth = Continue, 0
+	if d.StopOnEntry {
+		d.action = StepInto
+	}
+
+	d.started = false
+
+	// Eval resolves the program again, the resolutions don't change
+	resolver.Resolve(program)
+	d.index(program)
+
+	eval.SetHook(env, d)
+	defer func() {
+		eval.SetHook(env, nil)
+		if r := recover(); r != nil {
+			if _, ok := r.(terminated); !ok {
+				panic(r)
+			}
+			result = nil
+		}
+	}()
+	return eval.Eval(program, env)
+}
+
+// Records the bindings of the boxes of a program, and how they nest
+func (d *Debugger) index(program *ast.Program) {
+	d.names = map[*ast.BlockStatement][]string{}
+	d.parent = map[*ast.BlockStatement]*ast.BlockStatement{}
+
+	bodies := []*ast.BlockStatement{nil}
+	nodes := []ast.Node{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node == nil {
+			if _, ok := nodes[len(nodes)-1].(*ast.BoxExpression); ok {
+				bodies = bodies[:len(bodies)-1]
+			}
+			nodes = nodes[:len(nodes)-1]
+			return true
+		}
+		nodes = append(nodes, node)
+
+		switch node := node.(type) {
+		case *ast.BoxExpression:
+			d.parent[node.Body] = bodies[len(bodies)-1]
+			d.names[node.Body] = make([]string, node.Slots)
+			bodies = append(bodies, node.Body)
+		case *ast.Identifier:
+			body := bodies[len(bodies)-1]
+			r := node.Resolution
+			if body != nil && r != nil && r.Declaration == node && !r.Global && r.Slot < len(d.names[body]) {
+				d.names[body][r.Slot] = node.Value
+			}
+		}
+		return true
+	})
+}
+
+// Breakpoints
+
+// SetBreakpoint sets a breakpoint on a line, replacing the one there.
+// The condition is an expression, empty for none.
+func (d *Debugger) SetBreakpoint(line int, condition string) (*Breakpoint, error) {
+	bp := &Breakpoint{Line: line, Condition: strings.TrimSpace(condition)}
+	if bp.Condition != "" {
+		expr, err := parseExpression(bp.Condition)
+		if err != nil {
+			return nil, err
+		}
+		bp.condition = expr
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakpoints[line] = bp
+	return bp, nil
+}
+
+// ClearBreakpoint removes the breakpoint of a line, returning false when
+// there is none
+func (d *Debugger) ClearBreakpoint(line int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.breakpoints[line]
+	delete(d.breakpoints, line)
+	return ok
+}
+
+// Breakpoints returns the breakpoints, sorted by line
+func (d *Debugger) Breakpoints() []*Breakpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	breakpoints := []*Breakpoint{}
+	for _, bp := range d.breakpoints {
+		breakpoints = append(breakpoints, bp)
+	}
+	sort.Slice(breakpoints, func(i, j int) bool { return breakpoints[i].Line < breakpoints[j].Line })
+	return breakpoints
+}
+
+// StatementLines returns the lines a statement of a program starts on,
+// the lines breakpoints stop at, in order
+func StatementLines(program *ast.Program) []int {
+	seen := map[int]bool{}
+	lines := []int{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if stmt, ok := node.(ast.Statement); ok {
+			if line := position(stmt).Line; line > 0 && !seen[line] {
+				seen[line] = true
+				lines = append(lines, line)
+			}
+		}
+		return true
+	})
+	sort.Ints(lines)
+	return lines
+}
+
+// Pause stops the running program at its next statement. It can be
+// called from any goroutine.
+func (d *Debugger) Pause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pausing = true
+}
+
+func parseExpression(source string) (ast.Expression, error) {
+	p := parser.CreateParser(lexer.CreateLexer(source))
+	program := p.ParseCardBoard()
+	if errs := p.GetErrors(); len(errs) > 0 {
+		return nil, fmt.Errorf("Invalid expression <%s>: %s", source, strings.TrimSpace(errs[0]))
+	}
+	if len(program.Statements) != 1 {
+		return nil, fmt.Errorf("Invalid expression <%s>: expected a single expression", source)
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		return nil, fmt.Errorf("Invalid expression <%s>: expected an expression, not a statement", source)
+	}
+	return stmt.Expression, nil
+}
+
+// Hook of the evaluator
+
+func (d *Debugger) Statement(stmt ast.Statement, env *object.Environment) {
+	if d.evaluating {
+		return
+	}
+
+	frame := d.frames[len(d.frames)-1]
+	tok := position(stmt)
+	newLine := frame.Line != tok.Line
+	frame.Line, frame.Column, frame.Env = tok.Line, tok.Column, env
+	if !newLine {
+		return
+	}
+
+	entry := !d.started
+	d.started = true
+
+	stop := Stop{Statement: stmt, Line: tok.Line, Column: tok.Column}
+	switch {
+	case d.hitBreakpoint(&stop):
+	case d.paused():
+		stop.Reason = ReasonPause
+	case d.action == StepInto,
+		d.action == StepOver && len(d.frames) <= d.depth,
+		d.action == StepOut && len(d.frames) < d.depth:
+		stop.Reason = ReasonStep
+		if entry {
+			stop.Reason = ReasonEntry
+		}
+	default:
+		return
+	}
+
+	d.mu.Lock()
+	d.pausing = false
+	d.mu.Unlock()
+
+	d.action = d.handler(d, stop)
+	d.depth = len(d.frames)
+	if d.action == Terminate {
+		panic(terminated{})
+	}
+}
+
+// Reports whether a breakpoint stops the program at a statement
+func (d *Debugger) hitBreakpoint(stop *Stop) bool {
+	d.mu.Lock()
+	bp, ok := d.breakpoints[stop.Line]
+	d.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	if bp.condition != nil {
+		value := d.eval(bp.condition, 0)
+		if err, ok := value.(*object.Error); ok {
+			stop.ConditionError = err
+		} else if !object.Truthy(value) {
+			return false
+		}
+	}
+
+	bp.Hits++
+	stop.Reason, stop.Breakpoint = ReasonBreakpoint, bp
+	return true
+}
+
+// Reports whether Pause was called since the program last stopped
+func (d *Debugger) paused() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.pausing
+}
+
+func (d *Debugger) Call(fn *object.Box, call token.Token, env *object.Environment) {
+	if d.evaluating {
+		return
+	}
+	d.frames = append(d.frames, &Frame{
+		Function:   boxName(fn),
+		Env:        env,
+		box:        fn,
+		CallLine:   call.Line,
+		CallColumn: call.Column,
+	})
+}
+
+func (d *Debugger) Return(fn *object.Box, result object.Object) {
+	if d.evaluating {
+		return
+	}
+	d.frames = d.frames[:len(d.frames)-1]
+}
+
+func boxName(fn *object.Box) string {
+	if fn.Name == "" {
+		return "<box>"
+	}
+	return fn.Name
+}
+
+// Token a statement starts on
+func position(stmt ast.Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *ast.PutStatement:
+		return stmt.NodeToken
+	case *ast.UnboxStatement:
+		return stmt.NodeToken
+	case *ast.ThrowStatement:
+		return stmt.NodeToken
+	case *ast.ExpressionStatement:
+		return stmt.NodeToken
+	case *ast.TryStatement:
+		return stmt.NodeToken
+	}
+	return token.Token{}
+}
+
+// Inspection
+
+// Stack returns the running calls, innermost first
+func (d *Debugger) Stack() []Frame {
+	frames := []Frame{}
+	for idx := len(d.frames) - 1; idx >= 0; idx-- {
+		frames = append(frames, *d.frames[idx])
+	}
+	return frames
+}
+
+// A binding visible from a frame
+type Variable struct {
+	Name  string
+	Value object.Object
+}
+
+// Bindings made by a box call, or by the program
+type Scope struct {
+	// Name of the box making the bindings, "<main>" for the program
+	Name      string
+	Variables []Variable
+}
+
+// Scopes returns the environment chain of a frame, counted from the
+// innermost one, and the bindings made so far in each, innermost first.
+func (d *Debugger) Scopes(frame int) []Scope {
+	f := d.frame(frame)
+	if f == nil {
+		return nil
+	}
+
+	scopes := []Scope{}
+	env := f.Env
+	var body *ast.BlockStatement
+	if f.box != nil {
+		body = f.box.Body
+	}
+
+	for ; env != nil && env.IsFrame(); env = env.Outer() {
+		scope := Scope{Name: "<box>", Variables: []Variable{}}
+		if len(scopes) == 0 {
+			scope.Name = f.Function
+		}
+
+		names := d.names[body]
+		for slot := 0; slot < env.Size(); slot++ {
+			value, ok := env.GetSlot(0, slot)
+			if !ok {
+				continue
+			}
+			name := fmt.Sprintf("#%d", slot)
+			if slot < len(names) && names[slot] != "" {
+				name = names[slot]
+			}
+			scope.Variables = append(scope.Variables, Variable{Name: name, Value: value})
+		}
+		scopes = append(scopes, scope)
+		body = d.parent[body]
+	}
+
+	if env != nil {
+		scope := Scope{Name: "<main>", Variables: []Variable{}}
+		for _, name := range env.Names() {
+			value, _ := env.Get(name)
+			scope.Variables = append(scope.Variables, Variable{Name: name, Value: value})
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes
+}
+
+func (d *Debugger) frame(frame int) *Frame {
+	if frame < 0 || frame >= len(d.frames) {
+		return nil
+	}
+	return d.frames[len(d.frames)-1-frame]
+}
+
+// Evaluate evaluates an expression in a frame, counted from the innermost
+// one, as if it was written at the statement running there. Boxes the
+// expression calls run without stopping.
+func (d *Debugger) Evaluate(source string, frame int) (object.Object, error) {
+	if d.frame(frame) == nil {
+		return nil, fmt.Errorf("No frame %d", frame)
+	}
+	expr, err := parseExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	return d.eval(expr, frame), nil
+}
+
+func (d *Debugger) eval(expr ast.Expression, frame int) object.Object {
+	f := d.frame(frame)
+	d.resolve(expr, f)
+
+	d.evaluating = true
+	defer func() { d.evaluating = false }()
+	return eval.Eval(expr, f.Env)
+}
+
+// Resolves the identifiers of an expression to the bindings of the
+// scopes of a frame, by name
+func (d *Debugger) resolve(expr ast.Expression, f *Frame) {
+	var body *ast.BlockStatement
+	if f.box != nil {
+		body = f.box.Body
+	}
+
+	ast.Inspect(expr, func(node ast.Node) bool {
+		ident, ok := node.(*ast.Identifier)
+		if !ok {
+			return true
+		}
+
+		ident.Resolution = nil
+		depth := 0
+		for b := body; b != nil; b = d.parent[b] {
+			names := d.names[b]
+			for slot := len(names) - 1; slot >= 0; slot-- {
+				if names[slot] == ident.Value {
+					ident.Resolution = &ast.Resolution{Depth: depth, Slot: slot}
+					return true
+				}
+			}
+			depth++
+		}
+		return true
+	})
+}
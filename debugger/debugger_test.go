@@ -0,0 +1,244 @@
+package debugger
+
+import (
+	"bytes"
+	"cardboard/lexer"
+	"cardboard/object"
+	"cardboard/parser"
+	"cardboard/parser/ast"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const script = `put add = box(a, b) {
+    put sum = a + b;
+    unbox sum;
+};
+put x = 1;
+put y = add(x, 2);
+add(y, 3);`
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.CreateParser(lexer.CreateLexer(input))
+	program := p.ParseCardBoard()
+	if errs := p.GetErrors(); len(errs) > 0 {
+		t.Fatalf("Test failed. Parser errors: %q", errs)
+	}
+	return program
+}
+
+// Runs the script, answering each stop with the next action, and returns
+// where the program stopped
+func run(t *testing.T, d *Debugger, actions ...Action) ([]string, object.Object) {
+	stops := []string{}
+	d.handler = func(d *Debugger, stop Stop) Action {
+		stops = append(stops, fmt.Sprintf("%s %d in %s", stop.Reason, stop.Line, d.Stack()[0].Function))
+		if len(actions) == 0 {
+			return Continue
+		}
+		action := actions[0]
+		actions = actions[1:]
+		return action
+	}
+	result := d.Run(parse(t, script), object.CreateEnvironment())
+	return stops, result
+}
+
+func TestStepping(t *testing.T) {
+	tests := []struct {
+		actions  []Action
+		expected []string
+	}{
+		{
+			[]Action{StepInto, StepInto, StepInto, StepInto, StepInto, StepInto},
+			[]string{"entry 1 in <main>", "step 5 in <main>", "step 6 in <main>", "step 2 in add", "step 3 in add", "step 7 in <main>", "step 2 in add"},
+		},
+		{
+			[]Action{StepOver, StepOver, StepOver},
+			[]string{"entry 1 in <main>", "step 5 in <main>", "step 6 in <main>", "step 7 in <main>"},
+		},
+		{
+			[]Action{StepOver, StepOver, StepInto, StepOut, StepInto},
+			[]string{"entry 1 in <main>", "step 5 in <main>", "step 6 in <main>", "step 2 in add", "step 7 in <main>", "step 2 in add"},
+		},
+	}
+
+	for _, tt := range tests {
+		d := New(nil)
+		d.StopOnEntry = true
+		stops, result := run(t, d, append(tt.actions, Terminate)...)
+		if strings.Join(stops, ", ") != strings.Join(tt.expected, ", ") {
+			t.Errorf("Test failed. Wrong stops for %v.\nwant=%q\ngot=%q", tt.actions, tt.expected, stops)
+		}
+		if result != nil {
+			t.Errorf("Test failed. Expected no result from a terminated program. Got <%s>", result.Inspect())
+		}
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	d := New(nil)
+	if _, err := d.SetBreakpoint(3, "sum - 3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.SetBreakpoint(5, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.SetBreakpoint(4, "put"); err == nil {
+		t.Errorf("Test failed. Expected an invalid condition to be rejected.")
+	}
+
+	stops, result := run(t, d)
+	expected := []string{"breakpoint 5 in <main>", "breakpoint 3 in add"}
+	if strings.Join(stops, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("Test failed. Wrong stops.\nwant=%q\ngot=%q", expected, stops)
+	}
+	if result == nil || result.Inspect() != "6" {
+		t.Errorf("Test failed. Expected the program to finish with 6. Got <%v>", result)
+	}
+
+	breakpoints := d.Breakpoints()
+	if len(breakpoints) != 2 || breakpoints[0].Line != 3 || breakpoints[0].Hits != 1 || breakpoints[1].Hits != 1 {
+		t.Errorf("Test failed. Wrong breakpoints: %v", breakpoints)
+	}
+	if !d.ClearBreakpoint(3) || d.ClearBreakpoint(3) {
+		t.Errorf("Test failed. Expected the breakpoint of line 3 to be cleared once.")
+	}
+}
+
+func TestConditionError(t *testing.T) {
+	d := New(nil)
+	d.SetBreakpoint(2, "unknown")
+
+	var stop Stop
+	d.handler = func(d *Debugger, s Stop) Action {
+		stop = s
+		return Terminate
+	}
+	d.Run(parse(t, script), object.CreateEnvironment())
+
+	if stop.Reason != ReasonBreakpoint || stop.ConditionError == nil {
+		t.Fatalf("Test failed. Expected the failing condition to stop the program. Got <%+v>", stop)
+	}
+	if !strings.Contains(stop.ConditionError.Message, "unknown") {
+		t.Errorf("Test failed. Wrong condition error: %s", stop.ConditionError.Message)
+	}
+}
+
+func TestInspection(t *testing.T) {
+	d := New(nil)
+	d.SetBreakpoint(3, "")
+
+	inspected := false
+	d.handler = func(d *Debugger, stop Stop) Action {
+		if inspected {
+			return Continue
+		}
+		inspected = true
+
+		stack := d.Stack()
+		if len(stack) != 2 || stack[0].Function != "add" || stack[0].CallLine != 6 || stack[1].Function != "<main>" {
+			t.Errorf("Test failed. Wrong stack: %+v", stack)
+		}
+
+		scopes := describeScopes(d.Scopes(0))
+		expected := "add: a = 1, b = 2, sum = 3; <main>: add = box add(a, b), x = 1"
+		if scopes != expected {
+			t.Errorf("Test failed. Wrong scopes.\nwant=%q\ngot=%q", expected, scopes)
+		}
+		if scopes := describeScopes(d.Scopes(1)); scopes != "<main>: add = box add(a, b), x = 1" {
+			t.Errorf("Test failed. Wrong scopes of the caller: %q", scopes)
+		}
+		if d.Scopes(2) != nil {
+			t.Errorf("Test failed. Expected no scopes for a missing frame.")
+		}
+
+		tests := []struct {
+			source   string
+			frame    int
+			expected string
+		}{
+			{"sum * 10 + a", 0, "31"},
+			{"add(sum, x)", 0, "4"},
+			{"x", 1, "1"},
+			{"sum", 1, "error: Unknown identifier: sum"},
+		}
+		for _, tt := range tests {
+			value, err := d.Evaluate(tt.source, tt.frame)
+			if err != nil {
+				t.Errorf("Test failed. Can't evaluate %s: %s", tt.source, err)
+				continue
+			}
+			if !strings.HasPrefix(Display(value), tt.expected) {
+				t.Errorf("Test failed. Wrong value for %s in frame %d. want=%s, got=%s", tt.source, tt.frame, tt.expected, Display(value))
+			}
+		}
+		if _, err := d.Evaluate("x", 2); err == nil {
+			t.Errorf("Test failed. Expected an error for a missing frame.")
+		}
+		return Continue
+	}
+
+	result := d.Run(parse(t, script), object.CreateEnvironment())
+	if result == nil || result.Inspect() != "6" {
+		t.Errorf("Test failed. Expected the program to finish with 6. Got <%v>", result)
+	}
+	if !inspected {
+		t.Errorf("Test failed. The breakpoint was never hit.")
+	}
+}
+
+func describeScopes(scopes []Scope) string {
+	out := []string{}
+	for _, scope := range scopes {
+		variables := []string{}
+		for _, variable := range scope.Variables {
+			variables = append(variables, variable.Name+" = "+Display(variable.Value))
+		}
+		out = append(out, scope.Name+": "+strings.Join(variables, ", "))
+	}
+	return strings.Join(out, "; ")
+}
+
+func TestConsole(t *testing.T) {
+	input := "break 3 if sum - 3\nc\nbt\np sum\nquit\n"
+	var out bytes.Buffer
+	console := NewConsole(strings.NewReader(input), &out, script)
+
+	d := New(console.Stopped)
+	d.StopOnEntry = true
+	if result := d.Run(parse(t, script), object.CreateEnvironment()); result != nil {
+		t.Errorf("Test failed. Expected no result from a terminated program. Got <%s>", result.Inspect())
+	}
+
+	expected := `Stopped at 1:1, in <main>
+>    1  put add = box(a, b) {
+(debug) Breakpoint on line 3 if sum - 3
+(debug) Breakpoint at 3:5, in add
+>    3      unbox sum;
+(debug) > #0 add at 3:5, called at 7:4
+  #1 <main> at 7:1
+(debug) 6
+(debug) `
+	if out.String() != expected {
+		t.Errorf("Test failed. Wrong output.\nwant=%q\ngot=%q", expected, out.String())
+	}
+}
+
+func TestPause(t *testing.T) {
+	d := New(nil)
+	d.Pause()
+	stops, _ := run(t, d, Terminate)
+	if strings.Join(stops, ", ") != "pause 1 in <main>" {
+		t.Errorf("Test failed. Expected the program to pause at its first line. Got <%q>", stops)
+	}
+}
+
+func TestStatementLines(t *testing.T) {
+	lines := StatementLines(parse(t, script+"\n\ntry { 1; } catch { 2; }"))
+	expected := []int{1, 2, 3, 5, 6, 7, 9}
+	if fmt.Sprint(lines) != fmt.Sprint(expected) {
+		t.Errorf("Test failed. Wrong statement lines. want=%v, got=%v", expected, lines)
+	}
+}
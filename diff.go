@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Lines of context printed around changed lines
+const diffContext = 3
+
+// Returns the changes turning a into b as a unified diff, empty when
+// they're the same
+func unifiedDiff(path string, a string, b string) string {
+	if a == b {
+		return ""
+	}
+	from, to := splitLines(a), splitLines(b)
+
+	// Longest common subsequence of lines, lcs[i][j] being the one of from[i:] and to[j:]
+	lcs := make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	// Edit script: ' ' kept, '-' removed, '+' added
+	type edit struct {
+		op   byte
+		line string
+	}
+	edits := []edit{}
+	i, j := 0, 0
+	for i < len(from) || j < len(to) {
+		switch {
+		case i < len(from) && j < len(to) && from[i] == to[j]:
+			edits = append(edits, edit{' ', from[i]})
+			i++
+			j++
+		case i < len(from) && (j == len(to) || lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{'-', from[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', to[j]})
+			j++
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s\n+++ %s (formatted)\n", path, path)
+
+	// Group the edits into hunks of changes, with their context
+	for start := 0; start < len(edits); {
+		if edits[start].op == ' ' {
+			start++
+			continue
+		}
+
+		first := start - diffContext
+		if first < 0 {
+			first = 0
+		}
+		last := start
+		for idx := start; idx < len(edits) && idx <= last+2*diffContext; idx++ {
+			if edits[idx].op != ' ' {
+				last = idx
+			}
+		}
+		end := last + diffContext + 1
+		if end > len(edits) {
+			end = len(edits)
+		}
+
+		// Line numbers of the hunk in both versions
+		fromLine, toLine := 1, 1
+		for _, e := range edits[:first] {
+			if e.op != '+' {
+				fromLine++
+			}
+			if e.op != '-' {
+				toLine++
+			}
+		}
+		fromCount, toCount := 0, 0
+		for _, e := range edits[first:end] {
+			if e.op != '+' {
+				fromCount++
+			}
+			if e.op != '-' {
+				toCount++
+			}
+		}
+
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", fromLine, fromCount, toLine, toCount)
+		for _, e := range edits[first:end] {
+			out.WriteByte(e.op)
+			out.WriteString(e.line)
+			out.WriteByte('\n')
+		}
+		start = end
+	}
+	return out.String()
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
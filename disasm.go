@@ -0,0 +1,62 @@
+package main
+
+import (
+	"cardboard/cbc"
+	"cardboard/compiler"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Prints the instructions of a script, or of a compiled .cbc file,
+// annotated with the source lines they were compiled from.
+func disasmCommand(args []string) int {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	optimize := flags.Bool("optimize", true, "optimize scripts before compiling them")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: cardboard disasm [-optimize=false] script.cb|program"+cbc.Extension)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	path := flags.Arg(0)
+
+	var bytecode *compiler.Bytecode
+	var source string
+
+	if strings.HasSuffix(path, cbc.Extension) {
+		file, err := readCompiled(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		bytecode = file.Bytecode
+
+		// The script is only needed to show source lines, it may be gone
+		if text, err := os.ReadFile(file.Source); err == nil {
+			source = string(text)
+		}
+	} else {
+		var ok bool
+		if bytecode, source, ok = compileScript(path, *optimize); !ok {
+			return 1
+		}
+	}
+
+	cbc.Disassemble(os.Stdout, bytecode, source)
+	return 0
+}
+
+func readCompiled(path string) (*cbc.File, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	return cbc.Read(in)
+}
@@ -1,18 +1,84 @@
 package eval
 
 import (
+	"cardboard/lexer/token"
 	"cardboard/object"
 	"cardboard/parser/ast"
+	"cardboard/resolver"
 	"fmt"
 )
 
 var NULL = &object.Null{}
 
+// A Hook is told about the progress of the evaluation of a program, to
+// debug, trace or profile it. Set it on the environment the program runs
+// in with SetHook: the frames of box calls inherit it.
+type Hook interface {
+	// Statement is called before a statement runs, with the environment
+	// it runs in
+	Statement(stmt ast.Statement, env *object.Environment)
+
+	// Call is called when a box call starts, once its parameters are
+	// bound in env, its frame
+	Call(fn *object.Box, call token.Token, env *object.Environment)
+
+	// Return is called when a box call ends, with its result: a value or
+	// an error. The result is nil when the box calls itself in tail
+	// position, which replaces the call by a new one.
+	Return(fn *object.Box, result object.Object)
+}
+
+// SetHook sets the hook of an environment, nil removing it
+func SetHook(env *object.Environment, hook Hook) {
+	if hook == nil {
+		env.SetHook(nil)
+		return
+	}
+	env.SetHook(hook)
+}
+
+// A Tracer is a hook also told about every node evaluated and every
+// binding made, to trace the evaluation step by step
+type Tracer interface {
+	Hook
+
+	// Node is called once a node is evaluated, with its result
+	Node(node ast.Node, result object.Object, env *object.Environment)
+
+	// Bind is called once a value is bound to an identifier in env. The
+	// parameters of a box call are bound once Call is called.
+	Bind(ident *ast.Identifier, val object.Object, env *object.Environment)
+}
+
+func hookOf(env *object.Environment) Hook {
+	hook, _ := env.Hook().(Hook)
+	return hook
+}
+
+func tracerOf(env *object.Environment) Tracer {
+	if env.Hook() == nil {
+		return nil
+	}
+	tracer, _ := env.Hook().(Tracer)
+	return tracer
+}
+
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	if tracer := tracerOf(env); tracer != nil {
+		result := evalNode(node, env)
+		tracer.Node(node, result, env)
+		return result
+	}
+	return evalNode(node, env)
+}
+
+func evalNode(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 
 	// Statements
 	case *ast.Program:
+		// Locate the bindings of the identifiers before running the program
+		resolver.Resolve(node)
 		return evalStatements(node.Statements, env)
 	case *ast.UnboxStatement:
 		return evalUnboxStatement(node, env)
@@ -20,6 +86,10 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalPutStatement(node, env)
 	case *ast.BlockStatement:
 		return evalBlockStatement(node, env)
+	case *ast.ThrowStatement:
+		return evalThrowStatement(node, env)
+	case *ast.TryStatement:
+		return evalTryStatement(node, env)
 
 	// Expressions
 	case *ast.BoxExpression:
@@ -36,15 +106,23 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalInfixExpression(node, env)
 	case *ast.IntegerLiteral:
 		return evalInteger(node)
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+	case *ast.MemberExpression:
+		return evalMemberExpression(node, env)
 	}
 
 	// We've encountered an unknown word thats attempting ot be evaluated.
-	return throwError("Unknown Word: <%s>", node.TokenLiteral())
+	return throwError(object.RUNTIME_ERROR, token.Token{}, "Unknown Word: <%s>", node.TokenLiteral())
 }
 
 func evalStatements(stmts []ast.Statement, env *object.Environment) object.Object {
-	var result object.Object
+	var result object.Object = NULL
+	hook := hookOf(env)
 	for _, statement := range stmts {
+		if hook != nil {
+			hook.Statement(statement, env)
+		}
 		result = Eval(statement, env)
 		switch result.Type() {
 		case object.ERROR_OBJ:
@@ -64,7 +142,7 @@ func evalPrefixExpression(expr *ast.PrefixExpression, env *object.Environment) o
 	}
 
 	if operand.Type() != object.INTEGER {
-		return throwError("Type error. Can't use <%s> Operator with <%s> Type.", expr.Operator, operand.Type())
+		return throwError(object.TYPE_ERROR, expr.NodeToken, "Type error. Can't use <%s> Operator with <%s> Type.", expr.Operator, operand.Type())
 	}
 
 	value := operand.(*object.Integer).Value
@@ -76,23 +154,29 @@ func evalPrefixExpression(expr *ast.PrefixExpression, env *object.Environment) o
 		return &object.Integer{Value: -value}
 	}
 
-	return throwError("Unknown Operator: <%s>.", expr.Operator)
+	return throwError(object.RUNTIME_ERROR, expr.NodeToken, "Unknown Operator: <%s>.", expr.Operator)
 }
 
 func evalInfixExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
 	// Eval Arguments
 	left := Eval(node.Left, env)
-	right := Eval(node.Right, env)
-
 	if isError(left) {
 		return left
-	} else if isError(right) {
+	}
+
+	right := Eval(node.Right, env)
+	if isError(right) {
 		return right
 	}
 
-	// Infix Operations only defined for integers for now.
+	// Strings can only be concatenated
+	if left.Type() == object.STRING && right.Type() == object.STRING && node.Operator == "+" {
+		return &object.String{Value: left.(*object.String).Value + right.(*object.String).Value}
+	}
+
+	// Other Infix Operations only defined for integers for now.
 	if left.Type() != object.INTEGER || right.Type() != object.INTEGER {
-		return throwError("Type Mismatch: <%s><%s><%s>", left.Type(), node.Operator, right.Type())
+		return throwError(object.TYPE_ERROR, node.NodeToken, "Type Mismatch: <%s><%s><%s>", left.Type(), node.Operator, right.Type())
 	}
 
 	leftVal := left.(*object.Integer).Value
@@ -103,6 +187,13 @@ func evalInfixExpression(node *ast.InfixExpression, env *object.Environment) obj
 		return &object.Integer{Value: leftVal + rightVal}
 	case "-":
 		return &object.Integer{Value: leftVal - rightVal}
+	case "*":
+		return &object.Integer{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return throwError(object.ZERO_DIVISION_ERROR, node.NodeToken, "Division By Zero: <%d/0>", leftVal)
+		}
+		return &object.Integer{Value: leftVal / rightVal}
 	}
 
 	return NULL
@@ -125,20 +216,122 @@ func evalPutStatement(stmt *ast.PutStatement, env *object.Environment) object.Ob
 	if isError(val) {
 		return val
 	}
-	return env.Set(stmt.NodeIdentifier.Value, val)
+	// Name anonymous boxes after their first binding for stack traces
+	if box, ok := val.(*object.Box); ok && box.Name == "" {
+		box.Name = stmt.NodeIdentifier.Value
+	}
+	return bind(&stmt.NodeIdentifier, val, env)
 }
 
-func evalIdentifier(ident *ast.Identifier, env *object.Environment) object.Object {
-	obj, ok := env.Get(ident.Value)
+func evalThrowStatement(stmt *ast.ThrowStatement, env *object.Environment) object.Object {
+	val := Eval(stmt.NodeExpression, env)
+	if isError(val) {
+		return val
+	}
+
+	// Rethrowing a caught error keeps its original details
+	if exception, ok := val.(*object.Exception); ok {
+		return exception.Error
+	}
+
+	err := throwError(object.USER_ERROR, stmt.NodeToken, "%s", val.Inspect())
+	err.Value = val
+	return err
+}
+
+// Evaluates the try block, handing any error it raises to the catch block.
+// The finally block always runs last, and only changes the outcome of the
+// statement when it raises an error or unboxes a value itself.
+func evalTryStatement(stmt *ast.TryStatement, env *object.Environment) object.Object {
+	result := Eval(stmt.Body, env)
+
+	if err, ok := result.(*object.Error); ok && stmt.Catch != nil {
+		catchEnv := env
+		if stmt.CatchParameter != nil {
+			exception := &object.Exception{Error: err}
+			if !env.IsFrame() {
+				// The catch parameter of the top level is bound by name, in
+				// an environment of its own so it doesn't replace a global
+				catchEnv = object.CreateEnclosedEnvironment(env)
+				catchEnv.Set(stmt.CatchParameter.Value, exception)
+			}
+			bind(stmt.CatchParameter, exception, catchEnv)
+		}
+		result = Eval(stmt.Catch, catchEnv)
+	}
+
+	if stmt.Finally != nil {
+		final := Eval(stmt.Finally, env)
+		if final.Type() == object.ERROR_OBJ || final.Type() == object.UNBOX_OBJ {
+			return final
+		}
+	}
+
+	return result
+}
+
+func evalMemberExpression(expr *ast.MemberExpression, env *object.Environment) object.Object {
+	obj := Eval(expr.Object, env)
+	if isError(obj) {
+		return obj
+	}
+
+	exception, ok := obj.(*object.Exception)
+	if !ok {
+		return throwError(object.TYPE_ERROR, expr.NodeToken, "Type error. <%s> Type has no properties.", obj.Type())
+	}
+
+	property, ok := exception.Property(expr.Property.Value)
 	if !ok {
-		return throwError("Unknown identifier: %s.", ident.TokenLiteral())
+		return throwError(object.NAME_ERROR, expr.NodeToken, "Unknown property: %s.", expr.Property.Value)
 	}
-	return obj
+	return property
+}
+
+// Looks an identifier up in the slot of its binding. Until a binding is
+// made, the name refers to the binding of the enclosing body, and at last
+// to the globals and builtins.
+func evalIdentifier(ident *ast.Identifier, env *object.Environment) object.Object {
+	for r := ident.Resolution; r != nil && !r.Global; r = r.Outer {
+		if obj, ok := env.GetSlot(r.Depth, r.Slot); ok {
+			return obj
+		}
+	}
+
+	if obj, ok := env.Get(ident.Value); ok {
+		return obj
+	}
+	if builtin, _, found := object.LookupBuiltin(ident.Value); found {
+		return builtin
+	}
+	return throwError(object.NAME_ERROR, ident.NodeToken, "Unknown identifier: %s.", ident.TokenLiteral())
+}
+
+// Binds a value to an identifier, telling the tracer if there is one
+func bind(ident *ast.Identifier, val object.Object, env *object.Environment) object.Object {
+	store(ident, val, env)
+	if tracer := tracerOf(env); tracer != nil {
+		tracer.Bind(ident, val, env)
+	}
+	return val
+}
+
+// Stores a binding: in its slot within a box call, by name at the top
+// level and when the identifier wasn't resolved.
+func store(ident *ast.Identifier, val object.Object, env *object.Environment) object.Object {
+	if r := ident.Resolution; r != nil && !r.Global {
+		return env.SetSlot(r.Slot, val)
+	}
+	return env.Rebind(ident.Value, val)
 }
 
 func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
-	var result object.Object
+	var result object.Object = NULL
+	hook := hookOf(env)
 	for _, statement := range block.Statements {
+		if hook != nil {
+			hook.Statement(statement, env)
+		}
 		result = Eval(statement, env)
 		if result.Type() == object.ERROR_OBJ || result.Type() == object.UNBOX_OBJ {
 			return result
@@ -148,56 +341,222 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 }
 
 func evalBoxExpression(box *ast.BoxExpression, env *object.Environment) object.Object {
-	return &object.Box{Env: env, ParameterList: box.ParameterList, Body: box.Body}
+	return &object.Box{Env: env, ParameterList: box.ParameterList, Body: box.Body, Slots: box.Slots}
 }
 
 func evalCallExpression(call *ast.CallExpression, env *object.Environment) object.Object {
-	var arguments []object.Object
+	box, arguments, err := evalCallOperands(call, env)
+	if err != nil {
+		return err
+	}
+	return applyBoxFunction(box, arguments, call.NodeToken, env)
+}
+
+// Evaluates the box and the arguments of a call, returning the first error met.
+func evalCallOperands(call *ast.CallExpression, env *object.Environment) (object.Object, []object.Object, object.Object) {
+	// Never nil, even without arguments: the arguments of a tail call tell
+	// it apart from a result in evalBoxBody
+	arguments := make([]object.Object, 0, len(call.Arguments))
 
 	box := Eval(call.Function, env)
 	if isError(box) {
-		return box
+		return nil, nil, box
 	}
 
 	for _, arg := range call.Arguments {
 		evaluated := Eval(arg, env)
 		if isError(evaluated) {
-			return evaluated
+			return nil, nil, evaluated
 		}
 		arguments = append(arguments, evaluated)
 	}
 
-	return applyBoxFunction(box, arguments)
+	return box, arguments, nil
 }
 
-func applyBoxFunction(box object.Object, args []object.Object) object.Object {
+// Calls a box or a builtin from the environment caller
+func applyBoxFunction(box object.Object, args []object.Object, callToken token.Token, caller *object.Environment) object.Object {
+	if builtin, ok := box.(*object.Builtin); ok {
+		return applyBuiltin(builtin, args, callToken, caller)
+	}
+
 	fn, ok := box.(*object.Box)
 
 	if !ok {
-		return throwError("Type Mismatch Error. Expected Function. Got <%s>", box.Type())
+		return throwError(object.TYPE_ERROR, callToken, "Type Mismatch Error. Expected Function. Got <%s>", box.Type())
 	}
 
-	fn.Env = object.CreateEnclosedEnvironment(fn.Env)
+	if len(args) != len(fn.ParameterList) {
+		return throwError(object.TYPE_ERROR, callToken, "Wrong number of arguments. Expected %d. Got <%d>", len(fn.ParameterList), len(args))
+	}
 
-	for paramIdx, param := range fn.ParameterList {
-		fn.Env.Set(param.Value, args[paramIdx])
+	// The program itself counts as a call, like the frame of the main
+	// function of the virtual machine
+	depth := caller.Depth() + 1
+	if depth >= object.MaxCallDepth {
+		return throwError(object.RUNTIME_ERROR, callToken, "Stack Overflow: more than %d nested calls", object.MaxCallDepth)
 	}
 
-	evaluated := Eval(fn.Body, fn.Env)
+	// Calls of the box to itself in tail position are made by this loop
+	// rather than nested, so tail recursive boxes run in constant stack.
+	tailCalls := 0
+	var traced []tracedTailCall
+	for {
+		env := object.CreateFrame(fn.Env, fn.Slots)
+		env.SetDepth(depth)
+
+		for paramIdx, param := range fn.ParameterList {
+			store(param, args[paramIdx], env)
+		}
+
+		hook := hookOf(env)
+		if hook != nil {
+			hook.Call(fn, callToken, env)
+		}
+		if tracer := tracerOf(env); tracer != nil {
+			for paramIdx, param := range fn.ParameterList {
+				tracer.Bind(param, args[paramIdx], env)
+			}
+		}
+
+		evaluated, tail, tailArgs := evalBoxBody(fn, env)
+		if tailArgs != nil {
+			if hook != nil {
+				hook.Return(fn, nil)
+			}
+			if tracerOf(env) != nil {
+				traced = append(traced, tracedTailCall{stmt: tail, env: env})
+			}
+			args = tailArgs
+			tailCalls++
+			continue
+		}
+
+		if hook != nil {
+			result := evaluated
+			if unbox, ok := evaluated.(*object.Unbox); ok {
+				result = unbox.Value
+			}
+			hook.Return(fn, result)
+		}
+
+		// The tail calls made by the loop have the result of the last call,
+		// reported from the innermost as if the calls were nested
+		for idx := len(traced) - 1; idx >= 0; idx-- {
+			result := evaluated
+			if unbox, ok := evaluated.(*object.Unbox); ok {
+				result = unbox.Value
+			}
+			traceTailCall(traced[idx].stmt, result, traced[idx].env)
+		}
+
+		// Record the call on the error's stack trace as it propagates to the caller
+		if err, ok := evaluated.(*object.Error); ok {
+			frame := object.StackFrame{Function: fn.Name, Line: callToken.Line, Column: callToken.Column, TailCalls: tailCalls}
+			err.Trace = append(err.Trace, frame)
+			return err
+		}
+
+		if unbox, ok := evaluated.(*object.Unbox); ok {
+			return unbox.Value
+		}
 
-	if isError(evaluated) {
 		return evaluated
 	}
+}
 
-	if unbox, ok := evaluated.(*object.Unbox); ok {
-		return unbox.Value
+func applyBuiltin(builtin *object.Builtin, args []object.Object, callToken token.Token, env *object.Environment) object.Object {
+	if len(args) != len(builtin.Parameters) {
+		return throwError(object.TYPE_ERROR, callToken, "Wrong number of arguments. Expected %d. Got <%d>", len(builtin.Parameters), len(args))
+	}
+
+	ctx := &object.Context{
+		Call: func(fn object.Object, args ...object.Object) object.Object {
+			return applyBoxFunction(fn, args, callToken, env)
+		},
+		Out: env.Output(),
+	}
+	result := builtin.Fn(ctx, args...)
+	if err, ok := result.(*object.Error); ok && err.Line == 0 {
+		err.Line, err.Column = callToken.Line, callToken.Column
 	}
+	return result
+}
 
-	return evaluated
+// Evaluates the body of a box call. When the body ends with a call of the
+// box itself, as its last statement or the value it unboxes, the call is
+// left to the caller: the statement and the arguments of the call are
+// returned instead of a result.
+func evalBoxBody(fn *object.Box, env *object.Environment) (object.Object, ast.Statement, []object.Object) {
+	var result object.Object = NULL
+
+	hook := hookOf(env)
+	stmts := fn.Body.Statements
+	for idx, stmt := range stmts {
+		if hook != nil {
+			hook.Statement(stmt, env)
+		}
+		if call := tailCall(stmt, idx == len(stmts)-1); call != nil {
+			box, args, err := evalCallOperands(call, env)
+			if err != nil {
+				traceTailCall(stmt, err, env)
+				return err, nil, nil
+			}
+			if self, ok := box.(*object.Box); ok && self == fn && len(args) == len(fn.ParameterList) {
+				return nil, stmt, args
+			}
+			result = applyBoxFunction(box, args, call.NodeToken, env)
+			traceTailCall(stmt, result, env)
+			return result, nil, nil
+		}
+
+		result = Eval(stmt, env)
+		if result.Type() == object.ERROR_OBJ || result.Type() == object.UNBOX_OBJ {
+			return result, nil, nil
+		}
+	}
+	return result, nil, nil
+}
+
+// A tail call made by the loop of a box call, traced once its result is known
+type tracedTailCall struct {
+	stmt ast.Statement
+	env  *object.Environment
+}
+
+// Tells the tracer, if there is one, about a call in tail position and its
+// statement, which aren't evaluated by Eval
+func traceTailCall(stmt ast.Statement, result object.Object, env *object.Environment) {
+	tracer := tracerOf(env)
+	if tracer == nil {
+		return
+	}
+	tracer.Node(tailCall(stmt, true), result, env)
+	if _, ok := stmt.(*ast.UnboxStatement); ok && !isError(result) {
+		result = &object.Unbox{Value: result}
+	}
+	tracer.Node(stmt, result, env)
+}
+
+// Returns the call in tail position in a statement of a box body, if any:
+// the value of an 'unbox' statement, or of the last statement.
+func tailCall(stmt ast.Statement, last bool) *ast.CallExpression {
+	switch stmt := stmt.(type) {
+	case *ast.UnboxStatement:
+		call, _ := stmt.NodeExpression.(*ast.CallExpression)
+		return call
+	case *ast.ExpressionStatement:
+		if last {
+			call, _ := stmt.Expression.(*ast.CallExpression)
+			return call
+		}
+	}
+	return nil
 }
 
-func throwError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+// Creates an error of the given kind positioned at the given token
+func throwError(kind object.ErrorKind, tok token.Token, format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...), Line: tok.Line, Column: tok.Column}
 }
 
 func isError(obj object.Object) bool {
@@ -0,0 +1,51 @@
+package eval
+
+import (
+	"cardboard/lexer"
+	"cardboard/object"
+	"cardboard/parser"
+	"testing"
+)
+
+// Returns n for 0 and 1, where n * (n - 1) is zero
+const fibProgram = `
+put fib = box(n) {
+	try { 1 / (n * (n - 1)); } catch { unbox n; }
+	fib(n - 1) + fib(n - 2)
+};
+fib(20);`
+
+const sumProgram = `
+put sum = box(n, acc) {
+	try { 1 / n; } catch { unbox acc; }
+	sum(n - 1, acc + n)
+};
+sum(100000, 0);`
+
+// Variables of enclosing calls, several levels up
+const closuresProgram = `
+put count = box(n) {
+	put step = box(a) { box(b) { box(c) { a + b + c - n } } };
+	try { 1 / n; } catch { unbox 0; }
+	step(1)(1)(-1) + count(n - 1)
+};
+count(5000);`
+
+func BenchmarkFib(b *testing.B)      { benchmarkProgram(b, fibProgram) }
+func BenchmarkSum(b *testing.B)      { benchmarkProgram(b, sumProgram) }
+func BenchmarkClosures(b *testing.B) { benchmarkProgram(b, closuresProgram) }
+
+func benchmarkProgram(b *testing.B, input string) {
+	p := parser.CreateParser(lexer.CreateLexer(input))
+	program := p.ParseCardBoard()
+	if errs := p.GetErrors(); len(errs) > 0 {
+		b.Fatalf("Parser errors: %v", errs)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if result := Eval(program, object.CreateEnvironment()); isError(result) {
+			b.Fatalf("Runtime error: %s", result.Inspect())
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package eval
+
+import (
+	"cardboard/conformance/corpus"
+	"cardboard/lexer"
+	"cardboard/lexer/token"
+	"cardboard/object"
+	"cardboard/parser"
+	"cardboard/parser/ast"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Statements and calls a fuzzed program may run, enough for recursion to
+// reach the limit on nested calls: every level runs a statement and a call
+const fuzzBudget = 4 * object.MaxCallDepth
+
+// Recurses without tail calls, until the stack overflows
+const overflowProgram = "put f = box(n) { 1 + f(n) }; f(1);"
+
+// Panics with exhausted once the budget of a program is spent
+type budget struct{ steps int }
+
+type exhausted struct{}
+
+func (b *budget) spend() {
+	if b.steps++; b.steps > fuzzBudget {
+		panic(exhausted{})
+	}
+}
+
+func (b *budget) Statement(stmt ast.Statement, env *object.Environment)          { b.spend() }
+func (b *budget) Call(fn *object.Box, call token.Token, env *object.Environment) { b.spend() }
+func (b *budget) Return(fn *object.Box, result object.Object)                    {}
+
+// Evaluates any program that parses without panicking, stopping programs
+// that run for longer than the budget. The result is never nil and errors
+// are positioned.
+func FuzzEval(f *testing.F) {
+	corpus.Add(f, fuzzSeeds...)
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := parser.CreateParser(lexer.CreateLexer(input))
+		program := p.ParseCardBoard()
+		if len(p.GetErrors()) > 0 {
+			return
+		}
+
+		result := evalWithin(program)
+		if result == nil {
+			t.Fatalf("Test failed. Nil result for <%q>", input)
+		}
+		if err, ok := result.(*object.Error); ok && err.Line < 1 {
+			t.Fatalf("Test failed. Error <%s: %s> without a position for <%q>", err.Kind, err.Message, input)
+		}
+	})
+}
+
+// Recursion stops with an error before running out of budget
+func TestFuzzBudget(t *testing.T) {
+	result := evalWithin(parser.CreateParser(lexer.CreateLexer(overflowProgram)).ParseCardBoard())
+	err, ok := result.(*object.Error)
+	if !ok || err.Kind != object.RUNTIME_ERROR || !strings.HasPrefix(err.Message, "Stack Overflow") {
+		t.Errorf("Test failed. Expected a stack overflow error. Got <%s>", result.Inspect())
+	}
+}
+
+// Evaluates a program, returning null when it runs out of budget
+func evalWithin(program *ast.Program) (result object.Object) {
+	env := object.CreateEnvironment()
+	env.SetOutput(io.Discard)
+	SetHook(env, &budget{})
+
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(exhausted); !ok {
+				panic(r)
+			}
+			result = NULL
+		}
+	}()
+	return Eval(program, env)
+}
+
+// Programs erring at runtime seeding the corpus along with the golden files
+var fuzzSeeds = []string{
+	fibProgram, sumProgram, closuresProgram,
+	"put f = box(x) { x }; f();", "put f = box() { 1 }; f(1, 2);", "assert();", "assertError(1);",
+	"put f = box() { f() }; f();", overflowProgram, "1(2);", "\"a\" + 1;", "x;", "put e = assertError(box() { throw 1; }); e.kind.x;",
+}
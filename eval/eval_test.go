@@ -2,8 +2,12 @@ package eval
 
 import (
 	"cardboard/lexer"
+	"cardboard/lexer/token"
 	"cardboard/object"
 	"cardboard/parser"
+	"cardboard/parser/ast"
+	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -132,6 +136,307 @@ func TestFunctionsAsArguments(t *testing.T) {
 	testIntegerObject(t, testEval(input, t), 4)
 }
 
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		line    int
+		column  int
+	}{
+		{"put a = b;", "Unknown identifier: b.", 1, 9},
+		{"put f = box(x) { x };\n5 + f;", "Type Mismatch: <INTEGER><+><FUNCTION>", 2, 3},
+		{"put a = 5;\n  -box(){};", "Type error. Can't use <-> Operator with <FUNCTION> Type.", 2, 3},
+		{"put a = 5;\na(1);", "Type Mismatch Error. Expected Function. Got <INTEGER>", 2, 2},
+		{"put a = 5;\nassertEqual(a, 6);", "Assertion failed: got 5, want 6.", 2, 12},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input, t)
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("Test failed. Expected *object.Error. Got <%T>", evaluated)
+		}
+		if err.Message != tt.message || err.Line != tt.line || err.Column != tt.column {
+			t.Fatalf("Test failed. Expected <%s> at %d:%d. Got <%s> at %d:%d",
+				tt.message, tt.line, tt.column, err.Message, err.Line, err.Column)
+		}
+	}
+}
+
+func TestErrorStackTrace(t *testing.T) {
+	input := `
+	put inner = box(x) { x + z };
+	put outer = box(x) { unbox inner(x); };
+	put v = 10;
+	box() { outer(v) }();`
+
+	evaluated := testEval(input, t)
+	err, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("Test failed. Expected *object.Error. Got <%T>", evaluated)
+	}
+
+	expected := []object.StackFrame{
+		{Function: "inner", Line: 3, Column: 34},
+		{Function: "outer", Line: 5, Column: 15},
+		{Function: "", Line: 5, Column: 20},
+	}
+
+	if len(err.Trace) != len(expected) {
+		t.Fatalf("Test failed. Expected %d stack frames. Got <%d>", len(expected), len(err.Trace))
+	}
+
+	for idx, frame := range expected {
+		if err.Trace[idx] != frame {
+			t.Fatalf("Test failed. Expected frame %d to be <%+v>. Got <%+v>", idx, frame, err.Trace[idx])
+		}
+	}
+
+	traceback := "Traceback (most recent call last):\n" +
+		"  at 5:20, in <main>\n" +
+		"  at 5:15, in <box>\n" +
+		"  at 3:34, in outer\n" +
+		"  at 2:27, in inner\n"
+
+	if err.Traceback() != traceback {
+		t.Fatalf("Test failed. Expected traceback:\n%s\nGot:\n%s", traceback, err.Traceback())
+	}
+}
+
+func TestProductExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"2 * 3;", 6},
+		{"1 + 2 * 3;", 7},
+		{"(1 + 2) * 3;", 9},
+		{"7 / 2;", 3},
+		{"-7 / 2 * 2;", -6},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input, t), tt.expected)
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { 1 / 0; } catch (e) { 5; }`, 5},
+		{`try { 10; } catch (e) { 5; }`, 10},
+		{`try { throw 42; } catch (e) { e.value; }`, 42},
+		{`try { throw "bad"; } catch (e) { e.message; }`, "bad"},
+		{`try { throw 42; } catch (e) { e.kind; }`, "UserError"},
+		{`try { 1 / 0; } catch (e) { e.kind; }`, "ZeroDivisionError"},
+		{`try { missing; } catch (e) { e.kind; }`, "NameError"},
+		{`try { 1 + box(){}; } catch (e) { e.kind; }`, "TypeError"},
+		{`try { missing; } catch (e) { e.message; }`, "Unknown identifier: missing."},
+		{`try { 1 / 0; } catch (e) { e.value; }`, "Division By Zero: <1/0>"},
+		{"try {\n  1 / 0; } catch (e) { e.line * 100 + e.column; }", 205},
+		{`put x = 1; try { put x = 2; } finally { put x = x + 10; } x;`, 12},
+		{`put x = 1; try { 1 / 0; } catch { put x = 2; } finally { put x = x * 10; } x;`, 20},
+		{`try { try { throw 1; } finally { put y = 7; } } catch (e) { y + e.value; }`, 8},
+		{`try { try { throw 1; } catch (e) { throw e.value + 1; } } catch (e) { e.value; }`, 2},
+		{`try { try { missing; } catch (e) { throw e; } } catch (e) { e.kind; }`, "NameError"},
+		{`try { 1; } finally { throw 3; }`, "error:3"},
+		{`throw "uncaught";`, "error:uncaught"},
+		{`try { 1 / 0; } finally { 1; }`, "error:Division By Zero: <1/0>"},
+		{`put f = box() { try { unbox 1; } finally { 2; } 3; }; f();`, 1},
+		{`put f = box() { try { unbox 1; } finally { unbox 2; } }; f();`, 2},
+		{`put f = box() { try { throw 1; } catch (e) { unbox 5; } 3; }; f();`, 5},
+		{`put f = box(x) { throw x * 2; }; try { f(21); } catch (e) { e.value; }`, 42},
+		{`put f = box() { missing; }; try { f(); } catch (e) { e.trace; }`,
+			"Traceback (most recent call last):\n  at 1:36, in <main>\n  at 1:17, in f\n"},
+		{`"cardboard" + " " + "box";`, "cardboard box"},
+		{`try { 5.message; } catch (e) { e.message; }`, "Type error. <INTEGER> Type has no properties."},
+		{`try { throw 1; } catch (e) { e.size; }`, "error:Unknown property: size."},
+		// The catch parameter is only bound in the catch block
+		{`put e = 5; try { 1 / 0; } catch (e) { e.kind; } e;`, 5},
+		{`try { 1 / 0; } catch (e) { 1; } e;`, "error:Unknown identifier: e."},
+		{`put f = box() { put e = 5; try { 1 / 0; } catch (e) { put e = 1; } e }; f();`, 5},
+		{`try { 1 / 0; } catch (e) { put e = 7; e; }`, 7},
+		{`put x = 1; try { throw 2; } catch (e) { put x = e.value; } x;`, 2},
+		{`try { throw 3; } catch (e) { put f = box() { e.value }; } f();`, 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input, t)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if len(expected) > 6 && expected[:6] == "error:" {
+				err, ok := evaluated.(*object.Error)
+				if !ok || err.Message != expected[6:] {
+					t.Fatalf("Test failed. Expected error <%s> for <%s>. Got <%s>", expected[6:], tt.input, evaluated.Inspect())
+				}
+				continue
+			}
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Fatalf("Test failed. Expected string <%s> for <%s>. Got <%s>", expected, tt.input, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestEmptyProgram(t *testing.T) {
+	if evaluated := testEval("", t); evaluated != NULL {
+		t.Fatalf("Test failed. Expected NULL for an empty program. Got <%v>", evaluated)
+	}
+	if evaluated := testEval("box(){}()", t); evaluated != NULL {
+		t.Fatalf("Test failed. Expected NULL for an empty box body. Got <%v>", evaluated)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// Deep enough to exhaust the Go stack without tail calls
+		{"put sum = box(n, acc) { try { 1 / n; } catch { unbox acc; } sum(n - 1, acc + n) }; sum(1000000, 0);", 500000500000},
+		{"put sum = box(n, acc) { try { 1 / n; } catch { unbox acc; } unbox sum(n - 1, acc + n); 0; }; sum(100000, 0);", 5000050000},
+		// Every call binds its own parameters
+		{"put f = box(n, g) { try { 1 / n; } catch { unbox g(); } f(n - 1, box() { n }) }; f(3, box() { 0 });", 1},
+		// Calls of other boxes and calls with the wrong arity aren't reused
+		{"put g = box(x) { x * 2 }; put f = box(x) { g(x + 1) }; f(1);", 4},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input, t), tt.expected)
+	}
+}
+
+func TestTailCallTraceback(t *testing.T) {
+	input := `
+	put f = box(n) { try { 1 / n; } catch { unbox missing; } f(n - 1) };
+	f(3);`
+
+	err, ok := testEval(input, t).(*object.Error)
+	if !ok {
+		t.Fatalf("Test failed. Expected *object.Error")
+	}
+
+	expected := []object.StackFrame{{Function: "f", Line: 3, Column: 3, TailCalls: 3}}
+	if len(err.Trace) != 1 || err.Trace[0] != expected[0] {
+		t.Fatalf("Test failed. Expected frames <%+v>. Got <%+v>", expected, err.Trace)
+	}
+
+	traceback := "Traceback (most recent call last):\n" +
+		"  at 3:3, in <main>\n" +
+		"  ... 3 tail calls of f\n" +
+		"  at 2:48, in f\n"
+
+	if err.Traceback() != traceback {
+		t.Fatalf("Test failed. Expected traceback:\n%s\nGot:\n%s", traceback, err.Traceback())
+	}
+}
+
+func TestResolvedBindings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"put f = box(a, a) { a }; f(1, 2);", 2},
+		{"put f = box(x) { put g = box() { x + y }; put y = 10; g() }; f(1);", 11},
+		{"put f = box(x) { box() { box() { x } } }; f(7)()();", 7},
+		{"put a = 1; put f = box() { put a = 2; a }; f() * 10 + a;", 21},
+		{"put f = box() { try { 1 / 0; } catch (e) { put k = e.line; } k }; f();", 1},
+		// Every call has its own bindings
+		{"put mk = box(x) { box() { x } }; put one = mk(1); put two = mk(2); one() * 10 + two();", 12},
+		// Until its 'put' runs, a binding refers to the enclosing one
+		{"put x = 1; put f = box() { put x = x + 1; x }; f();", 2},
+		{"put x = 10; put f = box(){ put y = x; put x = 1; y }; f();", 10},
+		{"box(x){ box(){ put x = x + 1; x } }(1)();", 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input, t), tt.expected)
+	}
+}
+
+// The REPL evaluates one line at a time, each line binding globals by name
+func TestGlobalsAcrossPrograms(t *testing.T) {
+	env := object.CreateEnvironment()
+
+	lines := []string{
+		"put f = box(x) { x * n };",
+		"put n = 3;",
+		"f(2);",
+	}
+
+	var result object.Object
+	for _, line := range lines {
+		p := parser.CreateParser(lexer.CreateLexer(line))
+		result = Eval(p.ParseCardBoard(), env)
+	}
+	testIntegerObject(t, result, 6)
+}
+
+// Records what the hook of the evaluator is told
+type recorder struct {
+	events []string
+}
+
+func (r *recorder) Statement(stmt ast.Statement, env *object.Environment) {
+	r.events = append(r.events, stmt.String())
+}
+
+func (r *recorder) Call(fn *object.Box, call token.Token, env *object.Environment) {
+	r.events = append(r.events, fmt.Sprintf("call %s at %d:%d", fn.Name, call.Line, call.Column))
+}
+
+func (r *recorder) Return(fn *object.Box, result object.Object) {
+	if result == nil {
+		r.events = append(r.events, "tail call of "+fn.Name)
+		return
+	}
+	r.events = append(r.events, fmt.Sprintf("return %s from %s", result.Inspect(), fn.Name))
+}
+
+func TestHook(t *testing.T) {
+	input := "put f = box(n) { try { 1 / n; } catch { unbox 0; } f(n - 1) };\nf(1);"
+	expected := []string{
+		"put f = (n,){try{(1/n)}catch{unbox 0;}f((n-1))};",
+		"f(1)",
+		"call f at 2:2",
+		"try{(1/n)}catch{unbox 0;}",
+		"(1/n)",
+		"f((n-1))",
+		"tail call of f",
+		"call f at 2:2",
+		"try{(1/n)}catch{unbox 0;}",
+		"(1/n)",
+		"unbox 0;",
+		"return 0 from f",
+	}
+
+	p := parser.CreateParser(lexer.CreateLexer(input))
+	program := p.ParseCardBoard()
+	checkParserErrors(t, p)
+
+	env := object.CreateEnvironment()
+	r := &recorder{}
+	SetHook(env, r)
+	testIntegerObject(t, Eval(program, env), 0)
+
+	if got := strings.Join(r.events, "\n"); got != strings.Join(expected, "\n") {
+		t.Errorf("Test failed. Wrong events.\nwant=%q\ngot=%q", expected, r.events)
+	}
+
+	// Without the hook, nothing is recorded
+	SetHook(env, nil)
+	r.events = nil
+	Eval(program, env)
+	if len(r.events) != 0 {
+		t.Errorf("Test failed. Expected no events once the hook is removed. Got <%q>", r.events)
+	}
+}
+
 func testEval(input string, t *testing.T) object.Object {
 	l := lexer.CreateLexer(input)
 	p := parser.CreateParser(l)
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"cardboard/format"
+	"cardboard/lexer"
+	"cardboard/parser"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Formats scripts in the canonical layout. Prints the formatted source,
+// or with -w rewrites the scripts, and with -d prints the changes instead.
+func fmtCommand(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write the formatted source back to the script")
+	diff := flags.Bool("d", false, "print the changes formatting makes, as a diff")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: cardboard fmt [-w] [-d] script.cb ...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	code := 0
+	for _, path := range flags.Args() {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+			continue
+		}
+
+		p := parser.CreateParser(lexer.CreateLexer(string(source)))
+		program := p.ParseCardBoard()
+		if errs := p.GetErrors(); len(errs) > 0 {
+			for _, err := range errs {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			}
+			code = 1
+			continue
+		}
+
+		formatted := format.Program(program)
+		switch {
+		case *diff:
+			fmt.Print(unifiedDiff(path, string(source), formatted))
+		case *write:
+			if formatted == string(source) {
+				continue
+			}
+			if err := os.WriteFile(path, []byte(formatted), 0o644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				code = 1
+			}
+		default:
+			fmt.Print(formatted)
+		}
+	}
+	return code
+}
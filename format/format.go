@@ -0,0 +1,321 @@
+// Package format renders programs back to source in the canonical layout:
+// one statement per line ending with ';', bodies indented by four spaces,
+// single spaces around operators and after commas, and only the
+// parentheses the precedence of operators requires.
+//
+// Comments are kept where they were, between the statements they sit
+// between, or at the end of the line of the statement they follow. Single
+// blank lines between statements are kept too.
+package format
+
+import (
+	"bytes"
+	"cardboard/lexer/token"
+	"cardboard/parser/ast"
+	"strconv"
+	"strings"
+)
+
+const indentation = "    "
+
+// Program returns the canonical source of a program. Formatting the
+// source of the result again gives the same source.
+func Program(program *ast.Program) string {
+	p := &printer{comments: program.Comments}
+	for _, stmt := range program.Statements {
+		p.item(position(stmt))
+		p.statement(stmt)
+		p.lastLine = endLine(stmt)
+	}
+	p.commentsBefore(token.Token{Line: int(^uint(0) >> 1)})
+
+	if p.out.Len() == 0 {
+		return ""
+	}
+	p.out.WriteString("\n")
+	return p.out.String()
+}
+
+type printer struct {
+	out    bytes.Buffer
+	indent int
+
+	// Comments of the program, and the index of the next one to print
+	comments []*ast.Comment
+	next     int
+
+	// Source line the last printed statement or comment ends on,
+	// 0 before the first one of the program
+	lastLine int
+
+	// Nothing was printed yet in the block being printed
+	blockStart bool
+}
+
+// Starts a new line for a statement or comment starting on the given
+// source token, keeping a blank line when the source has one
+func (p *printer) item(tok token.Token) {
+	p.commentsBefore(tok)
+	p.startLine(tok.Line)
+}
+
+func (p *printer) startLine(line int) {
+	if p.lastLine == 0 {
+		p.blockStart = false
+		return
+	}
+	if !p.blockStart && line > p.lastLine+1 {
+		p.out.WriteString("\n")
+	}
+	p.blockStart = false
+
+	p.out.WriteString("\n")
+	p.out.WriteString(strings.Repeat(indentation, p.indent))
+}
+
+// Prints the comments positioned before a token. Comments within the
+// lines of the last statement of a body go at the end of its line.
+func (p *printer) commentsBefore(tok token.Token) {
+	for ; p.next < len(p.comments); p.next++ {
+		comment := p.comments[p.next]
+		pos := comment.NodeToken
+		if pos.Line > tok.Line || (pos.Line == tok.Line && pos.Column >= tok.Column) {
+			return
+		}
+
+		if p.lastLine != 0 && pos.Line <= p.lastLine && !p.blockStart {
+			p.out.WriteString(" ")
+		} else {
+			p.startLine(pos.Line)
+		}
+		p.out.WriteString(commentText(comment))
+		p.lastLine = maxLine(p.lastLine, pos.Line+strings.Count(comment.Text, "\n"))
+	}
+}
+
+func commentText(comment *ast.Comment) string {
+	text := strings.TrimSpace(comment.Text)
+	if text == "" {
+		return "<>"
+	}
+	return "< " + text + " >"
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.PutStatement:
+		p.out.WriteString("put " + stmt.NodeIdentifier.Value)
+		if stmt.Type != nil {
+			p.out.WriteString(": " + stmt.Type.String())
+		}
+		p.out.WriteString(" = ")
+		p.expression(stmt.NodeExpression, lowest)
+		p.out.WriteString(";")
+	case *ast.UnboxStatement:
+		p.out.WriteString("unbox ")
+		p.expression(stmt.NodeExpression, lowest)
+		p.out.WriteString(";")
+	case *ast.ThrowStatement:
+		p.out.WriteString("throw ")
+		p.expression(stmt.NodeExpression, lowest)
+		p.out.WriteString(";")
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression, lowest)
+		p.out.WriteString(";")
+	case *ast.TryStatement:
+		p.out.WriteString("try ")
+		p.block(stmt.Body)
+		if stmt.Catch != nil {
+			p.out.WriteString(" catch ")
+			if stmt.CatchParameter != nil {
+				p.out.WriteString("(" + stmt.CatchParameter.Value + ") ")
+			}
+			p.block(stmt.Catch)
+		}
+		if stmt.Finally != nil {
+			p.out.WriteString(" finally ")
+			p.block(stmt.Finally)
+		}
+	}
+}
+
+func (p *printer) block(block *ast.BlockStatement) {
+	p.out.WriteString("{")
+	p.indent++
+	p.lastLine = block.NodeToken.Line
+	p.blockStart = true
+
+	for _, stmt := range block.Statements {
+		p.item(position(stmt))
+		p.statement(stmt)
+		p.lastLine = endLine(stmt)
+	}
+	p.commentsBefore(block.RightBrace)
+
+	p.indent--
+	if !p.blockStart {
+		p.out.WriteString("\n" + strings.Repeat(indentation, p.indent))
+	}
+	p.blockStart = false
+	p.out.WriteString("}")
+	p.lastLine = block.RightBrace.Line
+}
+
+// Precedences of expressions, deciding where parentheses are needed
+const (
+	lowest = iota
+	sum
+	product
+	prefix
+	call
+)
+
+func precedence(expr ast.Expression) int {
+	switch expr := expr.(type) {
+	case *ast.InfixExpression:
+		if expr.Operator == "*" || expr.Operator == "/" {
+			return product
+		}
+		return sum
+	case *ast.PrefixExpression:
+		return prefix
+	}
+	return call
+}
+
+// Prints an expression, in parentheses when its precedence is lower
+// than the given one
+func (p *printer) expression(expr ast.Expression, min int) {
+	if precedence(expr) < min {
+		p.out.WriteString("(")
+		defer p.out.WriteString(")")
+	}
+
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		p.out.WriteString(expr.Value)
+	case *ast.IntegerLiteral:
+		p.out.WriteString(strconv.FormatInt(expr.Value, 10))
+	case *ast.StringLiteral:
+		p.out.WriteString(ast.QuoteString(expr.Value))
+	case *ast.PrefixExpression:
+		p.out.WriteString(expr.Operator)
+		p.expression(expr.Right, prefix)
+	case *ast.InfixExpression:
+		// Operators group to the left, the right operand needs parentheses
+		// when it has the same precedence
+		op := precedence(expr)
+		p.expression(expr.Left, op)
+		p.out.WriteString(" " + expr.Operator + " ")
+		p.expression(expr.Right, op+1)
+	case *ast.BoxExpression:
+		p.boxExpression(expr)
+	case *ast.CallExpression:
+		p.expression(expr.Function, call)
+		p.out.WriteString("(")
+		for idx, arg := range expr.Arguments {
+			if idx > 0 {
+				p.out.WriteString(", ")
+			}
+			p.expression(arg, lowest)
+		}
+		p.out.WriteString(")")
+	case *ast.MemberExpression:
+		p.expression(expr.Object, call)
+		p.out.WriteString("." + expr.Property.Value)
+	}
+}
+
+func (p *printer) boxExpression(box *ast.BoxExpression) {
+	p.out.WriteString("box(")
+	for idx, param := range box.ParameterList {
+		if idx > 0 {
+			p.out.WriteString(", ")
+		}
+		p.out.WriteString(param.Value)
+		if typ := box.ParameterType(idx); typ != nil {
+			p.out.WriteString(": " + typ.String())
+		}
+	}
+	p.out.WriteString(") ")
+	if box.ReturnType != nil {
+		p.out.WriteString("-> " + box.ReturnType.String() + " ")
+	}
+	p.block(box.Body)
+}
+
+// Token a statement starts on
+func position(stmt ast.Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *ast.PutStatement:
+		return stmt.NodeToken
+	case *ast.UnboxStatement:
+		return stmt.NodeToken
+	case *ast.ThrowStatement:
+		return stmt.NodeToken
+	case *ast.ExpressionStatement:
+		return stmt.NodeToken
+	case *ast.TryStatement:
+		return stmt.NodeToken
+	}
+	return token.Token{}
+}
+
+// Last source line of a statement, as far as the tokens kept in the tree
+// tell. Statements formatted on several lines end with a block, whose
+// closing brace is known.
+func endLine(stmt ast.Statement) int {
+	switch stmt := stmt.(type) {
+	case *ast.PutStatement:
+		return maxLine(stmt.NodeToken.Line, expressionEndLine(stmt.NodeExpression))
+	case *ast.UnboxStatement:
+		return maxLine(stmt.NodeToken.Line, expressionEndLine(stmt.NodeExpression))
+	case *ast.ThrowStatement:
+		return maxLine(stmt.NodeToken.Line, expressionEndLine(stmt.NodeExpression))
+	case *ast.ExpressionStatement:
+		return maxLine(stmt.NodeToken.Line, expressionEndLine(stmt.Expression))
+	case *ast.TryStatement:
+		end := stmt.Body.RightBrace.Line
+		if stmt.Catch != nil {
+			end = stmt.Catch.RightBrace.Line
+		}
+		if stmt.Finally != nil {
+			end = stmt.Finally.RightBrace.Line
+		}
+		return end
+	}
+	return 0
+}
+
+func expressionEndLine(expr ast.Expression) int {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		return expr.NodeToken.Line
+	case *ast.IntegerLiteral:
+		return expr.NodeToken.Line
+	case *ast.StringLiteral:
+		return expr.NodeToken.Line
+	case *ast.PrefixExpression:
+		return expressionEndLine(expr.Right)
+	case *ast.InfixExpression:
+		return maxLine(expressionEndLine(expr.Left), expressionEndLine(expr.Right))
+	case *ast.BoxExpression:
+		return expr.Body.RightBrace.Line
+	case *ast.CallExpression:
+		end := expressionEndLine(expr.Function)
+		for _, arg := range expr.Arguments {
+			end = maxLine(end, expressionEndLine(arg))
+		}
+		return end
+	case *ast.MemberExpression:
+		return expr.Property.NodeToken.Line
+	}
+	return 0
+}
+
+func maxLine(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
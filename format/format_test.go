@@ -0,0 +1,98 @@
+package format
+
+import (
+	"cardboard/lexer"
+	"cardboard/parser"
+	"cardboard/parser/ast"
+	"testing"
+)
+
+func TestProgram(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"put a=5;", "put a = 5;\n"},
+		{"put a: int = 5; a", "put a: int = 5;\na;\n"},
+		{"add(1,2 , 3)", "add(1, 2, 3);\n"},
+		{"1+2*3; (1+2)*3; 1-(2-3); (1-2)-3; 1+(2+3)", "1 + 2 * 3;\n(1 + 2) * 3;\n1 - (2 - 3);\n1 - 2 - 3;\n1 + (2 + 3);\n"},
+		{"-(1+2); -(-a); -f(1); (-a).kind", "-(1 + 2);\n--a;\n-f(1);\n(-a).kind;\n"},
+		{`"a\"b\n"`, "\"a\\\"b\\n\";\n"},
+		{"put f = box(a,b){a+b};", "put f = box(a, b) {\n    a + b;\n};\n"},
+		{"box(){}(); box(x){x}(5)", "box() {}();\nbox(x) {\n    x;\n}(5);\n"},
+		{
+			"put f = box(a: int, g: box(int) -> int) -> int { unbox g(a); };",
+			"put f = box(a: int, g: box(int) -> int) -> int {\n    unbox g(a);\n};\n",
+		},
+		{
+			"try { throw 1; } catch (e) { e.value } finally { put x = 1; }",
+			"try {\n    throw 1;\n} catch (e) {\n    e.value;\n} finally {\n    put x = 1;\n}\n",
+		},
+		{"try { 1 } catch { 2 }", "try {\n    1;\n} catch {\n    2;\n}\n"},
+		// Blank lines are kept, but not repeated
+		{"put a = 1;\n\n\n\nput b = 2;\nput c = 3;", "put a = 1;\n\nput b = 2;\nput c = 3;\n"},
+		{"box() {\n\n  1;\n\n  2;\n\n}", "box() {\n    1;\n\n    2;\n};\n"},
+		// Comments
+		{"< only >", "< only >\n"},
+		{"<a>\nput a = 1; <b>\n<c>\na;<d>", "< a >\nput a = 1; < b >\n< c >\na; < d >\n"},
+		{"put f = box() { < first >\n  1; < one >\n  < last >\n};", "put f = box() {\n    < first >\n    1; < one >\n    < last >\n};\n"},
+		{"box() { <>  }", "box() {\n    <>\n};\n"},
+		{"put a = f(1, < one >\n 2);\na;", "put a = f(1, 2); < one >\na;\n"},
+	}
+
+	for _, tt := range tests {
+		formatted := Program(parse(t, tt.input))
+		if formatted != tt.expected {
+			t.Errorf("Test failed. Wrong format of <%s>.\nwant=%q\ngot=%q", tt.input, tt.expected, formatted)
+		}
+	}
+}
+
+// Formatting is idempotent, and keeps the meaning of programs
+func TestIdempotent(t *testing.T) {
+	inputs := []string{
+		`
+		< Function Declaration >
+		put add = box(a, b) { put y = a + b; unbox y; };  < adds >
+
+
+		put applyFunc = box(a, b, func) { func(a, b) }; applyFunc(2, 2, add);
+		put newAdder = box(x) {
+		  box(y) { x + y }
+		};
+		< trailing >`,
+		"put f = box(n) { try { 1 / n; } catch { unbox 1; } n * f(n - 1) }; f(5);",
+		"try { try { throw 1; } finally { put y = 7; } } catch (e) { y + e.value; }",
+		"put a = box(x) { box(y) { box(z) { x + y + z } } }; a(1)(2)(3);",
+		"box() {\n  < a >\n\n  < b >\n  1\n}",
+		"-7 / 2 * 2; 2 * (3 / 4); 1 - -2; (a + b).kind; box(){}.kind;",
+	}
+
+	for _, input := range inputs {
+		program := parse(t, input)
+		once := Program(program)
+
+		reparsed := parse(t, once)
+		if reparsed.String() != program.String() {
+			t.Errorf("Test failed. Formatting changed the program <%s>.\nwant=%s\ngot=%s", input, program.String(), reparsed.String())
+		}
+		if len(reparsed.Comments) != len(program.Comments) {
+			t.Errorf("Test failed. Formatting lost comments of <%s>. Got <%s>", input, once)
+		}
+
+		twice := Program(reparsed)
+		if twice != once {
+			t.Errorf("Test failed. Formatting <%s> isn't idempotent.\nonce=%q\ntwice=%q", input, once, twice)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.CreateParser(lexer.CreateLexer(input))
+	program := p.ParseCardBoard()
+	if errs := p.GetErrors(); len(errs) > 0 {
+		t.Fatalf("Test failed. Parser errors for <%s>: %v", input, errs)
+	}
+	return program
+}
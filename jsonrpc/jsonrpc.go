@@ -0,0 +1,200 @@
+// Package jsonrpc reads and writes JSON-RPC 2.0 messages over a stream,
+// each framed by a header giving its length, the base protocol of the
+// Language Server Protocol:
+//
+//	Content-Length: 52\r\n
+//	\r\n
+//	{"jsonrpc":"2.0","id":1,"method":"shutdown"}
+//
+// The framing is used on its own for any JSON value by Read and Write.
+package jsonrpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const Version = "2.0"
+
+// Error codes defined by JSON-RPC
+const (
+	ParseError     = -32700
+	InvalidRequest = -32600
+	MethodNotFound = -32601
+	InvalidParams  = -32602
+	InternalError  = -32603
+)
+
+// A request, a response to one, or a notification, which is a request
+// without an ID that never gets a response.
+type Message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *Error           `json:"error,omitempty"`
+}
+
+// IsRequest reports whether the message is a request or a notification
+func (m *Message) IsRequest() bool { return m.Method != "" }
+
+// IsNotification reports whether the message is a request without an ID
+func (m *Message) IsNotification() bool { return m.Method != "" && m.ID == nil }
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
+}
+
+// Errorf returns an error with the given code, sent as is in responses
+func Errorf(code int, format string, a ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+// A stream of framed messages. Writes are safe from several goroutines.
+type Conn struct {
+	reader *bufio.Reader
+
+	mu     sync.Mutex
+	writer io.Writer
+}
+
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	return &Conn{reader: bufio.NewReader(r), writer: w}
+}
+
+// Read reads the next framed value into v. It returns io.EOF when the
+// stream ends between values.
+func (c *Conn) Read(v interface{}) error {
+	length := -1
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" && length == -1 {
+				return io.EOF
+			}
+			return fmt.Errorf("Invalid message header: %w", err)
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return fmt.Errorf("Invalid message header: %q", line)
+		}
+		if strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil || length < 0 {
+				return fmt.Errorf("Invalid Content-Length: %q", value)
+			}
+		}
+	}
+	if length == -1 {
+		return fmt.Errorf("Invalid message header: missing Content-Length")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return fmt.Errorf("Invalid message body: %w", err)
+	}
+	return json.Unmarshal(body, v)
+}
+
+// Write writes v as a framed value
+func (c *Conn) Write(v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := fmt.Fprintf(c.writer, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = c.writer.Write(body)
+	return err
+}
+
+// ReadMessage reads the next message
+func (c *Conn) ReadMessage() (*Message, error) {
+	msg := &Message{}
+	if err := c.Read(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Request sends a request. Its ID is any JSON value, usually a number.
+func (c *Conn) Request(id interface{}, method string, params interface{}) error {
+	raw, err := marshalRaw(id)
+	if err != nil {
+		return err
+	}
+	msg := &Message{JSONRPC: Version, ID: &raw, Method: method}
+	if msg.Params, err = marshalParams(params); err != nil {
+		return err
+	}
+	return c.Write(msg)
+}
+
+// Notify sends a notification
+func (c *Conn) Notify(method string, params interface{}) error {
+	msg := &Message{JSONRPC: Version, Method: method}
+	var err error
+	if msg.Params, err = marshalParams(params); err != nil {
+		return err
+	}
+	return c.Write(msg)
+}
+
+// Reply sends the response to the request with the given ID: an error
+// when err isn't nil, the result otherwise. Errors other than *Error are
+// sent as internal errors.
+func (c *Conn) Reply(id *json.RawMessage, result interface{}, err error) error {
+	msg := &Message{JSONRPC: Version, ID: id}
+	if id == nil {
+		// Requests too invalid to find their ID get a null one
+		null := json.RawMessage("null")
+		msg.ID = &null
+	}
+
+	if err != nil {
+		rpcErr, ok := err.(*Error)
+		if !ok {
+			rpcErr = &Error{Code: InternalError, Message: err.Error()}
+		}
+		msg.Error = rpcErr
+		return c.Write(msg)
+	}
+
+	if msg.Result, err = marshalRaw(result); err != nil {
+		return err
+	}
+	return c.Write(msg)
+}
+
+func marshalRaw(v interface{}) (json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	return json.RawMessage(data), err
+}
+
+// Params are omitted rather than null when there are none
+func marshalParams(params interface{}) (json.RawMessage, error) {
+	if params == nil {
+		return nil, nil
+	}
+	return marshalRaw(params)
+}
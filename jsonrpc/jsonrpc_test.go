@@ -0,0 +1,83 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var stream bytes.Buffer
+	conn := NewConn(&stream, &stream)
+
+	if err := conn.Request(1, "initialize", map[string]int{"processId": 7}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Notify("exit", nil); err != nil {
+		t.Fatal(err)
+	}
+	id := json.RawMessage("1")
+	if err := conn.Reply(&id, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Reply(&id, nil, Errorf(MethodNotFound, "Unknown method: %s", "x")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"processId":7}}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+		`{"jsonrpc":"2.0","id":1,"result":null}`,
+		`{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"Unknown method: x"}}`,
+	}
+	for _, want := range expected {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Test failed. Can't read %s: %s", want, err)
+		}
+		got, _ := json.Marshal(msg)
+		if string(got) != want {
+			t.Errorf("Test failed. Wrong message.\nwant=%s\ngot=%s", want, got)
+		}
+	}
+
+	if _, err := conn.ReadMessage(); err != io.EOF {
+		t.Errorf("Test failed. Expected EOF after the last message. Got <%v>", err)
+	}
+}
+
+func TestFraming(t *testing.T) {
+	stream := "Content-Length: 2\r\nContent-Type: application/vscode-jsonrpc; charset=utf-8\r\n\r\n{}" +
+		"content-length:4\r\n\r\nnull"
+	conn := NewConn(strings.NewReader(stream), io.Discard)
+
+	for idx := 0; idx < 2; idx++ {
+		var v interface{}
+		if err := conn.Read(&v); err != nil {
+			t.Fatalf("Test failed. Can't read value %d: %s", idx, err)
+		}
+	}
+}
+
+func TestInvalidFraming(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Content-Length: 2\r\n{}", "Invalid message header"},
+		{"\r\n{}", "Invalid message header: missing Content-Length"},
+		{"Content-Length: x\r\n\r\n", `Invalid Content-Length: " x"`},
+		{"Content-Length: 10\r\n\r\n{}", "Invalid message body: unexpected EOF"},
+		{"Content-Length: 2\r\n\r\n{x", "invalid character"},
+	}
+
+	for _, tt := range tests {
+		var v interface{}
+		err := NewConn(strings.NewReader(tt.input), io.Discard).Read(&v)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("Test failed. Expected error containing %q for %q. Got <%v>", tt.expected, tt.input, err)
+		}
+	}
+}
@@ -1,19 +1,58 @@
+// Package lexer splits the source of cardboard scripts into tokens.
+//
+// Source is UTF-8 text, read rune by rune. Positions are 1-based lines
+// and columns, columns counting runes rather than bytes.
+//
+//   - Identifiers start with a Unicode letter or '_', followed by any
+//     number of Unicode letters, '_' and Unicode decimal digits: 'x2',
+//     '_tmp' and 'größe' are identifiers, '2x' is an integer then one.
+//   - Integers are sequences of the ASCII digits '0' to '9'.
+//   - Strings and comments hold any rune.
+//   - Unicode white space separates tokens.
+//
+// Bytes that aren't valid UTF-8 are reported by Errors with their
+// position. They're skipped between tokens, and read as U+FFFD within
+// strings.
 package lexer
 
 import (
+	"bytes"
 	"cardboard/lexer/token"
+	"fmt"
 	"unicode"
+	"unicode/utf8"
 )
 
 type Lexer struct {
 	data    string
 	curPos  int
 	nextPos int
-	char    byte
+	char    rune
+
+	// Bytes taken by the current char in data, 1 for invalid UTF-8
+	width int
+
+	// Position of the current char
+	line   int
+	column int
+
+	// Comments read so far
+	comments []token.Token
+
+	// Errors met so far
+	errors []Error
+}
+
+// An Error is a part of the source that isn't valid, like bytes that
+// aren't valid UTF-8
+type Error struct {
+	Message string
+	Line    int
+	Column  int
 }
 
 func CreateLexer(inputData string) *Lexer {
-	lexer := Lexer{data: inputData}
+	lexer := Lexer{data: inputData, line: 1}
 	lexer.readChar()
 	return &lexer
 }
@@ -22,6 +61,7 @@ func (lex *Lexer) NextToken() token.Token {
 	var curToken token.Token
 
 	lex.eatWhiteSpace()
+	line, column := lex.line, lex.column
 
 	switch lex.char {
 
@@ -38,55 +78,191 @@ func (lex *Lexer) NextToken() token.Token {
 		curToken = token.NewToken(token.COMMA, ",")
 	case ';':
 		curToken = token.NewToken(token.SCOLON, ";")
+	case '.':
+		curToken = token.NewToken(token.DOT, ".")
+	case ':':
+		curToken = token.NewToken(token.COLON, ":")
 
 	// Arithmetic Operators
 	case '+':
 		curToken = token.NewToken(token.ADD, "+")
 	case '-':
-		curToken = token.NewToken(token.SUB, "-")
+		if lex.peekChar() == '>' {
+			lex.readChar()
+			curToken = token.NewToken(token.ARROW, "->")
+		} else {
+			curToken = token.NewToken(token.SUB, "-")
+		}
+	case '*':
+		curToken = token.NewToken(token.MUL, "*")
+	case '/':
+		curToken = token.NewToken(token.DIV, "/")
 	case '=':
 		curToken = token.NewToken(token.ASSIGN, "=")
 
+	// Strings
+	case '"':
+		if str, ok := lex.readString(); ok {
+			curToken = token.NewToken(token.STRING, str)
+		} else {
+			// Unterminated string
+			curToken = token.NewToken(token.UNKNOWN, "\""+str)
+		}
+
+	// Comments
+	case '<':
+		text, ok := lex.readComment()
+		if !ok {
+			// Unterminated comment
+			return positioned(token.NewToken(token.UNKNOWN, "<"+text), line, column)
+		}
+		lex.readChar()
+		lex.comments = append(lex.comments, positioned(token.NewToken(token.COMMENT, text), line, column))
+		return lex.NextToken()
+
 	// EOF
 	case 0:
 		curToken = token.NewToken(token.EOF, "")
 
 	default:
+		// Invalid bytes are reported by readChar
+		if lex.invalidChar() {
+			lex.readChar()
+			return lex.NextToken()
+		}
+
 		// isInteger, isLetter return their tokens because
 		// theres no need to move the lexer char pointer forwards!
 		if isInteger(lex.char) {
 			readInteger := lex.readInteger()
-			return token.NewToken(token.INT, readInteger)
+			return positioned(token.NewToken(token.INT, readInteger), line, column)
 		} else if isLetter(lex.char) {
 			readIdentifier := lex.readIdentifier()
-			return token.NewToken(token.GetIdentifierType(readIdentifier), readIdentifier)
+			return positioned(token.NewToken(token.GetIdentifierType(readIdentifier), readIdentifier), line, column)
 		} else {
 			// Unknown token
 			curToken = token.NewToken(token.UNKNOWN, string(lex.char))
 		}
 	}
 	lex.readChar()
-	return curToken
+	return positioned(curToken, line, column)
+}
+
+func positioned(tok token.Token, line int, column int) token.Token {
+	tok.Line = line
+	tok.Column = column
+	return tok
 }
 
 func (lex *Lexer) readChar() {
-	if lex.nextPos >= len(lex.data) {
-		lex.char = 0
+	// Past the end, reading stays put
+	if lex.nextPos > len(lex.data) {
+		return
+	}
+
+	if lex.char == '\n' {
+		lex.line++
+		lex.column = 1
 	} else {
-		lex.char = lex.data[lex.nextPos]
+		lex.column++
 	}
 	lex.curPos = lex.nextPos
-	lex.nextPos++
+	if lex.curPos >= len(lex.data) {
+		lex.char, lex.width = 0, 0
+		lex.nextPos++
+		return
+	}
+
+	lex.char, lex.width = utf8.DecodeRuneInString(lex.data[lex.curPos:])
+	lex.nextPos += lex.width
+	if lex.invalidChar() {
+		lex.errors = append(lex.errors, Error{
+			Message: fmt.Sprintf("Invalid UTF-8 encoding at %d:%d: <%#x>", lex.line, lex.column, lex.data[lex.curPos]),
+			Line:    lex.line,
+			Column:  lex.column,
+		})
+	}
+}
+
+// Whether the current char is a byte that isn't valid UTF-8, rather than
+// a U+FFFD written in the source
+func (lex *Lexer) invalidChar() bool {
+	return lex.char == utf8.RuneError && lex.width == 1
+}
+
+// Returns the character following the current one, without reading it
+func (lex *Lexer) peekChar() rune {
+	if lex.nextPos >= len(lex.data) {
+		return 0
+	}
+	char, _ := utf8.DecodeRuneInString(lex.data[lex.nextPos:])
+	return char
 }
 
 func (lex *Lexer) readIdentifier() string {
 	startPos := lex.curPos
-	for isLetter(lex.char) {
+	for isLetter(lex.char) || unicode.IsDigit(lex.char) {
 		lex.readChar()
 	}
 	return string(lex.data[startPos:lex.curPos])
 }
 
+// Reads a string literal, starting on its opening quote and stopping on the
+// closing one. Escape sequences are decoded. Returns false when the input
+// ends before the string is closed.
+func (lex *Lexer) readString() (string, bool) {
+	var str bytes.Buffer
+	for {
+		lex.readChar()
+		switch lex.char {
+		case '"':
+			return str.String(), true
+		case 0:
+			return str.String(), false
+		case '\\':
+			lex.readChar()
+			switch lex.char {
+			case 'n':
+				str.WriteByte('\n')
+			case 't':
+				str.WriteByte('\t')
+			case 0:
+				return str.String(), false
+			default:
+				str.WriteRune(lex.char)
+			}
+		default:
+			str.WriteRune(lex.char)
+		}
+	}
+}
+
+// Reads a comment, starting on its opening '<' and stopping on the closing
+// '>'. Returns the text between them, and false when the input ends before
+// the comment is closed.
+func (lex *Lexer) readComment() (string, bool) {
+	startPos := lex.nextPos
+	for {
+		lex.readChar()
+		switch lex.char {
+		case '>':
+			return lex.data[startPos:lex.curPos], true
+		case 0:
+			return lex.data[startPos:lex.curPos], false
+		}
+	}
+}
+
+// Comments returns the comments skipped so far, in source order
+func (lex *Lexer) Comments() []token.Token {
+	return lex.comments
+}
+
+// Errors returns the errors met so far, in source order
+func (lex *Lexer) Errors() []Error {
+	return lex.errors
+}
+
 func (lex *Lexer) readInteger() string {
 	startPos := lex.curPos
 	for isInteger(lex.char) {
@@ -95,16 +271,16 @@ func (lex *Lexer) readInteger() string {
 	return string(lex.data[startPos:lex.curPos])
 }
 
-func isLetter(ch byte) bool {
-	return unicode.IsLetter(rune(ch))
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
 }
 
-func isInteger(ch byte) bool {
-	return unicode.IsDigit(rune(ch))
+func isInteger(ch rune) bool {
+	return '0' <= ch && ch <= '9'
 }
 
 func (lex *Lexer) eatWhiteSpace() {
-	for unicode.IsSpace(rune(lex.char)) {
+	for unicode.IsSpace(lex.char) {
 		lex.readChar()
 	}
 }
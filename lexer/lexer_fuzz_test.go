@@ -0,0 +1,42 @@
+package lexer
+
+import (
+	"cardboard/conformance/corpus"
+	"cardboard/lexer/token"
+	"testing"
+	"unicode/utf8"
+)
+
+// Lexes any input to the end, each token starting at a valid position
+// after the previous one
+func FuzzNextToken(f *testing.F) {
+	corpus.Add(f, fuzzSeeds...)
+
+	f.Fuzz(func(t *testing.T, input string) {
+		lex := CreateLexer(input)
+		line, column := 0, 0
+		// Every token but EOF reads at least one byte
+		for i := 0; i <= len(input); i++ {
+			tok := lex.NextToken()
+			if tok.Line < 1 || tok.Column < 0 {
+				t.Fatalf("Test failed. Token <%s> at invalid position %d:%d", tok.TokenLiteral, tok.Line, tok.Column)
+			}
+			if tok.Line < line || (tok.Line == line && tok.Column < column) {
+				t.Fatalf("Test failed. Token <%s> at %d:%d before the previous one at %d:%d",
+					tok.TokenLiteral, tok.Line, tok.Column, line, column)
+			}
+			if tok.TokenType == token.EOF {
+				// Only bytes that aren't valid UTF-8 are errors
+				if utf8.ValidString(input) && len(lex.Errors()) > 0 {
+					t.Fatalf("Test failed. Errors <%+v> for valid UTF-8 <%q>", lex.Errors(), input)
+				}
+				return
+			}
+			line, column = tok.Line, tok.Column
+		}
+		t.Fatalf("Test failed. No EOF after %d tokens for <%q>", len(input)+1, input)
+	})
+}
+
+// Malformed inputs seeding the corpus along with the golden files
+var fuzzSeeds = []string{"", "put x = 5;", "\"unterminated", "< unterminated", "$", "x ->", "\xff", "größe = \"世界\""}
@@ -2,6 +2,8 @@ package lexer
 
 import (
 	"cardboard/lexer/token"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -94,12 +96,12 @@ func TestLexer2(t *testing.T) {
 }
 
 func TestLexer3(t *testing.T) {
-	input := `/]?`
+	input := `$]?`
 	expectedResult := []struct {
 		expectedType    token.TokenType
 		expectedLiteral string
 	}{
-		{expectedType: token.UNKNOWN, expectedLiteral: "/"},
+		{expectedType: token.UNKNOWN, expectedLiteral: "$"},
 		{expectedType: token.UNKNOWN, expectedLiteral: "]"},
 		{expectedType: token.UNKNOWN, expectedLiteral: "?"},
 		{expectedType: token.EOF, expectedLiteral: ""},
@@ -123,3 +125,204 @@ func TestLexer3(t *testing.T) {
 	}
 
 }
+
+func TestExceptionTokens(t *testing.T) {
+	input := `try { throw "bad \"input\""; } catch (e) { e.message; } finally { 6 * 2 / 3; } "open`
+	expectedResult := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.TRY, "try"}, {token.LCURLY, "{"}, {token.THROW, "throw"},
+		{token.STRING, `bad "input"`}, {token.SCOLON, ";"}, {token.RCURLY, "}"},
+		{token.CATCH, "catch"}, {token.LPAREN, "("}, {token.IDENTIFIER, "e"}, {token.RPAREN, ")"},
+		{token.LCURLY, "{"}, {token.IDENTIFIER, "e"}, {token.DOT, "."}, {token.IDENTIFIER, "message"},
+		{token.SCOLON, ";"}, {token.RCURLY, "}"}, {token.FINALLY, "finally"}, {token.LCURLY, "{"},
+		{token.INT, "6"}, {token.MUL, "*"}, {token.INT, "2"}, {token.DIV, "/"}, {token.INT, "3"},
+		{token.SCOLON, ";"}, {token.RCURLY, "}"}, {token.UNKNOWN, `"open`}, {token.EOF, ""},
+	}
+
+	l := CreateLexer(input)
+
+	for _, testToken := range expectedResult {
+		lexerToken := l.NextToken()
+
+		if (lexerToken.TokenType != testToken.expectedType) ||
+			(lexerToken.TokenLiteral != testToken.expectedLiteral) {
+			t.Fatalf("Test Failed! Expected Token: <Type: %s, Literal: %s> but Got Token: <Type: %s, Literal: %s>\n",
+				testToken.expectedType,
+				testToken.expectedLiteral,
+				lexerToken.TokenType,
+				lexerToken.TokenLiteral)
+		}
+	}
+}
+
+func TestTypeAnnotationTokens(t *testing.T) {
+	input := `put f: box(int) -> int = box(a: int) -> int { a - 1 };`
+	expectedResult := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.PUT, "put"}, {token.IDENTIFIER, "f"}, {token.COLON, ":"}, {token.BOX, "box"},
+		{token.LPAREN, "("}, {token.IDENTIFIER, "int"}, {token.RPAREN, ")"}, {token.ARROW, "->"},
+		{token.IDENTIFIER, "int"}, {token.ASSIGN, "="}, {token.BOX, "box"}, {token.LPAREN, "("},
+		{token.IDENTIFIER, "a"}, {token.COLON, ":"}, {token.IDENTIFIER, "int"}, {token.RPAREN, ")"},
+		{token.ARROW, "->"}, {token.IDENTIFIER, "int"}, {token.LCURLY, "{"}, {token.IDENTIFIER, "a"},
+		{token.SUB, "-"}, {token.INT, "1"}, {token.RCURLY, "}"}, {token.SCOLON, ";"}, {token.EOF, ""},
+	}
+
+	l := CreateLexer(input)
+
+	for _, testToken := range expectedResult {
+		lexerToken := l.NextToken()
+
+		if (lexerToken.TokenType != testToken.expectedType) ||
+			(lexerToken.TokenLiteral != testToken.expectedLiteral) {
+			t.Fatalf("Test Failed! Expected Token: <Type: %s, Literal: %s> but Got Token: <Type: %s, Literal: %s>\n",
+				testToken.expectedType,
+				testToken.expectedLiteral,
+				lexerToken.TokenType,
+				lexerToken.TokenLiteral)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "< first >put x = 5; <second\nline>\nx < open"
+	expected := []token.Token{
+		{TokenType: token.PUT, TokenLiteral: "put", Line: 1, Column: 10},
+		{TokenType: token.IDENTIFIER, TokenLiteral: "x", Line: 1, Column: 14},
+		{TokenType: token.ASSIGN, TokenLiteral: "=", Line: 1, Column: 16},
+		{TokenType: token.INT, TokenLiteral: "5", Line: 1, Column: 18},
+		{TokenType: token.SCOLON, TokenLiteral: ";", Line: 1, Column: 19},
+		{TokenType: token.IDENTIFIER, TokenLiteral: "x", Line: 3, Column: 1},
+		{TokenType: token.UNKNOWN, TokenLiteral: "< open", Line: 3, Column: 3},
+	}
+
+	l := CreateLexer(input)
+	for _, tt := range expected {
+		tok := l.NextToken()
+		if tok != tt {
+			t.Fatalf("Test Failed! Expected Token %+v. Got %+v", tt, tok)
+		}
+	}
+
+	comments := []token.Token{
+		{TokenType: token.COMMENT, TokenLiteral: " first ", Line: 1, Column: 1},
+		{TokenType: token.COMMENT, TokenLiteral: "second\nline", Line: 1, Column: 21},
+	}
+	if len(l.Comments()) != len(comments) {
+		t.Fatalf("Test Failed! Expected %d comments. Got %+v", len(comments), l.Comments())
+	}
+	for idx, comment := range l.Comments() {
+		if comment != comments[idx] {
+			t.Fatalf("Test Failed! Expected comment %+v. Got %+v", comments[idx], comment)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := `put x = 5;
+	put add = box(a, b) {
+  unbox a + b;
+}`
+	expectedResult := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"put", 1, 1}, {"x", 1, 5}, {"=", 1, 7}, {"5", 1, 9}, {";", 1, 10},
+		{"put", 2, 2}, {"add", 2, 6}, {"=", 2, 10}, {"box", 2, 12}, {"(", 2, 15},
+		{"a", 2, 16}, {",", 2, 17}, {"b", 2, 19}, {")", 2, 20}, {"{", 2, 22},
+		{"unbox", 3, 3}, {"a", 3, 9}, {"+", 3, 11}, {"b", 3, 13}, {";", 3, 14},
+		{"}", 4, 1}, {"", 4, 2},
+	}
+
+	l := CreateLexer(input)
+
+	for _, testToken := range expectedResult {
+		lexerToken := l.NextToken()
+
+		if lexerToken.TokenLiteral != testToken.expectedLiteral ||
+			lexerToken.Line != testToken.expectedLine ||
+			lexerToken.Column != testToken.expectedColumn {
+			t.Fatalf("Test Failed! Expected Token: <%s at %d:%d> but Got Token: <%s at %d:%d>\n",
+				testToken.expectedLiteral,
+				testToken.expectedLine,
+				testToken.expectedColumn,
+				lexerToken.TokenLiteral,
+				lexerToken.Line,
+				lexerToken.Column)
+		}
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := `put größe = "héllo, 世界";
+变量 + _x2 + x٣ - 2x ⅷ`
+	expectedResult := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{token.PUT, "put", 1, 1},
+		{token.IDENTIFIER, "größe", 1, 5},
+		{token.ASSIGN, "=", 1, 11},
+		{token.STRING, "héllo, 世界", 1, 13},
+		{token.SCOLON, ";", 1, 24},
+		{token.IDENTIFIER, "变量", 2, 1},
+		{token.ADD, "+", 2, 4},
+		{token.IDENTIFIER, "_x2", 2, 6},
+		{token.ADD, "+", 2, 10},
+		{token.IDENTIFIER, "x٣", 2, 12},
+		{token.SUB, "-", 2, 15},
+		{token.INT, "2", 2, 17},
+		{token.IDENTIFIER, "x", 2, 18},
+		{token.UNKNOWN, "ⅷ", 2, 20},
+		{token.EOF, "", 2, 21},
+	}
+
+	l := CreateLexer(input)
+
+	for _, testToken := range expectedResult {
+		lexerToken := l.NextToken()
+
+		if lexerToken.TokenType != testToken.expectedType ||
+			lexerToken.TokenLiteral != testToken.expectedLiteral ||
+			lexerToken.Line != testToken.expectedLine ||
+			lexerToken.Column != testToken.expectedColumn {
+			t.Fatalf("Test Failed! Expected Token: <%s %q at %d:%d> but Got Token: <%s %q at %d:%d>\n",
+				testToken.expectedType, testToken.expectedLiteral, testToken.expectedLine, testToken.expectedColumn,
+				lexerToken.TokenType, lexerToken.TokenLiteral, lexerToken.Line, lexerToken.Column)
+		}
+	}
+	if len(l.Errors()) != 0 {
+		t.Errorf("Test failed. Expected no errors. Got <%+v>", l.Errors())
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	input := "put x\xff = \"a\xc3\";\n< b\xe4 > 1"
+
+	l := CreateLexer(input)
+	literals := []string{}
+	for tok := l.NextToken(); tok.TokenType != token.EOF; tok = l.NextToken() {
+		literals = append(literals, tok.TokenLiteral)
+	}
+
+	// Invalid bytes are skipped between tokens, and replaced in strings
+	expectedLiterals := []string{"put", "x", "=", "a�", ";", "1"}
+	if strings.Join(literals, " ") != strings.Join(expectedLiterals, " ") {
+		t.Errorf("Test failed. Expected tokens <%q>. Got <%q>", expectedLiterals, literals)
+	}
+
+	expectedErrors := []Error{
+		{Message: "Invalid UTF-8 encoding at 1:6: <0xff>", Line: 1, Column: 6},
+		{Message: "Invalid UTF-8 encoding at 1:12: <0xc3>", Line: 1, Column: 12},
+		{Message: "Invalid UTF-8 encoding at 2:4: <0xe4>", Line: 2, Column: 4},
+	}
+	if !reflect.DeepEqual(l.Errors(), expectedErrors) {
+		t.Errorf("Test failed. Expected errors <%+v>. Got <%+v>", expectedErrors, l.Errors())
+	}
+}
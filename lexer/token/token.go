@@ -1,10 +1,17 @@
 package token
 
+import "sort"
+
 type TokenType string
 
 type Token struct {
 	TokenType    TokenType
 	TokenLiteral string
+
+	// Source position of the first character of the token (1-based),
+	// columns counting runes
+	Line   int
+	Column int
 }
 
 const (
@@ -18,10 +25,15 @@ const (
 	RCURLY TokenType = "}"
 	COMMA  TokenType = ","
 	SCOLON TokenType = ";"
+	DOT    TokenType = "."
+	COLON  TokenType = ":"
+	ARROW  TokenType = "->"
 
 	// Arithmetic Operators
 	ADD    TokenType = "+"
 	SUB    TokenType = "-"
+	MUL    TokenType = "*"
+	DIV    TokenType = "/"
 	ASSIGN TokenType = "="
 
 	// User IDENTIFIERS
@@ -31,27 +43,52 @@ const (
 	BOX   TokenType = "BOX"
 	PUT   TokenType = "PUT"
 	UNBOX TokenType = "UNBOX"
-	SHOW  TokenType = "SHOW"
+
+	// Exceptions
+	THROW   TokenType = "THROW"
+	TRY     TokenType = "TRY"
+	CATCH   TokenType = "CATCH"
+	FINALLY TokenType = "FINALLY"
 
 	// Integers
 	INT TokenType = "INT"
+
+	// Strings
+	STRING TokenType = "STRING"
+
+	// Comments: < text >. The lexer skips them, keeping them aside.
+	COMMENT TokenType = "COMMENT"
 )
 
 func NewToken(t_type TokenType, t_value string) Token {
-	return Token{t_type, t_value}
+	return Token{TokenType: t_type, TokenLiteral: t_value}
+}
+
+// Reserved words of the language mapped to their token types
+var keywords = map[string]TokenType{
+	"box":   BOX,
+	"put":   PUT,
+	"unbox": UNBOX,
+
+	"throw":   THROW,
+	"try":     TRY,
+	"catch":   CATCH,
+	"finally": FINALLY,
 }
 
 func GetIdentifierType(identifier string) TokenType {
-	switch identifier {
-	case "box":
-		return BOX
-	case "put":
-		return PUT
-	case "unbox":
-		return UNBOX
-	case "show":
-		return SHOW
-	default:
-		return IDENTIFIER
+	if tokenType, ok := keywords[identifier]; ok {
+		return tokenType
+	}
+	return IDENTIFIER
+}
+
+// Keywords returns every reserved word, sorted alphabetically.
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
 	}
+	sort.Strings(words)
+	return words
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"cardboard/lsp"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Runs the language server, talking to an editor over the standard
+// input and output
+func lspCommand(args []string) int {
+	flags := flag.NewFlagSet("lsp", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: cardboard lsp")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if err := lsp.Serve(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,399 @@
+package lsp
+
+import (
+	"cardboard/format"
+	"cardboard/lexer"
+	"cardboard/lexer/token"
+	"cardboard/object"
+	"cardboard/parser"
+	"cardboard/parser/ast"
+	"cardboard/resolver"
+	"cardboard/types"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// An open document, analyzed again each time its text changes
+type document struct {
+	uri     string
+	version int
+	text    string
+
+	diagnostics []Diagnostic
+
+	// Analysis of the text, nil when it doesn't parse
+	analysis *analysis
+
+	// Analysis of the last text that parsed, completing identifiers while
+	// the text is being edited
+	lastAnalysis *analysis
+}
+
+func newDocument(uri string, version int, text string) *document {
+	d := &document{uri: uri}
+	d.update(version, text)
+	return d
+}
+
+func (d *document) update(version int, text string) {
+	d.version, d.text = version, text
+	d.diagnostics = []Diagnostic{}
+
+	p := parser.CreateParser(lexer.CreateLexer(text))
+	program := p.ParseCardBoard()
+	if errs := p.GetErrors(); len(errs) > 0 {
+		positions := p.GetErrorPositions()
+		for idx, err := range errs {
+			d.diagnostics = append(d.diagnostics, d.diagnostic(positions[idx].Line, positions[idx].Column, SeverityError, strings.TrimSpace(err)))
+		}
+		d.analysis = nil
+		return
+	}
+
+	found := resolver.Resolve(program)
+	found = append(found, types.Check(program)...)
+	sort.SliceStable(found, func(i, j int) bool {
+		a, b := found[i], found[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	for _, diagnostic := range found {
+		severity := SeverityWarning
+		if diagnostic.Severity == resolver.Error {
+			severity = SeverityError
+		}
+		d.diagnostics = append(d.diagnostics, d.diagnostic(diagnostic.Line, diagnostic.Column, severity, diagnostic.Message))
+	}
+
+	d.analysis = analyze(program)
+	d.lastAnalysis = d.analysis
+}
+
+// Diagnostic covering the word found at a source position
+func (d *document) diagnostic(line int, column int, severity DiagnosticSeverity, message string) Diagnostic {
+	start := position(line, column)
+	end := start
+
+	lines := strings.Split(d.text, "\n")
+	if start.Line < len(lines) {
+		text := []rune(lines[start.Line])
+		for end.Character < len(text) && isWordChar(text[end.Character]) {
+			end.Character++
+		}
+	}
+	if end == start {
+		end.Character++
+	}
+	return Diagnostic{Range: Range{Start: start, End: end}, Severity: severity, Source: "cardboard", Message: message}
+}
+
+func isWordChar(ch rune) bool {
+	return unicode.IsLetter(ch) || unicode.IsDigit(ch) || ch == '_'
+}
+
+// Edits giving the document its canonical format, nil when it doesn't parse
+func (d *document) format() []TextEdit {
+	if d.analysis == nil {
+		return nil
+	}
+
+	formatted := format.Program(d.analysis.program)
+	if formatted == d.text {
+		return []TextEdit{}
+	}
+
+	lines := strings.Split(d.text, "\n")
+	end := Position{Line: len(lines) - 1, Character: utf8.RuneCountInString(lines[len(lines)-1])}
+	return []TextEdit{{Range: Range{End: end}, NewText: formatted}}
+}
+
+type bindingKind int
+
+const (
+	putBinding bindingKind = iota
+	parameterBinding
+	catchBinding
+)
+
+// A binding made by a program, at the identifier first making it
+type binding struct {
+	kind  bindingKind
+	ident *ast.Identifier
+
+	// Statement making a 'put' binding
+	put *ast.PutStatement
+
+	// Box whose body the binding is visible in, nil for the program
+	box *ast.BoxExpression
+
+	// Inferred type
+	typ string
+}
+
+type analysis struct {
+	program *ast.Program
+
+	// Every identifier, in source order
+	identifiers []*ast.Identifier
+
+	bindings []*binding
+	byIdent  map[*ast.Identifier]*binding
+}
+
+func analyze(program *ast.Program) *analysis {
+	a := &analysis{program: program, byIdent: map[*ast.Identifier]*binding{}}
+
+	inferred := map[token.Token]string{}
+	for _, signature := range types.InferBindings(program) {
+		inferred[token.Token{Line: signature.Line, Column: signature.Column}] = signature.TypeString()
+	}
+
+	// Nodes being visited, and the boxes among them
+	nodes := []ast.Node{}
+	boxes := []*ast.BoxExpression{nil}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node == nil {
+			if _, ok := nodes[len(nodes)-1].(*ast.BoxExpression); ok {
+				boxes = boxes[:len(boxes)-1]
+			}
+			nodes = nodes[:len(nodes)-1]
+			return true
+		}
+		nodes = append(nodes, node)
+		box := boxes[len(boxes)-1]
+
+		switch node := node.(type) {
+		case *ast.Identifier:
+			a.identifiers = append(a.identifiers, node)
+		case *ast.PutStatement:
+			a.declare(&binding{kind: putBinding, ident: &node.NodeIdentifier, put: node, box: box})
+		case *ast.TryStatement:
+			if node.CatchParameter != nil {
+				a.declare(&binding{kind: catchBinding, ident: node.CatchParameter, box: box})
+			}
+		case *ast.BoxExpression:
+			for _, param := range node.ParameterList {
+				a.declare(&binding{kind: parameterBinding, ident: param, box: node})
+			}
+			boxes = append(boxes, node)
+		}
+		return true
+	})
+
+	for _, b := range a.bindings {
+		b.typ = inferred[token.Token{Line: b.ident.NodeToken.Line, Column: b.ident.NodeToken.Column}]
+	}
+	return a
+}
+
+// Records a binding, unless the name was already bound in the same body
+func (a *analysis) declare(b *binding) {
+	if r := b.ident.Resolution; r == nil || r.Declaration != b.ident {
+		return
+	}
+	a.bindings = append(a.bindings, b)
+	a.byIdent[b.ident] = b
+}
+
+// Identifier under or right after a position
+func (a *analysis) identifierAt(pos Position) *ast.Identifier {
+	for _, ident := range a.identifiers {
+		r := identRange(ident)
+		if r.Start.Line == pos.Line && r.Start.Character <= pos.Character && pos.Character <= r.End.Character {
+			return ident
+		}
+	}
+	return nil
+}
+
+// Binding the identifier at a position refers to or makes
+func (a *analysis) bindingAt(pos Position) (*ast.Identifier, *binding) {
+	ident := a.identifierAt(pos)
+	if ident == nil || ident.Resolution == nil {
+		return ident, nil
+	}
+	return ident, a.byIdent[ident.Resolution.Declaration]
+}
+
+func (a *analysis) hover(pos Position) *Hover {
+	ident, b := a.bindingAt(pos)
+	if b == nil {
+		return nil
+	}
+
+	r := identRange(ident)
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: "```cardboard\n" + b.describe() + "\n```"},
+		Range:    &r,
+	}
+}
+
+// Describes a binding with its type, and its value when it is a literal
+func (b *binding) describe() string {
+	var out strings.Builder
+	switch b.kind {
+	case putBinding:
+		out.WriteString("put ")
+	case parameterBinding:
+		out.WriteString("parameter ")
+	case catchBinding:
+		out.WriteString("catch ")
+	}
+	out.WriteString(b.ident.Value)
+
+	if b.typ != "" {
+		out.WriteString(": " + b.typ)
+	}
+	if b.put != nil {
+		switch value := b.put.NodeExpression.(type) {
+		case *ast.IntegerLiteral:
+			out.WriteString(" = " + strconv.FormatInt(value.Value, 10))
+		case *ast.StringLiteral:
+			out.WriteString(" = " + ast.QuoteString(value.Value))
+		}
+	}
+	return out.String()
+}
+
+func (a *analysis) definition(uri string, pos Position) *Location {
+	_, b := a.bindingAt(pos)
+	if b == nil {
+		return nil
+	}
+	return &Location{URI: uri, Range: identRange(b.ident)}
+}
+
+// Symbols of the 'put' bindings of statements, those of boxes nested in
+// the boxes they're bound to
+func (a *analysis) symbols(stmts []ast.Statement) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.PutStatement:
+			symbol := DocumentSymbol{
+				Name:           stmt.NodeIdentifier.Value,
+				Kind:           SymbolVariable,
+				Range:          Range{Start: position(stmt.NodeToken.Line, stmt.NodeToken.Column), End: endPosition(stmt.NodeExpression)},
+				SelectionRange: identRange(&stmt.NodeIdentifier),
+			}
+			if b := a.byIdent[&stmt.NodeIdentifier]; b != nil {
+				symbol.Detail = b.typ
+			}
+			if box, ok := stmt.NodeExpression.(*ast.BoxExpression); ok {
+				symbol.Kind = SymbolFunction
+				symbol.Children = a.symbols(box.Body.Statements)
+			}
+			symbols = append(symbols, symbol)
+		case *ast.TryStatement:
+			symbols = append(symbols, a.symbols(stmt.Body.Statements)...)
+			if stmt.Catch != nil {
+				symbols = append(symbols, a.symbols(stmt.Catch.Statements)...)
+			}
+			if stmt.Finally != nil {
+				symbols = append(symbols, a.symbols(stmt.Finally.Statements)...)
+			}
+		}
+	}
+	return symbols
+}
+
+// Keywords, and the bindings visible at a position. Bindings are visible
+// in the whole body making them, even before the statement making them.
+func (a *analysis) completion(pos Position) []CompletionItem {
+	items := []CompletionItem{}
+	seen := map[string]bool{}
+
+	if a != nil {
+		for _, b := range a.bindings {
+			if seen[b.ident.Value] || (b.box != nil && !boxContains(b.box, pos)) {
+				continue
+			}
+			seen[b.ident.Value] = true
+
+			kind := CompletionVariable
+			if strings.HasPrefix(b.typ, "box(") {
+				kind = CompletionFunction
+			}
+			items = append(items, CompletionItem{Label: b.ident.Value, Kind: kind, Detail: b.typ})
+		}
+	}
+
+	for _, builtin := range object.Builtins {
+		if !seen[builtin.Name] {
+			items = append(items, CompletionItem{Label: builtin.Name, Kind: CompletionFunction, Detail: builtin.Inspect()})
+		}
+	}
+
+	for _, keyword := range token.Keywords() {
+		if !seen[keyword] {
+			items = append(items, CompletionItem{Label: keyword, Kind: CompletionKeyword})
+		}
+	}
+	return items
+}
+
+func boxContains(box *ast.BoxExpression, pos Position) bool {
+	start := position(box.NodeToken.Line, box.NodeToken.Column)
+	end := position(box.Body.RightBrace.Line, box.Body.RightBrace.Column)
+	return !before(pos, start) && !before(end, pos)
+}
+
+func before(a Position, b Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+}
+
+// Zero-based position of a one-based source position
+func position(line int, column int) Position {
+	if line < 1 {
+		line = 1
+	}
+	if column < 1 {
+		column = 1
+	}
+	return Position{Line: line - 1, Character: column - 1}
+}
+
+func identRange(ident *ast.Identifier) Range {
+	start := position(ident.NodeToken.Line, ident.NodeToken.Column)
+	return Range{Start: start, End: Position{Line: start.Line, Character: start.Character + utf8.RuneCountInString(ident.Value)}}
+}
+
+// Position after the last token of an expression, as far as the tokens
+// kept in the tree tell
+func endPosition(expr ast.Expression) Position {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		return identRange(expr).End
+	case *ast.IntegerLiteral:
+		start := position(expr.NodeToken.Line, expr.NodeToken.Column)
+		return Position{Line: start.Line, Character: start.Character + len(expr.NodeToken.TokenLiteral)}
+	case *ast.StringLiteral:
+		start := position(expr.NodeToken.Line, expr.NodeToken.Column)
+		return Position{Line: start.Line, Character: start.Character + utf8.RuneCountInString(ast.QuoteString(expr.Value))}
+	case *ast.PrefixExpression:
+		return endPosition(expr.Right)
+	case *ast.InfixExpression:
+		return endPosition(expr.Right)
+	case *ast.BoxExpression:
+		end := position(expr.Body.RightBrace.Line, expr.Body.RightBrace.Column)
+		end.Character++
+		return end
+	case *ast.CallExpression:
+		end := endPosition(expr.Function)
+		if len(expr.Arguments) > 0 {
+			end = endPosition(expr.Arguments[len(expr.Arguments)-1])
+		}
+		// The closing parenthesis
+		end.Character++
+		return end
+	case *ast.MemberExpression:
+		return identRange(expr.Property).End
+	}
+	return Position{}
+}
@@ -0,0 +1,408 @@
+package lsp
+
+import (
+	"cardboard/jsonrpc"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const uri = "file:///test.cb"
+
+// In-process client, talking to a server over pipes
+type client struct {
+	t    *testing.T
+	conn *jsonrpc.Conn
+
+	// Messages read from the server, and the notifications among them not
+	// looked at yet
+	messages      chan *jsonrpc.Message
+	notifications []*jsonrpc.Message
+
+	nextID int
+	done   chan error
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	c := &client{
+		t:        t,
+		conn:     jsonrpc.NewConn(clientIn, clientOut),
+		messages: make(chan *jsonrpc.Message, 64),
+		done:     make(chan error, 1),
+	}
+	go func() {
+		c.done <- Serve(serverIn, serverOut)
+		serverOut.Close()
+	}()
+	go func() {
+		defer close(c.messages)
+		for {
+			msg, err := c.conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			c.messages <- msg
+		}
+	}()
+	t.Cleanup(func() { clientOut.Close() })
+
+	if err := c.call("initialize", InitializeParams{}, nil); err != nil {
+		t.Fatalf("Test failed. Can't initialize: %s", err)
+	}
+	c.notify("initialized", struct{}{})
+	return c
+}
+
+// Sends a request, and decodes the result of its response
+func (c *client) call(method string, params interface{}, result interface{}) *jsonrpc.Error {
+	c.t.Helper()
+
+	c.nextID++
+	if err := c.conn.Request(c.nextID, method, params); err != nil {
+		c.t.Fatal(err)
+	}
+
+	for msg := range c.messages {
+		if msg.IsNotification() {
+			c.notifications = append(c.notifications, msg)
+			continue
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result != nil {
+			if err := json.Unmarshal(msg.Result, result); err != nil {
+				c.t.Fatalf("Test failed. Invalid result of %s: %s", method, err)
+			}
+		}
+		return nil
+	}
+	c.t.Fatalf("Test failed. No response to %s", method)
+	return nil
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.t.Helper()
+	if err := c.conn.Notify(method, params); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// Waits for the next diagnostics published
+func (c *client) diagnostics() []Diagnostic {
+	c.t.Helper()
+
+	for len(c.notifications) == 0 {
+		msg, ok := <-c.messages
+		if !ok {
+			c.t.Fatalf("Test failed. No diagnostics published")
+		}
+		c.notifications = append(c.notifications, msg)
+	}
+	msg := c.notifications[0]
+	c.notifications = c.notifications[1:]
+
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("Test failed. Expected diagnostics. Got <%s>", msg.Method)
+	}
+	var params PublishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.t.Fatal(err)
+	}
+	return params.Diagnostics
+}
+
+func (c *client) open(text string) []Diagnostic {
+	c.t.Helper()
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, LanguageID: "cardboard", Version: 1, Text: text}})
+	return c.diagnostics()
+}
+
+func at(line int, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: Position{Line: line, Character: character}}
+}
+
+func span(line int, start int, end int) Range {
+	return Range{Start: Position{Line: line, Character: start}, End: Position{Line: line, Character: end}}
+}
+
+func TestLifecycle(t *testing.T) {
+	c := newClient(t)
+
+	if err := c.call("textDocument/rename", at(0, 0), nil); err == nil || err.Code != jsonrpc.MethodNotFound {
+		t.Errorf("Test failed. Expected an unknown method error. Got <%v>", err)
+	}
+	if err := c.call("textDocument/hover", at(0, 0), nil); err == nil || err.Code != jsonrpc.InvalidParams {
+		t.Errorf("Test failed. Expected an unknown document error. Got <%v>", err)
+	}
+
+	if err := c.call("shutdown", nil, nil); err != nil {
+		t.Fatalf("Test failed. Can't shut down: %s", err)
+	}
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("Test failed. Server exited with <%s>", err)
+	}
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	c := newClient(t)
+	c.notify("exit", nil)
+	if err := <-c.done; err == nil {
+		t.Errorf("Test failed. Expected an error exiting without shutdown")
+	}
+}
+
+func TestNotInitialized(t *testing.T) {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	go Serve(serverIn, serverOut)
+	defer clientOut.Close()
+
+	conn := jsonrpc.NewConn(clientIn, clientOut)
+	go conn.Request(1, "textDocument/hover", at(0, 0))
+	msg, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Error == nil || msg.Error.Code != serverNotInitialized {
+		t.Errorf("Test failed. Expected a not initialized error. Got <%+v>", msg.Error)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := newClient(t)
+
+	diagnostics := c.open("put a = 1;\nput b = a + missing;")
+	expected := []Diagnostic{
+		{Range: span(1, 4, 5), Severity: SeverityWarning, Source: "cardboard", Message: "b is bound but never used."},
+		{Range: span(1, 12, 19), Severity: SeverityError, Source: "cardboard", Message: "Unknown identifier: missing."},
+	}
+	if !reflect.DeepEqual(diagnostics, expected) {
+		t.Errorf("Test failed. Wrong diagnostics.\nwant=%+v\ngot=%+v", expected, diagnostics)
+	}
+
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: uri, Version: 2},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "put a = 1;\nput a = ;"}},
+	})
+	diagnostics = c.diagnostics()
+	expected = []Diagnostic{
+		{Range: span(1, 8, 9), Severity: SeverityError, Source: "cardboard", Message: "Unknown character: <;>"},
+		{Range: span(1, 9, 10), Severity: SeverityError, Source: "cardboard", Message: "Error. Expected <;> at the end of the box statement."},
+	}
+	if !reflect.DeepEqual(diagnostics, expected) {
+		t.Errorf("Test failed. Wrong parser diagnostics.\nwant=%+v\ngot=%+v", expected, diagnostics)
+	}
+
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: uri, Version: 3},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: `put a: int = "s"; a;`}},
+	})
+	diagnostics = c.diagnostics()
+	if len(diagnostics) != 1 || diagnostics[0].Message != "Type Mismatch: a is declared <int>. Got <string>" {
+		t.Errorf("Test failed. Expected a type error. Got <%+v>", diagnostics)
+	}
+
+	// Positions count runes
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: uri, Version: 4},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "put größe = 1;\nput b = größe + zähler;"}},
+	})
+	diagnostics = c.diagnostics()
+	expected = []Diagnostic{
+		{Range: span(1, 4, 5), Severity: SeverityWarning, Source: "cardboard", Message: "b is bound but never used."},
+		{Range: span(1, 16, 22), Severity: SeverityError, Source: "cardboard", Message: "Unknown identifier: zähler."},
+	}
+	if !reflect.DeepEqual(diagnostics, expected) {
+		t.Errorf("Test failed. Wrong diagnostics for Unicode identifiers.\nwant=%+v\ngot=%+v", expected, diagnostics)
+	}
+
+	c.notify("textDocument/didClose", DidCloseTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}})
+	if diagnostics := c.diagnostics(); len(diagnostics) != 0 {
+		t.Errorf("Test failed. Expected closing to clear diagnostics. Got <%+v>", diagnostics)
+	}
+}
+
+const program = `put limit = 10;
+put add = box(x, y) {
+    put sum = x + y;
+    unbox sum;
+};
+try { add(limit, 2); } catch (e) { e.message; }
+`
+
+func TestHover(t *testing.T) {
+	c := newClient(t)
+	c.open(program)
+
+	tests := []struct {
+		line      int
+		character int
+		expected  string
+		span      Range
+	}{
+		{0, 4, "put limit: int = 10", span(0, 4, 9)},
+		{5, 6, "put add: box(a, a) -> a where a: int | string", span(5, 6, 9)},
+		{5, 14, "put limit: int = 10", span(5, 10, 15)},
+		{2, 14, "parameter x: a where a: int | string", span(2, 14, 15)},
+		{3, 12, "put sum: a where a: int | string", span(3, 10, 13)},
+		{5, 35, "catch e: exception", span(5, 35, 36)},
+	}
+
+	for _, tt := range tests {
+		var hover *Hover
+		if err := c.call("textDocument/hover", at(tt.line, tt.character), &hover); err != nil {
+			t.Fatal(err)
+		}
+		if hover == nil {
+			t.Errorf("Test failed. No hover at %d:%d", tt.line, tt.character)
+			continue
+		}
+		if want := "```cardboard\n" + tt.expected + "\n```"; hover.Contents.Value != want {
+			t.Errorf("Test failed. Wrong hover at %d:%d.\nwant=%q\ngot=%q", tt.line, tt.character, want, hover.Contents.Value)
+		}
+		if hover.Range == nil || *hover.Range != tt.span {
+			t.Errorf("Test failed. Wrong hover range at %d:%d. Expected <%+v>. Got <%+v>", tt.line, tt.character, tt.span, hover.Range)
+		}
+	}
+
+	// Nothing to tell about keywords, literals and properties
+	for _, pos := range []Position{{Line: 0, Character: 1}, {Line: 0, Character: 13}, {Line: 5, Character: 41}} {
+		var hover *Hover
+		if err := c.call("textDocument/hover", at(pos.Line, pos.Character), &hover); err != nil {
+			t.Fatal(err)
+		}
+		if hover != nil {
+			t.Errorf("Test failed. Expected no hover at %d:%d. Got <%+v>", pos.Line, pos.Character, hover)
+		}
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	c := newClient(t)
+	c.open(program)
+
+	tests := []struct {
+		line      int
+		character int
+		expected  Range
+	}{
+		{5, 7, span(1, 4, 7)},
+		{5, 12, span(0, 4, 9)},
+		{2, 18, span(1, 17, 18)},
+		{3, 11, span(2, 8, 11)},
+		{5, 36, span(5, 30, 31)},
+		// Declarations are their own definition
+		{1, 5, span(1, 4, 7)},
+	}
+
+	for _, tt := range tests {
+		var location *Location
+		if err := c.call("textDocument/definition", at(tt.line, tt.character), &location); err != nil {
+			t.Fatal(err)
+		}
+		if location == nil || location.URI != uri || location.Range != tt.expected {
+			t.Errorf("Test failed. Wrong definition at %d:%d. Expected <%+v>. Got <%+v>", tt.line, tt.character, tt.expected, location)
+		}
+	}
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	c := newClient(t)
+	c.open(program + "try { put inner = box() { 1 }; } finally { 2; }\n")
+
+	var symbols []DocumentSymbol
+	if err := c.call("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &symbols); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []DocumentSymbol{
+		{Name: "limit", Detail: "int", Kind: SymbolVariable, Range: span(0, 0, 14), SelectionRange: span(0, 4, 9)},
+		{
+			Name:           "add",
+			Detail:         "box(a, a) -> a where a: int | string",
+			Kind:           SymbolFunction,
+			Range:          Range{Start: Position{Line: 1, Character: 0}, End: Position{Line: 4, Character: 1}},
+			SelectionRange: span(1, 4, 7),
+			Children: []DocumentSymbol{
+				{Name: "sum", Detail: "a where a: int | string", Kind: SymbolVariable, Range: span(2, 4, 19), SelectionRange: span(2, 8, 11)},
+			},
+		},
+		{Name: "inner", Detail: "box() -> int", Kind: SymbolFunction, Range: span(6, 6, 29), SelectionRange: span(6, 10, 15)},
+	}
+	if !reflect.DeepEqual(symbols, expected) {
+		t.Errorf("Test failed. Wrong symbols.\nwant=%+v\ngot=%+v", expected, symbols)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	c := newClient(t)
+	c.open(program)
+
+	labels := func(line int, character int) string {
+		var items []CompletionItem
+		if err := c.call("textDocument/completion", CompletionParams{at(line, character)}, &items); err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, item := range items {
+			names = append(names, item.Label)
+		}
+		return strings.Join(names, " ")
+	}
+
+	keywords := "assert assertEqual assertError show box catch finally put throw try unbox"
+	if got := labels(3, 4); got != "limit add x y sum e "+keywords {
+		t.Errorf("Test failed. Wrong completion inside a box. Got <%s>", got)
+	}
+	if got := labels(5, 0); got != "limit add e "+keywords {
+		t.Errorf("Test failed. Wrong completion outside of boxes. Got <%s>", got)
+	}
+
+	// Bindings of the last version that parsed are offered while editing
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: uri, Version: 2},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: program + "put b = "}},
+	})
+	c.diagnostics()
+	if got := labels(6, 8); got != "limit add e "+keywords {
+		t.Errorf("Test failed. Wrong completion of a document that doesn't parse. Got <%s>", got)
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	c := newClient(t)
+	c.open("put a=1;\nput f = box(x){x+a};")
+
+	params := DocumentFormattingParams{TextDocument: TextDocumentIdentifier{URI: uri}}
+	var edits []TextEdit
+	if err := c.call("textDocument/formatting", params, &edits); err != nil {
+		t.Fatal(err)
+	}
+	expected := []TextEdit{{
+		Range:   Range{End: Position{Line: 1, Character: 20}},
+		NewText: "put a = 1;\nput f = box(x) {\n    x + a;\n};\n",
+	}}
+	if !reflect.DeepEqual(edits, expected) {
+		t.Errorf("Test failed. Wrong formatting edits.\nwant=%+v\ngot=%+v", expected, edits)
+	}
+
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: uri, Version: 2},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: expected[0].NewText}},
+	})
+	c.diagnostics()
+	edits = nil
+	if err := c.call("textDocument/formatting", params, &edits); err != nil {
+		t.Fatal(err)
+	}
+	if edits == nil || len(edits) != 0 {
+		t.Errorf("Test failed. Expected no edits for a formatted document. Got <%+v>", edits)
+	}
+}
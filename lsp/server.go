@@ -0,0 +1,252 @@
+// Package lsp is a Language Server Protocol server for cardboard scripts,
+// run by 'cardboard lsp' over its standard input and output.
+//
+// Documents are analyzed each time they change. The server publishes the
+// diagnostics of the parser, the resolver and the type checker, and
+// answers hover, go-to-definition, document symbol, completion and
+// formatting requests. Positions count the runes of lines, like the
+// columns of tokens, which matches the UTF-16 code units editors count
+// unless lines hold characters outside the Basic Multilingual Plane.
+package lsp
+
+import (
+	"cardboard/jsonrpc"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Error code of requests received before 'initialize'
+const serverNotInitialized = -32002
+
+type Server struct {
+	conn      *jsonrpc.Conn
+	documents map[string]*document
+
+	initialized  bool
+	shuttingDown bool
+}
+
+func NewServer(conn *jsonrpc.Conn) *Server {
+	return &Server{conn: conn, documents: map[string]*document{}}
+}
+
+// Serve runs a server reading messages from in and writing to out.
+func Serve(in io.Reader, out io.Writer) error {
+	return NewServer(jsonrpc.NewConn(in, out)).Run()
+}
+
+// Run answers requests until the client sends 'exit' or closes the
+// stream. Exiting without a 'shutdown' request first is an error.
+func (s *Server) Run() error {
+	for {
+		msg, err := s.conn.ReadMessage()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				// The stream is still in sync, only the message is lost
+				if err := s.conn.Reply(nil, nil, jsonrpc.Errorf(jsonrpc.ParseError, "%s", err)); err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+
+		// Responses to requests of the server: it makes none
+		if !msg.IsRequest() {
+			continue
+		}
+
+		if msg.Method == "exit" {
+			if !s.shuttingDown {
+				return errors.New("lsp: exit without shutdown")
+			}
+			return nil
+		}
+
+		result, err := s.handle(msg)
+		if msg.IsNotification() {
+			continue
+		}
+		if err := s.conn.Reply(msg.ID, result, err); err != nil {
+			return err
+		}
+	}
+}
+
+type handler func(s *Server, params json.RawMessage) (interface{}, error)
+
+var handlers = map[string]handler{
+	"initialize":  (*Server).initialize,
+	"initialized": func(*Server, json.RawMessage) (interface{}, error) { return nil, nil },
+	"shutdown":    (*Server).shutdown,
+
+	"textDocument/didOpen":   (*Server).didOpen,
+	"textDocument/didChange": (*Server).didChange,
+	"textDocument/didClose":  (*Server).didClose,
+
+	"textDocument/hover":          (*Server).hover,
+	"textDocument/definition":     (*Server).definition,
+	"textDocument/documentSymbol": (*Server).documentSymbol,
+	"textDocument/completion":     (*Server).completion,
+	"textDocument/formatting":     (*Server).formatting,
+}
+
+func (s *Server) handle(msg *jsonrpc.Message) (interface{}, error) {
+	handle, ok := handlers[msg.Method]
+	if !ok {
+		return nil, jsonrpc.Errorf(jsonrpc.MethodNotFound, "Unknown method: %s", msg.Method)
+	}
+	if !s.initialized && msg.Method != "initialize" {
+		return nil, jsonrpc.Errorf(serverNotInitialized, "Server not initialized")
+	}
+	if s.shuttingDown {
+		return nil, jsonrpc.Errorf(jsonrpc.InvalidRequest, "Server shutting down")
+	}
+	return handle(s, msg.Params)
+}
+
+func decode(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return jsonrpc.Errorf(jsonrpc.InvalidParams, "Invalid params: %s", err)
+	}
+	return nil
+}
+
+func (s *Server) initialize(params json.RawMessage) (interface{}, error) {
+	var p InitializeParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	s.initialized = true
+
+	return InitializeResult{
+		Capabilities: ServerCapabilities{
+			TextDocumentSync:           fullSync,
+			HoverProvider:              true,
+			DefinitionProvider:         true,
+			DocumentSymbolProvider:     true,
+			CompletionProvider:         &CompletionOptions{},
+			DocumentFormattingProvider: true,
+		},
+		ServerInfo: ServerInfo{Name: "cardboard"},
+	}, nil
+}
+
+func (s *Server) shutdown(json.RawMessage) (interface{}, error) {
+	s.shuttingDown = true
+	return nil, nil
+}
+
+func (s *Server) didOpen(params json.RawMessage) (interface{}, error) {
+	var p DidOpenTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+
+	doc := newDocument(p.TextDocument.URI, p.TextDocument.Version, p.TextDocument.Text)
+	s.documents[doc.uri] = doc
+	return nil, s.publishDiagnostics(doc)
+}
+
+func (s *Server) didChange(params json.RawMessage) (interface{}, error) {
+	var p DidChangeTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, ok := s.documents[p.TextDocument.URI]
+	if !ok || len(p.ContentChanges) == 0 {
+		return nil, nil
+	}
+
+	// Changes give the full text, the last one is the current text
+	doc.update(p.TextDocument.Version, p.ContentChanges[len(p.ContentChanges)-1].Text)
+	return nil, s.publishDiagnostics(doc)
+}
+
+func (s *Server) didClose(params json.RawMessage) (interface{}, error) {
+	var p DidCloseTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+
+	delete(s.documents, p.TextDocument.URI)
+	return nil, s.conn.Notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+}
+
+func (s *Server) publishDiagnostics(doc *document) error {
+	return s.conn.Notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         doc.uri,
+		Version:     doc.version,
+		Diagnostics: doc.diagnostics,
+	})
+}
+
+// Document a request is about, with the position it gives
+func (s *Server) document(params json.RawMessage) (*document, Position, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, Position{}, err
+	}
+	doc, ok := s.documents[p.TextDocument.URI]
+	if !ok {
+		return nil, Position{}, jsonrpc.Errorf(jsonrpc.InvalidParams, "Unknown document: %s", p.TextDocument.URI)
+	}
+	return doc, p.Position, nil
+}
+
+func (s *Server) hover(params json.RawMessage) (interface{}, error) {
+	doc, pos, err := s.document(params)
+	if err != nil || doc.analysis == nil {
+		return nil, err
+	}
+	if hover := doc.analysis.hover(pos); hover != nil {
+		return hover, nil
+	}
+	return nil, nil
+}
+
+func (s *Server) definition(params json.RawMessage) (interface{}, error) {
+	doc, pos, err := s.document(params)
+	if err != nil || doc.analysis == nil {
+		return nil, err
+	}
+	if location := doc.analysis.definition(doc.uri, pos); location != nil {
+		return location, nil
+	}
+	return nil, nil
+}
+
+func (s *Server) documentSymbol(params json.RawMessage) (interface{}, error) {
+	doc, _, err := s.document(params)
+	if err != nil {
+		return nil, err
+	}
+	if doc.analysis == nil {
+		return []DocumentSymbol{}, nil
+	}
+	return doc.analysis.symbols(doc.analysis.program.Statements), nil
+}
+
+func (s *Server) completion(params json.RawMessage) (interface{}, error) {
+	doc, pos, err := s.document(params)
+	if err != nil {
+		return nil, err
+	}
+	return doc.lastAnalysis.completion(pos), nil
+}
+
+func (s *Server) formatting(params json.RawMessage) (interface{}, error) {
+	doc, _, err := s.document(params)
+	if err != nil {
+		return nil, err
+	}
+	if edits := doc.format(); edits != nil {
+		return edits, nil
+	}
+	return nil, nil
+}
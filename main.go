@@ -1,8 +1,49 @@
 package main
 
-import "cardboard/repl"
+import (
+	"cardboard/repl"
+	"cardboard/trace"
+	"flag"
+	"os"
+)
+
+// Commands run with 'cardboard <command> [arguments]'. They return the exit code.
+var commands = map[string]func(args []string) int{
+	"check":   checkCommand,
+	"compile": compileCommand,
+	"cover":   coverCommand,
+	"dap":     dapCommand,
+	"debug":   debugCommand,
+	"disasm":  disasmCommand,
+	"fmt":     fmtCommand,
+	"lsp":     lspCommand,
+	"parse":   parseCommand,
+	"profile": profileCommand,
+	"test":    testCommand,
+}
 
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			os.Exit(command(os.Args[2:]))
+		}
+	}
+
+	engine := flag.String("engine", repl.EngineEval, "engine running programs: eval or vm")
+	optimize := flag.Bool("optimize", true, "optimize scripts before running them")
+	traced := flag.Bool("trace", false, "trace the evaluation of the script on standard error")
+	traceFormat := flag.String("trace-format", trace.FormatText, "format of the trace: text or json")
+	flag.Parse()
+
+	// Run a script when given one
+	if flag.NArg() > 0 {
+		opts := repl.Options{Engine: *engine, Optimize: *optimize}
+		if *traced {
+			opts.Trace = *traceFormat
+		}
+		os.Exit(repl.RunFile(flag.Arg(0), opts))
+	}
+
 	// READ -> EVALUATE -> PRINT -> LOOP
-	repl.StartREPL()
+	repl.StartREPL(*engine)
 }
@@ -0,0 +1,142 @@
+package object
+
+import (
+	"cardboard/parser/ast"
+	"fmt"
+	"io"
+)
+
+// What builtins use of the backend running them
+type Context struct {
+	// Calls a box (or builtin), returning its result or the error it raised
+	Call func(fn Object, args ...Object) Object
+
+	// Output of the program
+	Out io.Writer
+}
+
+// Function implemented by the interpreter. Builtins are visible from
+// every program unless a binding of the same name shadows them.
+type Builtin struct {
+	Name       string
+	Parameters []string
+
+	// Called with as many arguments as there are parameters. Errors
+	// without a position are positioned at the call by the backend.
+	Fn func(ctx *Context, args ...Object) Object
+}
+
+func (b *Builtin) Type() ObjectType { return FUNCTION }
+func (b *Builtin) Inspect() string  { return "builtin " + b.Name }
+
+// Raised by failed assertions
+const ASSERTION_ERROR ErrorKind = "AssertionError"
+
+var null = &Null{}
+
+// Every builtin, the index of a builtin being its operand in the bytecode
+var Builtins = []*Builtin{
+	{
+		Name:       "assert",
+		Parameters: []string{"condition"},
+		Fn: func(ctx *Context, args ...Object) Object {
+			if !Truthy(args[0]) {
+				return assertionError("Assertion failed: %s is false.", describe(args[0]))
+			}
+			return null
+		},
+	},
+	{
+		Name:       "assertEqual",
+		Parameters: []string{"got", "want"},
+		Fn: func(ctx *Context, args ...Object) Object {
+			if !Equal(args[0], args[1]) {
+				return assertionError("Assertion failed: got %s, want %s.", describe(args[0]), describe(args[1]))
+			}
+			return null
+		},
+	},
+	{
+		// Calls a box without arguments, returning the error it raises as
+		// an exception
+		Name:       "assertError",
+		Parameters: []string{"fn"},
+		Fn: func(ctx *Context, args ...Object) Object {
+			if args[0].Type() != FUNCTION {
+				return &Error{Kind: TYPE_ERROR, Message: fmt.Sprintf("Type Mismatch Error. Expected Function. Got <%s>", args[0].Type())}
+			}
+			result := ctx.Call(args[0])
+			if err, ok := result.(*Error); ok {
+				return &Exception{Error: err}
+			}
+			return assertionError("Assertion failed: no error raised, got %s.", describe(result))
+		},
+	},
+	{
+		// Writes a value to the output of the program, on a line of its own
+		Name:       "show",
+		Parameters: []string{"value"},
+		Fn: func(ctx *Context, args ...Object) Object {
+			if _, err := fmt.Fprintln(ctx.Out, args[0].Inspect()); err != nil {
+				return &Error{Kind: RUNTIME_ERROR, Message: fmt.Sprintf("Output error: %s", err)}
+			}
+			return null
+		},
+	},
+}
+
+// LookupBuiltin returns the builtin with the given name and its index
+func LookupBuiltin(name string) (*Builtin, int, bool) {
+	for idx, builtin := range Builtins {
+		if builtin.Name == name {
+			return builtin, idx, true
+		}
+	}
+	return nil, 0, false
+}
+
+// Truthy reports whether a value holds: every value but null, 0 and ""
+func Truthy(value Object) bool {
+	switch value := value.(type) {
+	case *Null:
+		return false
+	case *Integer:
+		return value.Value != 0
+	case *String:
+		return value.Value != ""
+	}
+	return true
+}
+
+// Equal reports whether two values are equal: integers, strings and
+// nulls by value, other values by identity
+func Equal(a Object, b Object) bool {
+	switch a := a.(type) {
+	case *Integer:
+		b, ok := b.(*Integer)
+		return ok && a.Value == b.Value
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	}
+	return a == b
+}
+
+// Renders a value in assertion messages, quoting strings so they can be
+// told apart from other values
+func describe(value Object) string {
+	switch value := value.(type) {
+	case *String:
+		return ast.QuoteString(value.Value)
+	case *Integer, *Null, *Exception:
+		return value.Inspect()
+	}
+	return "<" + string(value.Type()) + ">"
+}
+
+func assertionError(format string, a ...interface{}) *Error {
+	return &Error{Kind: ASSERTION_ERROR, Message: fmt.Sprintf(format, a...)}
+}
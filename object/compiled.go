@@ -0,0 +1,95 @@
+package object
+
+import (
+	"cardboard/code"
+	"sort"
+	"strings"
+)
+
+const COMPILED_FUNCTION_OBJ ObjectType = "COMPILED_FUNCTION"
+
+// Line table entry: instructions from Offset onwards were compiled from
+// the node at Line and Column, until the next entry.
+type SourcePosition struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// Compiled box (or program) body
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+
+	// Name of the local slots, used to report unbound identifiers
+	LocalNames []string
+
+	// Binding each local slot falls back to while it isn't bound
+	Fallbacks []Fallback
+
+	// Line table, sorted by offset
+	Positions []SourcePosition
+
+	// Source of the box, used to inspect closures
+	Parameters []string
+	Body       string
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return "box(" + strings.Join(cf.Parameters, ", ") + ") => " + cf.Body
+}
+
+// PositionAt returns the source position the instruction at offset was compiled from.
+func (cf *CompiledFunction) PositionAt(offset int) (int, int) {
+	idx := sort.Search(len(cf.Positions), func(i int) bool {
+		return cf.Positions[i].Offset > offset
+	})
+	if idx == 0 {
+		return 0, 0
+	}
+	position := cf.Positions[idx-1]
+	return position.Line, position.Column
+}
+
+type FallbackKind int
+
+const (
+	// Slots that are always bound, like parameters
+	NoFallback FallbackKind = iota
+	GlobalFallback
+	FreeFallback
+)
+
+// Binding read in place of a local slot that isn't bound yet, like the
+// binding of an enclosing box before a 'put' runs: the global Index, or
+// the slot Index of the enclosing call Depth levels up the free variables
+// of the closure.
+type Fallback struct {
+	Kind  FallbackKind
+	Depth int
+	Index int
+}
+
+// Slots holding the locals of a running box call. Closures created during
+// the call keep a reference to them, so they observe later bindings.
+type Locals struct {
+	Values    []Object
+	Names     []string
+	Fallbacks []Fallback
+}
+
+// Function value of the virtual machine
+type Closure struct {
+	// Name the box was first bound to with 'put', empty when anonymous
+	Name string
+
+	Fn *CompiledFunction
+
+	// Locals of the enclosing calls, innermost first
+	Free []*Locals
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION }
+func (c *Closure) Inspect() string  { return c.Fn.Inspect() }
@@ -1,9 +1,34 @@
 package object
 
+import (
+	"io"
+	"os"
+	"sort"
+)
+
 // Environment
+//
+// The environment of the program (or REPL session) binds identifiers by
+// name. Environments of box calls are frames binding them by the slot the
+// resolver assigned them, and only fall back to names for identifiers
+// that weren't resolved.
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+
+	// Bindings of a box call, by slot
+	slots []Object
+
+	// Told about the progress of the evaluation, inherited by the
+	// environments enclosed by this one. See eval.Hook.
+	hook interface{}
+
+	// Output of the program, inherited like the hook. nil for os.Stdout.
+	out io.Writer
+
+	// Number of box calls the environment runs in, inherited by the
+	// environments enclosed by this one
+	depth int
 }
 
 func CreateEnvironment() *Environment {
@@ -14,9 +39,48 @@ func CreateEnvironment() *Environment {
 func CreateEnclosedEnvironment(outer *Environment) *Environment {
 	env := CreateEnvironment()
 	env.outer = outer
+	env.hook = outer.hook
+	env.out = outer.out
+	env.depth = outer.depth
 	return env
 }
 
+// CreateFrame creates the environment of a box call making size bindings.
+func CreateFrame(outer *Environment, size int) *Environment {
+	return &Environment{outer: outer, slots: make([]Object, size), hook: outer.hook, out: outer.out}
+}
+
+// Outer returns the enclosing environment, nil for the outermost one
+func (env *Environment) Outer() *Environment { return env.outer }
+
+// IsFrame reports whether the environment is the frame of a box call
+func (env *Environment) IsFrame() bool { return env.slots != nil }
+
+// Size returns the number of slots of a frame
+func (env *Environment) Size() int { return len(env.slots) }
+
+// SetHook sets the hook of the evaluator for the environment, and the
+// environments enclosed by it from now on. nil removes it.
+func (env *Environment) SetHook(hook interface{}) { env.hook = hook }
+
+func (env *Environment) Hook() interface{} { return env.hook }
+
+// SetOutput sets where builtins like 'show' write, for the environment and
+// the environments enclosed by it from now on.
+func (env *Environment) SetOutput(out io.Writer) { env.out = out }
+
+func (env *Environment) Output() io.Writer {
+	if env.out == nil {
+		return os.Stdout
+	}
+	return env.out
+}
+
+// SetDepth sets the number of box calls the environment runs in
+func (env *Environment) SetDepth(depth int) { env.depth = depth }
+
+func (env *Environment) Depth() int { return env.depth }
+
 func (env *Environment) Get(key string) (Object, bool) {
 	obj, found := env.store[key]
 	if !found && env.outer != nil {
@@ -26,6 +90,51 @@ func (env *Environment) Get(key string) (Object, bool) {
 }
 
 func (env *Environment) Set(key string, val Object) Object {
+	if env.store == nil {
+		env.store = make(map[string]Object)
+	}
 	env.store[key] = val
 	return val
 }
+
+// Rebind binds key in the innermost environment binding it, or in the
+// outermost one when none does, so a 'put' run by a catch block at the
+// top level binds a global unless it rebinds the catch parameter.
+func (env *Environment) Rebind(key string, val Object) Object {
+	for e := env; ; e = e.outer {
+		if _, ok := e.store[key]; ok || e.outer == nil {
+			return e.Set(key, val)
+		}
+	}
+}
+
+// GetSlot returns the binding in a slot of the frame depth levels up.
+func (env *Environment) GetSlot(depth int, slot int) (Object, bool) {
+	for ; depth > 0; depth-- {
+		env = env.outer
+	}
+	obj := env.slots[slot]
+	return obj, obj != nil
+}
+
+func (env *Environment) SetSlot(slot int, val Object) Object {
+	env.slots[slot] = val
+	return val
+}
+
+// Names returns every identifier visible from this environment,
+// including those bound in enclosing environments.
+func (env *Environment) Names() []string {
+	seen := make(map[string]bool)
+	names := []string{}
+	for e := env; e != nil; e = e.outer {
+		for name := range e.store {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
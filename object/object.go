@@ -3,6 +3,7 @@ package object
 import (
 	"bytes"
 	"cardboard/parser/ast"
+	"fmt"
 	"strconv"
 	"strings"
 )
@@ -22,6 +23,8 @@ const (
 	NULL      ObjectType = "NULL"
 	FUNCTION  ObjectType = "FUNCTION"
 	ERROR_OBJ ObjectType = "ERROR"
+	STRING    ObjectType = "STRING"
+	EXCEPTION ObjectType = "EXCEPTION"
 )
 
 // Integer
@@ -32,6 +35,14 @@ type Integer struct {
 func (i *Integer) Type() ObjectType { return INTEGER }
 func (i *Integer) Inspect() string  { return strconv.Itoa(int(i.Value)) }
 
+// String
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING }
+func (s *String) Inspect() string  { return s.Value }
+
 // Null
 type Null struct{}
 
@@ -48,9 +59,15 @@ func (un *Unbox) Inspect() string  { return un.Value.Inspect() }
 
 // Function (box)
 type Box struct {
+	// Name the box was first bound to with 'put', empty when anonymous
+	Name string
+
 	Env           *Environment
 	ParameterList []*ast.Identifier
 	Body          *ast.BlockStatement
+
+	// Number of bindings made by a call, parameters included
+	Slots int
 }
 
 func (f *Box) Type() ObjectType { return FUNCTION }
@@ -67,10 +84,119 @@ func (f *Box) Inspect() string {
 	return out.String()
 }
 
-// Errors
+// Kinds of errors, scripts can tell them apart when catching errors
+type ErrorKind string
+
+const (
+	TYPE_ERROR          ErrorKind = "TypeError"
+	NAME_ERROR          ErrorKind = "NameError"
+	ZERO_DIVISION_ERROR ErrorKind = "ZeroDivisionError"
+	RUNTIME_ERROR       ErrorKind = "RuntimeError"
+	USER_ERROR          ErrorKind = "UserError"
+)
+
+// MaxCallDepth is the deepest chain of box calls, the program included,
+// before a program is stopped with a Stack Overflow error. Every backend
+// stops at the same depth, which keeps the evaluator well within the
+// stack Go gives a goroutine.
+const MaxCallDepth = 1 << 16
+
+// Errors abort evaluation until they're caught by a 'try' statement
 type Error struct {
+	Kind    ErrorKind
 	Message string
+
+	// Value passed to 'throw', nil for errors raised by the interpreter
+	Value Object
+
+	// Source position where the error was raised, 0 when unknown
+	Line   int
+	Column int
+
+	// Box calls the error propagated through, innermost call first
+	Trace []StackFrame
 }
 
 func (err *Error) Type() ObjectType { return ERROR_OBJ }
 func (err *Error) Inspect() string  { return err.Message }
+
+// Traceback renders the call stack of the error, outermost call first,
+// listing for each function the position execution had reached in it.
+// Returns an empty string when the error wasn't raised inside a box.
+func (err *Error) Traceback() string {
+	if len(err.Trace) == 0 {
+		return ""
+	}
+
+	var out bytes.Buffer
+	out.WriteString("Traceback (most recent call last):\n")
+
+	caller := "<main>"
+	for idx := len(err.Trace) - 1; idx >= 0; idx-- {
+		frame := err.Trace[idx]
+		out.WriteString(fmt.Sprintf("  at %d:%d, in %s\n", frame.Line, frame.Column, caller))
+		caller = frame.FunctionName()
+
+		if frame.TailCalls > 0 {
+			out.WriteString(fmt.Sprintf("  ... %d tail calls of %s\n", frame.TailCalls, caller))
+		}
+	}
+	out.WriteString(fmt.Sprintf("  at %d:%d, in %s\n", err.Line, err.Column, caller))
+	return out.String()
+}
+
+// A box call an error propagated through
+type StackFrame struct {
+	// Name of the called box, empty when anonymous
+	Function string
+
+	// Position of the call site
+	Line   int
+	Column int
+
+	// Number of calls the box made to itself in tail position. They reuse
+	// the call rather than adding frames to the trace.
+	TailCalls int
+}
+
+// Exception is a caught error bound by a 'catch' clause. Unlike Error it
+// is a regular value, and exposes the error's details as properties.
+type Exception struct {
+	Error *Error
+}
+
+func (ex *Exception) Type() ObjectType { return EXCEPTION }
+func (ex *Exception) Inspect() string {
+	return string(ex.Error.Kind) + ": " + ex.Error.Message
+}
+
+// Property returns the value of a property of the exception:
+// message, kind, value (the thrown value or the message), trace, line and column.
+func (ex *Exception) Property(name string) (Object, bool) {
+	err := ex.Error
+	switch name {
+	case "message":
+		return &String{Value: err.Message}, true
+	case "kind":
+		return &String{Value: string(err.Kind)}, true
+	case "value":
+		if err.Value != nil {
+			return err.Value, true
+		}
+		return &String{Value: err.Message}, true
+	case "trace":
+		return &String{Value: err.Traceback()}, true
+	case "line":
+		return &Integer{Value: int64(err.Line)}, true
+	case "column":
+		return &Integer{Value: int64(err.Column)}, true
+	}
+	return nil, false
+}
+
+func (frame StackFrame) FunctionName() string {
+	if frame.Function == "" {
+		return "<box>"
+	}
+	return frame.Function
+}
@@ -0,0 +1,210 @@
+// Package optimizer rewrites programs into equivalent programs that are
+// cheaper to run:
+//
+//   - operations on literals are folded into their result,
+//   - statements following an 'unbox' or 'throw' in a block are removed,
+//   - identifiers bound once, with 'put', to a literal are replaced by the
+//     literal wherever the binding has certainly been made.
+//
+// Operations that would raise an error, such as a division by zero, are
+// left in place so the error is still raised when the program runs.
+package optimizer
+
+import (
+	"cardboard/lexer/token"
+	"cardboard/parser/ast"
+	"strconv"
+)
+
+// Optimize rewrites the program in place and returns it. Boxes created by
+// the optimized program print their optimized body.
+//
+// Bindings are only inlined within the program: a program run after it
+// sharing its bindings, like the next line of the REPL, may bind them again.
+func Optimize(program *ast.Program) *ast.Program {
+	o := &optimizer{bindings: map[string]int{}}
+	o.countBindings(program)
+
+	program.Statements = o.block(program.Statements, map[string]ast.Expression{})
+	return program
+}
+
+type optimizer struct {
+	// Number of places binding each identifier: 'put' statements,
+	// box parameters and catch parameters.
+	bindings map[string]int
+}
+
+// Literal value of the identifiers known at a point of the program
+type constants map[string]ast.Expression
+
+func (o *optimizer) countBindings(program *ast.Program) {
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.PutStatement:
+			o.bindings[node.NodeIdentifier.Value]++
+		case *ast.TryStatement:
+			if node.CatchParameter != nil {
+				o.bindings[node.CatchParameter.Value]++
+			}
+		case *ast.BoxExpression:
+			for _, param := range node.ParameterList {
+				o.bindings[param.Value]++
+			}
+		}
+		return true
+	})
+}
+
+// Optimizes the statements of a block. Constants bound by a statement are
+// known to the statements following it, which only run once it has.
+func (o *optimizer) block(stmts []ast.Statement, known constants) []ast.Statement {
+	scope := constants{}
+	for name, value := range known {
+		scope[name] = value
+	}
+
+	optimized := []ast.Statement{}
+	for _, stmt := range stmts {
+		if stmt == nil {
+			continue
+		}
+		optimized = append(optimized, o.statement(stmt, scope))
+
+		switch stmt := stmt.(type) {
+		case *ast.PutStatement:
+			if isLiteral(stmt.NodeExpression) && o.bindings[stmt.NodeIdentifier.Value] == 1 {
+				scope[stmt.NodeIdentifier.Value] = stmt.NodeExpression
+			}
+		case *ast.UnboxStatement, *ast.ThrowStatement:
+			// The statements following can never run
+			return optimized
+		}
+	}
+	return optimized
+}
+
+func (o *optimizer) statement(stmt ast.Statement, known constants) ast.Statement {
+	switch stmt := stmt.(type) {
+	case *ast.PutStatement:
+		stmt.NodeExpression = o.expression(stmt.NodeExpression, known)
+	case *ast.UnboxStatement:
+		stmt.NodeExpression = o.expression(stmt.NodeExpression, known)
+	case *ast.ExpressionStatement:
+		stmt.Expression = o.expression(stmt.Expression, known)
+	case *ast.ThrowStatement:
+		stmt.NodeExpression = o.expression(stmt.NodeExpression, known)
+	case *ast.TryStatement:
+		stmt.Body.Statements = o.block(stmt.Body.Statements, known)
+		if stmt.Catch != nil {
+			stmt.Catch.Statements = o.block(stmt.Catch.Statements, known)
+		}
+		if stmt.Finally != nil {
+			stmt.Finally.Statements = o.block(stmt.Finally.Statements, known)
+		}
+	}
+	return stmt
+}
+
+func (o *optimizer) expression(expr ast.Expression, known constants) ast.Expression {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		if value, ok := known[expr.Value]; ok {
+			return relocate(value, expr.NodeToken)
+		}
+	case *ast.PrefixExpression:
+		expr.Right = o.expression(expr.Right, known)
+		return foldPrefix(expr)
+	case *ast.InfixExpression:
+		expr.Left = o.expression(expr.Left, known)
+		expr.Right = o.expression(expr.Right, known)
+		return foldInfix(expr)
+	case *ast.BoxExpression:
+		expr.Body.Statements = o.block(expr.Body.Statements, known)
+	case *ast.CallExpression:
+		expr.Function = o.expression(expr.Function, known)
+		for idx, arg := range expr.Arguments {
+			expr.Arguments[idx] = o.expression(arg, known)
+		}
+	case *ast.MemberExpression:
+		expr.Object = o.expression(expr.Object, known)
+	}
+	return expr
+}
+
+func foldPrefix(expr *ast.PrefixExpression) ast.Expression {
+	right, ok := expr.Right.(*ast.IntegerLiteral)
+	if !ok {
+		return expr
+	}
+
+	switch expr.Operator {
+	case "-":
+		return integer(-right.Value, expr.NodeToken)
+	case "+":
+		return integer(right.Value, expr.NodeToken)
+	}
+	return expr
+}
+
+func foldInfix(expr *ast.InfixExpression) ast.Expression {
+	if left, ok := expr.Left.(*ast.StringLiteral); ok {
+		if right, ok := expr.Right.(*ast.StringLiteral); ok && expr.Operator == "+" {
+			return str(left.Value+right.Value, expr.NodeToken)
+		}
+		return expr
+	}
+
+	left, ok := expr.Left.(*ast.IntegerLiteral)
+	if !ok {
+		return expr
+	}
+	right, ok := expr.Right.(*ast.IntegerLiteral)
+	if !ok {
+		return expr
+	}
+
+	switch expr.Operator {
+	case "+":
+		return integer(left.Value+right.Value, expr.NodeToken)
+	case "-":
+		return integer(left.Value-right.Value, expr.NodeToken)
+	case "*":
+		return integer(left.Value*right.Value, expr.NodeToken)
+	case "/":
+		// Dividing by zero must still raise an error when the program runs
+		if right.Value != 0 {
+			return integer(left.Value/right.Value, expr.NodeToken)
+		}
+	}
+	return expr
+}
+
+func isLiteral(expr ast.Expression) bool {
+	switch expr.(type) {
+	case *ast.IntegerLiteral, *ast.StringLiteral:
+		return true
+	}
+	return false
+}
+
+// Copies a literal to the position of the node it replaces
+func relocate(literal ast.Expression, at token.Token) ast.Expression {
+	switch literal := literal.(type) {
+	case *ast.IntegerLiteral:
+		return integer(literal.Value, at)
+	case *ast.StringLiteral:
+		return str(literal.Value, at)
+	}
+	return literal
+}
+
+func integer(value int64, at token.Token) *ast.IntegerLiteral {
+	tok := token.Token{TokenType: token.INT, TokenLiteral: strconv.FormatInt(value, 10), Line: at.Line, Column: at.Column}
+	return &ast.IntegerLiteral{NodeToken: tok, Value: value}
+}
+
+func str(value string, at token.Token) *ast.StringLiteral {
+	tok := token.Token{TokenType: token.STRING, TokenLiteral: value, Line: at.Line, Column: at.Column}
+	return &ast.StringLiteral{NodeToken: tok, Value: value}
+}
@@ -0,0 +1,110 @@
+package optimizer
+
+import (
+	"cardboard/lexer"
+	"cardboard/parser"
+	"cardboard/parser/ast"
+	"testing"
+)
+
+func TestConstantFolding(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + (5 - 10);", "0"},
+		{"-50 + 100 + -50", "0"},
+		{"2 * 3 + 7 / 2", "9"},
+		{"-(1 + 2)", "-3"},
+		{`"card" + "board"`, `"cardboard"`},
+		{"1 / 0", "(1/0)"},
+		{"2 * (1 / 0)", "(2*(1/0))"},
+		{`1 + "a"`, `(1+"a")`},
+		{"x + (1 + 2)", "(x+3)"},
+		{"box(x) { x * (2 * 2) }", "(x,){(x*4)}"},
+		{"f(1 + 1)", "f(2)"},
+	}
+
+	for _, tt := range tests {
+		if actual := optimize(t, tt.input); actual != tt.expected {
+			t.Errorf("Test failed. Expected <%s> to be optimized to %s. Got <%s>", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestDeadCodeElimination(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"unbox 1; 2; 3;", "unbox 1;"},
+		{"box() { 1; unbox x; put y = 2; }", "(){1unbox x;}"},
+		{"box() { throw 1; 2 }", "(){throw 1;}"},
+		{"try { unbox 1; 2; } catch (e) { 3; } 4;", "try{unbox 1;}catch(e){3}4"},
+	}
+
+	for _, tt := range tests {
+		if actual := optimize(t, tt.input); actual != tt.expected {
+			t.Errorf("Test failed. Expected <%s> to be optimized to %s. Got <%s>", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestConstantBindings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Inlined in the following statements, and the boxes they create
+		{"put a = 1; put b = a + 1; b * 2", "put a = 1;put b = 2;4"},
+		{"put a = 1; box() { a }", "put a = 1;(){1}"},
+		{`put s = "x"; s + s`, `put s = "x";"xx"`},
+		// The binding may not be made yet
+		{"a; put a = 1;", "aput a = 1;"},
+		{"put f = box() { a }; put a = 1; f()", "put f = (){a};put a = 1;f()"},
+		{"try { put a = 1; } catch { 2; } a", "try{put a = 1;}catch{2}a"},
+		// Identifiers bound more than once
+		{"put a = 1; put a = 2; a", "put a = 1;put a = 2;a"},
+		{"put a = 1; box(a) { a }", "put a = 1;(a,){a}"},
+		{"put e = 1; try { 2; } catch (e) { e } e", "put e = 1;try{2}catch(e){e}e"},
+		// Values that aren't literals
+		{"put a = box() { 1 }; a", "put a = (){1};a"},
+		{"put a = 1 / 0; a", "put a = (1/0);a"},
+	}
+
+	for _, tt := range tests {
+		if actual := optimize(t, tt.input); actual != tt.expected {
+			t.Errorf("Test failed. Expected <%s> to be optimized to %s. Got <%s>", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestFoldedPositions(t *testing.T) {
+	program := parse(t, "put a = 1;\n  a + 2;")
+	Optimize(program)
+
+	literal, ok := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("Test failed. Expected an integer literal. Got <%s>", program.Statements[1])
+	}
+
+	if literal.NodeToken.Line != 2 || literal.NodeToken.Column != 5 {
+		t.Errorf("Test failed. Expected the literal at 2:5. Got <%d:%d>", literal.NodeToken.Line, literal.NodeToken.Column)
+	}
+}
+
+func optimize(t *testing.T, input string) string {
+	t.Helper()
+	return Optimize(parse(t, input)).String()
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.CreateParser(lexer.CreateLexer(input))
+	program := p.ParseCardBoard()
+	if errs := p.GetErrors(); len(errs) > 0 {
+		t.Fatalf("Test failed. Parser errors for <%s>: %v", input, errs)
+	}
+	return program
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"cardboard/lexer"
+	"cardboard/parser"
+	"cardboard/parser/ast"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Prints the syntax tree of a script, as JSON with -json
+func parseCommand(args []string) int {
+	flags := flag.NewFlagSet("parse", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the syntax tree as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: cardboard parse [-json] script.cb")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	path := flags.Arg(0)
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	p := parser.CreateParser(lexer.CreateLexer(string(source)))
+	program := p.ParseCardBoard()
+	if errs := p.GetErrors(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return 1
+	}
+
+	if !*asJSON {
+		for _, stmt := range program.Statements {
+			fmt.Println(stmt.String())
+		}
+		return 0
+	}
+
+	data, err := ast.EncodeJSON(program)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	os.Stdout.Write(data)
+	return 0
+}
@@ -24,6 +24,10 @@ type Expression interface {
 // therefore the AST Root Node is the list of statements of the program
 type Program struct {
 	Statements []Statement
+
+	// Comments of the source, in source order. They aren't statements,
+	// only the formatter looks at them.
+	Comments []*Comment
 }
 
 func (program *Program) String() string {
@@ -36,10 +40,45 @@ func (program *Program) String() string {
 
 func (program *Program) TokenLiteral() string { return "" }
 
+// Comment -> < text >
+type Comment struct {
+	NodeToken token.Token
+	Text      string
+}
+
+func (c *Comment) TokenLiteral() string { return c.NodeToken.TokenLiteral }
+func (c *Comment) String() string       { return "<" + c.Text + ">" }
+
 // Identifiers are Expressions.
 type Identifier struct {
 	NodeToken token.Token
 	Value     string
+
+	// Binding the identifier refers to, set by the resolver.
+	// nil until resolved, and for unknown identifiers.
+	Resolution *Resolution
+}
+
+// Location of a binding, relative to an identifier referring to it
+type Resolution struct {
+	// Number of box bodies between the identifier and the body
+	// (or program) making the binding
+	Depth int
+
+	// Index of the binding among those made by its body, parameters first
+	Slot int
+
+	// Made by the top level statements of the program
+	Global bool
+
+	// Identifier first making the binding: a 'put' binding, a parameter or
+	// a catch parameter
+	Declaration *Identifier
+
+	// Binding the identifier refers to while this one isn't made, like the
+	// binding of an enclosing body before a 'put' runs. nil when there is
+	// none, the name then refers to a global or a builtin.
+	Outer *Resolution
 }
 
 func (ident *Identifier) expressionNode()      {}
@@ -47,11 +86,14 @@ func (ident *Identifier) TokenLiteral() string { return ident.Value }
 func (ident *Identifier) String() string       { return ident.Value }
 
 // 'put' statement
-// put <identifier> = <expression>
+// put <identifier> [: <type>] = <expression>
 type PutStatement struct {
 	NodeToken      token.Token
 	NodeIdentifier Identifier
 	NodeExpression Expression
+
+	// Annotated type of the binding, nil when unannotated
+	Type Type
 }
 
 func (p *PutStatement) statementNode()       {}
@@ -60,7 +102,11 @@ func (p *PutStatement) TokenLiteral() string { return p.NodeToken.TokenLiteral }
 // Helps during debugging to observe what the Node represents
 func (p *PutStatement) String() string {
 	var outputString bytes.Buffer
-	outputString.WriteString(p.TokenLiteral() + " " + p.NodeIdentifier.Value + " = ")
+	outputString.WriteString(p.TokenLiteral() + " " + p.NodeIdentifier.Value)
+	if p.Type != nil {
+		outputString.WriteString(": " + p.Type.String())
+	}
+	outputString.WriteString(" = ")
 	if p.NodeExpression != nil {
 		outputString.WriteString(p.NodeExpression.String())
 	}
@@ -152,6 +198,9 @@ func (ie *InfixExpression) String() string {
 type BlockStatement struct {
 	NodeToken  token.Token
 	Statements []Statement
+
+	// Closing '}' of the block
+	RightBrace token.Token
 }
 
 func (bs *BlockStatement) statementNode()       {}
@@ -170,6 +219,15 @@ type BoxExpression struct {
 	NodeToken     token.Token
 	ParameterList []*Identifier
 	Body          *BlockStatement
+
+	// Annotated types of the parameters and of the returned value,
+	// nil when unannotated
+	ParameterTypes []Type
+	ReturnType     Type
+
+	// Number of bindings made by the body, parameters included.
+	// Set by the resolver.
+	Slots int
 }
 
 func (box *BoxExpression) expressionNode()      {}
@@ -177,10 +235,17 @@ func (box *BoxExpression) TokenLiteral() string { return box.NodeToken.TokenLite
 func (box *BoxExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
-	for _, arg := range box.ParameterList {
-		out.WriteString(arg.String() + ",")
+	for idx, arg := range box.ParameterList {
+		out.WriteString(arg.String())
+		if typ := box.ParameterType(idx); typ != nil {
+			out.WriteString(": " + typ.String())
+		}
+		out.WriteString(",")
 	}
 	out.WriteString(")")
+	if box.ReturnType != nil {
+		out.WriteString("->" + box.ReturnType.String())
+	}
 
 	out.WriteString("{")
 	for _, s := range box.Body.Statements {
@@ -190,6 +255,14 @@ func (box *BoxExpression) String() string {
 	return out.String()
 }
 
+// ParameterType returns the annotated type of parameter idx, or nil
+func (box *BoxExpression) ParameterType(idx int) Type {
+	if idx < len(box.ParameterTypes) {
+		return box.ParameterTypes[idx]
+	}
+	return nil
+}
+
 type CallExpression struct {
 	NodeToken token.Token
 	Function  Expression
@@ -202,10 +275,149 @@ func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString(ce.Function.String())
 	out.WriteString("(")
-	for _, arg := range ce.Arguments {
+	for idx, arg := range ce.Arguments {
+		if idx > 0 {
+			out.WriteString(", ")
+		}
 		out.WriteString(arg.String())
 	}
 	out.WriteString(")")
-	out.WriteString(ce.Function.String())
+	return out.String()
+}
+
+// String literals
+type StringLiteral struct {
+	NodeToken token.Token
+	Value     string
+}
+
+func (sl *StringLiteral) expressionNode()      {}
+func (sl *StringLiteral) TokenLiteral() string { return sl.NodeToken.TokenLiteral }
+func (sl *StringLiteral) String() string       { return QuoteString(sl.Value) }
+
+// QuoteString wraps a string in quotes, escaping characters the lexer decodes.
+func QuoteString(str string) string {
+	var out bytes.Buffer
+	out.WriteString("\"")
+	for _, ch := range str {
+		switch ch {
+		case '"':
+			out.WriteString("\\\"")
+		case '\\':
+			out.WriteString("\\\\")
+		case '\n':
+			out.WriteString("\\n")
+		case '\t':
+			out.WriteString("\\t")
+		default:
+			out.WriteRune(ch)
+		}
+	}
+	out.WriteString("\"")
+	return out.String()
+}
+
+// Member access -> <expression>.<identifier>
+type MemberExpression struct {
+	NodeToken token.Token
+	Object    Expression
+	Property  *Identifier
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.NodeToken.TokenLiteral }
+func (me *MemberExpression) String() string {
+	return me.Object.String() + "." + me.Property.String()
+}
+
+// 'throw' statement. Raises an error carrying any value.
+// throw <expression>;
+type ThrowStatement struct {
+	NodeToken      token.Token
+	NodeExpression Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.NodeToken.TokenLiteral }
+func (ts *ThrowStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(ts.NodeToken.TokenLiteral + " ")
+	if ts.NodeExpression != nil {
+		out.WriteString(ts.NodeExpression.String())
+	}
+	out.WriteString(";")
+	return out.String()
+}
+
+// 'try' statement. At least one of the catch and finally blocks is present.
+// try <block> catch (<identifier>) <block> finally <block>
+type TryStatement struct {
+	NodeToken token.Token
+	Body      *BlockStatement
+
+	// Identifier the caught error is bound to, nil when not bound
+	CatchParameter *Identifier
+	Catch          *BlockStatement
+	Finally        *BlockStatement
+}
+
+func (ts *TryStatement) statementNode()       {}
+func (ts *TryStatement) TokenLiteral() string { return ts.NodeToken.TokenLiteral }
+func (ts *TryStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("try" + ts.Body.String())
+	if ts.Catch != nil {
+		out.WriteString("catch")
+		if ts.CatchParameter != nil {
+			out.WriteString("(" + ts.CatchParameter.String() + ")")
+		}
+		out.WriteString(ts.Catch.String())
+	}
+	if ts.Finally != nil {
+		out.WriteString("finally" + ts.Finally.String())
+	}
+	return out.String()
+}
+
+// Type annotations
+type Type interface {
+	Node
+	typeNode()
+}
+
+// Named type: int, string, ...
+type TypeName struct {
+	NodeToken token.Token
+	Name      string
+}
+
+func (tn *TypeName) typeNode()            {}
+func (tn *TypeName) TokenLiteral() string { return tn.NodeToken.TokenLiteral }
+func (tn *TypeName) String() string       { return tn.Name }
+
+// Type of boxes: box(<parameter types>) [-> <return type>]
+type BoxType struct {
+	NodeToken  token.Token
+	Parameters []Type
+
+	// nil when the returned value isn't annotated
+	Return Type
+}
+
+func (bt *BoxType) typeNode()            {}
+func (bt *BoxType) TokenLiteral() string { return bt.NodeToken.TokenLiteral }
+func (bt *BoxType) String() string {
+	var out bytes.Buffer
+	out.WriteString("box(")
+	for idx, param := range bt.Parameters {
+		if idx > 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString(param.String())
+	}
+	out.WriteString(")")
+	if bt.Return != nil {
+		out.WriteString(" -> " + bt.Return.String())
+	}
 	return out.String()
 }
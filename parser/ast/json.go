@@ -0,0 +1,742 @@
+package ast
+
+import (
+	"bytes"
+	"cardboard/lexer/token"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// JSON encoding of programs, for tools written in other languages.
+//
+// Every node is an object whose "kind" is the name of its type, like
+// "PutStatement". Its "span" holds the "start" and "end" of the node in
+// the source, as given by Start and End, and "token" the position of its
+// own token, like the operator of an infix expression. Optional children
+// (types, catch parameters, catch and finally blocks) are left out when
+// missing.
+//
+// Decoding an encoded program gives a program that runs the same way,
+// errors included: the tokens of nodes take their positions from "token",
+// and closing braces from the end of the span of blocks. Resolutions
+// aren't encoded, the resolver sets them again.
+
+// Source position of a node
+type Span struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func spanOf(tok token.Token) Span { return Span{Line: tok.Line, Column: tok.Column} }
+
+func (s Span) token(tokenType token.TokenType, literal string) token.Token {
+	return token.Token{TokenType: tokenType, TokenLiteral: literal, Line: s.Line, Column: s.Column}
+}
+
+// Positions of an encoded node
+type jsonPosition struct {
+	Span  jsonSpan `json:"span"`
+	Token Span     `json:"token"`
+}
+
+type jsonSpan struct {
+	Start Span `json:"start"`
+	End   Span `json:"end"`
+}
+
+func positionOf(node Node, tok token.Token) jsonPosition {
+	return jsonPosition{Span: jsonSpan{Start: Start(node), End: End(node)}, Token: spanOf(tok)}
+}
+
+type jsonKind struct {
+	Kind string `json:"kind"`
+}
+
+type jsonProgram struct {
+	Kind       string            `json:"kind"`
+	Statements []json.RawMessage `json:"statements"`
+	Comments   []json.RawMessage `json:"comments,omitempty"`
+}
+
+type jsonComment struct {
+	Kind string `json:"kind"`
+	Text string `json:"text"`
+	jsonPosition
+}
+
+type jsonPutStatement struct {
+	Kind       string          `json:"kind"`
+	Identifier json.RawMessage `json:"identifier"`
+	Type       json.RawMessage `json:"type,omitempty"`
+	Value      json.RawMessage `json:"value"`
+	jsonPosition
+}
+
+// Unbox, throw and expression statements
+type jsonValueStatement struct {
+	Kind  string          `json:"kind"`
+	Value json.RawMessage `json:"value"`
+	jsonPosition
+}
+
+type jsonTryStatement struct {
+	Kind           string          `json:"kind"`
+	Body           json.RawMessage `json:"body"`
+	CatchParameter json.RawMessage `json:"catchParameter,omitempty"`
+	Catch          json.RawMessage `json:"catch,omitempty"`
+	Finally        json.RawMessage `json:"finally,omitempty"`
+	jsonPosition
+}
+
+type jsonBlockStatement struct {
+	Kind       string            `json:"kind"`
+	Statements []json.RawMessage `json:"statements"`
+	jsonPosition
+}
+
+// Identifiers and type names
+type jsonName struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	jsonPosition
+}
+
+type jsonLiteral struct {
+	Kind  string          `json:"kind"`
+	Value json.RawMessage `json:"value"`
+	jsonPosition
+}
+
+type jsonPrefixExpression struct {
+	Kind     string          `json:"kind"`
+	Operator string          `json:"operator"`
+	Right    json.RawMessage `json:"right"`
+	jsonPosition
+}
+
+type jsonInfixExpression struct {
+	Kind     string          `json:"kind"`
+	Operator string          `json:"operator"`
+	Left     json.RawMessage `json:"left"`
+	Right    json.RawMessage `json:"right"`
+	jsonPosition
+}
+
+type jsonBoxExpression struct {
+	Kind           string            `json:"kind"`
+	Parameters     []json.RawMessage `json:"parameters"`
+	ParameterTypes []json.RawMessage `json:"parameterTypes,omitempty"`
+	ReturnType     json.RawMessage   `json:"returnType,omitempty"`
+	Body           json.RawMessage   `json:"body"`
+	jsonPosition
+}
+
+type jsonCallExpression struct {
+	Kind      string            `json:"kind"`
+	Function  json.RawMessage   `json:"function"`
+	Arguments []json.RawMessage `json:"arguments"`
+	jsonPosition
+}
+
+type jsonMemberExpression struct {
+	Kind     string          `json:"kind"`
+	Object   json.RawMessage `json:"object"`
+	Property json.RawMessage `json:"property"`
+	jsonPosition
+}
+
+type jsonBoxType struct {
+	Kind       string            `json:"kind"`
+	Parameters []json.RawMessage `json:"parameters"`
+	Return     json.RawMessage   `json:"return,omitempty"`
+	jsonPosition
+}
+
+// EncodeJSON returns the JSON encoding of a program, indented
+func EncodeJSON(program *Program) ([]byte, error) {
+	raw, err := encode(program)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, raw, "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteString("\n")
+	return out.Bytes(), nil
+}
+
+// Encodes a node, nil nodes being null
+func encode(node Node) (json.RawMessage, error) {
+	var value interface{}
+	var err error
+
+	switch node := node.(type) {
+	case *Program:
+		p := jsonProgram{Kind: "Program"}
+		if p.Statements, err = encodeStatements(node.Statements); err != nil {
+			return nil, err
+		}
+		for _, comment := range node.Comments {
+			raw, err := encode(comment)
+			if err != nil {
+				return nil, err
+			}
+			p.Comments = append(p.Comments, raw)
+		}
+		value = p
+	case *Comment:
+		value = jsonComment{Kind: "Comment", jsonPosition: positionOf(node, node.NodeToken), Text: node.Text}
+
+	// Statements
+	case *PutStatement:
+		stmt := jsonPutStatement{Kind: "PutStatement", jsonPosition: positionOf(node, node.NodeToken)}
+		if stmt.Identifier, err = encode(&node.NodeIdentifier); err != nil {
+			return nil, err
+		}
+		if node.Type != nil {
+			if stmt.Type, err = encode(node.Type); err != nil {
+				return nil, err
+			}
+		}
+		if stmt.Value, err = encode(node.NodeExpression); err != nil {
+			return nil, err
+		}
+		value = stmt
+	case *UnboxStatement:
+		if value, err = encodeValueStatement("UnboxStatement", node, node.NodeToken, node.NodeExpression); err != nil {
+			return nil, err
+		}
+	case *ThrowStatement:
+		if value, err = encodeValueStatement("ThrowStatement", node, node.NodeToken, node.NodeExpression); err != nil {
+			return nil, err
+		}
+	case *ExpressionStatement:
+		if value, err = encodeValueStatement("ExpressionStatement", node, node.NodeToken, node.Expression); err != nil {
+			return nil, err
+		}
+	case *TryStatement:
+		stmt := jsonTryStatement{Kind: "TryStatement", jsonPosition: positionOf(node, node.NodeToken)}
+		if stmt.Body, err = encode(node.Body); err != nil {
+			return nil, err
+		}
+		if node.CatchParameter != nil {
+			if stmt.CatchParameter, err = encode(node.CatchParameter); err != nil {
+				return nil, err
+			}
+		}
+		if node.Catch != nil {
+			if stmt.Catch, err = encode(node.Catch); err != nil {
+				return nil, err
+			}
+		}
+		if node.Finally != nil {
+			if stmt.Finally, err = encode(node.Finally); err != nil {
+				return nil, err
+			}
+		}
+		value = stmt
+	case *BlockStatement:
+		block := jsonBlockStatement{Kind: "BlockStatement", jsonPosition: positionOf(node, node.NodeToken)}
+		if block.Statements, err = encodeStatements(node.Statements); err != nil {
+			return nil, err
+		}
+		value = block
+
+	// Expressions
+	case *Identifier:
+		if node == nil {
+			return json.RawMessage("null"), nil
+		}
+		value = jsonName{Kind: "Identifier", jsonPosition: positionOf(node, node.NodeToken), Name: node.Value}
+	case *IntegerLiteral:
+		value = jsonLiteral{Kind: "IntegerLiteral", jsonPosition: positionOf(node, node.NodeToken), Value: json.RawMessage(strconv.FormatInt(node.Value, 10))}
+	case *StringLiteral:
+		raw, err := json.Marshal(node.Value)
+		if err != nil {
+			return nil, err
+		}
+		value = jsonLiteral{Kind: "StringLiteral", jsonPosition: positionOf(node, node.NodeToken), Value: raw}
+	case *PrefixExpression:
+		expr := jsonPrefixExpression{Kind: "PrefixExpression", jsonPosition: positionOf(node, node.NodeToken), Operator: node.Operator}
+		if expr.Right, err = encode(node.Right); err != nil {
+			return nil, err
+		}
+		value = expr
+	case *InfixExpression:
+		expr := jsonInfixExpression{Kind: "InfixExpression", jsonPosition: positionOf(node, node.NodeToken), Operator: node.Operator}
+		if expr.Left, err = encode(node.Left); err != nil {
+			return nil, err
+		}
+		if expr.Right, err = encode(node.Right); err != nil {
+			return nil, err
+		}
+		value = expr
+	case *BoxExpression:
+		expr := jsonBoxExpression{Kind: "BoxExpression", jsonPosition: positionOf(node, node.NodeToken), Parameters: []json.RawMessage{}}
+		annotated := false
+		for idx, param := range node.ParameterList {
+			raw, err := encode(param)
+			if err != nil {
+				return nil, err
+			}
+			expr.Parameters = append(expr.Parameters, raw)
+
+			typ := json.RawMessage("null")
+			if annotation := node.ParameterType(idx); annotation != nil {
+				annotated = true
+				if typ, err = encode(annotation); err != nil {
+					return nil, err
+				}
+			}
+			expr.ParameterTypes = append(expr.ParameterTypes, typ)
+		}
+		if !annotated {
+			expr.ParameterTypes = nil
+		}
+		if node.ReturnType != nil {
+			if expr.ReturnType, err = encode(node.ReturnType); err != nil {
+				return nil, err
+			}
+		}
+		if expr.Body, err = encode(node.Body); err != nil {
+			return nil, err
+		}
+		value = expr
+	case *CallExpression:
+		expr := jsonCallExpression{Kind: "CallExpression", jsonPosition: positionOf(node, node.NodeToken), Arguments: []json.RawMessage{}}
+		if expr.Function, err = encode(node.Function); err != nil {
+			return nil, err
+		}
+		for _, arg := range node.Arguments {
+			raw, err := encode(arg)
+			if err != nil {
+				return nil, err
+			}
+			expr.Arguments = append(expr.Arguments, raw)
+		}
+		value = expr
+	case *MemberExpression:
+		expr := jsonMemberExpression{Kind: "MemberExpression", jsonPosition: positionOf(node, node.NodeToken)}
+		if expr.Object, err = encode(node.Object); err != nil {
+			return nil, err
+		}
+		if expr.Property, err = encode(node.Property); err != nil {
+			return nil, err
+		}
+		value = expr
+
+	// Types
+	case *TypeName:
+		value = jsonName{Kind: "TypeName", jsonPosition: positionOf(node, node.NodeToken), Name: node.Name}
+	case *BoxType:
+		typ := jsonBoxType{Kind: "BoxType", jsonPosition: positionOf(node, node.NodeToken), Parameters: []json.RawMessage{}}
+		for _, param := range node.Parameters {
+			raw, err := encode(param)
+			if err != nil {
+				return nil, err
+			}
+			typ.Parameters = append(typ.Parameters, raw)
+		}
+		if node.Return != nil {
+			if typ.Return, err = encode(node.Return); err != nil {
+				return nil, err
+			}
+		}
+		value = typ
+
+	case nil:
+		return json.RawMessage("null"), nil
+	default:
+		return nil, fmt.Errorf("Can't encode node of type %T", node)
+	}
+
+	return json.Marshal(value)
+}
+
+func encodeValueStatement(kind string, stmt Statement, tok token.Token, expr Expression) (interface{}, error) {
+	raw, err := encode(expr)
+	if err != nil {
+		return nil, err
+	}
+	return jsonValueStatement{Kind: kind, jsonPosition: positionOf(stmt, tok), Value: raw}, nil
+}
+
+func encodeStatements(stmts []Statement) ([]json.RawMessage, error) {
+	list := []json.RawMessage{}
+	for _, stmt := range stmts {
+		raw, err := encode(stmt)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, raw)
+	}
+	return list, nil
+}
+
+// DecodeJSON decodes a program encoded by EncodeJSON
+func DecodeJSON(data []byte) (*Program, error) {
+	var p jsonProgram
+	if err := decodeKind(data, "Program", &p); err != nil {
+		return nil, err
+	}
+
+	program := &Program{}
+	for _, raw := range p.Statements {
+		stmt, err := decodeStatement(raw)
+		if err != nil {
+			return nil, err
+		}
+		program.Statements = append(program.Statements, stmt)
+	}
+	for _, raw := range p.Comments {
+		var c jsonComment
+		if err := decodeKind(raw, "Comment", &c); err != nil {
+			return nil, err
+		}
+		program.Comments = append(program.Comments, &Comment{NodeToken: c.Token.token(token.COMMENT, c.Text), Text: c.Text})
+	}
+	return program, nil
+}
+
+func kindOf(raw json.RawMessage) (string, error) {
+	var k jsonKind
+	if err := json.Unmarshal(raw, &k); err != nil {
+		return "", fmt.Errorf("Invalid AST JSON: %s", err)
+	}
+	return k.Kind, nil
+}
+
+// Decodes a node of the given kind into v
+func decodeKind(raw json.RawMessage, kind string, v interface{}) error {
+	got, err := kindOf(raw)
+	if err != nil {
+		return err
+	}
+	if got != kind {
+		return fmt.Errorf("Invalid AST JSON: expected a %s node. Got <%s>", kind, got)
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("Invalid AST JSON: %s", err)
+	}
+	return nil
+}
+
+func isNull(raw json.RawMessage) bool {
+	return len(raw) == 0 || string(raw) == "null"
+}
+
+func decodeStatement(raw json.RawMessage) (Statement, error) {
+	kind, err := kindOf(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case "PutStatement":
+		var s jsonPutStatement
+		if err := decodeKind(raw, kind, &s); err != nil {
+			return nil, err
+		}
+		ident, err := decodeIdentifier(s.Identifier)
+		if err != nil {
+			return nil, err
+		}
+		stmt := &PutStatement{NodeToken: s.Token.token(token.PUT, "put"), NodeIdentifier: *ident}
+		if !isNull(s.Type) {
+			if stmt.Type, err = decodeType(s.Type); err != nil {
+				return nil, err
+			}
+		}
+		if stmt.NodeExpression, err = decodeExpression(s.Value); err != nil {
+			return nil, err
+		}
+		return stmt, nil
+
+	case "UnboxStatement", "ThrowStatement", "ExpressionStatement":
+		var s jsonValueStatement
+		if err := decodeKind(raw, kind, &s); err != nil {
+			return nil, err
+		}
+		expr, err := decodeExpression(s.Value)
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case "UnboxStatement":
+			return &UnboxStatement{NodeToken: s.Token.token(token.UNBOX, "unbox"), NodeExpression: expr}, nil
+		case "ThrowStatement":
+			return &ThrowStatement{NodeToken: s.Token.token(token.THROW, "throw"), NodeExpression: expr}, nil
+		}
+		first := firstToken(expr)
+		return &ExpressionStatement{NodeToken: s.Token.token(first.TokenType, first.TokenLiteral), Expression: expr}, nil
+
+	case "TryStatement":
+		var s jsonTryStatement
+		if err := decodeKind(raw, kind, &s); err != nil {
+			return nil, err
+		}
+		stmt := &TryStatement{NodeToken: s.Token.token(token.TRY, "try")}
+		if stmt.Body, err = decodeBlock(s.Body); err != nil {
+			return nil, err
+		}
+		if !isNull(s.CatchParameter) {
+			if stmt.CatchParameter, err = decodeIdentifier(s.CatchParameter); err != nil {
+				return nil, err
+			}
+		}
+		if !isNull(s.Catch) {
+			if stmt.Catch, err = decodeBlock(s.Catch); err != nil {
+				return nil, err
+			}
+		}
+		if !isNull(s.Finally) {
+			if stmt.Finally, err = decodeBlock(s.Finally); err != nil {
+				return nil, err
+			}
+		}
+		if stmt.Catch == nil && stmt.Finally == nil {
+			return nil, fmt.Errorf("Invalid AST JSON: try statement without catch or finally")
+		}
+		return stmt, nil
+	}
+	return nil, fmt.Errorf("Invalid AST JSON: unknown statement kind <%s>", kind)
+}
+
+// Token an expression starts with
+func firstToken(expr Expression) token.Token {
+	switch expr := expr.(type) {
+	case *InfixExpression:
+		return firstToken(expr.Left)
+	case *CallExpression:
+		return firstToken(expr.Function)
+	case *MemberExpression:
+		return firstToken(expr.Object)
+	case *Identifier:
+		return expr.NodeToken
+	case *IntegerLiteral:
+		return expr.NodeToken
+	case *StringLiteral:
+		return expr.NodeToken
+	case *PrefixExpression:
+		return expr.NodeToken
+	case *BoxExpression:
+		return expr.NodeToken
+	}
+	return token.Token{}
+}
+
+func decodeBlock(raw json.RawMessage) (*BlockStatement, error) {
+	var b jsonBlockStatement
+	if err := decodeKind(raw, "BlockStatement", &b); err != nil {
+		return nil, err
+	}
+
+	block := &BlockStatement{NodeToken: b.Token.token(token.LCURLY, "{"), RightBrace: after(b.Span.End, -1).token(token.RCURLY, "}")}
+	for _, raw := range b.Statements {
+		stmt, err := decodeStatement(raw)
+		if err != nil {
+			return nil, err
+		}
+		block.Statements = append(block.Statements, stmt)
+	}
+	return block, nil
+}
+
+func decodeIdentifier(raw json.RawMessage) (*Identifier, error) {
+	var n jsonName
+	if err := decodeKind(raw, "Identifier", &n); err != nil {
+		return nil, err
+	}
+	if n.Name == "" {
+		return nil, fmt.Errorf("Invalid AST JSON: identifier without name")
+	}
+	return &Identifier{NodeToken: n.Token.token(token.IDENTIFIER, n.Name), Value: n.Name}, nil
+}
+
+func decodeExpression(raw json.RawMessage) (Expression, error) {
+	if isNull(raw) {
+		return nil, fmt.Errorf("Invalid AST JSON: missing expression")
+	}
+	kind, err := kindOf(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case "Identifier":
+		return decodeIdentifier(raw)
+
+	case "IntegerLiteral":
+		var l jsonLiteral
+		if err := decodeKind(raw, kind, &l); err != nil {
+			return nil, err
+		}
+		var value int64
+		if err := json.Unmarshal(l.Value, &value); err != nil {
+			return nil, fmt.Errorf("Invalid AST JSON: %s", err)
+		}
+		if value < 0 {
+			return nil, fmt.Errorf("Invalid AST JSON: negative integer literal <%d>", value)
+		}
+		literal := strconv.FormatInt(value, 10)
+		return &IntegerLiteral{NodeToken: l.Token.token(token.INT, literal), Value: value}, nil
+
+	case "StringLiteral":
+		var l jsonLiteral
+		if err := decodeKind(raw, kind, &l); err != nil {
+			return nil, err
+		}
+		var value string
+		if err := json.Unmarshal(l.Value, &value); err != nil {
+			return nil, fmt.Errorf("Invalid AST JSON: %s", err)
+		}
+		return &StringLiteral{NodeToken: l.Token.token(token.STRING, value), Value: value}, nil
+
+	case "PrefixExpression":
+		var e jsonPrefixExpression
+		if err := decodeKind(raw, kind, &e); err != nil {
+			return nil, err
+		}
+		if e.Operator != "+" && e.Operator != "-" {
+			return nil, fmt.Errorf("Invalid AST JSON: unknown prefix operator <%s>", e.Operator)
+		}
+		right, err := decodeExpression(e.Right)
+		if err != nil {
+			return nil, err
+		}
+		return &PrefixExpression{NodeToken: e.Token.token(token.TokenType(e.Operator), e.Operator), Operator: e.Operator, Right: right}, nil
+
+	case "InfixExpression":
+		var e jsonInfixExpression
+		if err := decodeKind(raw, kind, &e); err != nil {
+			return nil, err
+		}
+		switch e.Operator {
+		case "+", "-", "*", "/":
+		default:
+			return nil, fmt.Errorf("Invalid AST JSON: unknown infix operator <%s>", e.Operator)
+		}
+		left, err := decodeExpression(e.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := decodeExpression(e.Right)
+		if err != nil {
+			return nil, err
+		}
+		return &InfixExpression{NodeToken: e.Token.token(token.TokenType(e.Operator), e.Operator), Operator: e.Operator, Left: left, Right: right}, nil
+
+	case "BoxExpression":
+		var e jsonBoxExpression
+		if err := decodeKind(raw, kind, &e); err != nil {
+			return nil, err
+		}
+		if e.ParameterTypes != nil && len(e.ParameterTypes) != len(e.Parameters) {
+			return nil, fmt.Errorf("Invalid AST JSON: %d parameter types for %d parameters", len(e.ParameterTypes), len(e.Parameters))
+		}
+
+		box := &BoxExpression{NodeToken: e.Token.token(token.BOX, "box"), ParameterList: []*Identifier{}}
+		for idx, raw := range e.Parameters {
+			param, err := decodeIdentifier(raw)
+			if err != nil {
+				return nil, err
+			}
+			box.ParameterList = append(box.ParameterList, param)
+
+			var typ Type
+			if e.ParameterTypes != nil && !isNull(e.ParameterTypes[idx]) {
+				if typ, err = decodeType(e.ParameterTypes[idx]); err != nil {
+					return nil, err
+				}
+			}
+			box.ParameterTypes = append(box.ParameterTypes, typ)
+		}
+		if !isNull(e.ReturnType) {
+			if box.ReturnType, err = decodeType(e.ReturnType); err != nil {
+				return nil, err
+			}
+		}
+		if box.Body, err = decodeBlock(e.Body); err != nil {
+			return nil, err
+		}
+		return box, nil
+
+	case "CallExpression":
+		var e jsonCallExpression
+		if err := decodeKind(raw, kind, &e); err != nil {
+			return nil, err
+		}
+		function, err := decodeExpression(e.Function)
+		if err != nil {
+			return nil, err
+		}
+		call := &CallExpression{NodeToken: e.Token.token(token.LPAREN, "("), Function: function, Arguments: []Expression{}}
+		for _, raw := range e.Arguments {
+			arg, err := decodeExpression(raw)
+			if err != nil {
+				return nil, err
+			}
+			call.Arguments = append(call.Arguments, arg)
+		}
+		return call, nil
+
+	case "MemberExpression":
+		var e jsonMemberExpression
+		if err := decodeKind(raw, kind, &e); err != nil {
+			return nil, err
+		}
+		object, err := decodeExpression(e.Object)
+		if err != nil {
+			return nil, err
+		}
+		property, err := decodeIdentifier(e.Property)
+		if err != nil {
+			return nil, err
+		}
+		return &MemberExpression{NodeToken: e.Token.token(token.DOT, "."), Object: object, Property: property}, nil
+	}
+	return nil, fmt.Errorf("Invalid AST JSON: unknown expression kind <%s>", kind)
+}
+
+func decodeType(raw json.RawMessage) (Type, error) {
+	kind, err := kindOf(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case "TypeName":
+		var n jsonName
+		if err := decodeKind(raw, kind, &n); err != nil {
+			return nil, err
+		}
+		if n.Name == "" {
+			return nil, fmt.Errorf("Invalid AST JSON: type name without name")
+		}
+		return &TypeName{NodeToken: n.Token.token(token.IDENTIFIER, n.Name), Name: n.Name}, nil
+
+	case "BoxType":
+		var t jsonBoxType
+		if err := decodeKind(raw, kind, &t); err != nil {
+			return nil, err
+		}
+		typ := &BoxType{NodeToken: t.Token.token(token.BOX, "box"), Parameters: []Type{}}
+		for _, raw := range t.Parameters {
+			param, err := decodeType(raw)
+			if err != nil {
+				return nil, err
+			}
+			typ.Parameters = append(typ.Parameters, param)
+		}
+		if !isNull(t.Return) {
+			if typ.Return, err = decodeType(t.Return); err != nil {
+				return nil, err
+			}
+		}
+		return typ, nil
+	}
+	return nil, fmt.Errorf("Invalid AST JSON: unknown type kind <%s>", kind)
+}
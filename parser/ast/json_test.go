@@ -0,0 +1,143 @@
+package ast_test
+
+import (
+	"cardboard/lexer"
+	"cardboard/parser"
+	"cardboard/parser/ast"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	inputs := []string{
+		"",
+		"put a = 5; a;",
+		`put s: string = "say \"hi\"\n"; s + "!";`,
+		"-1 + 2 * (3 - +4) / 5;",
+		"put add = box(a: int, b) -> int { unbox a + b; }; add(1, 2);",
+		"put f: box(int, box() -> string) -> any = g;",
+		"box() {}(); box(x) { x }(5);",
+		"try { throw 1; } catch (e) { e.value; } finally { put x = 1; }",
+		"try { 1; } catch { 2; }",
+		"try { 1; } finally { 2; }",
+		"< leading > put a = 1; < trailing >",
+	}
+
+	for _, input := range inputs {
+		p := parser.CreateParser(lexer.CreateLexer(input))
+		program := p.ParseCardBoard()
+		if errs := p.GetErrors(); len(errs) > 0 {
+			t.Fatalf("Test failed. Parser errors for <%s>: %v", input, errs)
+		}
+
+		data, err := ast.EncodeJSON(program)
+		if err != nil {
+			t.Fatalf("Test failed. Can't encode <%s>: %s", input, err)
+		}
+		decoded, err := ast.DecodeJSON(data)
+		if err != nil {
+			t.Fatalf("Test failed. Can't decode <%s>: %s\n%s", input, err, data)
+		}
+
+		if decoded.String() != program.String() {
+			t.Errorf("Test failed. Expected <%s>. Got <%s>", program.String(), decoded.String())
+		}
+		if !reflect.DeepEqual(decoded.Comments, program.Comments) {
+			t.Errorf("Test failed. Expected comments %v. Got %v", program.Comments, decoded.Comments)
+		}
+
+		again, err := ast.EncodeJSON(decoded)
+		if err != nil || string(again) != string(data) {
+			t.Errorf("Test failed. Encoding the decoded <%s> gives a different encoding.\nwant=%s\ngot=%s", input, data, again)
+		}
+	}
+}
+
+func TestJSONSpans(t *testing.T) {
+	p := parser.CreateParser(lexer.CreateLexer("put a = 1;\n  a(2).kind;"))
+	program := p.ParseCardBoard()
+
+	data, err := ast.EncodeJSON(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := ast.DecodeJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stmt := decoded.Statements[1].(*ast.ExpressionStatement)
+	member := stmt.Expression.(*ast.MemberExpression)
+	call := member.Object.(*ast.CallExpression)
+	positions := []struct {
+		name         string
+		line, column int
+		expected     [2]int
+	}{
+		{"statement", stmt.NodeToken.Line, stmt.NodeToken.Column, [2]int{2, 3}},
+		{"member", member.NodeToken.Line, member.NodeToken.Column, [2]int{2, 7}},
+		{"call", call.NodeToken.Line, call.NodeToken.Column, [2]int{2, 4}},
+		{"property", member.Property.NodeToken.Line, member.Property.NodeToken.Column, [2]int{2, 8}},
+	}
+	for _, pos := range positions {
+		if pos.line != pos.expected[0] || pos.column != pos.expected[1] {
+			t.Errorf("Test failed. Expected %s at %d:%d. Got %d:%d", pos.name, pos.expected[0], pos.expected[1], pos.line, pos.column)
+		}
+	}
+}
+
+// Spans run from the start to the end of nodes, tokens sit inside them
+func TestJSONEncodedSpans(t *testing.T) {
+	program := parser.CreateParser(lexer.CreateLexer("put a = 1;\n  a(2) + 10;")).ParseCardBoard()
+
+	data, err := ast.EncodeJSON(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var encoded struct {
+		Statements []struct {
+			Value struct {
+				Span  struct{ Start, End ast.Span }
+				Token ast.Span
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		t.Fatal(err)
+	}
+
+	infix := encoded.Statements[1].Value
+	if infix.Span.Start != (ast.Span{Line: 2, Column: 3}) || infix.Span.End != (ast.Span{Line: 2, Column: 12}) {
+		t.Errorf("Test failed. Expected the span 2:3 to 2:12. Got %v to %v", infix.Span.Start, infix.Span.End)
+	}
+	if infix.Token != (ast.Span{Line: 2, Column: 8}) {
+		t.Errorf("Test failed. Expected the token at 2:8. Got %v", infix.Token)
+	}
+}
+
+func TestInvalidJSON(t *testing.T) {
+	inputs := []string{
+		`[]`,
+		`{"kind": "Block"}`,
+		`{"kind": "Program", "statements": [{"kind": "Nope"}]}`,
+		`{"kind": "Program", "statements": [{"kind": "ExpressionStatement", "token": {"line": 1, "column": 1}}]}`,
+		`{"kind": "Program", "statements": [{"kind": "ExpressionStatement", "value": {"kind": "InfixExpression", "operator": "%",
+			"left": {"kind": "IntegerLiteral", "value": 1}, "right": {"kind": "IntegerLiteral", "value": 2}}}]}`,
+		`{"kind": "Program", "statements": [{"kind": "ExpressionStatement", "value": {"kind": "IntegerLiteral", "value": "1"}}]}`,
+		`{"kind": "Program", "statements": [{"kind": "TryStatement", "body": {"kind": "BlockStatement", "statements": []}}]}`,
+		`{"kind": "Program", "statements": [{"kind": "PutStatement", "identifier": {"kind": "Identifier", "name": ""},
+			"value": {"kind": "IntegerLiteral", "value": 1}}]}`,
+	}
+
+	for _, input := range inputs {
+		_, err := ast.DecodeJSON([]byte(input))
+		if err == nil {
+			t.Errorf("Test failed. Expected an error decoding <%s>.", input)
+		} else if !strings.HasPrefix(err.Error(), "Invalid AST JSON: ") {
+			t.Errorf("Test failed. Unexpected error <%s>", err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package ast
+
+import "unicode/utf8"
+
+// Source positions of nodes, as far as the tokens kept in the tree tell:
+// the semicolons ending statements and the parentheses around
+// expressions aren't kept, so they are left out of the spans of nodes.
+
+// Start returns the position of the first token of a node, zero when the
+// node has no token, like an empty program.
+func Start(node Node) Span {
+	switch node := node.(type) {
+	case *Program:
+		if len(node.Statements) > 0 {
+			return Start(node.Statements[0])
+		}
+	case *Comment:
+		return spanOf(node.NodeToken)
+	case *PutStatement:
+		return spanOf(node.NodeToken)
+	case *UnboxStatement:
+		return spanOf(node.NodeToken)
+	case *ThrowStatement:
+		return spanOf(node.NodeToken)
+	case *ExpressionStatement:
+		return Start(node.Expression)
+	case *TryStatement:
+		return spanOf(node.NodeToken)
+	case *BlockStatement:
+		return spanOf(node.NodeToken)
+	case *Identifier:
+		return spanOf(node.NodeToken)
+	case *IntegerLiteral:
+		return spanOf(node.NodeToken)
+	case *StringLiteral:
+		return spanOf(node.NodeToken)
+	case *PrefixExpression:
+		return spanOf(node.NodeToken)
+	case *InfixExpression:
+		return Start(node.Left)
+	case *BoxExpression:
+		return spanOf(node.NodeToken)
+	case *CallExpression:
+		return Start(node.Function)
+	case *MemberExpression:
+		return Start(node.Object)
+	case *TypeName:
+		return spanOf(node.NodeToken)
+	case *BoxType:
+		return spanOf(node.NodeToken)
+	}
+	return Span{}
+}
+
+// End returns the position following the last token of a node, zero when
+// the node has no token.
+func End(node Node) Span {
+	switch node := node.(type) {
+	case *Program:
+		if len(node.Statements) > 0 {
+			return End(node.Statements[len(node.Statements)-1])
+		}
+	case *Comment:
+		return after(spanOf(node.NodeToken), utf8.RuneCountInString(node.String()))
+	case *PutStatement:
+		return End(node.NodeExpression)
+	case *UnboxStatement:
+		return End(node.NodeExpression)
+	case *ThrowStatement:
+		return End(node.NodeExpression)
+	case *ExpressionStatement:
+		return End(node.Expression)
+	case *TryStatement:
+		if node.Finally != nil {
+			return End(node.Finally)
+		}
+		if node.Catch != nil {
+			return End(node.Catch)
+		}
+		return End(node.Body)
+	case *BlockStatement:
+		return after(spanOf(node.RightBrace), 1)
+	case *Identifier:
+		return after(spanOf(node.NodeToken), utf8.RuneCountInString(node.Value))
+	case *IntegerLiteral:
+		return after(spanOf(node.NodeToken), len(node.NodeToken.TokenLiteral))
+	case *StringLiteral:
+		return after(spanOf(node.NodeToken), utf8.RuneCountInString(QuoteString(node.Value)))
+	case *PrefixExpression:
+		return End(node.Right)
+	case *InfixExpression:
+		return End(node.Right)
+	case *BoxExpression:
+		return End(node.Body)
+	case *CallExpression:
+		if len(node.Arguments) == 0 {
+			return after(End(node.Function), len("()"))
+		}
+		// The closing parenthesis
+		return after(End(node.Arguments[len(node.Arguments)-1]), 1)
+	case *MemberExpression:
+		return End(node.Property)
+	case *TypeName:
+		return after(spanOf(node.NodeToken), utf8.RuneCountInString(node.Name))
+	case *BoxType:
+		if node.Return != nil {
+			return End(node.Return)
+		}
+		if len(node.Parameters) == 0 {
+			return after(spanOf(node.NodeToken), len("box()"))
+		}
+		return after(End(node.Parameters[len(node.Parameters)-1]), 1)
+	}
+	return Span{}
+}
+
+// Position n columns after a position, unknown positions staying unknown
+func after(s Span, n int) Span {
+	if s.Line == 0 {
+		return s
+	}
+	return Span{Line: s.Line, Column: s.Column + n}
+}
@@ -0,0 +1,48 @@
+package ast_test
+
+import (
+	"cardboard/parser/ast"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{
+			"put a: box(int) -> int = -x;",
+			"Program 1:1-1:28 PutStatement 1:1-1:28 Identifier 1:5-1:6 BoxType 1:8-1:23 TypeName 1:12-1:15 TypeName 1:20-1:23 PrefixExpression 1:26-1:28 Identifier 1:27-1:28",
+		},
+		{
+			"f(1, \"b\").kind + g();",
+			"Program 1:1-1:21 ExpressionStatement 1:1-1:21 InfixExpression 1:1-1:21 MemberExpression 1:1-1:15 CallExpression 1:1-1:10 Identifier 1:1-1:2 IntegerLiteral 1:3-1:4 StringLiteral 1:6-1:9 Identifier 1:11-1:15 CallExpression 1:18-1:21 Identifier 1:18-1:19",
+		},
+		{
+			"put größe = \"ü\";",
+			"Program 1:1-1:16 PutStatement 1:1-1:16 Identifier 1:5-1:10 StringLiteral 1:13-1:16",
+		},
+		{
+			"try {\n    throw 1;\n} catch {\n}",
+			"Program 1:1-4:2 TryStatement 1:1-4:2 BlockStatement 1:5-3:2 ThrowStatement 2:5-2:12 IntegerLiteral 2:11-2:12 BlockStatement 3:9-4:2",
+		},
+	}
+
+	for _, tt := range tests {
+		spans := []string{}
+		ast.Inspect(parse(t, tt.input), func(node ast.Node) bool {
+			if node != nil && len(tt.input) > 0 {
+				start, end := ast.Start(node), ast.End(node)
+				kind := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+				spans = append(spans, fmt.Sprintf("%s %d:%d-%d:%d", kind, start.Line, start.Column, end.Line, end.Column))
+			}
+			return true
+		})
+		if got := strings.Join(spans, " "); got != tt.expected {
+			t.Errorf("Test failed. Wrong spans for <%s>.\nwant=%s\ngot=%s", tt.input, tt.expected, got)
+		}
+	}
+}
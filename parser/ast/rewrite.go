@@ -0,0 +1,210 @@
+package ast
+
+// A Cursor describes the node being visited by Rewrite, and lets the
+// visiting functions replace or delete it.
+type Cursor struct {
+	parent Node
+	node   Node
+
+	// Sets the node in its parent
+	replace func(Node)
+
+	// Removes the node from the list holding it, nil when the node isn't
+	// in a list of statements or of arguments
+	delete  func()
+	deleted bool
+}
+
+// Node returns the node being visited
+func (c *Cursor) Node() Node { return c.node }
+
+// Parent returns the node holding the node being visited, nil for the root
+func (c *Cursor) Parent() Node { return c.parent }
+
+// Replace replaces the node being visited. The new node must be of a type
+// its parent can hold there, or Replace panics: a Statement in a list of
+// statements, an *Identifier for a parameter, and so on. When called from
+// the pre function, the children of the new node are visited.
+func (c *Cursor) Replace(node Node) {
+	c.replace(node)
+	c.node = node
+}
+
+// Delete removes the node being visited from the list of statements or of
+// call arguments holding it. It panics for any other node.
+func (c *Cursor) Delete() {
+	if c.delete == nil {
+		panic("ast: Delete of a node that isn't in a list of statements or arguments")
+	}
+	c.delete()
+	c.deleted = true
+}
+
+// An ApplyFunc is called by Rewrite for each node
+type ApplyFunc func(*Cursor) bool
+
+// Rewrite traverses a tree like Walk, calling pre for each node before its
+// children, and post after them, either of which can be nil. The functions
+// can replace or delete the node with the cursor they're given.
+//
+// When pre returns false, the children of the node and post are skipped.
+// When post returns false, the traversal stops. Rewrite returns the root,
+// which is a new node when the root was replaced.
+func Rewrite(root Node, pre ApplyFunc, post ApplyFunc) Node {
+	r := &rewriter{pre: pre, post: post}
+	r.apply(nil, root, func(node Node) { root = node }, nil)
+	return root
+}
+
+type rewriter struct {
+	pre  ApplyFunc
+	post ApplyFunc
+}
+
+// Visits a node, returning false when the traversal stops
+func (r *rewriter) apply(parent Node, node Node, replace func(Node), delete func()) bool {
+	c := &Cursor{parent: parent, node: node, replace: replace, delete: delete}
+
+	if r.pre != nil && !r.pre(c) {
+		return true
+	}
+	if c.deleted {
+		return true
+	}
+
+	if !r.children(c.node) {
+		return false
+	}
+
+	if r.post != nil {
+		return r.post(c)
+	}
+	return true
+}
+
+// Visits the children of a node
+func (r *rewriter) children(node Node) bool {
+	switch n := node.(type) {
+	case *Program:
+		return r.statements(n, &n.Statements)
+
+	// Statements
+	case *PutStatement:
+		ok := r.apply(n, &n.NodeIdentifier, func(node Node) { n.NodeIdentifier = *node.(*Identifier) }, nil)
+		if ok && n.Type != nil {
+			ok = r.apply(n, n.Type, func(node Node) { n.Type = node.(Type) }, nil)
+		}
+		return ok && r.expression(n, n.NodeExpression, func(node Node) { n.NodeExpression = node.(Expression) })
+	case *UnboxStatement:
+		return r.expression(n, n.NodeExpression, func(node Node) { n.NodeExpression = node.(Expression) })
+	case *ThrowStatement:
+		return r.expression(n, n.NodeExpression, func(node Node) { n.NodeExpression = node.(Expression) })
+	case *ExpressionStatement:
+		return r.expression(n, n.Expression, func(node Node) { n.Expression = node.(Expression) })
+	case *TryStatement:
+		ok := r.apply(n, n.Body, func(node Node) { n.Body = node.(*BlockStatement) }, nil)
+		if ok && n.CatchParameter != nil {
+			ok = r.apply(n, n.CatchParameter, func(node Node) { n.CatchParameter = node.(*Identifier) }, nil)
+		}
+		if ok && n.Catch != nil {
+			ok = r.apply(n, n.Catch, func(node Node) { n.Catch = node.(*BlockStatement) }, nil)
+		}
+		if ok && n.Finally != nil {
+			ok = r.apply(n, n.Finally, func(node Node) { n.Finally = node.(*BlockStatement) }, nil)
+		}
+		return ok
+	case *BlockStatement:
+		return r.statements(n, &n.Statements)
+
+	// Expressions
+	case *PrefixExpression:
+		return r.expression(n, n.Right, func(node Node) { n.Right = node.(Expression) })
+	case *InfixExpression:
+		return r.expression(n, n.Left, func(node Node) { n.Left = node.(Expression) }) &&
+			r.expression(n, n.Right, func(node Node) { n.Right = node.(Expression) })
+	case *BoxExpression:
+		for idx := range n.ParameterList {
+			idx := idx
+			if !r.apply(n, n.ParameterList[idx], func(node Node) { n.ParameterList[idx] = node.(*Identifier) }, nil) {
+				return false
+			}
+			if n.ParameterType(idx) != nil {
+				if !r.apply(n, n.ParameterTypes[idx], func(node Node) { n.ParameterTypes[idx] = node.(Type) }, nil) {
+					return false
+				}
+			}
+		}
+		if n.ReturnType != nil {
+			if !r.apply(n, n.ReturnType, func(node Node) { n.ReturnType = node.(Type) }, nil) {
+				return false
+			}
+		}
+		return r.apply(n, n.Body, func(node Node) { n.Body = node.(*BlockStatement) }, nil)
+	case *CallExpression:
+		if !r.expression(n, n.Function, func(node Node) { n.Function = node.(Expression) }) {
+			return false
+		}
+		for idx := 0; idx < len(n.Arguments); idx++ {
+			i, deleted := idx, false
+			ok := r.apply(n, n.Arguments[i],
+				func(node Node) { n.Arguments[i] = node.(Expression) },
+				func() {
+					n.Arguments = append(n.Arguments[:i], n.Arguments[i+1:]...)
+					deleted = true
+				})
+			if deleted {
+				idx--
+			}
+			if !ok {
+				return false
+			}
+		}
+		return true
+	case *MemberExpression:
+		return r.expression(n, n.Object, func(node Node) { n.Object = node.(Expression) }) &&
+			r.apply(n, n.Property, func(node Node) { n.Property = node.(*Identifier) }, nil)
+
+	// Types
+	case *BoxType:
+		for idx := range n.Parameters {
+			idx := idx
+			if !r.apply(n, n.Parameters[idx], func(node Node) { n.Parameters[idx] = node.(Type) }, nil) {
+				return false
+			}
+		}
+		if n.Return != nil {
+			return r.apply(n, n.Return, func(node Node) { n.Return = node.(Type) }, nil)
+		}
+	}
+	return true
+}
+
+func (r *rewriter) expression(parent Node, expr Expression, replace func(Node)) bool {
+	if expr == nil {
+		return true
+	}
+	return r.apply(parent, expr, replace, nil)
+}
+
+func (r *rewriter) statements(parent Node, stmts *[]Statement) bool {
+	for idx := 0; idx < len(*stmts); idx++ {
+		if (*stmts)[idx] == nil {
+			continue
+		}
+
+		i, deleted := idx, false
+		ok := r.apply(parent, (*stmts)[i],
+			func(node Node) { (*stmts)[i] = node.(Statement) },
+			func() {
+				*stmts = append((*stmts)[:i], (*stmts)[i+1:]...)
+				deleted = true
+			})
+		if deleted {
+			idx--
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
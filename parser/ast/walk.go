@@ -0,0 +1,118 @@
+package ast
+
+// A Visitor's Visit method is called for every node Walk reaches. When it
+// returns a non-nil visitor w, Walk visits the children of the node with
+// w, then calls w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses a tree depth-first, in source order, starting with
+// v.Visit(node). Missing optional children, like the type of an
+// unannotated 'put', are skipped. Comments aren't part of the tree and
+// aren't visited.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+
+	// Statements
+	case *PutStatement:
+		Walk(v, &n.NodeIdentifier)
+		if n.Type != nil {
+			Walk(v, n.Type)
+		}
+		walkExpression(v, n.NodeExpression)
+	case *UnboxStatement:
+		walkExpression(v, n.NodeExpression)
+	case *ThrowStatement:
+		walkExpression(v, n.NodeExpression)
+	case *ExpressionStatement:
+		walkExpression(v, n.Expression)
+	case *TryStatement:
+		Walk(v, n.Body)
+		if n.CatchParameter != nil {
+			Walk(v, n.CatchParameter)
+		}
+		if n.Catch != nil {
+			Walk(v, n.Catch)
+		}
+		if n.Finally != nil {
+			Walk(v, n.Finally)
+		}
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+
+	// Expressions
+	case *PrefixExpression:
+		walkExpression(v, n.Right)
+	case *InfixExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Right)
+	case *BoxExpression:
+		for idx, param := range n.ParameterList {
+			Walk(v, param)
+			if typ := n.ParameterType(idx); typ != nil {
+				Walk(v, typ)
+			}
+		}
+		if n.ReturnType != nil {
+			Walk(v, n.ReturnType)
+		}
+		Walk(v, n.Body)
+	case *CallExpression:
+		walkExpression(v, n.Function)
+		for _, arg := range n.Arguments {
+			walkExpression(v, arg)
+		}
+	case *MemberExpression:
+		walkExpression(v, n.Object)
+		Walk(v, n.Property)
+
+	// Types
+	case *BoxType:
+		for _, param := range n.Parameters {
+			Walk(v, param)
+		}
+		if n.Return != nil {
+			Walk(v, n.Return)
+		}
+	}
+
+	v.Visit(nil)
+}
+
+// Statements and expressions left nil by parse errors are skipped
+func walkStatements(v Visitor, stmts []Statement) {
+	for _, stmt := range stmts {
+		if stmt != nil {
+			Walk(v, stmt)
+		}
+	}
+}
+
+func walkExpression(v Visitor, expr Expression) {
+	if expr != nil {
+		Walk(v, expr)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses a tree like Walk, calling f for every node, then
+// f(nil) once the children of the node are visited. The children of a
+// node are skipped when f returns false for it.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,184 @@
+package ast_test
+
+import (
+	"cardboard/lexer"
+	"cardboard/lexer/token"
+	"cardboard/parser"
+	"cardboard/parser/ast"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", "Program"},
+		{"put a: int = -1;", "Program PutStatement Identifier TypeName PrefixExpression IntegerLiteral"},
+		{"f(a, \"b\").kind;", "Program ExpressionStatement MemberExpression CallExpression Identifier Identifier StringLiteral Identifier"},
+		{
+			"put g = box(a: int, b) -> box(int) -> int { unbox a + b; };",
+			"Program PutStatement Identifier BoxExpression Identifier TypeName Identifier BoxType TypeName TypeName BlockStatement UnboxStatement InfixExpression Identifier Identifier",
+		},
+		{
+			"try { throw 1; } catch (e) { e; } finally { 2; }",
+			"Program TryStatement BlockStatement ThrowStatement IntegerLiteral Identifier BlockStatement ExpressionStatement Identifier BlockStatement ExpressionStatement IntegerLiteral",
+		},
+	}
+
+	for _, tt := range tests {
+		visited := []string{}
+		depth := 0
+		ast.Inspect(parse(t, tt.input), func(node ast.Node) bool {
+			if node == nil {
+				depth--
+				return false
+			}
+			depth++
+			visited = append(visited, strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast."))
+			return true
+		})
+
+		if got := strings.Join(visited, " "); got != tt.expected {
+			t.Errorf("Test failed. Wrong nodes visited for <%s>.\nwant=%s\ngot=%s", tt.input, tt.expected, got)
+		}
+		if depth != 0 {
+			t.Errorf("Test failed. Nodes of <%s> weren't all left. Got depth <%d>", tt.input, depth)
+		}
+	}
+}
+
+// The children of a node are skipped when the function returns false for it
+func TestInspectSkip(t *testing.T) {
+	program := parse(t, "put a = 1; put f = box(x) { put b = 2; }; put c = 3;")
+
+	names := []string{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.PutStatement:
+			names = append(names, node.NodeIdentifier.Value)
+		case *ast.BoxExpression:
+			return false
+		}
+		return true
+	})
+
+	if got := strings.Join(names, " "); got != "a f c" {
+		t.Errorf("Test failed. Wrong bindings found. Expected <a f c>. Got <%s>", got)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x;", "5"},
+		{"put y = x + f(x, z);", "put y = (5+f(5, z));"},
+		{"box(x) { x; }(x);", "(x,){5}(5)"},
+		// Deleted statements and arguments
+		{"1; debug(x); 2;", "12"},
+		{"f(1, debug(x), 2);", "f(1, 2)"},
+		{"try { debug(1); debug(2); } catch { x; }", "try{}catch{5}"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+
+		ast.Rewrite(program, func(c *ast.Cursor) bool {
+			switch node := c.Node().(type) {
+			case *ast.Identifier:
+				// Parameters are identifiers too, but can't hold a literal
+				if _, ok := c.Parent().(*ast.BoxExpression); node.Value == "x" && !ok {
+					c.Replace(&ast.IntegerLiteral{NodeToken: token.Token{TokenType: token.INT, TokenLiteral: "5"}, Value: 5})
+				}
+			case *ast.ExpressionStatement:
+				if isDebug(node.Expression) {
+					c.Delete()
+				}
+			case *ast.CallExpression:
+				if isDebug(node) {
+					c.Delete()
+				}
+			}
+			return true
+		}, nil)
+
+		if got := program.String(); got != tt.expected {
+			t.Errorf("Test failed. Wrong rewrite of <%s>.\nwant=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func isDebug(expr ast.Expression) bool {
+	call, ok := expr.(*ast.CallExpression)
+	if !ok {
+		return false
+	}
+	fn, ok := call.Function.(*ast.Identifier)
+	return ok && fn.Value == "debug"
+}
+
+// Post functions see the rewritten children, and can stop the traversal,
+// and the root itself can be replaced
+func TestRewritePost(t *testing.T) {
+	program := parse(t, "1 + 2 * 3; 4 + 5;")
+
+	folded := 0
+	ast.Rewrite(program, nil, func(c *ast.Cursor) bool {
+		infix, ok := c.Node().(*ast.InfixExpression)
+		if !ok {
+			return true
+		}
+		left, right := infix.Left.(*ast.IntegerLiteral), infix.Right.(*ast.IntegerLiteral)
+		value := left.Value * right.Value
+		if infix.Operator == "+" {
+			value = left.Value + right.Value
+		}
+		c.Replace(&ast.IntegerLiteral{NodeToken: token.Token{TokenType: token.INT, TokenLiteral: strconv.FormatInt(value, 10)}, Value: value})
+
+		folded++
+		return folded < 2
+	})
+
+	if got := program.String(); got != "7(4+5)" {
+		t.Errorf("Test failed. Wrong folding. Expected <7(4+5)>. Got <%s>", got)
+	}
+
+	root := ast.Rewrite(program, func(c *ast.Cursor) bool {
+		if c.Parent() == nil {
+			c.Replace(&ast.Program{})
+		}
+		return true
+	}, nil)
+	if root, ok := root.(*ast.Program); !ok || len(root.Statements) != 0 {
+		t.Errorf("Test failed. The root wasn't replaced. Got <%v>", root)
+	}
+}
+
+func TestRewriteInvalidDelete(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Test failed. Deleting the operand of an infix expression didn't panic")
+		}
+	}()
+
+	ast.Rewrite(parse(t, "1 + 2;"), func(c *ast.Cursor) bool {
+		if _, ok := c.Parent().(*ast.InfixExpression); ok {
+			c.Delete()
+		}
+		return true
+	}, nil)
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.CreateParser(lexer.CreateLexer(input))
+	program := p.ParseCardBoard()
+	if errs := p.GetErrors(); len(errs) > 0 {
+		t.Fatalf("Test failed. Parser errors for <%s>: %v", input, errs)
+	}
+	return program
+}
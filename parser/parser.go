@@ -13,6 +13,8 @@ type Parser struct {
 	curToken    token.Token
 	peekToken   token.Token
 	errors      []string
+	positions   []token.Token
+	lexerErrors int
 	prefixFuncs map[token.TokenType]prefixFunc
 	infixFuncs  map[token.TokenType]infixFunc
 }
@@ -26,13 +28,17 @@ const (
 	PRODUCT //*
 	PREFIX  //-X or !X
 	CALL    // myFunction(X)
+	MEMBER  // error.message
 )
 
 // Precedence mapping
 var precedence = map[token.TokenType]int{
 	token.ADD:    SUM,
 	token.SUB:    SUM,
+	token.MUL:    PRODUCT,
+	token.DIV:    PRODUCT,
 	token.LPAREN: CALL,
+	token.DOT:    MEMBER,
 }
 
 func CreateParser(l *lexer.Lexer) *Parser {
@@ -47,6 +53,7 @@ func CreateParser(l *lexer.Lexer) *Parser {
 	p.prefixFuncs = make(map[token.TokenType]prefixFunc)
 	p.setPrefixFunction(token.IDENTIFIER, p.parseIdentifier)
 	p.setPrefixFunction(token.INT, p.parseIntegerLiteral)
+	p.setPrefixFunction(token.STRING, p.parseStringLiteral)
 	p.setPrefixFunction(token.SUB, p.parsePrefixExpression)
 	p.setPrefixFunction(token.ADD, p.parsePrefixExpression)
 	p.setPrefixFunction(token.LPAREN, p.parseGroupedExpression)
@@ -56,7 +63,10 @@ func CreateParser(l *lexer.Lexer) *Parser {
 	p.infixFuncs = make(map[token.TokenType]infixFunc)
 	p.setInfixFunction(token.ADD, p.parseInfixExpression)
 	p.setInfixFunction(token.SUB, p.parseInfixExpression)
+	p.setInfixFunction(token.MUL, p.parseInfixExpression)
+	p.setInfixFunction(token.DIV, p.parseInfixExpression)
 	p.setInfixFunction(token.LPAREN, p.parseCallExpression)
+	p.setInfixFunction(token.DOT, p.parseMemberExpression)
 
 	return p
 }
@@ -67,30 +77,59 @@ func (p *Parser) ParseCardBoard() *ast.Program {
 
 	for !p.curTokenIs(token.EOF) {
 		if p.curTokenIs(token.UNKNOWN) {
-			p.addError(fmt.Sprintf("Unknown Token: %s", p.curToken.TokenLiteral))
+			p.addErrorAt(p.curToken, fmt.Sprintf("Unknown Token: %s", p.curToken.TokenLiteral))
 			return &ast.Program{}
 		}
-		stmt := p.parseStatement()
-		program.Statements = append(program.Statements, stmt)
+		if stmt := p.parseStatement(); stmt != nil {
+			program.Statements = append(program.Statements, stmt)
+		}
 		p.nextToken()
 	}
+
+	for _, comment := range p.lexer.Comments() {
+		program.Comments = append(program.Comments, &ast.Comment{NodeToken: comment, Text: comment.TokenLiteral})
+	}
 	return &program
 }
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.lexer.NextToken()
+
+	// Report the errors the lexer met reading the token
+	errs := p.lexer.Errors()
+	for _, err := range errs[p.lexerErrors:] {
+		p.addErrorAt(token.Token{Line: err.Line, Column: err.Column}, err.Message)
+	}
+	p.lexerErrors = len(errs)
 }
 
+// Parses a statement, nil when it couldn't be parsed. The parse functions
+// return typed nil pointers on errors, which aren't nil statements.
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.TokenType {
 	case token.PUT:
-		return p.parsePutStatement()
+		if stmt := p.parsePutStatement(); stmt != nil {
+			return stmt
+		}
 	case token.UNBOX:
-		return p.parseUnboxStatement()
+		if stmt := p.parseUnboxStatement(); stmt != nil {
+			return stmt
+		}
+	case token.THROW:
+		if stmt := p.parseThrowStatement(); stmt != nil {
+			return stmt
+		}
+	case token.TRY:
+		if stmt := p.parseTryStatement(); stmt != nil {
+			return stmt
+		}
 	default:
-		return p.parseExpressionStatement()
+		if stmt := p.parseExpressionStatement(); stmt != nil {
+			return stmt
+		}
 	}
+	return nil
 }
 
 func (p *Parser) parsePutStatement() *ast.PutStatement {
@@ -107,6 +146,15 @@ func (p *Parser) parsePutStatement() *ast.PutStatement {
 
 	putStmt.NodeIdentifier = ast.Identifier{NodeToken: p.curToken, Value: p.curToken.TokenLiteral}
 
+	// Optional type annotation
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		p.nextToken()
+		if putStmt.Type = p.parseType(); putStmt.Type == nil {
+			return nil
+		}
+	}
+
 	// Ensure Next Token is Assign
 	if !p.expectPeek(token.ASSIGN) {
 		p.typeError(token.ASSIGN, p.peekToken.TokenType)
@@ -142,6 +190,72 @@ func (p *Parser) parseUnboxStatement() *ast.UnboxStatement {
 	return unboxStmt
 }
 
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	throwStmt := &ast.ThrowStatement{NodeToken: p.curToken}
+
+	p.nextToken()
+	throwStmt.NodeExpression = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.SCOLON) {
+		p.addError("Error. Expected <;> at the end of THROW statement.")
+		return nil
+	}
+
+	return throwStmt
+}
+
+func (p *Parser) parseTryStatement() *ast.TryStatement {
+	tryStmt := &ast.TryStatement{NodeToken: p.curToken}
+
+	if !p.expectPeek(token.LCURLY) {
+		p.addError(fmt.Sprintf("Error. Expected block statement after try. Found <%s>", p.peekToken.TokenLiteral))
+		return nil
+	}
+	tryStmt.Body = p.parseBlockStatement()
+
+	if p.expectPeek(token.CATCH) {
+		// Binding the caught error is optional
+		if p.expectPeek(token.LPAREN) {
+			if !p.expectPeek(token.IDENTIFIER) {
+				p.typeError(token.IDENTIFIER, p.peekToken.TokenType)
+				return nil
+			}
+			tryStmt.CatchParameter = &ast.Identifier{NodeToken: p.curToken, Value: p.curToken.TokenLiteral}
+
+			if !p.expectPeek(token.RPAREN) {
+				p.addError(fmt.Sprintf("Error. Expected <)> after catch parameter. Found <%s>", p.peekToken.TokenLiteral))
+				return nil
+			}
+		}
+
+		if !p.expectPeek(token.LCURLY) {
+			p.addError(fmt.Sprintf("Error. Expected block statement after catch. Found <%s>", p.peekToken.TokenLiteral))
+			return nil
+		}
+		tryStmt.Catch = p.parseBlockStatement()
+	}
+
+	if p.expectPeek(token.FINALLY) {
+		if !p.expectPeek(token.LCURLY) {
+			p.addError(fmt.Sprintf("Error. Expected block statement after finally. Found <%s>", p.peekToken.TokenLiteral))
+			return nil
+		}
+		tryStmt.Finally = p.parseBlockStatement()
+	}
+
+	if tryStmt.Catch == nil && tryStmt.Finally == nil {
+		p.addError("Error. Expected catch or finally block after try block.")
+		return nil
+	}
+
+	// Optional Semi-colon
+	if p.peekTokenIs(token.SCOLON) {
+		p.nextToken()
+	}
+
+	return tryStmt
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	expStmt := &ast.ExpressionStatement{NodeToken: p.curToken}
 	expStmt.Expression = p.parseExpression(LOWEST)
@@ -156,7 +270,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixFuncs[p.curToken.TokenType]
 	if prefix == nil {
-		p.errors = append(p.errors, fmt.Sprintf("Unknown character: <%s>", p.curToken.TokenLiteral))
+		p.addErrorAt(p.curToken, fmt.Sprintf("Unknown character: <%s>", p.curToken.TokenLiteral))
 		return nil
 	}
 	leftExp := prefix()
@@ -184,12 +298,16 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	val, err := strconv.ParseInt(p.curToken.TokenLiteral, 10, 0)
 	if err != nil {
 		error := fmt.Sprintf("Error. Couldn't Parse Integer From String = <%s>", p.curToken.TokenLiteral)
-		p.errors = append(p.errors, error)
+		p.addErrorAt(p.curToken, error)
 		return nil
 	}
 	return &ast.IntegerLiteral{NodeToken: p.curToken, Value: val}
 }
 
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{NodeToken: p.curToken, Value: p.curToken.TokenLiteral}
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expression := &ast.PrefixExpression{
 		NodeToken: p.curToken,
@@ -235,7 +353,16 @@ func (p *Parser) parseBoxStatement() ast.Expression {
 		return nil
 	}
 
-	box.ParameterList = p.parseFunctionParameters()
+	box.ParameterList, box.ParameterTypes = p.parseFunctionParameters()
+
+	// Optional return type annotation
+	if p.peekTokenIs(token.ARROW) {
+		p.nextToken()
+		p.nextToken()
+		if box.ReturnType = p.parseType(); box.ReturnType == nil {
+			return nil
+		}
+	}
 
 	if !p.expectPeek(token.LCURLY) {
 		p.addError("Error. Expected function block statement after parameter list.")
@@ -259,37 +386,100 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	p.nextToken()
 
 	for !p.curTokenIs(token.RCURLY) && !p.curTokenIs(token.EOF) {
-		stmt := p.parseStatement()
-		block.Statements = append(block.Statements, stmt)
+		if stmt := p.parseStatement(); stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
 		p.nextToken()
 	}
+	block.RightBrace = p.curToken
 	return block
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+// Parses a parameter list, along with the annotated type of each parameter
+func (p *Parser) parseFunctionParameters() ([]*ast.Identifier, []ast.Type) {
 	list := []*ast.Identifier{}
+	types := []ast.Type{}
 
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return list
+		return list, types
 	}
 
-	p.nextToken()
+	for {
+		p.nextToken()
+		list = append(list, &ast.Identifier{NodeToken: p.curToken, Value: p.curToken.TokenLiteral})
 
-	list = append(list, &ast.Identifier{NodeToken: p.curToken, Value: p.curToken.TokenLiteral})
+		var typ ast.Type
+		if p.peekTokenIs(token.COLON) {
+			p.nextToken()
+			p.nextToken()
+			if typ = p.parseType(); typ == nil {
+				return nil, nil
+			}
+		}
+		types = append(types, typ)
 
-	for p.peekTokenIs(token.COMMA) {
-		p.nextToken()
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
 		p.nextToken()
-		list = append(list, &ast.Identifier{NodeToken: p.curToken, Value: p.curToken.TokenLiteral})
 	}
 
 	if !p.expectPeek(token.RPAREN) {
 		p.addError(fmt.Sprintf("Error. Expected parameter list closure. Got <%s>", p.peekToken.TokenLiteral))
-		return nil
+		return nil, nil
 	}
 
-	return list
+	return list, types
+}
+
+// Parses a type annotation, starting on its first token:
+// <type name> | box(<type>, ...) [-> <type>]
+func (p *Parser) parseType() ast.Type {
+	switch p.curToken.TokenType {
+	case token.IDENTIFIER:
+		return &ast.TypeName{NodeToken: p.curToken, Name: p.curToken.TokenLiteral}
+
+	case token.BOX:
+		typ := &ast.BoxType{NodeToken: p.curToken, Parameters: []ast.Type{}}
+		if !p.expectPeek(token.LPAREN) {
+			p.addError(fmt.Sprintf("Error. Expected parameter types after <box>. Got <%s>", p.peekToken.TokenLiteral))
+			return nil
+		}
+
+		if !p.peekTokenIs(token.RPAREN) {
+			for {
+				p.nextToken()
+				param := p.parseType()
+				if param == nil {
+					return nil
+				}
+				typ.Parameters = append(typ.Parameters, param)
+
+				if !p.peekTokenIs(token.COMMA) {
+					break
+				}
+				p.nextToken()
+			}
+		}
+
+		if !p.expectPeek(token.RPAREN) {
+			p.addError(fmt.Sprintf("Error. Expected parameter types closure. Got <%s>", p.peekToken.TokenLiteral))
+			return nil
+		}
+
+		if p.peekTokenIs(token.ARROW) {
+			p.nextToken()
+			p.nextToken()
+			if typ.Return = p.parseType(); typ.Return == nil {
+				return nil
+			}
+		}
+		return typ
+	}
+
+	p.addErrorAt(p.curToken, fmt.Sprintf("Error. Expected a type. Got <%s>", p.curToken.TokenLiteral))
+	return nil
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
@@ -298,6 +488,18 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	return expr
 }
 
+func (p *Parser) parseMemberExpression(object ast.Expression) ast.Expression {
+	expr := &ast.MemberExpression{NodeToken: p.curToken, Object: object}
+
+	if !p.expectPeek(token.IDENTIFIER) {
+		p.addError(fmt.Sprintf("Error. Expected property name after <.>. Got <%s>", p.peekToken.TokenLiteral))
+		return nil
+	}
+
+	expr.Property = &ast.Identifier{NodeToken: p.curToken, Value: p.curToken.TokenLiteral}
+	return expr
+}
+
 func (p *Parser) parseCallArguments() []ast.Expression {
 	arguments := []ast.Expression{}
 
@@ -355,6 +557,11 @@ func (p *Parser) GetErrors() []string {
 	return p.errors
 }
 
+// Tokens the errors were found at, in the order of GetErrors
+func (p *Parser) GetErrorPositions() []token.Token {
+	return p.positions
+}
+
 // In the case where the statement is invalid, we'll
 // need to skip it!
 func (p *Parser) skipStatement() {
@@ -364,8 +571,7 @@ func (p *Parser) skipStatement() {
 }
 
 func (p *Parser) typeError(expectedType token.TokenType, gotType token.TokenType) {
-	p.errors = append(p.errors,
-		fmt.Sprintf("Error. Expected Token Type <%s>. Got Token Type <%s>.\n", expectedType, gotType))
+	p.addError(fmt.Sprintf("Error. Expected Token Type <%s>. Got Token Type <%s>.\n", expectedType, gotType))
 	p.skipStatement()
 }
 
@@ -383,7 +589,12 @@ func (p *Parser) setPrefixFunction(token token.TokenType, function prefixFunc) {
 	p.prefixFuncs[token] = function
 }
 
-// Helper function to help to register errors
+// Helper function to help to register errors, found at the next token
 func (p *Parser) addError(err string) {
+	p.addErrorAt(p.peekToken, err)
+}
+
+func (p *Parser) addErrorAt(tok token.Token, err string) {
 	p.errors = append(p.errors, err)
+	p.positions = append(p.positions, tok)
 }
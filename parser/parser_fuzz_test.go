@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"cardboard/conformance/corpus"
+	"cardboard/lexer"
+	"cardboard/parser/ast"
+	"reflect"
+	"testing"
+)
+
+// Parses any input without panicking. The tree never holds nil
+// statements, and prints back when it parses without errors.
+func FuzzParseCardBoard(f *testing.F) {
+	corpus.Add(f, fuzzSeeds...)
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := CreateParser(lexer.CreateLexer(input))
+		program := p.ParseCardBoard()
+		if len(p.GetErrors()) != len(p.GetErrorPositions()) {
+			t.Fatalf("Test failed. %d errors for %d positions", len(p.GetErrors()), len(p.GetErrorPositions()))
+		}
+
+		errs := len(p.GetErrors()) > 0
+		ast.Inspect(program, func(node ast.Node) bool {
+			if node == nil {
+				return true
+			}
+			if reflect.ValueOf(node).IsNil() {
+				t.Fatalf("Test failed. Nil %T in the tree of <%q>", node, input)
+			}
+			if _, ok := node.(ast.Statement); ok && !errs {
+				assertChildren(t, node, input)
+			}
+			return true
+		})
+
+		if !errs {
+			_ = program.String()
+		}
+	})
+}
+
+// Fails when an expression a statement or expression can't do without is
+// missing from a tree parsed without errors
+func assertChildren(t *testing.T, node ast.Node, input string) {
+	t.Helper()
+
+	var missing bool
+	switch n := node.(type) {
+	case *ast.PutStatement:
+		missing = n.NodeExpression == nil
+	case *ast.UnboxStatement:
+		missing = n.NodeExpression == nil
+	case *ast.ThrowStatement:
+		missing = n.NodeExpression == nil
+	case *ast.ExpressionStatement:
+		missing = n.Expression == nil
+	}
+	if missing {
+		t.Fatalf("Test failed. %T missing its expression in <%q>, parsed without errors", node, input)
+	}
+}
+
+// Malformed inputs seeding the corpus along with the golden files
+var fuzzSeeds = []string{
+	"", "put x = 5;", "put = 5;", "put x 5;", "unbox;", "throw 1", "try", "try {} catch (",
+	"box(", "box(x) -> ", "f(1,", "(1", "x.", "1 +", "99999999999999999999", "{",
+}
@@ -477,6 +477,134 @@ func TestPutBoxStatementParsing(t *testing.T) {
 	}
 }
 
+func TestProductPrecedence(t *testing.T) {
+	testCases := []struct {
+		input string
+		out   string
+	}{
+		{"1 + 2 * 3", "(1+(2*3))"},
+		{"10 / 2 - 3", "((10/2)-3)"},
+		{"-2 * (3 + 4) / 7", "(((-2)*(3+4))/7)"},
+		{"e.message + f.kind", "(e.message+f.kind)"},
+	}
+
+	for _, tc := range testCases {
+		p := CreateParser(lexer.CreateLexer(tc.input))
+		program := p.ParseCardBoard()
+		checkParserErrors(t, p)
+
+		expr, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("Test failed! Expected type *ast.ExpressionStatement. Got <%T>", program.Statements[0])
+		}
+		if expr.Expression.String() != tc.out {
+			t.Fatalf("Test failed! Expected %s. Got <%s>", tc.out, expr.Expression.String())
+		}
+	}
+}
+
+func TestTryStatementParsing(t *testing.T) {
+	testCases := []struct {
+		input      string
+		parameter  string
+		hasCatch   bool
+		hasFinally bool
+	}{
+		{`try { throw "bad"; } catch (e) { e.message; }`, "e", true, false},
+		{`try { 1; } finally { 2; };`, "", false, true},
+		{`try { 1; } catch { 2; } finally { 3; }`, "", true, true},
+		{`try { 1; } catch (err) { 2; } finally { 3; }`, "err", true, true},
+	}
+
+	for _, tc := range testCases {
+		p := CreateParser(lexer.CreateLexer(tc.input))
+		program := p.ParseCardBoard()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("Test Failed! Expected Program Length Of 1. Got Length <%d>", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.TryStatement)
+		if !ok {
+			t.Fatalf("Test Failed! Statement is not *ast.TryStatement. Got <%T>", program.Statements[0])
+		}
+
+		if (stmt.Catch != nil) != tc.hasCatch || (stmt.Finally != nil) != tc.hasFinally {
+			t.Fatalf("Test Failed! Expected catch=%t finally=%t for <%s>", tc.hasCatch, tc.hasFinally, tc.input)
+		}
+
+		parameter := ""
+		if stmt.CatchParameter != nil {
+			parameter = stmt.CatchParameter.Value
+		}
+		if parameter != tc.parameter {
+			t.Fatalf("Test Failed! Expected catch parameter <%s>. Got <%s>", tc.parameter, parameter)
+		}
+	}
+}
+
+func TestInvalidTryStatements(t *testing.T) {
+	inputs := []string{
+		"try { 1; }",
+		"try 1;",
+		"try { 1; } catch (5) { 2; }",
+		"throw 5",
+	}
+
+	for _, input := range inputs {
+		p := CreateParser(lexer.CreateLexer(input))
+		p.ParseCardBoard()
+
+		if len(p.GetErrors()) == 0 {
+			t.Fatalf("Test Failed! Expected parser errors for <%s>.", input)
+		}
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"put a: int = 5;", "put a: int = 5;"},
+		{"put f = box(a: int, b) -> string { b };", "put f = (a: int,b,)->string{b};"},
+		{"put f: box(int, box() -> int) -> int = g;", "put f: box(int, box() -> int) -> int = g;"},
+		{"put f: box() = g;", "put f: box() = g;"},
+		{"box() -> box(string) -> int { g }", "()->box(string) -> int{g}"},
+	}
+
+	for _, tc := range tests {
+		p := CreateParser(lexer.CreateLexer(tc.input))
+		program := p.ParseCardBoard()
+		checkParserErrors(t, p)
+
+		if program.String() != tc.expected {
+			t.Errorf("Test Failed! Expected <%s>. Got <%s>", tc.expected, program.String())
+		}
+	}
+}
+
+func TestInvalidTypeAnnotations(t *testing.T) {
+	inputs := []string{
+		"put a: = 5;",
+		"put a: 5 = 5;",
+		"box(a:) { a }",
+		"box(a) -> { a }",
+		"put f: box(int = g;",
+		"put f: box int = g;",
+	}
+
+	for _, input := range inputs {
+		p := CreateParser(lexer.CreateLexer(input))
+		p.ParseCardBoard()
+
+		if len(p.GetErrors()) == 0 {
+			t.Fatalf("Test Failed! Expected parser errors for <%s>.", input)
+		}
+	}
+}
+
 func testIntegerLiterals(t *testing.T, tcVal int64, exp ast.Expression) bool {
 	intexp, ok := exp.(*ast.IntegerLiteral)
 
@@ -508,3 +636,16 @@ func checkParserErrors(t *testing.T, p *Parser) {
 		t.FailNow()
 	}
 }
+
+func TestInvalidUTF8(t *testing.T) {
+	p := CreateParser(lexer.CreateLexer("put x = 1;\nput größe = \"\xff\";"))
+	p.ParseCardBoard()
+
+	errs, positions := p.GetErrors(), p.GetErrorPositions()
+	if len(errs) != 1 || errs[0] != "Invalid UTF-8 encoding at 2:14: <0xff>" {
+		t.Fatalf("Test Failed! Expected an invalid encoding error. Got <%q>", errs)
+	}
+	if positions[0].Line != 2 || positions[0].Column != 14 {
+		t.Errorf("Test Failed! Expected the error at 2:14. Got <%d:%d>", positions[0].Line, positions[0].Column)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"cardboard/lexer"
+	"cardboard/object"
+	"cardboard/parser"
+	"cardboard/profile"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Runs a script on the evaluator, printing where it spent its time.
+// Scripts aren't optimized, so the profile matches the source.
+func profileCommand(args []string) int {
+	flags := flag.NewFlagSet("profile", flag.ExitOnError)
+	pprof := flags.String("pprof", "", "also write the profile to `file` in the format of pprof")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: cardboard profile [-pprof file] script.cb")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	path := flags.Arg(0)
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	p := parser.CreateParser(lexer.CreateLexer(string(source)))
+	program := p.ParseCardBoard()
+	if errs := p.GetErrors(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return 1
+	}
+
+	profiler := profile.New(path)
+	result := profiler.Run(program, object.CreateEnvironment())
+
+	code := 0
+	if err, ok := result.(*object.Error); ok {
+		fmt.Fprintf(os.Stderr, "Runtime Error [%d:%d]: %s\n", err.Line, err.Column, err.Message)
+		fmt.Fprint(os.Stderr, err.Traceback())
+		code = 1
+	}
+
+	if err := profiler.WriteReport(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *pprof != "" {
+		if err := writeFile(*pprof, profiler.WritePprof); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	return code
+}
@@ -0,0 +1,202 @@
+package profile
+
+import (
+	"compress/gzip"
+	"io"
+	"sort"
+	"strings"
+)
+
+// The pprof format is a gzipped protocol buffer, a Profile message of
+// github.com/google/pprof/proto/profile.proto. Each location is a line
+// of a box, and samples have two values: the calls made, counted at
+// line 0 of the box called, and the time spent, in nanoseconds.
+
+// Fields of the messages written
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileTimeNanos     = 9
+	profileDurationNanos = 10
+	profilePeriodType    = 11
+	profilePeriod        = 12
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+	functionStartLine  = 5
+)
+
+// WritePprof writes the profile in the format of pprof
+func (p *Profiler) WritePprof(out io.Writer) error {
+	table := newStringTable()
+	var profile buffer
+
+	for _, sampleType := range [][2]string{{"calls", "count"}, {"time", "nanoseconds"}} {
+		var vt buffer
+		vt.int(valueTypeType, table.index(sampleType[0]))
+		vt.int(valueTypeUnit, table.index(sampleType[1]))
+		profile.message(profileSampleType, &vt)
+	}
+
+	// Locations are numbered in the order the samples meet them, samples
+	// are written in the order of their stacks for the output to be stable
+	keys := []string{}
+	for key := range p.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	locations := map[frame]int{}
+	order := []frame{}
+	for _, key := range keys {
+		s := p.samples[key]
+		ids := []int{}
+		for _, f := range s.stack {
+			id, ok := locations[f]
+			if !ok {
+				id = len(order) + 1
+				locations[f] = id
+				order = append(order, f)
+			}
+			ids = append(ids, id)
+		}
+
+		var sample buffer
+		sample.packed(sampleLocationID, ids...)
+		sample.packed(sampleValue, s.calls, int(s.time))
+		profile.message(profileSample, &sample)
+	}
+
+	for _, f := range order {
+		var line buffer
+		line.int(lineFunctionID, f.fn.id)
+		line.int(lineLine, f.line)
+
+		var location buffer
+		location.int(locationID, locations[f])
+		location.message(locationLine, &line)
+		profile.message(profileLocation, &location)
+	}
+
+	for _, fn := range p.order {
+		// pprof drops what is within angle brackets from names, like the
+		// parameters of C++ templates: <main> would be empty
+		name := table.index(strings.Trim(fn.name, "<>"))
+
+		var entry buffer
+		entry.int(functionID, fn.id)
+		entry.int(functionName, name)
+		entry.int(functionSystemName, name)
+		entry.int(functionFilename, table.index(p.filename))
+		entry.int(functionStartLine, fn.line)
+		profile.message(profileFunction, &entry)
+	}
+
+	var periodType buffer
+	periodType.int(valueTypeType, table.index("time"))
+	periodType.int(valueTypeUnit, table.index("nanoseconds"))
+
+	profile.int(profileTimeNanos, int(p.start.UnixNano()))
+	profile.int(profileDurationNanos, int(p.duration))
+	profile.message(profilePeriodType, &periodType)
+	profile.int(profilePeriod, 1)
+
+	// The string table is complete once everything else is written
+	for _, s := range table.strings {
+		profile.bytes(profileStringTable, []byte(s))
+	}
+
+	zw := gzip.NewWriter(out)
+	if _, err := zw.Write(profile.data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Strings of a profile are written once, and referred to by index. The
+// first one is always the empty string.
+type stringTable struct {
+	strings []string
+	indexes map[string]int
+}
+
+func newStringTable() *stringTable {
+	return &stringTable{strings: []string{""}, indexes: map[string]int{"": 0}}
+}
+
+func (t *stringTable) index(s string) int {
+	idx, ok := t.indexes[s]
+	if !ok {
+		idx = len(t.strings)
+		t.indexes[s] = idx
+		t.strings = append(t.strings, s)
+	}
+	return idx
+}
+
+// Encodes a protocol buffer message, field by field
+type buffer struct {
+	data []byte
+}
+
+// Wire types of fields
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (b *buffer) varint(v uint64) {
+	for v >= 0x80 {
+		b.data = append(b.data, byte(v)|0x80)
+		v >>= 7
+	}
+	b.data = append(b.data, byte(v))
+}
+
+func (b *buffer) key(field int, wireType int) {
+	b.varint(uint64(field<<3 | wireType))
+}
+
+// Zero values are the default of fields, and left out
+func (b *buffer) int(field int, v int) {
+	if v == 0 {
+		return
+	}
+	b.key(field, wireVarint)
+	b.varint(uint64(v))
+}
+
+func (b *buffer) bytes(field int, data []byte) {
+	b.key(field, wireBytes)
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+func (b *buffer) message(field int, m *buffer) {
+	b.bytes(field, m.data)
+}
+
+func (b *buffer) packed(field int, values ...int) {
+	var p buffer
+	for _, v := range values {
+		p.varint(uint64(v))
+	}
+	b.bytes(field, p.data)
+}
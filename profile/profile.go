@@ -0,0 +1,250 @@
+// Package profile measures where programs spend their time on the
+// evaluator: how many times each box is called and each line runs, and
+// the time spent in each, on its own (self) or including the boxes it
+// calls (cumulative).
+//
+// The profiler is instrumenting: the hook of the evaluator reads the
+// clock at every statement, call and return, and charges the time since
+// the previous one to the calls running then. Profiles are written as a
+// text report, or in the format of pprof for 'go tool pprof' to show.
+package profile
+
+import (
+	"cardboard/eval"
+	"cardboard/lexer/token"
+	"cardboard/object"
+	"cardboard/parser/ast"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Profiler is the hook of the evaluator recording a profile
+type Profiler struct {
+	// Name of the script profiled, in reports
+	filename string
+
+	// Reads the clock, replaced by tests
+	now func() time.Time
+
+	// Boxes of the program, by body, "<main>" being the program itself
+	functions map[*ast.BlockStatement]*function
+	order     []*function
+
+	// Running calls, outermost first, and when the clock was last read
+	stack []*frame
+	last  time.Time
+
+	// Time and calls by stack, keyed by the locations of the stack
+	samples map[string]*sample
+
+	// Number of times each line ran
+	hits map[int]int
+
+	start    time.Time
+	duration time.Duration
+}
+
+type function struct {
+	id   int
+	name string
+
+	// Line of the box expression, 0 for the program
+	line int
+
+	calls int
+}
+
+// A running call, at a line
+type frame struct {
+	fn   *function
+	line int
+}
+
+// Time spent with a stack of calls
+type sample struct {
+	// Locations, innermost call first
+	stack []frame
+
+	calls int
+	time  time.Duration
+}
+
+func New(filename string) *Profiler {
+	return &Profiler{
+		filename:  filename,
+		now:       time.Now,
+		functions: map[*ast.BlockStatement]*function{},
+		samples:   map[string]*sample{},
+		hits:      map[int]int{},
+	}
+}
+
+// Run runs a program in env, recording its profile, and returns its result
+func (p *Profiler) Run(program *ast.Program, env *object.Environment) object.Object {
+	p.stack = []*frame{{fn: p.function(nil, "<main>", 0)}}
+	p.start = p.now()
+	p.last = p.start
+
+	eval.SetHook(env, p)
+	defer eval.SetHook(env, nil)
+
+	result := eval.Eval(program, env)
+	p.charge()
+	p.duration = p.last.Sub(p.start)
+	return result
+}
+
+func (p *Profiler) function(body *ast.BlockStatement, name string, line int) *function {
+	fn, ok := p.functions[body]
+	if !ok {
+		fn = &function{id: len(p.order) + 1, name: name, line: line}
+		p.functions[body] = fn
+		p.order = append(p.order, fn)
+	}
+	return fn
+}
+
+// Charges the time since the clock was last read to the running calls
+func (p *Profiler) charge() {
+	now := p.now()
+	p.sample().time += now.Sub(p.last)
+	p.last = now
+}
+
+// Sample of the running calls
+func (p *Profiler) sample() *sample {
+	var key strings.Builder
+	for idx := len(p.stack) - 1; idx >= 0; idx-- {
+		f := p.stack[idx]
+		key.WriteString(strconv.Itoa(f.fn.id) + ":" + strconv.Itoa(f.line) + " ")
+	}
+
+	s, ok := p.samples[key.String()]
+	if !ok {
+		s = &sample{}
+		for idx := len(p.stack) - 1; idx >= 0; idx-- {
+			s.stack = append(s.stack, *p.stack[idx])
+		}
+		p.samples[key.String()] = s
+	}
+	return s
+}
+
+// Hook of the evaluator
+
+func (p *Profiler) Statement(stmt ast.Statement, env *object.Environment) {
+	p.charge()
+	line := ast.Start(stmt).Line
+	p.stack[len(p.stack)-1].line = line
+	p.hits[line]++
+}
+
+func (p *Profiler) Call(fn *object.Box, call token.Token, env *object.Environment) {
+	p.charge()
+
+	name := fn.Name
+	if name == "" {
+		name = "<box>"
+	}
+	callee := p.function(fn.Body, name, fn.Body.NodeToken.Line)
+	callee.calls++
+
+	// Calls are counted, and the time until the body runs is charged, at
+	// line 0 of the box: out of the lines, like the time before the program
+	// runs, so the header line of the box isn't charged for its calls
+	p.stack = append(p.stack, &frame{fn: callee})
+	p.sample().calls++
+}
+
+func (p *Profiler) Return(fn *object.Box, result object.Object) {
+	p.charge()
+	p.stack = p.stack[:len(p.stack)-1]
+}
+
+// Statistics of a function or a line
+type Stats struct {
+	// Name of the box, or number of the line
+	Name string
+	Line int
+
+	// Calls of the box, or number of times the line ran
+	Count int
+
+	Self       time.Duration
+	Cumulative time.Duration
+}
+
+// Functions returns the statistics of the boxes called and of the
+// program, "<main>", by decreasing self time
+func (p *Profiler) Functions() []Stats {
+	stats := map[*function]*Stats{}
+	for _, fn := range p.order {
+		stats[fn] = &Stats{Name: fn.name, Line: fn.line, Count: fn.calls}
+	}
+
+	for _, s := range p.samples {
+		stats[s.stack[0].fn].Self += s.time
+		seen := map[*function]bool{}
+		for _, f := range s.stack {
+			// Recursive calls are counted once
+			if !seen[f.fn] {
+				seen[f.fn] = true
+				stats[f.fn].Cumulative += s.time
+			}
+		}
+	}
+
+	out := []Stats{}
+	for _, fn := range p.order {
+		out = append(out, *stats[fn])
+	}
+	sortStats(out)
+	return out
+}
+
+// Lines returns the statistics of the lines that ran, by decreasing self
+// time. Calls are charged to the lines they are made from.
+func (p *Profiler) Lines() []Stats {
+	stats := map[int]*Stats{}
+	for line, hits := range p.hits {
+		stats[line] = &Stats{Line: line, Count: hits}
+	}
+	get := func(line int) *Stats {
+		if _, ok := stats[line]; !ok {
+			stats[line] = &Stats{Line: line}
+		}
+		return stats[line]
+	}
+
+	for _, s := range p.samples {
+		get(s.stack[0].line).Self += s.time
+		seen := map[int]bool{}
+		for _, f := range s.stack {
+			if !seen[f.line] {
+				seen[f.line] = true
+				get(f.line).Cumulative += s.time
+			}
+		}
+	}
+
+	out := []Stats{}
+	for _, s := range stats {
+		// Time before the first statement of the program or of a box runs
+		if s.Line > 0 {
+			out = append(out, *s)
+		}
+	}
+	sortStats(out)
+	return out
+}
+
+func sortStats(stats []Stats) {
+	sort.SliceStable(stats, func(i, j int) bool {
+		if stats[i].Self != stats[j].Self {
+			return stats[i].Self > stats[j].Self
+		}
+		return stats[i].Line < stats[j].Line
+	})
+}
@@ -0,0 +1,159 @@
+package profile
+
+import (
+	"bytes"
+	"cardboard/lexer"
+	"cardboard/object"
+	"cardboard/parser"
+	"compress/gzip"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const script = `put add = box(a, b) {
+    a + b
+};
+add(1, 2);
+add(3, 4);`
+
+// Profiles the script with a clock moving by a millisecond each time it
+// is read
+func run(t *testing.T) *Profiler {
+	p := parser.CreateParser(lexer.CreateLexer(script))
+	program := p.ParseCardBoard()
+	if errs := p.GetErrors(); len(errs) > 0 {
+		t.Fatalf("Test failed. Parser errors: %q", errs)
+	}
+
+	profiler := New("test.cb")
+	clock := time.Unix(0, 0)
+	profiler.now = func() time.Time {
+		now := clock
+		clock = clock.Add(time.Millisecond)
+		return now
+	}
+	if result := profiler.Run(program, object.CreateEnvironment()); result.Inspect() != "7" {
+		t.Fatalf("Test failed. Wrong result: %s", result.Inspect())
+	}
+	return profiler
+}
+
+func TestStats(t *testing.T) {
+	profiler := run(t)
+	ms := time.Millisecond
+
+	functions := []Stats{
+		{Name: "<main>", Count: 0, Self: 6 * ms, Cumulative: 10 * ms},
+		{Name: "add", Line: 1, Count: 2, Self: 4 * ms, Cumulative: 4 * ms},
+	}
+	if got := profiler.Functions(); !reflect.DeepEqual(got, functions) {
+		t.Errorf("Test failed. Wrong functions.\nwant=%+v\ngot=%+v", functions, got)
+	}
+
+	// The calls of add are charged to the lines they are made from until
+	// its body runs, not to its header on line 1
+	lines := []Stats{
+		{Line: 2, Count: 2, Self: 2 * ms, Cumulative: 2 * ms},
+		{Line: 4, Count: 1, Self: 2 * ms, Cumulative: 4 * ms},
+		{Line: 5, Count: 1, Self: 2 * ms, Cumulative: 4 * ms},
+		{Line: 1, Count: 1, Self: 1 * ms, Cumulative: 1 * ms},
+	}
+	if got := profiler.Lines(); !reflect.DeepEqual(got, lines) {
+		t.Errorf("Test failed. Wrong lines.\nwant=%+v\ngot=%+v", lines, got)
+	}
+}
+
+func TestReport(t *testing.T) {
+	var out bytes.Buffer
+	if err := run(t).WriteReport(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"Total time: 10ms",
+		"0   6ms  60.0%        10ms       100.0% <main> (test.cb)",
+		"2   4ms  40.0%         4ms        40.0% add (test.cb:1)",
+		"1   2ms  20.0%         4ms        40.0% test.cb:4",
+	}
+	for _, want := range expected {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Test failed. Expected the report to contain %q. Got\n%s", want, out.String())
+		}
+	}
+}
+
+func TestPprof(t *testing.T) {
+	var out bytes.Buffer
+	if err := run(t).WritePprof(&out); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Count the fields of the profile, and read its strings
+	fields := map[uint64]int{}
+	table := []string{}
+	for len(data) > 0 {
+		key, n := readVarint(t, data)
+		data = data[n:]
+		field, wireType := key>>3, key&7
+		fields[field]++
+
+		switch wireType {
+		case wireVarint:
+			_, n = readVarint(t, data)
+			data = data[n:]
+		case wireBytes:
+			length, n := readVarint(t, data)
+			value := data[n : n+int(length)]
+			data = data[n+int(length):]
+			if field == profileStringTable {
+				table = append(table, string(value))
+			}
+		default:
+			t.Fatalf("Test failed. Unexpected wire type %d", wireType)
+		}
+	}
+
+	// The profile starts at the zero time, left out. Samples: main at lines 0, 1, 4 and 5, and add at lines 0 and 2
+	// called from lines 4 and 5. Locations are the lines of main and add.
+	expected := map[uint64]int{
+		profileSampleType:    2,
+		profileSample:        8,
+		profileLocation:      6,
+		profileFunction:      2,
+		profileStringTable:   len(table),
+		profileDurationNanos: 1,
+		profilePeriodType:    1,
+		profilePeriod:        1,
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Test failed. Wrong fields.\nwant=%v\ngot=%v", expected, fields)
+	}
+
+	strings := []string{"", "calls", "count", "time", "nanoseconds", "main", "test.cb", "add"}
+	if !reflect.DeepEqual(table, strings) {
+		t.Errorf("Test failed. Wrong string table.\nwant=%q\ngot=%q", strings, table)
+	}
+}
+
+func readVarint(t *testing.T, data []byte) (uint64, int) {
+	var v uint64
+	for idx, b := range data {
+		v |= uint64(b&0x7f) << (7 * idx)
+		if b < 0x80 {
+			return v, idx + 1
+		}
+	}
+	t.Fatalf("Test failed. Truncated varint")
+	return 0, 0
+}
@@ -0,0 +1,40 @@
+package profile
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// WriteReport writes the statistics of the functions and of the lines as
+// tables
+func (p *Profiler) WriteReport(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	fmt.Fprintf(w, "Total time: %s\n", p.duration)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "calls\tself\tself%\tcumulative\tcumulative%\t function")
+	for _, s := range p.Functions() {
+		location := p.filename
+		if s.Line > 0 {
+			location += ":" + strconv.Itoa(s.Line)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t %s (%s)\n", s.Count, s.Self, p.percent(s.Self), s.Cumulative, p.percent(s.Cumulative), s.Name, location)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "hits\tself\tself%\tcumulative\tcumulative%\t line")
+	for _, s := range p.Lines() {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t %s:%d\n", s.Count, s.Self, p.percent(s.Self), s.Cumulative, p.percent(s.Cumulative), p.filename, s.Line)
+	}
+	return w.Flush()
+}
+
+func (p *Profiler) percent(d time.Duration) string {
+	if p.duration == 0 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(d)/float64(p.duration))
+}
@@ -0,0 +1,96 @@
+package repl
+
+import (
+	"cardboard/compiler"
+	"cardboard/eval"
+	"cardboard/object"
+	"cardboard/parser/ast"
+	"cardboard/vm"
+	"fmt"
+	"sort"
+)
+
+// Engines available to run programs
+const (
+	EngineEval = "eval"
+	EngineVM   = "vm"
+)
+
+// An engine runs programs one after the other, keeping the bindings
+// made by earlier programs.
+type engine interface {
+	Run(program *ast.Program) object.Object
+
+	// Bind sets a top level binding
+	Bind(name string, val object.Object)
+
+	// Names returns every identifier bound so far
+	Names() []string
+}
+
+func newEngine(name string) (engine, error) {
+	switch name {
+	case EngineEval:
+		return &evalEngine{env: object.CreateEnvironment()}, nil
+	case EngineVM:
+		return &vmEngine{
+			symbolTable: compiler.NewSymbolTable(),
+			constants:   []object.Object{},
+			globals:     make([]object.Object, vm.GlobalsSize),
+		}, nil
+	}
+	return nil, fmt.Errorf("Unknown engine: <%s>. Expected %s or %s", name, EngineEval, EngineVM)
+}
+
+// Walks the syntax tree
+type evalEngine struct {
+	env *object.Environment
+}
+
+func (e *evalEngine) Run(program *ast.Program) object.Object {
+	return eval.Eval(program, e.env)
+}
+
+func (e *evalEngine) Bind(name string, val object.Object) { e.env.Set(name, val) }
+
+func (e *evalEngine) Names() []string { return e.env.Names() }
+
+// Compiles to bytecode and runs it on the virtual machine
+type vmEngine struct {
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+}
+
+func (e *vmEngine) Run(program *ast.Program) object.Object {
+	comp := compiler.NewWithState(e.symbolTable, e.constants)
+	if err := comp.Compile(program); err != nil {
+		return &object.Error{Kind: object.RUNTIME_ERROR, Message: err.Error()}
+	}
+
+	bytecode := comp.Bytecode()
+	e.constants = bytecode.Constants
+	return vm.NewWithGlobalsStore(bytecode, e.globals).Run()
+}
+
+// Bind leaves out globals past the store, which the compiler reports when
+// a program refers to them.
+func (e *vmEngine) Bind(name string, val object.Object) {
+	if idx := e.symbolTable.Declare(name).Index; idx < len(e.globals) {
+		e.globals[idx] = val
+	}
+}
+
+// Names returns the globals holding a value. Slots of identifiers that
+// were only referred to, and of catch parameters out of scope, are left out.
+func (e *vmEngine) Names() []string {
+	names := []string{}
+	for idx, name := range e.symbolTable.Names() {
+		symbol, _, _ := e.symbolTable.Resolve(name)
+		if symbol.Index == idx && idx < len(e.globals) && e.globals[idx] != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
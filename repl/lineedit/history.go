@@ -0,0 +1,88 @@
+package lineedit
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// Maximum number of entries kept in memory and on disk
+const maxHistory = 1000
+
+// History of previously entered lines, optionally persisted to a file.
+type History struct {
+	entries []string
+	path    string
+}
+
+// LoadHistory reads the history stored at path. A missing file is not
+// an error, it simply results in an empty history.
+func LoadHistory(path string) (*History, error) {
+	h := &History{path: path}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	} else if err != nil {
+		return h, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+	h.trim()
+	return h, scanner.Err()
+}
+
+// Add appends a line to the history and persists it if the
+// history is backed by a file. Empty lines and immediate repeats are ignored.
+func (h *History) Add(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.Contains(line, "\n") {
+		return nil
+	}
+	if len(h.entries) > 0 && h.entries[len(h.entries)-1] == line {
+		return nil
+	}
+	h.entries = append(h.entries, line)
+	h.trim()
+	return h.save()
+}
+
+// Len returns the number of entries.
+func (h *History) Len() int { return len(h.entries) }
+
+// At returns the entry at idx, where 0 is the oldest entry.
+func (h *History) At(idx int) string { return h.entries[idx] }
+
+// Search looks backwards from (and including) idx for an entry containing
+// query. It returns the index of the match or -1.
+func (h *History) Search(query string, idx int) int {
+	if idx >= len(h.entries) {
+		idx = len(h.entries) - 1
+	}
+	for ; idx >= 0; idx-- {
+		if strings.Contains(h.entries[idx], query) {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (h *History) trim() {
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[len(h.entries)-maxHistory:]
+	}
+}
+
+func (h *History) save() error {
+	if h.path == "" {
+		return nil
+	}
+	data := strings.Join(h.entries, "\n") + "\n"
+	return os.WriteFile(h.path, []byte(data), 0600)
+}
@@ -0,0 +1,437 @@
+// Package lineedit implements a small terminal line editor for the REPL
+// with cursor movement, history browsing, reverse search and tab completion.
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrInterrupted is returned by ReadLine when the user presses Ctrl-C.
+var ErrInterrupted = errors.New("interrupted")
+
+// CompleteFunc returns the candidate words for the word being typed.
+// Candidates that don't start with prefix are discarded by the editor.
+type CompleteFunc func(prefix string) []string
+
+// Key codes
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlG     = 7
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyNewLine   = 10
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEsc       = 27
+	keyBackspace = 127
+)
+
+type Editor struct {
+	History  *History
+	Complete CompleteFunc
+
+	in  *bufio.Reader
+	out io.Writer
+	fd  int
+}
+
+// Creates an editor reading keys from in and drawing on out.
+// Line editing is only enabled when in is a terminal, otherwise
+// ReadLine falls back to reading plain lines.
+func New(in io.Reader, out io.Writer) *Editor {
+	editor := &Editor{History: &History{}, in: bufio.NewReader(in), out: out, fd: -1}
+	if file, ok := in.(*os.File); ok && isTerminal(int(file.Fd())) {
+		editor.fd = int(file.Fd())
+	}
+	return editor
+}
+
+// ReadLine displays prompt and returns the line entered by the user.
+// It returns io.EOF on Ctrl-D (or end of input) and ErrInterrupted on Ctrl-C.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if e.fd < 0 {
+		return e.readPlain(prompt)
+	}
+
+	restore, err := enableRawMode(e.fd)
+	if err != nil {
+		return e.readPlain(prompt)
+	}
+	defer restore()
+
+	return e.edit(prompt)
+}
+
+func (e *Editor) readPlain(prompt string) (string, error) {
+	fmt.Fprint(e.out, prompt)
+	line, err := e.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// State of the line currently being edited
+type state struct {
+	prompt string
+	buf    []rune
+	pos    int
+
+	// Position while browsing history. Equal to History.Len() when
+	// editing a fresh line, whose contents are kept in saved.
+	historyIdx int
+	saved      []rune
+}
+
+func (e *Editor) edit(prompt string) (string, error) {
+	s := &state{prompt: prompt, historyIdx: e.History.Len()}
+	e.refresh(s)
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err == io.EOF && len(s.buf) > 0 {
+			fmt.Fprint(e.out, "\n")
+			return string(s.buf), nil
+		} else if err != nil {
+			return "", err
+		}
+
+		if line, done, err := e.handleKey(s, r); done {
+			return line, err
+		}
+		e.refresh(s)
+	}
+}
+
+// Applies a single key press. done is set once the line is finished.
+func (e *Editor) handleKey(s *state, r rune) (line string, done bool, err error) {
+	switch r {
+	case keyEnter, keyNewLine:
+		fmt.Fprint(e.out, "\n")
+		return string(s.buf), true, nil
+	case keyCtrlC:
+		fmt.Fprint(e.out, "^C\n")
+		return "", true, ErrInterrupted
+	case keyCtrlD:
+		if len(s.buf) == 0 {
+			fmt.Fprint(e.out, "\n")
+			return "", true, io.EOF
+		}
+		s.deleteForward()
+	case keyBackspace, keyCtrlH:
+		s.backspace()
+	case keyTab:
+		e.complete(s)
+	case keyCtrlA:
+		s.pos = 0
+	case keyCtrlE:
+		s.pos = len(s.buf)
+	case keyCtrlB:
+		s.moveLeft()
+	case keyCtrlF:
+		s.moveRight()
+	case keyCtrlK:
+		s.buf = s.buf[:s.pos]
+	case keyCtrlU:
+		s.buf = append([]rune{}, s.buf[s.pos:]...)
+		s.pos = 0
+	case keyCtrlW:
+		s.deleteWord()
+	case keyCtrlP:
+		e.historyPrev(s)
+	case keyCtrlN:
+		e.historyNext(s)
+	case keyCtrlL:
+		fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+	case keyCtrlR:
+		return e.reverseSearch(s)
+	case keyEsc:
+		e.escapeSequence(s)
+	default:
+		if unicode.IsPrint(r) {
+			s.insert(r)
+		}
+	}
+	return "", false, nil
+}
+
+// Handles ANSI escape sequences for arrows, home/end and delete.
+func (e *Editor) escapeSequence(s *state) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return
+	}
+
+	r, _, err = e.in.ReadRune()
+	if err != nil {
+		return
+	}
+
+	// Sequences of the form ESC [ <digit> ~
+	if r >= '0' && r <= '9' {
+		code := r
+		for r != '~' {
+			if r, _, err = e.in.ReadRune(); err != nil {
+				return
+			}
+		}
+		switch code {
+		case '1', '7':
+			s.pos = 0
+		case '4', '8':
+			s.pos = len(s.buf)
+		case '3':
+			s.deleteForward()
+		}
+		return
+	}
+
+	switch r {
+	case 'A':
+		e.historyPrev(s)
+	case 'B':
+		e.historyNext(s)
+	case 'C':
+		s.moveRight()
+	case 'D':
+		s.moveLeft()
+	case 'H':
+		s.pos = 0
+	case 'F':
+		s.pos = len(s.buf)
+	}
+}
+
+// Redraws the prompt and the line, then places the cursor.
+func (e *Editor) refresh(s *state) {
+	var out strings.Builder
+	out.WriteString("\r")
+	out.WriteString(s.prompt)
+	out.WriteString(string(s.buf))
+	out.WriteString("\x1b[K\r")
+	if col := utf8.RuneCountInString(s.prompt) + s.pos; col > 0 {
+		out.WriteString(fmt.Sprintf("\x1b[%dC", col))
+	}
+	fmt.Fprint(e.out, out.String())
+}
+
+func (e *Editor) historyPrev(s *state) {
+	if s.historyIdx == 0 {
+		return
+	}
+	if s.historyIdx == e.History.Len() {
+		s.saved = s.buf
+	}
+	s.historyIdx--
+	s.setLine([]rune(e.History.At(s.historyIdx)))
+}
+
+func (e *Editor) historyNext(s *state) {
+	if s.historyIdx >= e.History.Len() {
+		return
+	}
+	s.historyIdx++
+	if s.historyIdx == e.History.Len() {
+		s.setLine(s.saved)
+	} else {
+		s.setLine([]rune(e.History.At(s.historyIdx)))
+	}
+}
+
+// Incremental reverse search through history (Ctrl-R).
+// Enter runs the match, Ctrl-G cancels, and any other key
+// accepts the match for editing before being handled as usual.
+func (e *Editor) reverseSearch(s *state) (string, bool, error) {
+	original := s.buf
+	query := []rune{}
+	matchIdx := e.History.Len()
+	match := ""
+
+	for {
+		status := "reverse-i-search"
+		if len(query) > 0 && matchIdx < 0 {
+			status = "failing reverse-i-search"
+		}
+		fmt.Fprintf(e.out, "\r(%s)`%s': %s\x1b[K", status, string(query), match)
+
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", true, err
+		}
+
+		switch {
+		case r == keyCtrlR:
+			if matchIdx > 0 {
+				if idx := e.History.Search(string(query), matchIdx-1); idx >= 0 {
+					matchIdx, match = idx, e.History.At(idx)
+				}
+			}
+		case r == keyBackspace || r == keyCtrlH:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+			}
+			matchIdx, match = e.History.Len(), ""
+			if len(query) > 0 {
+				if idx := e.History.Search(string(query), e.History.Len()-1); idx >= 0 {
+					matchIdx, match = idx, e.History.At(idx)
+				}
+			}
+		case r == keyCtrlG || r == keyCtrlC:
+			s.setLine(original)
+			return "", false, nil
+		case unicode.IsPrint(r):
+			query = append(query, r)
+			from := matchIdx
+			if from >= e.History.Len() {
+				from = e.History.Len() - 1
+			}
+			if idx := e.History.Search(string(query), from); idx >= 0 {
+				matchIdx, match = idx, e.History.At(idx)
+			} else {
+				matchIdx = -1
+			}
+		default:
+			if match != "" {
+				s.setLine([]rune(match))
+				s.historyIdx = e.History.Len()
+			}
+			return e.handleKey(s, r)
+		}
+	}
+}
+
+// Completes the word before the cursor. A single candidate is inserted
+// directly, several candidates are narrowed to their common prefix and
+// listed when no further progress can be made.
+func (e *Editor) complete(s *state) {
+	if e.Complete == nil {
+		return
+	}
+
+	start := s.pos
+	for start > 0 && isWordRune(s.buf[start-1]) {
+		start--
+	}
+	prefix := string(s.buf[start:s.pos])
+
+	candidates := []string{}
+	seen := make(map[string]bool)
+	for _, candidate := range e.Complete(prefix) {
+		if strings.HasPrefix(candidate, prefix) && !seen[candidate] {
+			seen[candidate] = true
+			candidates = append(candidates, candidate)
+		}
+	}
+	sort.Strings(candidates)
+
+	switch len(candidates) {
+	case 0:
+		fmt.Fprint(e.out, "\a")
+	case 1:
+		s.insertString(candidates[0][len(prefix):])
+	default:
+		common := longestCommonPrefix(candidates)
+		if len(common) > len(prefix) {
+			s.insertString(common[len(prefix):])
+		} else {
+			fmt.Fprintf(e.out, "\n%s\n", strings.Join(candidates, "  "))
+		}
+	}
+}
+
+func longestCommonPrefix(words []string) string {
+	prefix := words[0]
+	for _, word := range words[1:] {
+		// Trimmed a rune at a time, never leaving half a rune behind
+		for !strings.HasPrefix(word, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+func (s *state) setLine(line []rune) {
+	s.buf = append([]rune{}, line...)
+	s.pos = len(s.buf)
+}
+
+func (s *state) insert(r rune) {
+	s.buf = append(s.buf, 0)
+	copy(s.buf[s.pos+1:], s.buf[s.pos:])
+	s.buf[s.pos] = r
+	s.pos++
+}
+
+func (s *state) insertString(str string) {
+	for _, r := range str {
+		s.insert(r)
+	}
+}
+
+func (s *state) backspace() {
+	if s.pos == 0 {
+		return
+	}
+	s.buf = append(s.buf[:s.pos-1], s.buf[s.pos:]...)
+	s.pos--
+}
+
+func (s *state) deleteForward() {
+	if s.pos >= len(s.buf) {
+		return
+	}
+	s.buf = append(s.buf[:s.pos], s.buf[s.pos+1:]...)
+}
+
+func (s *state) deleteWord() {
+	start := s.pos
+	for start > 0 && s.buf[start-1] == ' ' {
+		start--
+	}
+	for start > 0 && s.buf[start-1] != ' ' {
+		start--
+	}
+	s.buf = append(s.buf[:start], s.buf[s.pos:]...)
+	s.pos = start
+}
+
+func (s *state) moveLeft() {
+	if s.pos > 0 {
+		s.pos--
+	}
+}
+
+func (s *state) moveRight() {
+	if s.pos < len(s.buf) {
+		s.pos++
+	}
+}
+
+// IsTerminal reports whether file is connected to a terminal.
+func IsTerminal(file *os.File) bool {
+	return isTerminal(int(file.Fd()))
+}
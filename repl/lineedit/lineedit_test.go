@@ -0,0 +1,139 @@
+package lineedit
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testEditor(input string, history ...string) *Editor {
+	e := New(strings.NewReader(input), &bytes.Buffer{})
+	for _, line := range history {
+		e.History.Add(line)
+	}
+	return e
+}
+
+func TestLineEditing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"put x = 5;\r", "put x = 5;"},
+		{"put = 5;\x1b[D\x1b[D\x1b[D\x1b[Dx \r", "put x = 5;"},
+		{"put xy\x7f = 5;\r", "put x = 5;"},
+		{"= 5;\x01put x \r", "put x = 5;"},
+		{"put x = 5; junk\x17\x7f\r", "put x = 5;"},
+		{"junk\x15put x = 5;\r", "put x = 5;"},
+		{"put x = 5;\x01\x1b[3~p\r", "put x = 5;"},
+		{"put x = 5; 10\x02\x02\x02\x0b\r", "put x = 5;"},
+	}
+
+	for _, tt := range tests {
+		line, err := testEditor(tt.input).edit(">>> ")
+		if err != nil {
+			t.Fatalf("Test Failed! Unexpected error <%s> for input %q", err, tt.input)
+		}
+		if line != tt.expected {
+			t.Fatalf("Test Failed! Expected line <%s>. Got <%s> for input %q", tt.expected, line, tt.input)
+		}
+	}
+}
+
+func TestControlKeys(t *testing.T) {
+	if _, err := testEditor("\x04").edit(">>> "); err != io.EOF {
+		t.Fatalf("Test Failed! Expected io.EOF on Ctrl-D. Got <%v>", err)
+	}
+	if _, err := testEditor("abc\x03").edit(">>> "); err != ErrInterrupted {
+		t.Fatalf("Test Failed! Expected ErrInterrupted on Ctrl-C. Got <%v>", err)
+	}
+}
+
+func TestHistoryBrowsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"\x1b[A\r", "put b = 2;"},
+		{"\x1b[A\x1b[A\r", "put a = 1;"},
+		{"\x1b[A\x1b[A\x1b[A\x1b[B\r", "put b = 2;"},
+		{"draft\x1b[A\x1b[B\r", "draft"},
+		{"\x10\x10\x0e\r", "put b = 2;"},
+	}
+
+	for _, tt := range tests {
+		line, _ := testEditor(tt.input, "put a = 1;", "put b = 2;").edit(">>> ")
+		if line != tt.expected {
+			t.Fatalf("Test Failed! Expected line <%s>. Got <%s> for input %q", tt.expected, line, tt.input)
+		}
+	}
+}
+
+func TestReverseSearch(t *testing.T) {
+	history := []string{"put add = box(a, b) { a + b };", "put x = 10;", "add(x, 5);"}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"\x12put\r", "put x = 10;"},
+		{"\x12put\x12\r", "put add = box(a, b) { a + b };"},
+		{"\x12add\r", "add(x, 5);"},
+		{"\x12x =\x1b[D\x7f\r", "put x = 1;"},
+		{"keep\x12add\x07\r", "keep"},
+	}
+
+	for _, tt := range tests {
+		line, _ := testEditor(tt.input, history...).edit(">>> ")
+		if line != tt.expected {
+			t.Fatalf("Test Failed! Expected line <%s>. Got <%s> for input %q", tt.expected, line, tt.input)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	words := []string{"box", "put", "unbox", "newAdder", "newValue", "add", "größe", "grün"}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"un\t 5;\r", "unbox 5;"},
+		{"ne\t\r", "new"},
+		{"newA\t(2);\r", "newAdder(2);"},
+		{"put y = a\t(1, 2);\r", "put y = add(1, 2);"},
+		{"zz\t\r", "zz"},
+		{"g\t\r", "gr"},
+		{"grö\t\r", "größe"},
+	}
+
+	for _, tt := range tests {
+		e := testEditor(tt.input)
+		e.Complete = func(prefix string) []string { return words }
+		line, _ := e.edit(">>> ")
+		if line != tt.expected {
+			t.Fatalf("Test Failed! Expected line <%s>. Got <%s> for input %q", tt.expected, line, tt.input)
+		}
+	}
+}
+
+func TestHistoryPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".cardboard_history")
+
+	history, err := LoadHistory(path)
+	if err != nil {
+		t.Fatalf("Test Failed! Loading a missing history file returned <%s>", err)
+	}
+	history.Add("put x = 5;")
+	history.Add("put x = 5;")
+	history.Add("   ")
+	history.Add("x;")
+
+	loaded, err := LoadHistory(path)
+	if err != nil {
+		t.Fatalf("Test Failed! Unexpected error <%s>", err)
+	}
+	if loaded.Len() != 2 || loaded.At(0) != "put x = 5;" || loaded.At(1) != "x;" {
+		t.Fatalf("Test Failed! Expected history [put x = 5; x;]. Got <%v>", loaded.entries)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package lineedit
+
+import "errors"
+
+func enableRawMode(fd int) (func(), error) {
+	return nil, errors.New("raw mode is only supported on linux")
+}
+
+func isTerminal(fd int) bool { return false }
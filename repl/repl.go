@@ -1,35 +1,55 @@
 package repl
 
 import (
-	"bufio"
-	"cardboard/eval"
 	"cardboard/lexer"
+	"cardboard/lexer/token"
 	"cardboard/object"
 	"cardboard/parser"
+	"cardboard/parser/ast"
+	"cardboard/repl/lineedit"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
-func StartREPL() {
-	scanner := bufio.NewScanner(os.Stdin)
-	env := object.CreateEnvironment()
+// File in the user's home directory where REPL history is persisted
+const historyFile = ".cardboard_history"
+
+// Identifier bound to the last printed result
+const lastResult = "_"
+
+// StartREPL reads lines from standard input and runs them on the named
+// engine, printing their results.
+func StartREPL(engineName string) {
+	engine, err := newEngine(engineName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	editor := createEditor(engine)
 
 	fmt.Println("Cardboard v1.0! type :q to quit REPL.")
 
 	for {
-		fmt.Print(">>> ")
-		scanner.Scan()
+		line, err := editor.ReadLine(">>> ")
+		if err == lineedit.ErrInterrupted {
+			continue
+		} else if err != nil {
+			return
+		}
 
-		input := strings.TrimSpace(scanner.Text())
+		input := strings.TrimSpace(line)
 
 		if input == "" {
-			return
+			continue
 		} else if input == ":q" {
 			fmt.Println("Ending REPL.")
 			os.Exit(0)
 		}
 
+		editor.History.Add(input)
+
 		lex := lexer.CreateLexer(input)
 		parser := parser.CreateParser(lex)
 		program := parser.ParseCardBoard()
@@ -38,9 +58,101 @@ func StartREPL() {
 			continue
 		}
 
-		evaluatedProgram := eval.Eval(program, env)
-		fmt.Println(evaluatedProgram.Inspect())
+		evaluatedProgram := engine.Run(program)
+		printResult(program, evaluatedProgram, engine, input)
+	}
+}
+
+// Prints the outcome of evaluating a line. Errors are highlighted and
+// point at their source location, statements that only bind a value
+// print nothing, and any other value is printed and bound to '_'.
+func printResult(program *ast.Program, result object.Object, engine engine, source string) {
+	if result == nil {
+		return
+	}
+
+	if err, ok := result.(*object.Error); ok {
+		// Errors raised inside boxes may come from code entered on earlier
+		// lines, so the current line can only be shown for top level errors.
+		if len(err.Trace) > 0 {
+			source = ""
+		}
+		printError(os.Stdout, err, source)
+		return
+	}
+
+	if isPutProgram(program) {
+		return
+	}
+
+	engine.Bind(lastResult, result)
+	fmt.Println(result.Inspect())
+}
+
+// Prints a runtime error with its location, the offending source line
+// and the traceback of the box calls it propagated through.
+func printError(out *os.File, err *object.Error, source string) {
+	prefix := "Runtime Error"
+	if err.Kind == object.USER_ERROR {
+		prefix = "Uncaught Exception"
+	}
+	if err.Line > 0 {
+		prefix = fmt.Sprintf("%s [%d:%d]", prefix, err.Line, err.Column)
+	}
+	fmt.Fprintln(out, highlight(out, prefix+": ")+err.Message)
+
+	// Point at the offending column in the source line
+	lines := strings.Split(source, "\n")
+	if err.Line > 0 && err.Line <= len(lines) {
+		fmt.Fprintln(out, "    "+lines[err.Line-1])
+		fmt.Fprintln(out, "    "+strings.Repeat(" ", err.Column-1)+highlight(out, "^"))
+	}
+
+	fmt.Fprint(out, err.Traceback())
+}
+
+// Reports whether the program ends by binding a value with 'put',
+// and isn't cut short by a top level 'unbox'.
+func isPutProgram(program *ast.Program) bool {
+	if len(program.Statements) == 0 {
+		return false
+	}
+	for _, stmt := range program.Statements {
+		if _, ok := stmt.(*ast.UnboxStatement); ok {
+			return false
+		}
+	}
+	_, ok := program.Statements[len(program.Statements)-1].(*ast.PutStatement)
+	return ok
+}
+
+// Colours text red when writing to a terminal
+func highlight(out *os.File, text string) string {
+	if !lineedit.IsTerminal(out) {
+		return text
+	}
+	return "\x1b[1;31m" + text + "\x1b[0m"
+}
+
+func createEditor(engine engine) *lineedit.Editor {
+	editor := lineedit.New(os.Stdin, os.Stdout)
+
+	if home, err := os.UserHomeDir(); err == nil {
+		if history, err := lineedit.LoadHistory(filepath.Join(home, historyFile)); err == nil {
+			editor.History = history
+		}
 	}
+
+	// Complete keywords, builtins and every identifier bound in the session.
+	editor.Complete = func(prefix string) []string {
+		words := token.Keywords()
+		for _, builtin := range object.Builtins {
+			words = append(words, builtin.Name)
+		}
+		return append(words, engine.Names()...)
+	}
+
+	return editor
 }
 
 func checkParserErrors(p *parser.Parser) bool {
@@ -0,0 +1,108 @@
+package repl
+
+import (
+	"cardboard/cbc"
+	"cardboard/eval"
+	"cardboard/lexer"
+	"cardboard/object"
+	"cardboard/optimizer"
+	"cardboard/parser"
+	"cardboard/trace"
+	"cardboard/vm"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Options of a script run
+type Options struct {
+	// Name of the engine running the script
+	Engine string
+
+	// Optimize the script before running it
+	Optimize bool
+
+	// Format of the trace of the run written to standard error, empty to
+	// not trace it. Only the eval engine traces scripts.
+	Trace string
+}
+
+// RunFile runs the cardboard script at path and returns the exit code of
+// the run: 0 on success, 1 when the script fails to parse or raises a
+// runtime error. Compiled .cbc files always run on the virtual machine.
+func RunFile(path string, opts Options) int {
+	if strings.HasSuffix(path, cbc.Extension) {
+		return runCompiled(path)
+	}
+
+	engine, err := newEngine(opts.Engine)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	p := parser.CreateParser(lexer.CreateLexer(string(source)))
+	program := p.ParseCardBoard()
+
+	if errs := p.GetErrors(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return 1
+	}
+
+	if opts.Optimize {
+		program = optimizer.Optimize(program)
+	}
+
+	if opts.Trace != "" {
+		evalEngine, ok := engine.(*evalEngine)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Only the %s engine traces scripts\n", EngineEval)
+			return 1
+		}
+		tracer, err := trace.New(os.Stderr, opts.Trace)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		eval.SetHook(evalEngine.env, tracer)
+	}
+
+	result := engine.Run(program)
+	if err, ok := result.(*object.Error); ok {
+		printError(os.Stderr, err, string(source))
+		return 1
+	}
+	return 0
+}
+
+func runCompiled(path string) int {
+	in, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer in.Close()
+
+	file, err := cbc.Read(in)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	result := vm.New(file.Bytecode).Run()
+	if err, ok := result.(*object.Error); ok {
+		// Show the offending line when the script is still around
+		source, _ := os.ReadFile(file.Source)
+		printError(os.Stderr, err, string(source))
+		return 1
+	}
+	return 0
+}
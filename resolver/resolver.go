@@ -0,0 +1,324 @@
+// Package resolver finds the binding every identifier of a program refers
+// to before it runs, reporting the problems it finds as diagnostics.
+//
+// Bindings are scoped to the body of the box (or the program) making them:
+// parameters and 'put' statements, including those inside try statements.
+// Catch parameters are scoped to their catch block, where a 'put' of their
+// name rebinds them. A 'put' binding only shadows the binding of an
+// enclosing body once it's made: the statements of its body running before
+// its 'put' refer to the enclosing binding. Boxes may refer to bindings
+// made after they are created, since they run later.
+//
+// As a 'put' may not run, like one following an error in a try statement,
+// every resolution also gives the binding its identifier refers to while
+// the binding isn't made.
+package resolver
+
+import (
+	"cardboard/object"
+	"cardboard/parser/ast"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Severity int
+
+const (
+	Warning Severity = iota
+	Error
+)
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+// A problem found in a program, at the position of the offending identifier
+type Diagnostic struct {
+	Severity Severity
+	Line     int
+	Column   int
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", d.Line, d.Column, d.Severity, d.Message)
+}
+
+// Resolve annotates every identifier of the program with the binding it
+// refers to, builtins being left unresolved, and returns the diagnostics
+// of the program sorted by position: unknown identifiers are errors,
+// while bindings shadowing the binding of an enclosing body, and 'put'
+// bindings and parameters that are never used, are warnings. Names starting with '_' are never reported unused.
+func Resolve(program *ast.Program) []Diagnostic {
+	r := &resolver{}
+	r.body(program.Statements, nil)
+
+	sort.SliceStable(r.diagnostics, func(i, j int) bool {
+		a, b := r.diagnostics[i], r.diagnostics[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return r.diagnostics
+}
+
+type bindingKind int
+
+const (
+	putBinding bindingKind = iota
+	parameterBinding
+	catchBinding
+)
+
+type binding struct {
+	kind bindingKind
+	slot int
+
+	// Identifier first making the binding
+	ident *ast.Identifier
+
+	used bool
+
+	// A statement making the binding was resolved, and one that always runs
+	made, bound bool
+}
+
+// Bindings made by a box body, or by the program
+type scope struct {
+	outer    *scope
+	bindings map[string]*binding
+
+	// Every binding of the scope, by slot
+	slots []*binding
+}
+
+type resolver struct {
+	scope       *scope
+	diagnostics []Diagnostic
+
+	// Number of try statements being resolved, whose statements may not run
+	tries int
+}
+
+func (r *resolver) report(severity Severity, ident *ast.Identifier, format string, a ...interface{}) {
+	r.diagnostics = append(r.diagnostics, Diagnostic{
+		Severity: severity,
+		Line:     ident.NodeToken.Line,
+		Column:   ident.NodeToken.Column,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+// Resolves the statements of a box body, or of the program.
+// Returns the number of bindings made by the body.
+func (r *resolver) body(stmts []ast.Statement, params []*ast.Identifier) int {
+	r.scope = &scope{outer: r.scope, bindings: map[string]*binding{}}
+	defer func() { r.scope = r.scope.outer }()
+
+	for _, param := range params {
+		r.define(param, parameterBinding)
+	}
+	r.declareBindings(stmts, nil)
+
+	for _, stmt := range stmts {
+		r.statement(stmt)
+	}
+
+	for _, b := range r.scope.slots {
+		if b.used || strings.HasPrefix(b.ident.Value, "_") {
+			continue
+		}
+		switch b.kind {
+		case putBinding:
+			r.report(Warning, b.ident, "%s is bound but never used.", b.ident.Value)
+		case parameterBinding:
+			r.report(Warning, b.ident, "Parameter %s is never used.", b.ident.Value)
+		}
+	}
+	return len(r.scope.slots)
+}
+
+// Makes a binding in a new slot, even when the name is already bound in
+// the current scope, like repeated parameters.
+func (r *resolver) define(ident *ast.Identifier, kind bindingKind) {
+	r.checkShadowing(ident)
+
+	b := &binding{kind: kind, slot: len(r.scope.slots), ident: ident}
+	b.made = kind != putBinding
+	b.bound = b.made
+	r.scope.bindings[ident.Value] = b
+	r.scope.slots = append(r.scope.slots, b)
+	ident.Resolution = &ast.Resolution{Slot: b.slot, Global: r.scope.outer == nil, Declaration: ident}
+}
+
+// Makes a binding unless the name is already bound in the current scope
+func (r *resolver) declare(ident *ast.Identifier, kind bindingKind) {
+	if b, ok := r.scope.bindings[ident.Value]; ok {
+		ident.Resolution = &ast.Resolution{Slot: b.slot, Global: r.scope.outer == nil, Declaration: b.ident}
+		return
+	}
+	r.define(ident, kind)
+}
+
+func (r *resolver) checkShadowing(ident *ast.Identifier) {
+	for s := r.scope.outer; s != nil; s = s.outer {
+		if b, ok := s.bindings[ident.Value]; ok {
+			r.report(Warning, ident, "%s shadows the binding at %d:%d.", ident.Value, b.ident.NodeToken.Line, b.ident.NodeToken.Column)
+			return
+		}
+	}
+}
+
+// Binds the names bound by the statements of a body, before resolving them.
+// Names of the catch parameters in scope are left to the catch blocks.
+func (r *resolver) declareBindings(stmts []ast.Statement, params map[string]bool) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.PutStatement:
+			if !params[stmt.NodeIdentifier.Value] {
+				r.declare(&stmt.NodeIdentifier, putBinding)
+			}
+		case *ast.TryStatement:
+			r.declareBindings(stmt.Body.Statements, params)
+			if stmt.Catch != nil {
+				r.declareBindings(stmt.Catch.Statements, withParameter(params, stmt.CatchParameter))
+			}
+			if stmt.Finally != nil {
+				r.declareBindings(stmt.Finally.Statements, params)
+			}
+		}
+	}
+}
+
+// Returns the names of params with the name of a catch parameter, if any
+func withParameter(params map[string]bool, param *ast.Identifier) map[string]bool {
+	if param == nil {
+		return params
+	}
+	with := map[string]bool{param.Value: true}
+	for name := range params {
+		with[name] = true
+	}
+	return with
+}
+
+func (r *resolver) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.PutStatement:
+		r.expression(stmt.NodeExpression)
+		b := r.scope.bindings[stmt.NodeIdentifier.Value]
+		stmt.NodeIdentifier.Resolution = &ast.Resolution{Slot: b.slot, Global: r.scope.outer == nil, Declaration: b.ident}
+		r.make(b)
+	case *ast.UnboxStatement:
+		r.expression(stmt.NodeExpression)
+	case *ast.ExpressionStatement:
+		r.expression(stmt.Expression)
+	case *ast.ThrowStatement:
+		r.expression(stmt.NodeExpression)
+	case *ast.TryStatement:
+		r.tries++
+		defer func() { r.tries-- }()
+
+		r.block(stmt.Body)
+		if stmt.Catch != nil {
+			r.catch(stmt.CatchParameter, stmt.Catch)
+		}
+		if stmt.Finally != nil {
+			r.block(stmt.Finally)
+		}
+	}
+}
+
+// Records that the statements resolved from now on may see a binding made
+func (r *resolver) make(b *binding) {
+	b.made = true
+	if r.tries == 0 {
+		b.bound = true
+	}
+}
+
+// Resolves a catch block, its parameter making a binding of its own that
+// is only visible in the block
+func (r *resolver) catch(param *ast.Identifier, block *ast.BlockStatement) {
+	if param == nil {
+		r.block(block)
+		return
+	}
+
+	previous, ok := r.scope.bindings[param.Value]
+	r.define(param, catchBinding)
+	r.block(block)
+
+	if ok {
+		r.scope.bindings[param.Value] = previous
+	} else {
+		delete(r.scope.bindings, param.Value)
+	}
+}
+
+func (r *resolver) block(block *ast.BlockStatement) {
+	for _, stmt := range block.Statements {
+		r.statement(stmt)
+	}
+}
+
+func (r *resolver) expression(expr ast.Expression) {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		r.identifier(expr)
+	case *ast.PrefixExpression:
+		r.expression(expr.Right)
+	case *ast.InfixExpression:
+		r.expression(expr.Left)
+		r.expression(expr.Right)
+	case *ast.BoxExpression:
+		expr.Slots = r.body(expr.Body.Statements, expr.ParameterList)
+	case *ast.CallExpression:
+		r.expression(expr.Function)
+		for _, arg := range expr.Arguments {
+			r.expression(arg)
+		}
+	case *ast.MemberExpression:
+		r.expression(expr.Object)
+	}
+}
+
+func (r *resolver) identifier(ident *ast.Identifier) {
+	ident.Resolution = r.lookup(ident.Value, r.scope, 0, true)
+	if ident.Resolution != nil {
+		return
+	}
+
+	if _, _, ok := object.LookupBuiltin(ident.Value); ok {
+		return
+	}
+	r.report(Error, ident, "Unknown identifier: %s.", ident.Value)
+}
+
+// Resolves a name from a scope depth bodies away from the identifier, with
+// the bindings it falls back to, marking them used when used is set.
+// Bindings of the body being resolved are skipped until they're made.
+func (r *resolver) lookup(name string, from *scope, depth int, used bool) *ast.Resolution {
+	for s := from; s != nil; s = s.outer {
+		b, ok := s.bindings[name]
+		if ok && (b.made || s != r.scope) {
+			if used {
+				b.used = true
+			}
+			return &ast.Resolution{
+				Depth:       depth,
+				Slot:        b.slot,
+				Global:      s.outer == nil,
+				Declaration: b.ident,
+				Outer:       r.lookup(name, s.outer, depth+1, used && !b.bound),
+			}
+		}
+		depth++
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package resolver
+
+import (
+	"cardboard/lexer"
+	"cardboard/parser"
+	"cardboard/parser/ast"
+	"testing"
+)
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"put a = 1; a;", []string{}},
+		{"missing;", []string{"1:1: error: Unknown identifier: missing."}},
+		{"put a = b; a;", []string{"1:9: error: Unknown identifier: b."}},
+		{"assert(1); assertEqual; assertError;", []string{}},
+		{"put assert = 1; assert;", []string{}},
+		{"put a = 1;", []string{"1:5: warning: a is bound but never used."}},
+		{"put _a = 1;", []string{}},
+		{"box(x, y) { x }", []string{"1:8: warning: Parameter y is never used."}},
+		{"box(_) { 1 }", []string{}},
+		{
+			"put x = 1; box(x) { x }; x",
+			[]string{"1:16: warning: x shadows the binding at 1:5."},
+		},
+		{
+			"put x = 1; box() { put x = 2; x }; x",
+			[]string{"1:24: warning: x shadows the binding at 1:5."},
+		},
+		{
+			"box(e) { try { e; } catch (e) { e; } }",
+			[]string{},
+		},
+		// Catch parameters are only visible in their catch block
+		{"try { 1 / 0; } catch (e) { e; } e;", []string{"1:33: error: Unknown identifier: e."}},
+		{"put e = 1; try { 1 / 0; } catch (e) { put e = e; } e;", []string{}},
+		// Boxes may refer to bindings made later in the enclosing body
+		{"put f = box() { g() }; put g = box() { 1 }; f();", []string{}},
+		// but a binding can't be read before its 'put'
+		{
+			"x; put x = 1;",
+			[]string{"1:1: error: Unknown identifier: x.", "1:8: warning: x is bound but never used."},
+		},
+		{"put f = box() { put y = y; y }; f();", []string{"1:25: error: Unknown identifier: y."}},
+		// and refers to the enclosing binding until then
+		{
+			"put x = 1; put f = box() { put x = x + 1; x }; f();",
+			[]string{"1:32: warning: x shadows the binding at 1:5."},
+		},
+		{
+			"box(x) { box() { put x = x + 1; x } }",
+			[]string{"1:22: warning: x shadows the binding at 1:5."},
+		},
+		{"try { put y = 1; } catch (e) { e; } y;", []string{}},
+		// Bindings of a box aren't visible outside of it
+		{
+			"put f = box() { put y = 1; y }; f(); y;",
+			[]string{"1:38: error: Unknown identifier: y."},
+		},
+		// Property names aren't identifiers
+		{"try { 1; } catch (e) { e.kind; }", []string{}},
+		{
+			"put f = box(a) {\n  a + b\n};\nf(1)",
+			[]string{"2:7: error: Unknown identifier: b."},
+		},
+	}
+
+	for _, tt := range tests {
+		diagnostics := Resolve(parse(t, tt.input))
+
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("Test failed. Expected %d diagnostics for <%s>. Got <%v>", len(tt.expected), tt.input, diagnostics)
+			continue
+		}
+
+		for idx, diagnostic := range diagnostics {
+			if diagnostic.String() != tt.expected[idx] {
+				t.Errorf("Test failed. Expected diagnostic %q for <%s>. Got <%s>", tt.expected[idx], tt.input, diagnostic)
+			}
+		}
+	}
+}
+
+func TestResolutions(t *testing.T) {
+	program := parse(t, `
+	put a = 1;
+	put f = box(x, y) {
+		put z = x;
+		box() { a + y + z };
+	};`)
+	Resolve(program)
+
+	a := &program.Statements[0].(*ast.PutStatement).NodeIdentifier
+	f := program.Statements[1].(*ast.PutStatement)
+	box := f.NodeExpression.(*ast.BoxExpression)
+	y := box.ParameterList[1]
+	z := &box.Body.Statements[0].(*ast.PutStatement).NodeIdentifier
+
+	tests := []struct {
+		ident    *ast.Identifier
+		expected ast.Resolution
+	}{
+		{a, ast.Resolution{Slot: 0, Global: true, Declaration: a}},
+		{&f.NodeIdentifier, ast.Resolution{Slot: 1, Global: true, Declaration: &f.NodeIdentifier}},
+		{y, ast.Resolution{Slot: 1, Declaration: y}},
+		{z, ast.Resolution{Slot: 2, Declaration: z}},
+	}
+
+	// Identifiers of the innermost box: a + y + z
+	inner := box.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.BoxExpression)
+	sum := inner.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	left := sum.Left.(*ast.InfixExpression)
+
+	tests = append(tests, []struct {
+		ident    *ast.Identifier
+		expected ast.Resolution
+	}{
+		{left.Left.(*ast.Identifier), ast.Resolution{Depth: 2, Slot: 0, Global: true, Declaration: a}},
+		{left.Right.(*ast.Identifier), ast.Resolution{Depth: 1, Slot: 1, Declaration: y}},
+		{sum.Right.(*ast.Identifier), ast.Resolution{Depth: 1, Slot: 2, Declaration: z}},
+	}...)
+
+	for _, tt := range tests {
+		if tt.ident.Resolution == nil {
+			t.Errorf("Test failed. Expected %s to be resolved", tt.ident.Value)
+			continue
+		}
+		if *tt.ident.Resolution != tt.expected {
+			t.Errorf("Test failed. Expected %s to resolve to %+v. Got <%+v>", tt.ident.Value, tt.expected, *tt.ident.Resolution)
+		}
+	}
+}
+
+func TestUnknownIdentifierResolution(t *testing.T) {
+	program := parse(t, "missing;")
+	Resolve(program)
+
+	ident := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.Identifier)
+	if ident.Resolution != nil {
+		t.Fatalf("Test failed. Expected no resolution for an unknown identifier. Got <%+v>", ident.Resolution)
+	}
+}
+
+// Until its 'put' runs, a binding falls back to the enclosing one
+func TestOuterResolution(t *testing.T) {
+	program := parse(t, "put x = 1; box() { put x = x + 1; x };")
+	Resolve(program)
+
+	global := &program.Statements[0].(*ast.PutStatement).NodeIdentifier
+	box := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.BoxExpression)
+	put := box.Body.Statements[0].(*ast.PutStatement)
+	local := &put.NodeIdentifier
+	read := box.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.Identifier)
+
+	expected := ast.Resolution{
+		Slot:        0,
+		Declaration: local,
+		Outer:       &ast.Resolution{Depth: 1, Slot: 0, Global: true, Declaration: global},
+	}
+
+	resolution := read.Resolution
+	if resolution == nil || resolution.Outer == nil {
+		t.Fatalf("Test failed. Expected x to be resolved with an outer binding. Got <%+v>", resolution)
+	}
+	if resolution.Depth != expected.Depth || resolution.Slot != expected.Slot || resolution.Declaration != expected.Declaration || *resolution.Outer != *expected.Outer {
+		t.Fatalf("Test failed. Expected x to resolve to %+v then %+v. Got <%+v> then <%+v>", expected, *expected.Outer, *resolution, *resolution.Outer)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.CreateParser(lexer.CreateLexer(input))
+	program := p.ParseCardBoard()
+	if errs := p.GetErrors(); len(errs) > 0 {
+		t.Fatalf("Test failed. Parser errors for <%s>: %v", input, errs)
+	}
+	return program
+}
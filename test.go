@@ -0,0 +1,125 @@
+package main
+
+import (
+	"cardboard/conformance"
+	"cardboard/lexer"
+	"cardboard/object"
+	"cardboard/parser"
+	"cardboard/parser/ast"
+	"cardboard/repl"
+	"cardboard/tester"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Runs the tests of test files, given directly or found in directories
+// and their subdirectories, the current directory by default.
+func testCommand(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	engine := flags.String("engine", repl.EngineEval, "engine running the tests: eval or vm")
+	run := flags.String("run", "", "only run the tests whose name matches `regexp`")
+	verbose := flags.Bool("v", false, "also list the tests that pass")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: cardboard test [-engine name] [-run regexp] [-v] [path...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	var backend func(program *ast.Program, out io.Writer) object.Object
+	for _, b := range conformance.Backends {
+		if b.Name == *engine {
+			backend = b.Run
+		}
+	}
+	if backend == nil {
+		fmt.Fprintf(os.Stderr, "Unknown engine: <%s>. Expected %s or %s\n", *engine, repl.EngineEval, repl.EngineVM)
+		return 2
+	}
+
+	var filter *regexp.Regexp
+	if *run != "" {
+		var err error
+		if filter, err = regexp.Compile(*run); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -run pattern: %s\n", err)
+			return 2
+		}
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := testFiles(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "No test files: no *%s file found\n", tester.Suffix)
+		return 1
+	}
+
+	code := 0
+	for _, path := range files {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		p := parser.CreateParser(lexer.CreateLexer(string(source)))
+		program := p.ParseCardBoard()
+		if errs := p.GetErrors(); len(errs) > 0 {
+			for _, err := range errs {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			}
+			fmt.Printf("FAIL\t%s\t[parse failed]\n", path)
+			code = 1
+			continue
+		}
+
+		results := tester.Run(program, filter, backend)
+		for _, result := range results {
+			if !result.Passed() {
+				code = 1
+			}
+		}
+		if err := tester.WriteResults(os.Stdout, path, results, *verbose); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	return code
+}
+
+// Returns the test files among paths, and those in the directories of paths
+func testFiles(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err == nil && !entry.IsDir() && strings.HasSuffix(file, tester.Suffix) {
+				files = append(files, file)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
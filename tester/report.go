@@ -0,0 +1,56 @@
+package tester
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteResults writes the outcome of the tests of the file at path: the
+// failed tests with their output, the error they raised and its traceback,
+// the passed ones too when verbose, and a line summing the file up.
+func WriteResults(out io.Writer, path string, results []Result, verbose bool) error {
+	w := bufio.NewWriter(out)
+
+	failed := 0
+	for _, result := range results {
+		if result.Passed() {
+			if verbose {
+				fmt.Fprintf(w, "--- PASS: %s\n", result.Name)
+				writeIndented(w, result.Output)
+			}
+			continue
+		}
+
+		failed++
+		err := result.Err
+		fmt.Fprintf(w, "--- FAIL: %s (%s:%d:%d)\n", result.Name, path, result.Line, result.Column)
+		writeIndented(w, result.Output)
+		fmt.Fprintf(w, "    %s:%d:%d: %s: %s\n", path, err.Line, err.Column, err.Kind, err.Message)
+		writeIndented(w, err.Traceback())
+	}
+
+	switch {
+	case len(results) == 0:
+		fmt.Fprintf(w, "ok  \t%s\t[no tests to run]\n", path)
+	case failed > 0:
+		fmt.Fprintf(w, "FAIL\t%s\t%d passed, %d failed\n", path, len(results)-failed, failed)
+	default:
+		fmt.Fprintf(w, "ok  \t%s\t%d passed\n", path, len(results))
+	}
+	return w.Flush()
+}
+
+// Writes text indented by four spaces, ending its last line
+func writeIndented(w io.Writer, text string) {
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if line == "" {
+			continue
+		}
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n"
+		}
+		fmt.Fprint(w, "    "+line)
+	}
+}
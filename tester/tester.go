@@ -0,0 +1,134 @@
+// Package tester runs the tests of cardboard test files.
+//
+// Test files are named *_test.cb. Their tests are the boxes bound by top
+// level 'put' statements to names starting with "test" and not followed
+// by a lowercase letter, like testAdd or test_parse, and are called
+// without arguments. A test passes when its call returns, and fails with
+// the error it raises, like the errors of the assert builtins.
+//
+// Every test runs in an environment of its own: the top level statements
+// of the file run anew before the test is called, so the bindings a test
+// makes are never seen by the others. A test fails when a top level
+// 'unbox' ends the program before it's called.
+package tester
+
+import (
+	"bytes"
+	"cardboard/lexer/token"
+	"cardboard/object"
+	"cardboard/parser/ast"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Suffix of the names of test files
+const Suffix = "_test.cb"
+
+// Value of the program run for a test once the test has returned
+const called = "\x00tester: test called"
+
+// A test function, at the position of the identifier it's bound to
+type Test struct {
+	Name   string
+	Line   int
+	Column int
+}
+
+// Outcome of a test
+type Result struct {
+	Test
+
+	// Error the test failed with, nil when it passed
+	Err *object.Error
+
+	// Output of the run of the test
+	Output string
+}
+
+func (r Result) Passed() bool { return r.Err == nil }
+
+// IsTestName reports whether a binding of that name is a test
+func IsTestName(name string) bool {
+	if !strings.HasPrefix(name, "test") {
+		return false
+	}
+	rest := strings.TrimPrefix(name, "test")
+	r, _ := utf8.DecodeRuneInString(rest)
+	return rest == "" || !unicode.IsLower(r)
+}
+
+// Tests returns the tests of a program, in source order
+func Tests(program *ast.Program) []Test {
+	tests := []Test{}
+	for _, stmt := range program.Statements {
+		put, ok := stmt.(*ast.PutStatement)
+		if !ok || !IsTestName(put.NodeIdentifier.Value) {
+			continue
+		}
+		if _, ok := put.NodeExpression.(*ast.BoxExpression); !ok {
+			continue
+		}
+		tests = append(tests, Test{
+			Name:   put.NodeIdentifier.Value,
+			Line:   put.NodeIdentifier.NodeToken.Line,
+			Column: put.NodeIdentifier.NodeToken.Column,
+		})
+	}
+	return tests
+}
+
+// Run runs the tests of a program whose name matches filter, every test
+// when it's nil. Each test is a run of the program followed by a call of
+// the test, executed by run on a fresh environment.
+func Run(program *ast.Program, filter *regexp.Regexp, run func(program *ast.Program, out io.Writer) object.Object) []Result {
+	results := []Result{}
+	for _, test := range Tests(program) {
+		if filter != nil && !filter.MatchString(test.Name) {
+			continue
+		}
+
+		var out bytes.Buffer
+		result := Result{Test: test}
+		value := run(withCall(program, test), &out)
+		if err, ok := value.(*object.Error); ok {
+			result.Err = err
+		} else if str, ok := value.(*object.String); !ok || str.Value != called {
+			result.Err = notCalled(test)
+		}
+		result.Output = out.String()
+		results = append(results, result)
+	}
+	return results
+}
+
+// Error of a test the program unboxed before calling
+func notCalled(test Test) *object.Error {
+	return &object.Error{
+		Kind:    object.RUNTIME_ERROR,
+		Message: fmt.Sprintf("%s was never called, the program unboxed before.", test.Name),
+		Line:    test.Line,
+		Column:  test.Column,
+	}
+}
+
+// Returns the program followed by a call of a test, positioned at the
+// test so tracebacks show where it's defined, and by the called string
+func withCall(program *ast.Program, test Test) *ast.Program {
+	tok := token.Token{TokenType: token.IDENTIFIER, TokenLiteral: test.Name, Line: test.Line, Column: test.Column}
+	call := &ast.CallExpression{
+		NodeToken: tok,
+		Function:  &ast.Identifier{NodeToken: tok, Value: test.Name},
+	}
+
+	marker := &ast.StringLiteral{NodeToken: token.Token{TokenType: token.STRING, TokenLiteral: called, Line: test.Line, Column: test.Column}, Value: called}
+
+	stmts := make([]ast.Statement, 0, len(program.Statements)+2)
+	stmts = append(stmts, program.Statements...)
+	stmts = append(stmts, &ast.ExpressionStatement{NodeToken: tok, Expression: call})
+	stmts = append(stmts, &ast.ExpressionStatement{NodeToken: marker.NodeToken, Expression: marker})
+	return &ast.Program{Statements: stmts}
+}
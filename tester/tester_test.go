@@ -0,0 +1,151 @@
+package tester
+
+import (
+	"bytes"
+	"cardboard/conformance"
+	"cardboard/lexer"
+	"cardboard/parser"
+	"cardboard/parser/ast"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+const source = `put half = box(x) { x / 2 };
+
+put testHalf = box() {
+    assertEqual(half(10), 5);
+};
+
+put testOdd = box() {
+    show(half(7));
+    assertEqual(half(7), 4);
+};
+
+put testZero = box() {
+    put e = assertError(box() { 1 / 0 });
+    assertEqual(e.kind, "ZeroDivisionError");
+};
+
+put testing = box() { assert(0); };
+put test_arity = box(x) { x };
+put testValue = 5;
+`
+
+func TestIsTestName(t *testing.T) {
+	tests := map[string]bool{
+		"test":       true,
+		"testAdd":    true,
+		"test_add":   true,
+		"test2":      true,
+		"testing":    false,
+		"Test":       false,
+		"halfTest":   false,
+		"contested":  false,
+		"testéclair": false,
+		"testÉclair": true,
+	}
+
+	for name, expected := range tests {
+		if IsTestName(name) != expected {
+			t.Errorf("Test failed. Expected IsTestName(%q) to be %t", name, expected)
+		}
+	}
+}
+
+func TestTests(t *testing.T) {
+	expected := []Test{
+		{Name: "testHalf", Line: 3, Column: 5},
+		{Name: "testOdd", Line: 7, Column: 5},
+		{Name: "testZero", Line: 12, Column: 5},
+		{Name: "test_arity", Line: 18, Column: 5},
+	}
+
+	if tests := Tests(parse(t, source)); !reflect.DeepEqual(tests, expected) {
+		t.Fatalf("Test failed. Expected tests <%+v>. Got <%+v>", expected, tests)
+	}
+}
+
+func TestRun(t *testing.T) {
+	for _, backend := range conformance.Backends {
+		results := Run(parse(t, source), nil, backend.Run)
+
+		outcomes := []string{}
+		for _, result := range results {
+			outcome := result.Name + " passed"
+			if !result.Passed() {
+				outcome = result.Name + " failed: " + result.Err.Message
+			}
+			outcomes = append(outcomes, outcome)
+		}
+
+		expected := []string{
+			"testHalf passed",
+			"testOdd failed: Assertion failed: got 3, want 4.",
+			"testZero passed",
+			"test_arity failed: Wrong number of arguments. Expected 1. Got <0>",
+		}
+		if !reflect.DeepEqual(outcomes, expected) {
+			t.Errorf("Test failed. Expected %s outcomes <%q>. Got <%q>", backend.Name, expected, outcomes)
+		}
+	}
+}
+
+// A top level 'unbox' can't skip the call of a test
+func TestRunUnboxedProgram(t *testing.T) {
+	for _, backend := range conformance.Backends {
+		results := Run(parse(t, "put testBad = box() { assert(0); };\nunbox 1;"), nil, backend.Run)
+
+		expected := "testBad was never called, the program unboxed before."
+		if len(results) != 1 || results[0].Passed() || results[0].Err.Message != expected {
+			t.Errorf("Test failed. Expected testBad to fail on %s with %q. Got <%+v>", backend.Name, expected, results)
+		}
+	}
+}
+
+func TestRunFilter(t *testing.T) {
+	results := Run(parse(t, source), regexp.MustCompile("Half|Zero"), conformance.Backends[0].Run)
+
+	if len(results) != 2 || results[0].Name != "testHalf" || results[1].Name != "testZero" {
+		t.Fatalf("Test failed. Expected testHalf and testZero to run. Got <%+v>", results)
+	}
+}
+
+func TestWriteResults(t *testing.T) {
+	results := Run(parse(t, source), nil, conformance.Backends[0].Run)
+
+	var out bytes.Buffer
+	if err := WriteResults(&out, "half_test.cb", results[:2], true); err != nil {
+		t.Fatalf("Test failed. Error writing the results: %s", err)
+	}
+
+	expected := `--- PASS: testHalf
+--- FAIL: testOdd (half_test.cb:7:5)
+    3
+    half_test.cb:9:16: AssertionError: Assertion failed: got 3, want 4.
+    Traceback (most recent call last):
+      at 7:5, in <main>
+      at 9:16, in testOdd
+FAIL	half_test.cb	1 passed, 1 failed
+`
+	if out.String() != expected {
+		t.Errorf("Test failed. Expected results:\n%s\nGot:\n%s", expected, out.String())
+	}
+
+	out.Reset()
+	WriteResults(&out, "half_test.cb", nil, false)
+	if out.String() != "ok  \thalf_test.cb\t[no tests to run]\n" {
+		t.Errorf("Test failed. Expected no tests to run. Got <%s>", out.String())
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.CreateParser(lexer.CreateLexer(input))
+	program := p.ParseCardBoard()
+	if errs := p.GetErrors(); len(errs) > 0 {
+		t.Fatalf("Test failed. Parser errors for <%s>: %v", input, errs)
+	}
+	return program
+}
@@ -0,0 +1,180 @@
+// Package trace logs the evaluation of programs step by step: every node
+// evaluated with its result, every box call with its arguments and the
+// value it returns, and every binding made, indented by the depth of box
+// calls.
+//
+// Traces are text for people to read, or JSON lines, one event per line,
+// for tools to compare the traces of a script between versions.
+package trace
+
+import (
+	"cardboard/lexer/token"
+	"cardboard/object"
+	"cardboard/parser/ast"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Formats of traces
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Tracer is the hook of the evaluator writing the trace
+type Tracer struct {
+	out io.Writer
+
+	// Encoder of JSON lines, nil for text
+	json *json.Encoder
+
+	// Number of box calls running
+	depth int
+
+	// First error writing the trace, which stops it
+	err error
+}
+
+func New(out io.Writer, format string) (*Tracer, error) {
+	switch format {
+	case FormatText:
+		return &Tracer{out: out}, nil
+	case FormatJSON:
+		encoder := json.NewEncoder(out)
+		encoder.SetEscapeHTML(false)
+		return &Tracer{out: out, json: encoder}, nil
+	}
+	return nil, fmt.Errorf("Unknown trace format: <%s>. Expected %s or %s", format, FormatText, FormatJSON)
+}
+
+// Err returns the first error met writing the trace
+func (t *Tracer) Err() error { return t.err }
+
+// An event of the trace, as encoded in JSON lines
+type Event struct {
+	// node, call, bind or return
+	Event string `json:"event"`
+	Depth int    `json:"depth"`
+
+	// Type of the node evaluated, like "InfixExpression"
+	Kind string `json:"kind,omitempty"`
+
+	// Span of the node evaluated, position of the call or of the
+	// identifier bound
+	Start *ast.Span `json:"start,omitempty"`
+	End   *ast.Span `json:"end,omitempty"`
+
+	// Box called or returning, "<box>" when anonymous
+	Function  string  `json:"function,omitempty"`
+	Arguments []Value `json:"arguments,omitempty"`
+
+	// Identifier bound, and its value
+	Name  string `json:"name,omitempty"`
+	Value *Value `json:"value,omitempty"`
+
+	// Value of the node evaluated, or returned by the box
+	Result *Value `json:"result,omitempty"`
+
+	// The box returns by calling itself in tail position
+	TailCall bool `json:"tailCall,omitempty"`
+}
+
+type Value struct {
+	Type    string `json:"type"`
+	Inspect string `json:"inspect"`
+}
+
+func valueOf(obj object.Object) *Value {
+	if obj == nil {
+		return nil
+	}
+	return &Value{Type: string(obj.Type()), Inspect: obj.Inspect()}
+}
+
+func (v *Value) String() string {
+	// Keep each event on a line
+	return v.Type + " " + strings.ReplaceAll(v.Inspect, "\n", `\n`)
+}
+
+func span(s ast.Span) *ast.Span { return &s }
+
+func boxName(fn *object.Box) string {
+	if fn.Name == "" {
+		return "<box>"
+	}
+	return fn.Name
+}
+
+// Hook of the evaluator
+
+func (t *Tracer) Statement(stmt ast.Statement, env *object.Environment) {}
+
+func (t *Tracer) Node(node ast.Node, result object.Object, env *object.Environment) {
+	t.write(Event{
+		Event:  "node",
+		Kind:   reflect.TypeOf(node).Elem().Name(),
+		Start:  span(ast.Start(node)),
+		End:    span(ast.End(node)),
+		Result: valueOf(result),
+	})
+}
+
+func (t *Tracer) Call(fn *object.Box, call token.Token, env *object.Environment) {
+	args := []Value{}
+	for slot := range fn.ParameterList {
+		arg, _ := env.GetSlot(0, slot)
+		args = append(args, *valueOf(arg))
+	}
+	t.write(Event{
+		Event:     "call",
+		Start:     &ast.Span{Line: call.Line, Column: call.Column},
+		Function:  boxName(fn),
+		Arguments: args,
+	})
+	t.depth++
+}
+
+func (t *Tracer) Bind(ident *ast.Identifier, val object.Object, env *object.Environment) {
+	t.write(Event{Event: "bind", Start: span(ast.Start(ident)), Name: ident.Value, Value: valueOf(val)})
+}
+
+func (t *Tracer) Return(fn *object.Box, result object.Object) {
+	t.depth--
+	t.write(Event{Event: "return", Function: boxName(fn), Result: valueOf(result), TailCall: result == nil})
+}
+
+func (t *Tracer) write(ev Event) {
+	if t.err != nil {
+		return
+	}
+	ev.Depth = t.depth
+
+	if t.json != nil {
+		t.err = t.json.Encode(ev)
+		return
+	}
+	_, t.err = fmt.Fprintf(t.out, "%s%s\n", strings.Repeat("  ", ev.Depth), describe(ev))
+}
+
+// Text of an event
+func describe(ev Event) string {
+	switch ev.Event {
+	case "node":
+		return fmt.Sprintf("%d:%d-%d:%d %s -> %s", ev.Start.Line, ev.Start.Column, ev.End.Line, ev.End.Column, ev.Kind, ev.Result)
+	case "call":
+		args := []string{}
+		for idx := range ev.Arguments {
+			args = append(args, ev.Arguments[idx].String())
+		}
+		return fmt.Sprintf("call %s(%s) at %d:%d", ev.Function, strings.Join(args, ", "), ev.Start.Line, ev.Start.Column)
+	case "bind":
+		return fmt.Sprintf("bind %s = %s at %d:%d", ev.Name, ev.Value, ev.Start.Line, ev.Start.Column)
+	}
+	if ev.TailCall {
+		return fmt.Sprintf("return from %s by a tail call", ev.Function)
+	}
+	return fmt.Sprintf("return %s from %s", ev.Result, ev.Function)
+}
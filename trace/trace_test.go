@@ -0,0 +1,151 @@
+package trace
+
+import (
+	"bytes"
+	"cardboard/eval"
+	"cardboard/lexer"
+	"cardboard/object"
+	"cardboard/parser"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const script = `put count = box(n) {
+    try { 1 / n; } catch { unbox "done"; }
+    count(n - 1)
+};
+count(1);`
+
+func run(t *testing.T, source, format string) string {
+	p := parser.CreateParser(lexer.CreateLexer(source))
+	program := p.ParseCardBoard()
+	if errs := p.GetErrors(); len(errs) > 0 {
+		t.Fatalf("Test failed. Parser errors: %q", errs)
+	}
+
+	var out bytes.Buffer
+	tracer, err := New(&out, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := object.CreateEnvironment()
+	eval.SetHook(env, tracer)
+	if result := eval.Eval(program, env); result.Inspect() != "done" {
+		t.Fatalf("Test failed. Wrong result: %s", result.Inspect())
+	}
+	if tracer.Err() != nil {
+		t.Fatal(tracer.Err())
+	}
+	return out.String()
+}
+
+func TestText(t *testing.T) {
+	box := "FUNCTION box(n) => {try{(1/n)}catch{unbox \"done\";}count((n-1))}"
+	expected := []string{
+		"1:13-4:2 BoxExpression -> " + box,
+		"bind count = " + box + " at 1:5",
+		"1:1-4:2 PutStatement -> " + box,
+		"5:1-5:6 Identifier -> " + box,
+		"5:7-5:8 IntegerLiteral -> INTEGER 1",
+		"call count(INTEGER 1) at 5:6",
+		"  bind n = INTEGER 1 at 1:17",
+		"  2:11-2:12 IntegerLiteral -> INTEGER 1",
+		"  2:15-2:16 Identifier -> INTEGER 1",
+		"  2:11-2:16 InfixExpression -> INTEGER 1",
+		"  2:11-2:16 ExpressionStatement -> INTEGER 1",
+		"  2:9-2:19 BlockStatement -> INTEGER 1",
+		"  2:5-2:43 TryStatement -> INTEGER 1",
+		"  3:5-3:10 Identifier -> " + box,
+		"  3:11-3:12 Identifier -> INTEGER 1",
+		"  3:15-3:16 IntegerLiteral -> INTEGER 1",
+		"  3:11-3:16 InfixExpression -> INTEGER 0",
+		"return from count by a tail call",
+		"call count(INTEGER 0) at 5:6",
+		"  bind n = INTEGER 0 at 1:17",
+		"  2:11-2:12 IntegerLiteral -> INTEGER 1",
+		"  2:15-2:16 Identifier -> INTEGER 0",
+		"  2:11-2:16 InfixExpression -> ERROR Division By Zero: <1/0>",
+		"  2:11-2:16 ExpressionStatement -> ERROR Division By Zero: <1/0>",
+		"  2:9-2:19 BlockStatement -> ERROR Division By Zero: <1/0>",
+		"  2:34-2:40 StringLiteral -> STRING done",
+		"  2:28-2:40 UnboxStatement -> UNBOX_OBJ done",
+		"  2:26-2:43 BlockStatement -> UNBOX_OBJ done",
+		"  2:5-2:43 TryStatement -> UNBOX_OBJ done",
+		"return STRING done from count",
+		"3:5-3:17 CallExpression -> STRING done",
+		"3:5-3:17 ExpressionStatement -> STRING done",
+		"5:1-5:9 CallExpression -> STRING done",
+		"5:1-5:9 ExpressionStatement -> STRING done",
+		"1:1-5:9 Program -> STRING done",
+	}
+
+	got := strings.Split(strings.TrimSuffix(run(t, script, FormatText), "\n"), "\n")
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Test failed. Wrong trace.\nwant=%q\ngot=%q", expected, got)
+	}
+}
+
+// Calls in tail position are made by a loop of the evaluator, their nodes
+// are traced once the last call returns
+func TestTailCalls(t *testing.T) {
+	source := `put count = box(n) {
+    try { 1 / n; } catch { unbox "done"; }
+    unbox count(n - 1);
+};
+count(2);`
+
+	var nodes []string
+	for _, line := range strings.Split(run(t, source, FormatText), "\n") {
+		if strings.HasPrefix(line, "3:") {
+			nodes = append(nodes, line)
+		}
+	}
+	expected := []string{
+		"3:11-3:23 CallExpression -> STRING done",
+		"3:5-3:23 UnboxStatement -> UNBOX_OBJ done",
+		"3:11-3:23 CallExpression -> STRING done",
+		"3:5-3:23 UnboxStatement -> UNBOX_OBJ done",
+	}
+	if strings.Join(nodes, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Test failed. Wrong tail call nodes.\nwant=%q\ngot=%q", expected, nodes)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	lines := strings.Split(strings.TrimSuffix(run(t, script, FormatJSON), "\n"), "\n")
+
+	events := []Event{}
+	for _, line := range lines {
+		var ev Event
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("Test failed. Invalid line %s: %s", line, err)
+		}
+		events = append(events, ev)
+	}
+
+	call := events[5]
+	if call.Event != "call" || call.Function != "count" || len(call.Arguments) != 1 || call.Arguments[0] != (Value{Type: "INTEGER", Inspect: "1"}) {
+		t.Errorf("Test failed. Wrong call event: %s", lines[5])
+	}
+	bind := events[6]
+	if bind.Event != "bind" || bind.Depth != 1 || bind.Name != "n" || *bind.Value != (Value{Type: "INTEGER", Inspect: "1"}) {
+		t.Errorf("Test failed. Wrong bind event: %s", lines[6])
+	}
+	if tail := events[17]; tail.Event != "return" || !tail.TailCall || tail.Result != nil {
+		t.Errorf("Test failed. Wrong tail call event: %s", lines[17])
+	}
+	last := events[len(events)-1]
+	if last.Event != "node" || last.Kind != "Program" || last.Start.Line != 1 || last.End.Column != 9 || last.Result.Inspect != "done" {
+		t.Errorf("Test failed. Wrong last event: %s", lines[len(lines)-1])
+	}
+	if !strings.Contains(lines[0], `"inspect":"box(n) => {`) {
+		t.Errorf("Test failed. Expected values to be left unescaped. Got %s", lines[0])
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "xml"); err == nil || err.Error() != "Unknown trace format: <xml>. Expected text or json" {
+		t.Errorf("Test failed. Expected an unknown format error. Got <%v>", err)
+	}
+}
@@ -0,0 +1,390 @@
+package types
+
+import (
+	"cardboard/lexer/token"
+	"cardboard/parser/ast"
+	"cardboard/resolver"
+)
+
+// Check resolves the program and returns the type errors found in it,
+// sorted by position. Diagnostics of the resolver aren't included.
+//
+// Annotated bindings and parameters have their annotated type. Bindings
+// made once without annotation take the type of the value they're bound
+// to, catch parameters are exceptions, and unannotated parameters and
+// bindings made more than once are Any. Boxes return their annotated
+// type, or the type all their returned values agree on.
+func Check(program *ast.Program) []resolver.Diagnostic {
+	resolver.Resolve(program)
+
+	c := &checker{signatures: map[*ast.BoxExpression]*Box{}}
+	c.body(program.Statements, nil, nil)
+	return c.sorted()
+}
+
+// Type of a binding of a scope
+type binding struct {
+	typ Type
+
+	// The type comes from an annotation
+	declared bool
+
+	// Number of parameters, puts and catch parameters making the binding
+	count int
+}
+
+// Bindings made by a box body, or by the program, by slot
+type scope struct {
+	outer    *scope
+	bindings map[int]*binding
+}
+
+// Box whose body is being checked
+type boxContext struct {
+	// Annotated return type, nil when unannotated
+	declared Type
+
+	// Types of the values the box returns
+	returns []Type
+}
+
+type checker struct {
+	reporter
+	scope      *scope
+	box        *boxContext
+	signatures map[*ast.BoxExpression]*Box
+}
+
+// Checks the statements of a box body, or of the program, given the
+// annotated types of the parameters (nil when unannotated).
+// Returns the type of the value of the last statement, and whether the
+// end of the body can be reached.
+func (c *checker) body(stmts []ast.Statement, params []*ast.Identifier, paramTypes []Type) (Type, bool) {
+	c.scope = &scope{outer: c.scope, bindings: map[int]*binding{}}
+	defer func() { c.scope = c.scope.outer }()
+
+	for idx, param := range params {
+		b := c.slot(param)
+		b.count++
+		if paramTypes[idx] != nil {
+			b.typ, b.declared = paramTypes[idx], true
+		}
+	}
+	c.declareBindings(stmts)
+
+	return c.statements(stmts)
+}
+
+// Binding of the current scope made by an identifier. An identifier the
+// resolver didn't see makes a binding of its own, of type Any.
+func (c *checker) slot(ident *ast.Identifier) *binding {
+	if ident.Resolution == nil {
+		return &binding{typ: Any}
+	}
+	slot := ident.Resolution.Slot
+	b, ok := c.scope.bindings[slot]
+	if !ok {
+		b = &binding{typ: Any}
+		c.scope.bindings[slot] = b
+	}
+	return b
+}
+
+// Counts the bindings made by the statements of a body, and records
+// their annotated types, before checking them
+func (c *checker) declareBindings(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.PutStatement:
+			b := c.slot(&stmt.NodeIdentifier)
+			b.count++
+			if stmt.Type != nil && !b.declared {
+				b.typ, b.declared = c.annotation(stmt.Type), true
+			}
+		case *ast.TryStatement:
+			c.declareBindings(stmt.Body.Statements)
+			if stmt.CatchParameter != nil {
+				b := c.slot(stmt.CatchParameter)
+				b.count++
+				if !b.declared {
+					b.typ = Exception
+				}
+			}
+			if stmt.Catch != nil {
+				c.declareBindings(stmt.Catch.Statements)
+			}
+			if stmt.Finally != nil {
+				c.declareBindings(stmt.Finally.Statements)
+			}
+		}
+	}
+}
+
+// Type of a binding an identifier refers to
+func (c *checker) lookup(ident *ast.Identifier) Type {
+	r := ident.Resolution
+	if r == nil {
+		if typ, ok := builtins[ident.Value]; ok {
+			return typ
+		}
+		return Any
+	}
+
+	s := c.scope
+	for depth := 0; depth < r.Depth && s != nil; depth++ {
+		s = s.outer
+	}
+	if s == nil {
+		return Any
+	}
+
+	b, ok := s.bindings[r.Slot]
+	if !ok || (!b.declared && b.count > 1) {
+		return Any
+	}
+	return b.typ
+}
+
+// Checks a list of statements, returning the type of the value of the
+// last one, and whether the end of the list can be reached.
+func (c *checker) statements(stmts []ast.Statement) (Type, bool) {
+	var result Type = Null
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.UnboxStatement:
+			typ := c.expression(stmt.NodeExpression)
+			c.returns(stmt.NodeToken, typ)
+			return typ, false
+		case *ast.ThrowStatement:
+			c.expression(stmt.NodeExpression)
+			return Any, false
+		default:
+			result = c.statement(stmt)
+		}
+	}
+	return result, true
+}
+
+func (c *checker) statement(stmt ast.Statement) Type {
+	switch stmt := stmt.(type) {
+	case *ast.PutStatement:
+		return c.putStatement(stmt)
+	case *ast.ExpressionStatement:
+		return c.expression(stmt.Expression)
+	case *ast.TryStatement:
+		c.statements(stmt.Body.Statements)
+		if stmt.Catch != nil {
+			c.statements(stmt.Catch.Statements)
+		}
+		if stmt.Finally != nil {
+			c.statements(stmt.Finally.Statements)
+		}
+	}
+	return Any
+}
+
+func (c *checker) putStatement(stmt *ast.PutStatement) Type {
+	b := c.slot(&stmt.NodeIdentifier)
+	inferred := !b.declared && b.count == 1
+
+	// Boxes can call themselves, their signature is known before their body is checked
+	if box, ok := stmt.NodeExpression.(*ast.BoxExpression); ok && inferred {
+		b.typ = c.signature(box)
+	}
+
+	typ := c.expression(stmt.NodeExpression)
+	if b.declared && !Compatible(b.typ, typ) {
+		c.report(stmt.NodeIdentifier.NodeToken, "Type Mismatch: %s is declared <%s>. Got <%s>", stmt.NodeIdentifier.Value, b.typ, typ)
+	}
+	if inferred {
+		b.typ = typ
+	}
+	return typ
+}
+
+// Records a value returned by the box being checked
+func (c *checker) returns(tok token.Token, typ Type) {
+	if c.box == nil {
+		return
+	}
+	if c.box.declared != nil && !Compatible(c.box.declared, typ) {
+		c.report(tok, "Type Mismatch: box returns <%s>. Got <%s>", c.box.declared, typ)
+	}
+	c.box.returns = append(c.box.returns, typ)
+}
+
+func (c *checker) expression(expr ast.Expression) Type {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.StringLiteral:
+		return String
+	case *ast.Identifier:
+		return c.lookup(expr)
+	case *ast.PrefixExpression:
+		return c.prefixExpression(expr)
+	case *ast.InfixExpression:
+		return c.infixExpression(expr)
+	case *ast.BoxExpression:
+		return c.boxExpression(expr)
+	case *ast.CallExpression:
+		return c.callExpression(expr)
+	case *ast.MemberExpression:
+		return c.memberExpression(expr)
+	}
+	return Any
+}
+
+func (c *checker) prefixExpression(expr *ast.PrefixExpression) Type {
+	operand := c.expression(expr.Right)
+	if !Compatible(Int, operand) {
+		c.report(expr.NodeToken, "Type error. Can't use <%s> Operator with <%s> Type.", expr.Operator, operand)
+		return Any
+	}
+	return Int
+}
+
+func (c *checker) infixExpression(expr *ast.InfixExpression) Type {
+	left := c.expression(expr.Left)
+	right := c.expression(expr.Right)
+
+	// Strings can only be concatenated
+	if expr.Operator == "+" && (left == String || right == String) && Compatible(left, right) {
+		return String
+	}
+	if !Compatible(Int, left) || !Compatible(Int, right) {
+		c.report(expr.NodeToken, "Type Mismatch: <%s><%s><%s>", left, expr.Operator, right)
+		return Any
+	}
+	if expr.Operator == "+" && (left == Any || right == Any) {
+		return Any
+	}
+	return Int
+}
+
+// Type of a box from its annotations, unannotated types being Any
+func (c *checker) signature(box *ast.BoxExpression) *Box {
+	if typ, ok := c.signatures[box]; ok {
+		return typ
+	}
+
+	typ := &Box{Return: Any}
+	for idx := range box.ParameterList {
+		var param Type = Any
+		if annotation := box.ParameterType(idx); annotation != nil {
+			param = c.annotation(annotation)
+		}
+		typ.Params = append(typ.Params, param)
+	}
+	if box.ReturnType != nil {
+		typ.Return = c.annotation(box.ReturnType)
+	}
+
+	c.signatures[box] = typ
+	return typ
+}
+
+func (c *checker) boxExpression(box *ast.BoxExpression) Type {
+	signature := c.signature(box)
+
+	outer := c.box
+	c.box = &boxContext{}
+	if box.ReturnType != nil {
+		c.box.declared = signature.Return
+	}
+
+	declared := make([]Type, len(box.ParameterList))
+	for idx := range box.ParameterList {
+		if box.ParameterType(idx) != nil {
+			declared[idx] = signature.Params[idx]
+		}
+	}
+
+	last, reached := c.body(box.Body.Statements, box.ParameterList, declared)
+	if reached {
+		c.returns(lastToken(box), last)
+	}
+
+	returns := c.box.returns
+	c.box = outer
+
+	if box.ReturnType != nil {
+		return signature
+	}
+	return &Box{Params: signature.Params, Return: agreed(returns)}
+}
+
+// Position of the value a box returns by reaching the end of its body
+func lastToken(box *ast.BoxExpression) token.Token {
+	stmts := box.Body.Statements
+	if len(stmts) == 0 {
+		return box.Body.NodeToken
+	}
+	switch stmt := stmts[len(stmts)-1].(type) {
+	case *ast.PutStatement:
+		return stmt.NodeToken
+	case *ast.ExpressionStatement:
+		return stmt.NodeToken
+	case *ast.TryStatement:
+		return stmt.NodeToken
+	}
+	return box.Body.NodeToken
+}
+
+// Type all the given types agree on, or Any
+func agreed(types []Type) Type {
+	if len(types) == 0 {
+		return Any
+	}
+	for _, typ := range types[1:] {
+		if !Equal(types[0], typ) {
+			return Any
+		}
+	}
+	return types[0]
+}
+
+func (c *checker) callExpression(call *ast.CallExpression) Type {
+	function := c.expression(call.Function)
+	args := []Type{}
+	for _, arg := range call.Arguments {
+		args = append(args, c.expression(arg))
+	}
+
+	if function == Any {
+		return Any
+	}
+	box, ok := function.(*Box)
+	if !ok {
+		c.report(call.NodeToken, "Type Mismatch Error. Expected Function. Got <%s>", function)
+		return Any
+	}
+	if len(box.Params) != len(args) {
+		c.report(call.NodeToken, "Wrong number of arguments. Expected %d. Got <%d>", len(box.Params), len(args))
+		return box.Return
+	}
+	for idx, arg := range args {
+		if !Compatible(box.Params[idx], arg) {
+			c.report(call.NodeToken, "Type Mismatch: argument %d expects <%s>. Got <%s>", idx+1, box.Params[idx], arg)
+		}
+	}
+	return box.Return
+}
+
+func (c *checker) memberExpression(expr *ast.MemberExpression) Type {
+	object := c.expression(expr.Object)
+	if object == Any {
+		return Any
+	}
+	if object != Exception {
+		c.report(expr.NodeToken, "Type error. <%s> Type has no properties.", object)
+		return Any
+	}
+
+	property, ok := exceptionProperties[expr.Property.Value]
+	if !ok {
+		c.report(expr.NodeToken, "Unknown property: %s.", expr.Property.Value)
+		return Any
+	}
+	return property
+}
@@ -0,0 +1,131 @@
+package types
+
+import (
+	"cardboard/lexer"
+	"cardboard/parser"
+	"cardboard/parser/ast"
+	"cardboard/resolver"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		// Unannotated scripts are inferred where they can be
+		{"put a = 1; a + 2;", []string{}},
+		{`put a = "a"; a + "b";`, []string{}},
+		{`put a = 1; a + "b";`, []string{"1:14: error: Type Mismatch: <int><+><string>"}},
+		{`-"a";`, []string{"1:1: error: Type error. Can't use <-> Operator with <string> Type."}},
+		{`put f = box() { "s" }; f() * 2;`, []string{"1:28: error: Type Mismatch: <string><*><int>"}},
+		{"put a = 5; a(1);", []string{"1:13: error: Type Mismatch Error. Expected Function. Got <int>"}},
+		{"put f = box(a) { a }; f(1, 2);", []string{"1:24: error: Wrong number of arguments. Expected 1. Got <2>"}},
+		{"put a = 5; a.kind;", []string{"1:13: error: Type error. <int> Type has no properties."}},
+		{"try { 1; } catch (e) { e.size; }", []string{"1:25: error: Unknown property: size."}},
+		{"try { 1; } catch (e) { e.line + e.column; e.kind + e.message; }", []string{}},
+		// Nothing is known about parameters, or bindings made more than once
+		{"box(a, b) { a + b; -a; a(b); a.kind }", []string{}},
+		{`put a = 1; put a = "s"; a + "b";`, []string{}},
+		{"try { 1; } catch (e) { e.value + 1; }", []string{}},
+		{`put f = box() { g() }; put g = box() { "s" }; f() + 1;`, []string{}},
+		// Annotations
+		{"put a: int = 1; put b: string = a;", []string{"1:21: error: Type Mismatch: b is declared <string>. Got <int>"}},
+		{`put a: int = 1; put a = "s";`, []string{"1:21: error: Type Mismatch: a is declared <int>. Got <string>"}},
+		{"put a: any = 1; a(2);", []string{}},
+		{"put a: foo = 1;", []string{"1:8: error: Unknown type: foo."}},
+		{
+			`put add = box(a: int, b: int) -> int { a + b }; add(1, "2");`,
+			[]string{"1:52: error: Type Mismatch: argument 2 expects <int>. Got <string>"},
+		},
+		{`box(a: string) { -a }`, []string{"1:18: error: Type error. Can't use <-> Operator with <string> Type."}},
+		{`box() -> int { "s" }`, []string{"1:16: error: Type Mismatch: box returns <int>. Got <string>"}},
+		{`box() -> int { unbox "s"; }`, []string{"1:16: error: Type Mismatch: box returns <int>. Got <string>"}},
+		{`box() -> int { throw "s"; }`, []string{}},
+		{
+			"put twice = box(f: box(int) -> int, x: int) -> int { f(f(x)) }; twice(box(s: string) { 1 }, 1);",
+			[]string{"1:70: error: Type Mismatch: argument 1 expects <box(int) -> int>. Got <box(string) -> int>"},
+		},
+		{"put twice = box(f: box(int) -> int, x: int) -> int { f(f(x)) }; twice(box(n) { n }, 1);", []string{}},
+		// Returned types are inferred from every returned value
+		{
+			"put f = box(n) { try { 1 / n; } catch { unbox 1; } n * f(n - 1) }; put s: string = f(3);",
+			[]string{"1:72: error: Type Mismatch: s is declared <string>. Got <int>"},
+		},
+		{`put f = box(n) { try { 1 / n; } catch { unbox "s"; } 1 }; f(1) + 1; f(1) + "s";`, []string{}},
+		{"put f = box() { }; f() + 1;", []string{"1:24: error: Type Mismatch: <null><+><int>"}},
+		// Builtins
+		{`assert(1); assertEqual(1, "1"); assertError(box() { 1 / 0 }).kind + "";`, []string{}},
+		{"assertEqual(1);", []string{"1:12: error: Wrong number of arguments. Expected 2. Got <1>"}},
+		{"assert(1) + 1;", []string{"1:11: error: Type Mismatch: <null><+><int>"}},
+		{
+			"assertError(box(x) { x });",
+			[]string{"1:12: error: Type Mismatch: argument 1 expects <box() -> any>. Got <box(any) -> any>"},
+		},
+		{"put assert = 1; assert + 1;", []string{}},
+	}
+
+	for _, tt := range tests {
+		diagnostics := Check(parse(t, tt.input))
+
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("Test failed. Expected %d diagnostics for <%s>. Got <%v>", len(tt.expected), tt.input, diagnostics)
+			continue
+		}
+
+		for idx, diagnostic := range diagnostics {
+			if diagnostic.String() != tt.expected[idx] {
+				t.Errorf("Test failed. Expected diagnostic %q for <%s>. Got <%s>", tt.expected[idx], tt.input, diagnostic)
+			}
+		}
+	}
+}
+
+// Identifiers the resolver didn't see don't share the binding of slot 0
+func TestUnresolvedSlot(t *testing.T) {
+	program := parse(t, "put a = 1; put b = \"b\";")
+	resolver.Resolve(program)
+	program.Statements[1].(*ast.PutStatement).NodeIdentifier.Resolution = nil
+
+	c := &checker{signatures: map[*ast.BoxExpression]*Box{}, scope: &scope{bindings: map[int]*binding{}}}
+	c.declareBindings(program.Statements)
+	c.statements(program.Statements)
+
+	a := c.slot(&program.Statements[0].(*ast.PutStatement).NodeIdentifier)
+	b := c.slot(&program.Statements[1].(*ast.PutStatement).NodeIdentifier)
+	if a == b || a.typ != Int || b.typ != Any {
+		t.Fatalf("Test failed. Expected a of type int and b of type any. Got <%s> and <%s>", a.typ, b.typ)
+	}
+}
+
+func TestCompatible(t *testing.T) {
+	tests := []struct {
+		expected Type
+		got      Type
+		result   bool
+	}{
+		{Int, Int, true},
+		{Int, String, false},
+		{Int, Any, true},
+		{Any, String, true},
+		{&Box{Params: []Type{Int}, Return: Int}, &Box{Params: []Type{Any}, Return: Int}, true},
+		{&Box{Params: []Type{Int}, Return: Int}, &Box{Params: []Type{Int, Int}, Return: Int}, false},
+		{&Box{Params: []Type{}, Return: Int}, &Box{Params: []Type{}, Return: String}, false},
+		{&Box{Params: []Type{}, Return: Int}, Int, false},
+	}
+
+	for _, tt := range tests {
+		if Compatible(tt.expected, tt.got) != tt.result {
+			t.Errorf("Test failed. Expected Compatible(%s, %s) to be %t.", tt.expected, tt.got, tt.result)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.CreateParser(lexer.CreateLexer(input))
+	program := p.ParseCardBoard()
+	if errs := p.GetErrors(); len(errs) > 0 {
+		t.Fatalf("Test failed. Parser errors for <%s>: %v", input, errs)
+	}
+	return program
+}
@@ -0,0 +1,746 @@
+package types
+
+import (
+	"bytes"
+	"cardboard/lexer/token"
+	"cardboard/parser/ast"
+	"cardboard/resolver"
+	"fmt"
+	"sort"
+)
+
+// Type variable, standing for a type inference hasn't found yet
+type Var struct {
+	id int
+
+	// Type the variable was found to be, nil while unknown
+	instance Type
+
+	// The variable is an operand of '+', so it can only be int or string
+	addable bool
+}
+
+func (v *Var) String() string { return fmt.Sprintf("t%d", v.id) }
+
+// Inferred type of a box expression
+type Signature struct {
+	// Name the box is bound to with 'put', "<box>" when anonymous
+	Name string
+
+	// Position of the box expression
+	Line   int
+	Column int
+
+	Type Type
+}
+
+// String renders the signature, naming its type variables a, b, c...
+// Variables standing for operands of '+' are listed as int or string.
+func (s Signature) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", s.Line, s.Column, s.Name, s.TypeString())
+}
+
+// TypeString renders the type of the signature the way String does,
+// without the position and name: "box(a, a) -> a where a: int | string".
+func (s Signature) TypeString() string {
+	n := &namer{names: map[*Var]string{}}
+	out := n.format(s.Type)
+
+	constraints := []string{}
+	for _, v := range n.order {
+		if v.addable {
+			constraints = append(constraints, n.names[v]+": int | string")
+		}
+	}
+	for idx, constraint := range constraints {
+		if idx == 0 {
+			out += " where "
+		} else {
+			out += ", "
+		}
+		out += constraint
+	}
+	return out
+}
+
+// Infer infers the most general type of every box expression of the
+// program, Hindley-Milner style. Unlike Check, nothing is left unknown:
+// parameters take the type of their uses, and boxes bound once with 'put'
+// are generic, each use of them getting its own instance of their type.
+// Annotations are honoured, 'any' standing for a type to infer.
+//
+// Returns the signatures of the boxes sorted by position, and the type
+// errors found in the program. Diagnostics of the resolver aren't included.
+func Infer(program *ast.Program) ([]Signature, []resolver.Diagnostic) {
+	c := infer(program)
+
+	signatures := []Signature{}
+	for _, box := range c.boxes {
+		signatures = append(signatures, Signature{
+			Name:   box.name,
+			Line:   box.expr.NodeToken.Line,
+			Column: box.expr.NodeToken.Column,
+			Type:   c.resolve(box.typ),
+		})
+	}
+	return sortSignatures(signatures), c.sorted()
+}
+
+// InferBindings infers the types of the program like Infer, and returns
+// the type of every binding instead, positioned at the identifier first
+// making it: 'put' bindings, parameters and catch parameters. Bindings
+// that are generic have type variables, each use getting its own instance.
+func InferBindings(program *ast.Program) []Signature {
+	c := infer(program)
+
+	signatures := []Signature{}
+	for _, binding := range c.bindings {
+		signatures = append(signatures, Signature{
+			Name:   binding.ident.Value,
+			Line:   binding.ident.NodeToken.Line,
+			Column: binding.ident.NodeToken.Column,
+			Type:   c.resolve(binding.entry.typ),
+		})
+	}
+	return sortSignatures(signatures)
+}
+
+func infer(program *ast.Program) *inferrer {
+	resolver.Resolve(program)
+
+	c := &inferrer{names: map[*ast.BoxExpression]string{}}
+	c.body(program.Statements, nil, nil)
+	return c
+}
+
+func sortSignatures(signatures []Signature) []Signature {
+	sort.SliceStable(signatures, func(i, j int) bool {
+		a, b := signatures[i], signatures[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return signatures
+}
+
+// Type of a binding of a scope
+type entry struct {
+	typ Type
+
+	// Variables of the type each use of the binding gets its own instance of
+	quantified []*Var
+
+	// Number of parameters, puts and catch parameters making the binding
+	count int
+}
+
+// Bindings made by a box body, or by the program, by slot
+type inferScope struct {
+	outer    *inferScope
+	bindings map[int]*entry
+}
+
+type inferredBox struct {
+	expr *ast.BoxExpression
+	name string
+	typ  Type
+}
+
+type inferredBinding struct {
+	ident *ast.Identifier
+	entry *entry
+}
+
+type inferrer struct {
+	reporter
+	scope *inferScope
+
+	// Type returned by the box being inferred, nil at the top level
+	returns Type
+
+	nextVar int
+
+	// Undoes the bindings of variables, to try unifications without
+	// keeping their effects when they fail
+	trail []func()
+
+	// Names boxes are bound to, set before inferring them
+	names map[*ast.BoxExpression]string
+	boxes []inferredBox
+
+	// Every binding, with the identifier first making it
+	bindings []inferredBinding
+}
+
+func (c *inferrer) fresh() *Var {
+	c.nextVar++
+	return &Var{id: c.nextVar}
+}
+
+// Checks the statements of a box body, or of the program, given the
+// types of the parameters. Returns the type of the value of the last
+// statement, and whether the end of the body can be reached.
+func (c *inferrer) body(stmts []ast.Statement, params []*ast.Identifier, paramTypes []Type) (Type, bool) {
+	c.scope = &inferScope{outer: c.scope, bindings: map[int]*entry{}}
+	defer func() { c.scope = c.scope.outer }()
+
+	for idx, param := range params {
+		e := c.slot(param)
+		e.count++
+		c.unify(e.typ, paramTypes[idx])
+	}
+	c.declareBindings(stmts)
+
+	return c.statements(stmts)
+}
+
+// Binding of the current scope made by an identifier. An identifier the
+// resolver didn't see makes a binding of its own, of a new type variable.
+func (c *inferrer) slot(ident *ast.Identifier) *entry {
+	if ident.Resolution == nil {
+		return &entry{typ: c.fresh()}
+	}
+	slot := ident.Resolution.Slot
+	e, ok := c.scope.bindings[slot]
+	if !ok {
+		e = &entry{typ: c.fresh()}
+		c.scope.bindings[slot] = e
+		c.bindings = append(c.bindings, inferredBinding{ident: ident, entry: e})
+	}
+	return e
+}
+
+func (c *inferrer) declareBindings(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.PutStatement:
+			e := c.slot(&stmt.NodeIdentifier)
+			e.count++
+			if stmt.Type != nil {
+				declared := c.annotated(stmt.Type)
+				if !c.unify(e.typ, declared) {
+					c.mismatch(stmt.NodeIdentifier.NodeToken, "Type Mismatch: %s is declared <%s>. Got <%s>", stmt.NodeIdentifier.Value, declared, e.typ)
+				}
+			}
+		case *ast.TryStatement:
+			c.declareBindings(stmt.Body.Statements)
+			if stmt.CatchParameter != nil {
+				e := c.slot(stmt.CatchParameter)
+				e.count++
+				if !c.unify(e.typ, Exception) {
+					c.mismatch(stmt.CatchParameter.NodeToken, "Type Mismatch: %s is <%s>. Got <%s>", stmt.CatchParameter.Value, e.typ, Exception)
+				}
+			}
+			if stmt.Catch != nil {
+				c.declareBindings(stmt.Catch.Statements)
+			}
+			if stmt.Finally != nil {
+				c.declareBindings(stmt.Finally.Statements)
+			}
+		}
+	}
+}
+
+// Type named by an annotation, with a new variable for each 'any'
+func (c *inferrer) annotated(annotation ast.Type) Type {
+	return c.replaceAny(c.annotation(annotation))
+}
+
+func (c *inferrer) replaceAny(typ Type) Type {
+	switch typ := typ.(type) {
+	case *Box:
+		box := &Box{Return: c.replaceAny(typ.Return)}
+		for _, param := range typ.Params {
+			box.Params = append(box.Params, c.replaceAny(param))
+		}
+		return box
+	}
+	if typ == Any {
+		return c.fresh()
+	}
+	return typ
+}
+
+// Type of a binding an identifier refers to
+func (c *inferrer) lookup(ident *ast.Identifier) Type {
+	r := ident.Resolution
+	if r == nil {
+		if typ, ok := builtins[ident.Value]; ok {
+			return c.replaceAny(typ)
+		}
+		return c.fresh()
+	}
+
+	s := c.scope
+	for depth := 0; depth < r.Depth && s != nil; depth++ {
+		s = s.outer
+	}
+	if s == nil {
+		return c.fresh()
+	}
+
+	e, ok := s.bindings[r.Slot]
+	if !ok {
+		return c.fresh()
+	}
+	return c.instantiate(e)
+}
+
+// Type of a use of a binding, with new variables for its quantified ones
+func (c *inferrer) instantiate(e *entry) Type {
+	if len(e.quantified) == 0 {
+		return e.typ
+	}
+
+	vars := map[*Var]*Var{}
+	for _, v := range e.quantified {
+		instance := c.fresh()
+		instance.addable = v.addable
+		vars[v] = instance
+	}
+	return substitute(e.typ, vars)
+}
+
+func substitute(typ Type, vars map[*Var]*Var) Type {
+	switch typ := prune(typ).(type) {
+	case *Var:
+		if instance, ok := vars[typ]; ok {
+			return instance
+		}
+		return typ
+	case *Box:
+		box := &Box{Return: substitute(typ.Return, vars)}
+		for _, param := range typ.Params {
+			box.Params = append(box.Params, substitute(param, vars))
+		}
+		return box
+	default:
+		return typ
+	}
+}
+
+// Quantifies the variables of the type of a binding that no other
+// binding in scope refers to
+func (c *inferrer) generalize(e *entry) {
+	bound := map[*Var]bool{}
+	for s := c.scope; s != nil; s = s.outer {
+		for _, other := range s.bindings {
+			if other == e {
+				continue
+			}
+			quantified := map[*Var]bool{}
+			for _, v := range other.quantified {
+				quantified[v] = true
+			}
+			for _, v := range freeVars(other.typ, nil) {
+				if !quantified[v] {
+					bound[v] = true
+				}
+			}
+		}
+	}
+	if c.returns != nil {
+		for _, v := range freeVars(c.returns, nil) {
+			bound[v] = true
+		}
+	}
+
+	for _, v := range freeVars(e.typ, nil) {
+		if !bound[v] {
+			e.quantified = append(e.quantified, v)
+		}
+	}
+}
+
+// Appends the unknown variables of a type, in order of appearance
+func freeVars(typ Type, vars []*Var) []*Var {
+	switch typ := prune(typ).(type) {
+	case *Var:
+		for _, v := range vars {
+			if v == typ {
+				return vars
+			}
+		}
+		return append(vars, typ)
+	case *Box:
+		for _, param := range typ.Params {
+			vars = freeVars(param, vars)
+		}
+		return freeVars(typ.Return, vars)
+	}
+	return vars
+}
+
+// Follows the variables found to be other types
+func prune(typ Type) Type {
+	for {
+		v, ok := typ.(*Var)
+		if !ok || v.instance == nil {
+			return typ
+		}
+		typ = v.instance
+	}
+}
+
+// Type with every variable found to be another type replaced by it
+func (c *inferrer) resolve(typ Type) Type {
+	switch typ := prune(typ).(type) {
+	case *Box:
+		box := &Box{Return: c.resolve(typ.Return)}
+		for _, param := range typ.Params {
+			box.Params = append(box.Params, c.resolve(param))
+		}
+		return box
+	default:
+		return typ
+	}
+}
+
+// Makes two types the same type, binding their variables.
+// Returns false when they can't be, leaving them as they were.
+func (c *inferrer) unify(a Type, b Type) bool {
+	mark := len(c.trail)
+	if c.unifyTypes(a, b) {
+		return true
+	}
+	c.undo(mark)
+	return false
+}
+
+func (c *inferrer) undo(mark int) {
+	for idx := len(c.trail) - 1; idx >= mark; idx-- {
+		c.trail[idx]()
+	}
+	c.trail = c.trail[:mark]
+}
+
+func (c *inferrer) unifyTypes(a Type, b Type) bool {
+	a, b = prune(a), prune(b)
+	if a == b {
+		return true
+	}
+	if v, ok := a.(*Var); ok {
+		return c.bind(v, b)
+	}
+	if v, ok := b.(*Var); ok {
+		return c.bind(v, a)
+	}
+
+	aBox, ok := a.(*Box)
+	if !ok {
+		return false
+	}
+	bBox, ok := b.(*Box)
+	if !ok || len(aBox.Params) != len(bBox.Params) {
+		return false
+	}
+	for idx, param := range aBox.Params {
+		if !c.unifyTypes(param, bBox.Params[idx]) {
+			return false
+		}
+	}
+	return c.unifyTypes(aBox.Return, bBox.Return)
+}
+
+func (c *inferrer) bind(v *Var, typ Type) bool {
+	for _, free := range freeVars(typ, nil) {
+		if free == v {
+			return false
+		}
+	}
+
+	if v.addable {
+		if other, ok := typ.(*Var); ok {
+			if !other.addable {
+				other.addable = true
+				c.trail = append(c.trail, func() { other.addable = false })
+			}
+		} else if typ != Int && typ != String {
+			return false
+		}
+	}
+
+	v.instance = typ
+	c.trail = append(c.trail, func() { v.instance = nil })
+	return true
+}
+
+// Requires a type to be int or string
+func (c *inferrer) addable(typ Type) bool {
+	switch typ := prune(typ).(type) {
+	case *Var:
+		if !typ.addable {
+			typ.addable = true
+			c.trail = append(c.trail, func() { typ.addable = false })
+		}
+		return true
+	default:
+		return typ == Int || typ == String
+	}
+}
+
+// Reports a type error involving types, naming their variables consistently
+func (c *inferrer) mismatch(tok token.Token, format string, a ...interface{}) {
+	n := &namer{names: map[*Var]string{}}
+	for idx, arg := range a {
+		if typ, ok := arg.(Type); ok {
+			a[idx] = n.format(typ)
+		}
+	}
+	c.report(tok, format, a...)
+}
+
+func (c *inferrer) statements(stmts []ast.Statement) (Type, bool) {
+	var result Type = Null
+	for _, stmt := range stmts {
+		typ, reached := c.statement(stmt)
+		if !reached {
+			return typ, false
+		}
+		result = typ
+	}
+	return result, true
+}
+
+// Infers the type of the value of a statement, and whether execution
+// can continue after it
+func (c *inferrer) statement(stmt ast.Statement) (Type, bool) {
+	switch stmt := stmt.(type) {
+	case *ast.PutStatement:
+		return c.putStatement(stmt), true
+	case *ast.ExpressionStatement:
+		return c.expression(stmt.Expression), true
+	case *ast.UnboxStatement:
+		typ := c.expression(stmt.NodeExpression)
+		c.unboxed(stmt.NodeToken, typ)
+		return typ, false
+	case *ast.ThrowStatement:
+		c.expression(stmt.NodeExpression)
+		return c.fresh(), false
+	case *ast.TryStatement:
+		return c.tryStatement(stmt)
+	}
+	return c.fresh(), true
+}
+
+func (c *inferrer) tryStatement(stmt *ast.TryStatement) (Type, bool) {
+	result, reached := c.statements(stmt.Body.Statements)
+
+	if stmt.Catch != nil {
+		caught, catchReached := c.statements(stmt.Catch.Statements)
+		switch {
+		case !reached:
+			result = caught
+		case catchReached && !c.unify(result, caught):
+			// The value of the statement depends on whether an error was caught
+			result = c.fresh()
+		}
+		reached = reached || catchReached
+	}
+
+	if stmt.Finally != nil {
+		if _, finallyReached := c.statements(stmt.Finally.Statements); !finallyReached {
+			reached = false
+		}
+	}
+	return result, reached
+}
+
+func (c *inferrer) putStatement(stmt *ast.PutStatement) Type {
+	e := c.slot(&stmt.NodeIdentifier)
+	if box, ok := stmt.NodeExpression.(*ast.BoxExpression); ok {
+		c.names[box] = stmt.NodeIdentifier.Value
+	}
+
+	typ := c.expression(stmt.NodeExpression)
+	if !c.unify(e.typ, typ) {
+		c.mismatch(stmt.NodeIdentifier.NodeToken, "Type Mismatch: %s is <%s>. Got <%s>", stmt.NodeIdentifier.Value, e.typ, typ)
+	}
+
+	// Bindings made once are generic
+	if e.count == 1 {
+		c.generalize(e)
+	}
+	return typ
+}
+
+// Records a value returned by the box being inferred
+func (c *inferrer) unboxed(tok token.Token, typ Type) {
+	if c.returns != nil && !c.unify(c.returns, typ) {
+		c.mismatch(tok, "Type Mismatch: box returns <%s>. Got <%s>", c.returns, typ)
+	}
+}
+
+func (c *inferrer) expression(expr ast.Expression) Type {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.StringLiteral:
+		return String
+	case *ast.Identifier:
+		return c.lookup(expr)
+	case *ast.PrefixExpression:
+		operand := c.expression(expr.Right)
+		if !c.unify(Int, operand) {
+			c.mismatch(expr.NodeToken, "Type error. Can't use <%s> Operator with <%s> Type.", expr.Operator, operand)
+		}
+		return Int
+	case *ast.InfixExpression:
+		return c.infixExpression(expr)
+	case *ast.BoxExpression:
+		return c.boxExpression(expr)
+	case *ast.CallExpression:
+		return c.callExpression(expr)
+	case *ast.MemberExpression:
+		return c.memberExpression(expr)
+	}
+	return c.fresh()
+}
+
+func (c *inferrer) infixExpression(expr *ast.InfixExpression) Type {
+	left := c.expression(expr.Left)
+	right := c.expression(expr.Right)
+
+	// Strings can only be concatenated
+	if expr.Operator == "+" {
+		mark := len(c.trail)
+		if c.unifyTypes(left, right) && c.addable(left) {
+			return left
+		}
+		c.undo(mark)
+		c.mismatch(expr.NodeToken, "Type Mismatch: <%s><%s><%s>", left, expr.Operator, right)
+		return c.fresh()
+	}
+
+	if !c.unify(Int, left) || !c.unify(Int, right) {
+		c.mismatch(expr.NodeToken, "Type Mismatch: <%s><%s><%s>", left, expr.Operator, right)
+	}
+	return Int
+}
+
+func (c *inferrer) boxExpression(box *ast.BoxExpression) Type {
+	typ := &Box{}
+	for idx := range box.ParameterList {
+		if annotation := box.ParameterType(idx); annotation != nil {
+			typ.Params = append(typ.Params, c.annotated(annotation))
+		} else {
+			typ.Params = append(typ.Params, c.fresh())
+		}
+	}
+	if box.ReturnType != nil {
+		typ.Return = c.annotated(box.ReturnType)
+	} else {
+		typ.Return = c.fresh()
+	}
+
+	name, ok := c.names[box]
+	if !ok {
+		name = "<box>"
+	}
+	c.boxes = append(c.boxes, inferredBox{expr: box, name: name, typ: typ})
+
+	outer := c.returns
+	c.returns = typ.Return
+	last, reached := c.body(box.Body.Statements, box.ParameterList, typ.Params)
+	if reached {
+		c.unboxed(lastToken(box), last)
+	}
+	c.returns = outer
+
+	return typ
+}
+
+func (c *inferrer) callExpression(call *ast.CallExpression) Type {
+	function := c.expression(call.Function)
+	args := []Type{}
+	for _, arg := range call.Arguments {
+		args = append(args, c.expression(arg))
+	}
+
+	switch fn := prune(function).(type) {
+	case *Box:
+		if len(fn.Params) != len(args) {
+			c.report(call.NodeToken, "Wrong number of arguments. Expected %d. Got <%d>", len(fn.Params), len(args))
+			return fn.Return
+		}
+		for idx, arg := range args {
+			if !c.unify(fn.Params[idx], arg) {
+				c.mismatch(call.NodeToken, "Type Mismatch: argument %d expects <%s>. Got <%s>", idx+1, fn.Params[idx], arg)
+			}
+		}
+		return fn.Return
+
+	case *Var:
+		result := c.fresh()
+		box := &Box{Params: args, Return: result}
+		if !c.unify(fn, box) {
+			// The box is passed to itself, or is an operand of '+'
+			c.mismatch(call.NodeToken, "Type error. Infinite or invalid type <%s> = <%s>", fn, box)
+		}
+		return result
+	}
+
+	c.mismatch(call.NodeToken, "Type Mismatch Error. Expected Function. Got <%s>", function)
+	return c.fresh()
+}
+
+func (c *inferrer) memberExpression(expr *ast.MemberExpression) Type {
+	object := c.expression(expr.Object)
+	if !c.unify(Exception, object) {
+		c.mismatch(expr.NodeToken, "Type error. <%s> Type has no properties.", object)
+		return c.fresh()
+	}
+
+	property, ok := exceptionProperties[expr.Property.Value]
+	if !ok {
+		c.report(expr.NodeToken, "Unknown property: %s.", expr.Property.Value)
+		return c.fresh()
+	}
+	if property == Any {
+		return c.fresh()
+	}
+	return property
+}
+
+// Names type variables a, b, c... in order of appearance
+type namer struct {
+	names map[*Var]string
+	order []*Var
+}
+
+func (n *namer) format(typ Type) string {
+	switch typ := prune(typ).(type) {
+	case *Var:
+		name, ok := n.names[typ]
+		if !ok {
+			name = varName(len(n.order))
+			n.names[typ] = name
+			n.order = append(n.order, typ)
+		}
+		return name
+	case *Box:
+		var out bytes.Buffer
+		out.WriteString("box(")
+		for idx, param := range typ.Params {
+			if idx > 0 {
+				out.WriteString(", ")
+			}
+			out.WriteString(n.format(param))
+		}
+		out.WriteString(") -> ")
+		out.WriteString(n.format(typ.Return))
+		return out.String()
+	default:
+		return typ.String()
+	}
+}
+
+// a, b, ..., z, a1, b1, ...
+func varName(idx int) string {
+	name := string(rune('a' + idx%26))
+	if idx >= 26 {
+		name += fmt.Sprint(idx / 26)
+	}
+	return name
+}
@@ -0,0 +1,154 @@
+package types
+
+import "testing"
+
+func TestInferSignatures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		// TestFunctionsAsArguments
+		{
+			"put add = box(a, b) { a + b }; put sub = box(a, b) { a - b }; put applyFunc = box(a, b, func) { func(a, b) }; applyFunc(2, 2, add);",
+			[]string{
+				"1:11: add: box(a, a) -> a where a: int | string",
+				"1:42: sub: box(int, int) -> int",
+				"1:79: applyFunc: box(a, b, box(a, b) -> c) -> c",
+			},
+		},
+		// Boxes bound once are generic
+		{
+			`put id = box(x) { x }; id(1) + 1; id("s") + "t";`,
+			[]string{"1:10: id: box(a) -> a"},
+		},
+		{
+			"put compose = box(f, g) { box(x) { f(g(x)) } };",
+			[]string{
+				"1:15: compose: box(box(a) -> b, box(c) -> a) -> box(c) -> b",
+				"1:27: <box>: box(a) -> b",
+			},
+		},
+		// TestClosures
+		{
+			"put newAdder = box(x) { box(y) { x + y } }; newAdder(2)(2);",
+			[]string{
+				"1:16: newAdder: box(a) -> box(a) -> a where a: int | string",
+				"1:25: <box>: box(a) -> a where a: int | string",
+			},
+		},
+		// Recursion, and values returned by 'unbox'
+		{
+			"put sum = box(n, acc) { try { 1 / n; } catch { unbox acc; } sum(n - 1, acc + n) };",
+			[]string{"1:11: sum: box(int, int) -> int"},
+		},
+		{
+			"put kind = box(e) { e.kind }; put f = box() { };",
+			[]string{"1:12: kind: box(exception) -> string", "1:39: f: box() -> null"},
+		},
+		{
+			"put f = box(a: any, b) -> string { b };",
+			[]string{"1:9: f: box(a, string) -> string"},
+		},
+		{
+			"put f = box(n) { try { unbox n; } catch (e) { e.line } };",
+			[]string{"1:9: f: box(int) -> int"},
+		},
+	}
+
+	for _, tt := range tests {
+		signatures, diagnostics := Infer(parse(t, tt.input))
+		if len(diagnostics) > 0 {
+			t.Errorf("Test failed. Unexpected diagnostics for <%s>: %v", tt.input, diagnostics)
+		}
+
+		if len(signatures) != len(tt.expected) {
+			t.Errorf("Test failed. Expected %d signatures for <%s>. Got <%v>", len(tt.expected), tt.input, signatures)
+			continue
+		}
+
+		for idx, signature := range signatures {
+			if signature.String() != tt.expected[idx] {
+				t.Errorf("Test failed. Expected signature %q for <%s>. Got <%s>", tt.expected[idx], tt.input, signature)
+			}
+		}
+	}
+}
+
+func TestInferErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`put a = 1; a + "b";`, []string{"1:14: error: Type Mismatch: <int><+><string>"}},
+		{"box(a) { -a; a.kind }", []string{"1:15: error: Type error. <int> Type has no properties."}},
+		{"box(a, b) { a(b); a + b }", []string{"1:21: error: Type Mismatch: <box(a) -> b><+><a>"}},
+		{"put f = box(a) { a }; f(1, 2);", []string{"1:24: error: Wrong number of arguments. Expected 1. Got <2>"}},
+		{"put f = box(a) { a * 2 }; f(\"s\");", []string{"1:28: error: Type Mismatch: argument 1 expects <int>. Got <string>"}},
+		{"put a = 5; a(1);", []string{"1:13: error: Type Mismatch Error. Expected Function. Got <int>"}},
+		{"box(f) { f(f) }", []string{"1:11: error: Type error. Infinite or invalid type <a> = <box(a) -> b>"}},
+		{`put a = 1; put a = "s";`, []string{`1:16: error: Type Mismatch: a is <int>. Got <string>`}},
+		{`box(n) { try { unbox 1; } catch { unbox "s"; } }`, []string{`1:35: error: Type Mismatch: box returns <int>. Got <string>`}},
+		{
+			"put applyFunc = box(a, b, func) { func(a, b) }; applyFunc(1, 2, box(x) { x.kind });",
+			[]string{"1:58: error: Type Mismatch: argument 3 expects <box(int, int) -> a>. Got <box(exception) -> string>"},
+		},
+		{"assertError(box(x) { x }).kind + 1;", []string{
+			"1:12: error: Type Mismatch: argument 1 expects <box() -> a>. Got <box(b) -> b>",
+			"1:32: error: Type Mismatch: <string><+><int>",
+		}},
+		// Uses of a binding before it is generalized share its type
+		{
+			`put f = box() { g(1); g("s") }; put g = box(x) { x };`,
+			[]string{"1:24: error: Type Mismatch: argument 1 expects <int>. Got <string>"},
+		},
+	}
+
+	for _, tt := range tests {
+		_, diagnostics := Infer(parse(t, tt.input))
+
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("Test failed. Expected %d diagnostics for <%s>. Got <%v>", len(tt.expected), tt.input, diagnostics)
+			continue
+		}
+
+		for idx, diagnostic := range diagnostics {
+			if diagnostic.String() != tt.expected[idx] {
+				t.Errorf("Test failed. Expected diagnostic %q for <%s>. Got <%s>", tt.expected[idx], tt.input, diagnostic)
+			}
+		}
+	}
+}
+
+func TestInferBindings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`put a = 1; put s: string = "b" + "c";`, []string{"1:5: a: int", "1:16: s: string"}},
+		{
+			"put add = box(a, b) { put c = a + b; unbox c; };",
+			[]string{
+				"1:5: add: box(a, a) -> a where a: int | string",
+				"1:15: a: a where a: int | string",
+				"1:18: b: a where a: int | string",
+				"1:27: c: a where a: int | string",
+			},
+		},
+		{"try { throw 1; } catch (e) { put k = e.kind; }", []string{"1:25: e: exception", "1:34: k: string"}},
+	}
+
+	for _, tt := range tests {
+		signatures := InferBindings(parse(t, tt.input))
+
+		if len(signatures) != len(tt.expected) {
+			t.Errorf("Test failed. Expected %d bindings for <%s>. Got <%v>", len(tt.expected), tt.input, signatures)
+			continue
+		}
+
+		for idx, signature := range signatures {
+			if signature.String() != tt.expected[idx] {
+				t.Errorf("Test failed. Expected binding %q for <%s>. Got <%s>", tt.expected[idx], tt.input, signature)
+			}
+		}
+	}
+}
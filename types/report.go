@@ -0,0 +1,56 @@
+package types
+
+import (
+	"cardboard/lexer/token"
+	"cardboard/parser/ast"
+	"cardboard/resolver"
+	"fmt"
+	"sort"
+)
+
+// Collects the type errors found in a program
+type reporter struct {
+	diagnostics []resolver.Diagnostic
+}
+
+func (r *reporter) report(tok token.Token, format string, a ...interface{}) {
+	r.diagnostics = append(r.diagnostics, resolver.Diagnostic{
+		Severity: resolver.Error,
+		Line:     tok.Line,
+		Column:   tok.Column,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+// Diagnostics sorted by position
+func (r *reporter) sorted() []resolver.Diagnostic {
+	sort.SliceStable(r.diagnostics, func(i, j int) bool {
+		a, b := r.diagnostics[i], r.diagnostics[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return r.diagnostics
+}
+
+// Type named by an annotation. Unknown names are reported, and are Any.
+func (r *reporter) annotation(annotation ast.Type) Type {
+	switch annotation := annotation.(type) {
+	case *ast.TypeName:
+		if typ, ok := names[annotation.Name]; ok {
+			return typ
+		}
+		r.report(annotation.NodeToken, "Unknown type: %s.", annotation.Name)
+	case *ast.BoxType:
+		typ := &Box{Return: Any}
+		for _, param := range annotation.Parameters {
+			typ.Params = append(typ.Params, r.annotation(param))
+		}
+		if annotation.Return != nil {
+			typ.Return = r.annotation(annotation.Return)
+		}
+		return typ
+	}
+	return Any
+}
@@ -0,0 +1,119 @@
+// Package types checks the types of a program before it runs, using the
+// optional type annotations of 'put' bindings and box parameters, and
+// inferring the types of unannotated code where it can.
+package types
+
+import (
+	"bytes"
+)
+
+// Static type of a value
+type Type interface {
+	String() string
+}
+
+// Types of the values without structure
+type Basic struct {
+	Name string
+}
+
+func (b *Basic) String() string { return b.Name }
+
+var (
+	Int       = &Basic{Name: "int"}
+	String    = &Basic{Name: "string"}
+	Null      = &Basic{Name: "null"}
+	Exception = &Basic{Name: "exception"}
+
+	// Any value, for code whose type isn't annotated and can't be inferred.
+	// It is compatible with every type, so it never causes a diagnostic.
+	Any = &Basic{Name: "any"}
+)
+
+// Types annotations can name
+var names = map[string]Type{
+	"int":       Int,
+	"string":    String,
+	"null":      Null,
+	"exception": Exception,
+	"any":       Any,
+}
+
+// Types of the builtins, see object.Builtins
+var builtins = map[string]Type{
+	"assert":      &Box{Params: []Type{Any}, Return: Null},
+	"assertEqual": &Box{Params: []Type{Any, Any}, Return: Null},
+	"assertError": &Box{Params: []Type{&Box{Return: Any}}, Return: Exception},
+	"show":        &Box{Params: []Type{Any}, Return: Null},
+}
+
+// Type of boxes taking parameters of the given types
+type Box struct {
+	Params []Type
+	Return Type
+}
+
+func (b *Box) String() string {
+	var out bytes.Buffer
+	out.WriteString("box(")
+	for idx, param := range b.Params {
+		if idx > 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString(param.String())
+	}
+	out.WriteString(") -> ")
+	out.WriteString(b.Return.String())
+	return out.String()
+}
+
+// Compatible reports whether a value of type got can be used where a value
+// of type expected is. Any is compatible with every type, both ways.
+func Compatible(expected Type, got Type) bool {
+	if expected == Any || got == Any {
+		return true
+	}
+
+	expectedBox, ok := expected.(*Box)
+	if !ok {
+		return expected == got
+	}
+	gotBox, ok := got.(*Box)
+	if !ok || len(expectedBox.Params) != len(gotBox.Params) {
+		return false
+	}
+	for idx, param := range expectedBox.Params {
+		if !Compatible(param, gotBox.Params[idx]) {
+			return false
+		}
+	}
+	return Compatible(expectedBox.Return, gotBox.Return)
+}
+
+// Equal reports whether two types are the same type
+func Equal(a Type, b Type) bool {
+	aBox, ok := a.(*Box)
+	if !ok {
+		return a == b
+	}
+	bBox, ok := b.(*Box)
+	if !ok || len(aBox.Params) != len(bBox.Params) {
+		return false
+	}
+	for idx, param := range aBox.Params {
+		if !Equal(param, bBox.Params[idx]) {
+			return false
+		}
+	}
+	return Equal(aBox.Return, bBox.Return)
+}
+
+// Types of the properties of exceptions
+var exceptionProperties = map[string]Type{
+	"message": String,
+	"kind":    String,
+	"value":   Any,
+	"trace":   String,
+	"line":    Int,
+	"column":  Int,
+}
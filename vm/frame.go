@@ -0,0 +1,43 @@
+package vm
+
+import (
+	"cardboard/code"
+	"cardboard/object"
+)
+
+// Call of a closure (or of the program itself) being executed
+type Frame struct {
+	cl *object.Closure
+
+	// Offset of the instruction being executed
+	ip int
+
+	// Stack index of the called closure. Its slot receives the returned value.
+	basePointer int
+
+	locals *object.Locals
+
+	// Calls of the closure to itself made in tail position, reusing this frame
+	tailCalls int
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer, locals: newLocals(cl.Fn)}
+}
+
+func newLocals(fn *object.CompiledFunction) *object.Locals {
+	return &object.Locals{
+		Values:    make([]object.Object, fn.NumLocals),
+		Names:     fn.LocalNames,
+		Fallbacks: fn.Fallbacks,
+	}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
+
+// Source position of the instruction being executed
+func (f *Frame) position() (int, int) {
+	return f.cl.Fn.PositionAt(f.ip)
+}
@@ -0,0 +1,526 @@
+package vm
+
+import (
+	"cardboard/code"
+	"cardboard/compiler"
+	"cardboard/object"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Size of the globals store: every global the 2-byte operands of
+// OpGetGlobal and OpSetGlobal can refer to
+const GlobalsSize = 65536
+
+// Deepest chain of box calls before the program is stopped
+const MaxFrames = object.MaxCallDepth
+
+// Initial size of the stack, grown as needed
+const StackSize = 2048
+
+var Null = &object.Null{}
+
+// An error handler registered by a try statement
+type handler struct {
+	// Address of the code handling the error
+	ip int
+
+	// Call the handler belongs to, and the stack height to restore
+	framesIndex int
+	sp          int
+}
+
+type VM struct {
+	constants []object.Object
+
+	globals     []object.Object
+	globalNames []string
+
+	stack []object.Object
+	sp    int // Always points to the next free slot. Top of stack is stack[sp-1]
+
+	frames      []*Frame
+	framesIndex int
+
+	handlers []handler
+
+	// Output of the program
+	out io.Writer
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobalsStore(bytecode, make([]object.Object, GlobalsSize))
+}
+
+// Creates a virtual machine sharing the globals of previous runs,
+// so the REPL can run one line at a time.
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, globals []object.Object) *VM {
+	mainClosure := &object.Closure{Fn: bytecode.Main}
+
+	vm := &VM{
+		constants:   bytecode.Constants,
+		globals:     globals,
+		globalNames: bytecode.Globals,
+		stack:       make([]object.Object, StackSize),
+		frames:      []*Frame{NewFrame(mainClosure, 0)},
+		framesIndex: 1,
+		out:         os.Stdout,
+	}
+	return vm
+}
+
+// SetOutput sets where builtins like 'show' write, os.Stdout by default
+func (vm *VM) SetOutput(out io.Writer) { vm.out = out }
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	if vm.framesIndex == len(vm.frames) {
+		vm.frames = append(vm.frames, f)
+	} else {
+		vm.frames[vm.framesIndex] = f
+	}
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// Run executes the program and returns its result: the value of the last
+// top level statement, the value unboxed at the top level, or the error
+// that stopped the program.
+func (vm *VM) Run() object.Object {
+	return vm.run(1)
+}
+
+// Executes instructions until the call at frames index floor returns,
+// or an error propagates out of it. The call is left on the frames.
+func (vm *VM) run(floor int) object.Object {
+	for {
+		frame := vm.currentFrame()
+		frame.ip++
+
+		ins := frame.Instructions()
+		ip := frame.ip
+		op := code.Opcode(ins[ip])
+
+		var err *object.Error
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.push(vm.constants[constIndex])
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpNull:
+			vm.push(Null)
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+			err = vm.executeBinaryOperation(op)
+
+		case code.OpMinus, code.OpPlus:
+			err = vm.executePrefixOperation(op)
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			err = vm.pushGlobal(int(globalIndex))
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.globals[globalIndex] = vm.bind(vm.globalNames[globalIndex])
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			vm.push(object.Builtins[builtinIndex])
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			err = vm.pushLocal(frame.locals, frame.cl.Free, int(localIndex))
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			frame.locals.Values[localIndex] = vm.bind(frame.locals.Names[localIndex])
+
+		case code.OpGetFree:
+			depth := code.ReadUint8(ins[ip+1:])
+			localIndex := code.ReadUint8(ins[ip+2:])
+			frame.ip += 2
+			err = vm.pushLocal(frame.cl.Free[depth], frame.cl.Free[depth+1:], int(localIndex))
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.pushClosure(int(constIndex))
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			err = vm.callFunction(int(numArgs))
+
+		case code.OpTailCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			err = vm.tailCall(int(numArgs))
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			// Returning from the call being run ends the run
+			if vm.framesIndex == floor {
+				return returnValue
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer
+			vm.push(returnValue)
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip = pos - 1
+
+		case code.OpTry:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			vm.handlers = append(vm.handlers, handler{ip: pos, framesIndex: vm.framesIndex, sp: vm.sp})
+
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+		case code.OpThrow:
+			err = vm.throw(vm.pop())
+
+		case code.OpRethrow:
+			val := vm.pop()
+			caught, ok := val.(*object.Exception)
+			if !ok {
+				err = vm.newError(object.RUNTIME_ERROR, "Invalid Rethrow: <%s> isn't a caught error", val.Type())
+				break
+			}
+			err = caught.Error
+
+		case code.OpMember:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			err = vm.executeMember(vm.constants[constIndex].(*object.String).Value)
+
+		default:
+			def, _ := code.Lookup(byte(op))
+			err = vm.newError(object.RUNTIME_ERROR, "Unknown Instruction: <%v>", def)
+		}
+
+		if err != nil && !vm.raise(err, floor) {
+			return err
+		}
+	}
+}
+
+// Hands an error to the innermost error handler, unwinding the calls made
+// since it was registered. Returns false when no handler is left down to
+// the call at frames index floor, in which case the error ends the run.
+func (vm *VM) raise(err *object.Error, floor int) bool {
+	for {
+		if n := len(vm.handlers); n > 0 && vm.handlers[n-1].framesIndex == vm.framesIndex {
+			h := vm.handlers[n-1]
+			vm.handlers = vm.handlers[:n-1]
+
+			vm.sp = h.sp
+			vm.push(&object.Exception{Error: err})
+			vm.currentFrame().ip = h.ip - 1
+			return true
+		}
+
+		if vm.framesIndex == floor {
+			return false
+		}
+
+		// Record the call on the error's stack trace as it propagates to the caller
+		frame := vm.popFrame()
+		line, column := vm.currentFrame().position()
+		err.Trace = append(err.Trace, object.StackFrame{Function: frame.cl.Name, Line: line, Column: column, TailCalls: frame.tailCalls})
+		vm.sp = frame.basePointer
+	}
+}
+
+// Creates an error of the given kind positioned at the current instruction
+func (vm *VM) newError(kind object.ErrorKind, format string, a ...interface{}) *object.Error {
+	line, column := vm.currentFrame().position()
+	return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...), Line: line, Column: column}
+}
+
+// Returns the value on top of the stack being bound to name. Like the
+// evaluator, anonymous boxes are named after their first binding.
+func (vm *VM) bind(name string) object.Object {
+	val := vm.stack[vm.sp-1]
+	if cl, ok := val.(*object.Closure); ok && cl.Name == "" {
+		cl.Name = name
+	}
+	return val
+}
+
+// Pushes a local slot of a call, whose enclosing calls are free. Until
+// the slot is bound, its fallback is pushed instead, like the evaluator
+// looking the name up in the enclosing environments.
+func (vm *VM) pushLocal(locals *object.Locals, free []*object.Locals, idx int) *object.Error {
+	for {
+		if val := locals.Values[idx]; val != nil {
+			vm.push(val)
+			return nil
+		}
+
+		switch fallback := locals.Fallbacks[idx]; fallback.Kind {
+		case object.FreeFallback:
+			locals, free, idx = free[fallback.Depth], free[fallback.Depth+1:], fallback.Index
+		case object.GlobalFallback:
+			return vm.pushGlobal(fallback.Index)
+		default:
+			return vm.pushBuiltin(locals.Names[idx])
+		}
+	}
+}
+
+// Pushes a global, or the builtin of the same name until it's bound
+func (vm *VM) pushGlobal(idx int) *object.Error {
+	if val := vm.globals[idx]; val != nil {
+		vm.push(val)
+		return nil
+	}
+	return vm.pushBuiltin(vm.globalNames[idx])
+}
+
+func (vm *VM) pushBuiltin(name string) *object.Error {
+	builtin, _, ok := object.LookupBuiltin(name)
+	if !ok {
+		return vm.newError(object.NAME_ERROR, "Unknown identifier: %s.", name)
+	}
+	vm.push(builtin)
+	return nil
+}
+
+func (vm *VM) pushClosure(constIndex int) {
+	fn := vm.constants[constIndex].(*object.CompiledFunction)
+
+	// Boxes created by the program only refer to globals
+	var free []*object.Locals
+	if vm.framesIndex > 1 {
+		frame := vm.currentFrame()
+		free = make([]*object.Locals, 0, len(frame.cl.Free)+1)
+		free = append(free, frame.locals)
+		free = append(free, frame.cl.Free...)
+	}
+
+	vm.push(&object.Closure{Fn: fn, Free: free})
+}
+
+func (vm *VM) callFunction(numArgs int) *object.Error {
+	basePointer := vm.sp - 1 - numArgs
+	callee := vm.stack[basePointer]
+
+	if builtin, ok := callee.(*object.Builtin); ok {
+		return vm.callBuiltin(builtin, numArgs)
+	}
+
+	cl, ok := callee.(*object.Closure)
+	if !ok {
+		return vm.newError(object.TYPE_ERROR, "Type Mismatch Error. Expected Function. Got <%s>", callee.Type())
+	}
+
+	if numArgs != cl.Fn.NumParameters {
+		return vm.newError(object.TYPE_ERROR, "Wrong number of arguments. Expected %d. Got <%d>", cl.Fn.NumParameters, numArgs)
+	}
+
+	if vm.framesIndex >= MaxFrames {
+		return vm.newError(object.RUNTIME_ERROR, "Stack Overflow: more than %d nested calls", MaxFrames)
+	}
+
+	frame := NewFrame(cl, basePointer)
+	copy(frame.locals.Values, vm.stack[basePointer+1:vm.sp])
+
+	vm.sp = basePointer
+	vm.pushFrame(frame)
+	return nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) *object.Error {
+	if numArgs != len(builtin.Parameters) {
+		return vm.newError(object.TYPE_ERROR, "Wrong number of arguments. Expected %d. Got <%d>", len(builtin.Parameters), numArgs)
+	}
+
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.sp -= numArgs + 1
+
+	result := builtin.Fn(&object.Context{Call: vm.call, Out: vm.out}, args...)
+	if err, ok := result.(*object.Error); ok {
+		if err.Line == 0 {
+			err.Line, err.Column = vm.currentFrame().position()
+		}
+		return err
+	}
+	vm.push(result)
+	return nil
+}
+
+// Calls a function on behalf of a builtin, running the call to its end
+func (vm *VM) call(fn object.Object, args ...object.Object) object.Object {
+	sp := vm.sp
+	vm.push(fn)
+	for _, arg := range args {
+		vm.push(arg)
+	}
+
+	floor := vm.framesIndex + 1
+	if err := vm.callFunction(len(args)); err != nil {
+		vm.sp = sp
+		return err
+	}
+	// Builtins leave their result on the stack rather than making a call
+	if vm.framesIndex < floor {
+		return vm.pop()
+	}
+
+	result := vm.run(floor)
+
+	// Record the call on the error's stack trace like raise does
+	frame := vm.popFrame()
+	if err, ok := result.(*object.Error); ok {
+		line, column := vm.currentFrame().position()
+		err.Trace = append(err.Trace, object.StackFrame{Function: frame.cl.Name, Line: line, Column: column, TailCalls: frame.tailCalls})
+	}
+	vm.sp = sp
+	return result
+}
+
+// Makes a call in tail position. A closure calling itself reuses its call,
+// so tail recursive boxes run without growing the frames.
+func (vm *VM) tailCall(numArgs int) *object.Error {
+	frame := vm.currentFrame()
+
+	cl, ok := vm.stack[vm.sp-1-numArgs].(*object.Closure)
+	if !ok || cl != frame.cl || numArgs != cl.Fn.NumParameters {
+		return vm.callFunction(numArgs)
+	}
+
+	// Closures created by the previous call keep its locals
+	frame.locals = newLocals(cl.Fn)
+	copy(frame.locals.Values, vm.stack[vm.sp-numArgs:vm.sp])
+
+	vm.sp = frame.basePointer
+	frame.ip = -1
+	frame.tailCalls++
+	return nil
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) *object.Error {
+	right := vm.pop()
+	left := vm.pop()
+
+	// Strings can only be concatenated
+	if left.Type() == object.STRING && right.Type() == object.STRING && op == code.OpAdd {
+		vm.push(&object.String{Value: left.(*object.String).Value + right.(*object.String).Value})
+		return nil
+	}
+
+	if left.Type() != object.INTEGER || right.Type() != object.INTEGER {
+		return vm.newError(object.TYPE_ERROR, "Type Mismatch: <%s><%s><%s>", left.Type(), operators[op], right.Type())
+	}
+
+	leftVal := left.(*object.Integer).Value
+	rightVal := right.(*object.Integer).Value
+
+	var result int64
+	switch op {
+	case code.OpAdd:
+		result = leftVal + rightVal
+	case code.OpSub:
+		result = leftVal - rightVal
+	case code.OpMul:
+		result = leftVal * rightVal
+	case code.OpDiv:
+		if rightVal == 0 {
+			return vm.newError(object.ZERO_DIVISION_ERROR, "Division By Zero: <%d/0>", leftVal)
+		}
+		result = leftVal / rightVal
+	}
+
+	vm.push(&object.Integer{Value: result})
+	return nil
+}
+
+func (vm *VM) executePrefixOperation(op code.Opcode) *object.Error {
+	operand := vm.pop()
+
+	if operand.Type() != object.INTEGER {
+		return vm.newError(object.TYPE_ERROR, "Type error. Can't use <%s> Operator with <%s> Type.", operators[op], operand.Type())
+	}
+
+	value := operand.(*object.Integer).Value
+	if op == code.OpMinus {
+		value = -value
+	}
+	vm.push(&object.Integer{Value: value})
+	return nil
+}
+
+func (vm *VM) executeMember(name string) *object.Error {
+	obj := vm.pop()
+
+	exception, ok := obj.(*object.Exception)
+	if !ok {
+		return vm.newError(object.TYPE_ERROR, "Type error. <%s> Type has no properties.", obj.Type())
+	}
+
+	property, ok := exception.Property(name)
+	if !ok {
+		return vm.newError(object.NAME_ERROR, "Unknown property: %s.", name)
+	}
+	vm.push(property)
+	return nil
+}
+
+func (vm *VM) throw(val object.Object) *object.Error {
+	// Rethrowing a caught error keeps its original details
+	if exception, ok := val.(*object.Exception); ok {
+		return exception.Error
+	}
+
+	err := vm.newError(object.USER_ERROR, "%s", val.Inspect())
+	err.Value = val
+	return err
+}
+
+// Operator spelling, for error messages
+var operators = map[code.Opcode]string{
+	code.OpAdd:   "+",
+	code.OpSub:   "-",
+	code.OpMul:   "*",
+	code.OpDiv:   "/",
+	code.OpMinus: "-",
+	code.OpPlus:  "+",
+}
+
+func (vm *VM) push(o object.Object) {
+	if vm.sp >= len(vm.stack) {
+		vm.stack = append(vm.stack, make([]object.Object, len(vm.stack))...)
+	}
+	vm.stack[vm.sp] = o
+	vm.sp++
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
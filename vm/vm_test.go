@@ -0,0 +1,208 @@
+package vm
+
+import (
+	"cardboard/code"
+	"cardboard/compiler"
+	"cardboard/lexer"
+	"cardboard/object"
+	"cardboard/parser"
+	"cardboard/parser/ast"
+	"testing"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"1 + 2", 3},
+		{"1 - 2", -1},
+		{"2 * (3 + 4)", 14},
+		{"-7 / 2", -3},
+		{"+5; -5", -5},
+		{`"card" + "board"`, "cardboard"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestPutStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"put a = 1; a", 1},
+		{"put a = 1; put b = a + 1; a + b", 3},
+		{"put a = 1; put a = a + 1; a", 2},
+		{"put a = 5;", 5},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingBoxes(t *testing.T) {
+	tests := []vmTestCase{
+		{"box() { 5 }()", 5},
+		{"put add = box(a, b) { a + b }; add(1, add(2, 3))", 6},
+		{"put f = box() { unbox 1; 2 }; f()", 1},
+		{"put f = box() { }; f()", nil},
+		{"put adder = box(x) { box(y) { x + y } }; adder(2)(3)", 5},
+		{"put f = box() { put a = 1; put g = box() { a }; put a = 2; g() }; f()", 2},
+		{"put count = box(n) { try { 1 / n; } catch { unbox 0; } unbox 1 + count(n - 1); }; count(5000);", 5000},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []vmTestCase{
+		// Deeper than MaxFrames
+		{"put sum = box(n, acc) { try { 1 / n; } catch { unbox acc; } sum(n - 1, acc + n) }; sum(2000000, 0)", 2000001000000},
+		{"put f = box(n, g) { try { 1 / n; } catch { unbox g(); } unbox f(n - 1, box() { n }); }; f(3, box() { 0 })", 1},
+		{"put f = box(n) { try { 1 / n; } catch { unbox 0; } unbox 1 + f(n - 1); }; f(10)", 10},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTryStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"try { 1 / 0; } catch (e) { e.kind; }", "ZeroDivisionError"},
+		{"try { throw 42; } catch (e) { e.value; }", 42},
+		{"put x = 1; try { 1; } finally { put x = 2; } x", 2},
+		{"put f = box() { try { unbox 1; } finally { unbox 2; } }; f()", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		kind    object.ErrorKind
+		message string
+		line    int
+		column  int
+		trace   int
+	}{
+		{"missing", object.NAME_ERROR, "Unknown identifier: missing.", 1, 1, 0},
+		{"1 + \"a\"", object.TYPE_ERROR, "Type Mismatch: <INTEGER><+><STRING>", 1, 3, 0},
+		{"put f = box(a) { a };\nf()", object.TYPE_ERROR, "Wrong number of arguments. Expected 1. Got <0>", 2, 2, 0},
+		{"put f = box() {\n 1 / 0 };\nf()", object.ZERO_DIVISION_ERROR, "Division By Zero: <1/0>", 2, 4, 1},
+		{"throw 1;", object.USER_ERROR, "1", 1, 1, 0},
+		{"put f = box() {\n assert(\"\") };\nf()", object.ASSERTION_ERROR, `Assertion failed: "" is false.`, 2, 8, 1},
+		{"assertError(box() { 1 })", object.ASSERTION_ERROR, "Assertion failed: no error raised, got 1.", 1, 12, 0},
+	}
+
+	for _, tt := range tests {
+		result := run(t, tt.input)
+
+		err, ok := result.(*object.Error)
+		if !ok {
+			t.Fatalf("Test failed. Expected an error for <%s>. Got <%s>", tt.input, result.Inspect())
+		}
+
+		if err.Kind != tt.kind || err.Message != tt.message {
+			t.Errorf("Test failed. Expected %s <%s>. Got <%s> <%s>", tt.kind, tt.message, err.Kind, err.Message)
+		}
+
+		if err.Line != tt.line || err.Column != tt.column {
+			t.Errorf("Test failed. Expected <%s> at %d:%d. Got <%d:%d>", tt.input, tt.line, tt.column, err.Line, err.Column)
+		}
+
+		if len(err.Trace) != tt.trace {
+			t.Errorf("Test failed. Expected %d trace frames for <%s>. Got <%d>", tt.trace, tt.input, len(err.Trace))
+		}
+	}
+}
+
+// Instructions the compiler never emits raise errors rather than crashing
+func TestInvalidRethrow(t *testing.T) {
+	main := &object.CompiledFunction{}
+	for _, ins := range [][]byte{code.Make(code.OpNull), code.Make(code.OpRethrow), code.Make(code.OpReturnValue)} {
+		main.Instructions = append(main.Instructions, ins...)
+	}
+
+	result := New(&compiler.Bytecode{Main: main}).Run()
+	err, ok := result.(*object.Error)
+	if !ok || err.Kind != object.RUNTIME_ERROR || err.Message != "Invalid Rethrow: <NULL> isn't a caught error" {
+		t.Errorf("Test failed. Expected an invalid rethrow error. Got <%s>", result.Inspect())
+	}
+}
+
+// The REPL compiles and runs one line at a time, sharing globals and constants
+func TestSharedGlobals(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	constants := []object.Object{}
+	globals := make([]object.Object, GlobalsSize)
+
+	lines := []vmTestCase{
+		{"put a = 10;", 10},
+		{"put f = box(x) { x * a };", nil},
+		{"put a = 2;", 2},
+		{"f(21)", 42},
+	}
+
+	for _, tt := range lines {
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("Test failed. Compiler error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+		constants = bytecode.Constants
+
+		result := NewWithGlobalsStore(bytecode, globals).Run()
+		if tt.expected != nil {
+			testExpectedObject(t, tt.input, tt.expected, result)
+		}
+	}
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, tt.expected, run(t, tt.input))
+	}
+}
+
+func run(t *testing.T, input string) object.Object {
+	t.Helper()
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("Test failed. Compiler error: %s", err)
+	}
+	return New(comp.Bytecode()).Run()
+}
+
+func parse(input string) *ast.Program {
+	return parser.CreateParser(lexer.CreateLexer(input)).ParseCardBoard()
+}
+
+func testExpectedObject(t *testing.T, input string, expected interface{}, actual object.Object) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		integer, ok := actual.(*object.Integer)
+		if !ok || integer.Value != int64(expected) {
+			t.Errorf("Test failed. Expected <%s> to be %d. Got <%s>", input, expected, actual.Inspect())
+		}
+	case string:
+		var value string
+		switch actual := actual.(type) {
+		case *object.String:
+			value = actual.Value
+		default:
+			value = actual.Inspect()
+		}
+		if value != expected {
+			t.Errorf("Test failed. Expected <%s> to be %q. Got <%s>", input, expected, actual.Inspect())
+		}
+	case nil:
+		if actual != Null {
+			t.Errorf("Test failed. Expected <%s> to be NULL. Got <%s>", input, actual.Inspect())
+		}
+	}
+}